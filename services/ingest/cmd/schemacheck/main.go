@@ -0,0 +1,91 @@
+// Command schemacheck diffs two event schema versions and classifies each
+// change as backward-compatible, forward-compatible or breaking.
+//
+//	schemacheck [-json] OLD_SCHEMA NEW_SCHEMA
+//
+// It exits 1 when any change is breaking and 2 on usage or load errors.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
+)
+
+const (
+	exitOK       = 0
+	exitBreaking = 1
+	exitUsage    = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("schemacheck", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print changes as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: schemacheck [-json] OLD_SCHEMA NEW_SCHEMA")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	oldSchema, err := validation.LoadSchema(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "load old schema: %v\n", err)
+		return exitUsage
+	}
+	newSchema, err := validation.LoadSchema(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "load new schema: %v\n", err)
+		return exitUsage
+	}
+
+	changes := validation.CompareSchemas(oldSchema, newSchema)
+	breaking := validation.HasBreakingChanges(changes)
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(map[string]any{
+			"breaking": breaking,
+			"changes":  changes,
+		})
+	} else {
+		printChanges(stdout, changes)
+	}
+
+	if breaking {
+		return exitBreaking
+	}
+	return exitOK
+}
+
+func printChanges(w io.Writer, changes []validation.SchemaChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "no validation-relevant changes")
+		return
+	}
+
+	counts := make(map[validation.Compatibility]int)
+	for _, change := range changes {
+		counts[change.Compatibility]++
+		fmt.Fprintf(w, "%-9s %s %s: %s\n", strings.ToUpper(string(change.Compatibility)), change.Path, change.Keyword, change.Message)
+	}
+	fmt.Fprintf(w, "\n%d breaking, %d forward-compatible, %d backward-compatible\n",
+		counts[validation.CompatBreaking], counts[validation.CompatForward], counts[validation.CompatBackward])
+}
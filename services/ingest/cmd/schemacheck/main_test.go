@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSchema(t *testing.T, dir, name, doc string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestRunExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	base := writeSchema(t, dir, "old.schema.json", `{"type":"object","properties":{"status":{"enum":["ok","failed"]}}}`)
+	widened := writeSchema(t, dir, "widened.schema.json", `{"type":"object","properties":{"status":{"enum":["ok","failed","cancelled"]}}}`)
+	narrowed := writeSchema(t, dir, "narrowed.schema.json", `{"type":"object","properties":{"status":{"enum":["ok"]}}}`)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"compatible", []string{base, widened}, exitOK},
+		{"breaking", []string{base, narrowed}, exitBreaking},
+		{"missing argument", []string{base}, exitUsage},
+		{"unreadable schema", []string{base, filepath.Join(dir, "missing.json")}, exitUsage},
+	}
+	for _, tc := range tests {
+		var stdout, stderr bytes.Buffer
+		if got := run(tc.args, &stdout, &stderr); got != tc.want {
+			t.Fatalf("%s: exit = %d, want %d (stderr %s)", tc.name, got, tc.want, stderr.String())
+		}
+	}
+}
+
+func TestRunPrintsBreakingChanges(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := writeSchema(t, dir, "old.schema.json", `{"required":["a"]}`)
+	newPath := writeSchema(t, dir, "new.schema.json", `{"required":["a","b"]}`)
+
+	var stdout, stderr bytes.Buffer
+	run([]string{oldPath, newPath}, &stdout, &stderr)
+
+	if !strings.Contains(stdout.String(), `BREAKING  $.b required: new required field "b"`) {
+		t.Fatalf("output = %q, want breaking required change", stdout.String())
+	}
+}
@@ -0,0 +1,272 @@
+// Package alerts evaluates alert rules against the ingested metrics.
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/synthetic"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
+)
+
+// engineWorkflowID is the workflow_id of alert events for rules that are not
+// scoped to a workflow.
+const engineWorkflowID = "alert-engine"
+
+// alertEventNamespace seeds the name-based event_ids of alert events.
+const alertEventNamespace = "agent-ops/alert.emitted"
+
+// Store is what the engine reads and writes: alert rules and their state, the
+// metrics a rule can watch, and InsertEvent for the events it emits.
+type Store interface {
+	ListAlertRules(ctx context.Context, filter persistence.AlertRuleFilter) ([]persistence.AlertRule, error)
+	GetOverviewMetrics(ctx context.Context, filter persistence.OverviewFilter) (persistence.OverviewMetrics, error)
+	CountPolicyViolations(ctx context.Context, filter persistence.OverviewFilter) (int64, error)
+	SaveAlertState(ctx context.Context, state persistence.AlertState) error
+	InsertEvent(ctx context.Context, payload map[string]any) (bool, error)
+}
+
+// Engine moves each rule through ok, pending, firing and resolved and emits
+// an alert.emitted event when a rule fires or resolves.
+type Engine struct {
+	store     Store
+	validator validation.Validator
+}
+
+// Pass summarizes one evaluation of every rule.
+type Pass struct {
+	Rules   int
+	Firing  int
+	Emitted int
+}
+
+// NewEngine constructs an engine over store.
+func NewEngine(store Store, validator validation.Validator) (*Engine, error) {
+	if store == nil || validator == nil {
+		return nil, errors.New("alert engine requires a store and a validator")
+	}
+	return &Engine{store: store, validator: validator}, nil
+}
+
+// Run re-evaluates the rules on each tick of interval until ctx is done.
+func (e *Engine) Run(ctx context.Context, logger *slog.Logger, interval time.Duration) {
+	synthetic.Every(ctx, interval, func(now time.Time) {
+		pass, err := e.Evaluate(ctx, now)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("alert_evaluation_failed", slog.String("error", err.Error()))
+		}
+		if pass.Emitted > 0 {
+			logger.Info("alerts_emitted",
+				slog.Int("rules", pass.Rules),
+				slog.Int("firing", pass.Firing),
+				slog.Int("emitted", pass.Emitted),
+			)
+		}
+	})
+}
+
+// Evaluate measures every rule over its window ending at now and records its
+// next state. Errors are collected per rule and joined, so one broken rule
+// never holds back the rest.
+func (e *Engine) Evaluate(ctx context.Context, now time.Time) (Pass, error) {
+	rules, err := e.store.ListAlertRules(ctx, persistence.AlertRuleFilter{})
+	if err != nil {
+		return Pass{}, err
+	}
+
+	pass := Pass{Rules: len(rules)}
+	var errs []error
+	for _, rule := range rules {
+		state, emitted, err := e.evaluateRule(ctx, rule, now.UTC())
+		pass.Emitted += emitted
+		if state.State == persistence.AlertStateFiring {
+			pass.Firing++
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("alert rule %s: %w", rule.RuleID, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return pass, errors.Join(errs...)
+}
+
+func (e *Engine) evaluateRule(ctx context.Context, rule persistence.AlertRule, now time.Time) (persistence.AlertState, int, error) {
+	previous := persistence.AlertState{RuleID: rule.RuleID, State: persistence.AlertStateOK, Notified: true}
+	if rule.State != nil {
+		previous = *rule.State
+	}
+
+	emitted := 0
+	// A transition whose event was not stored is sent again, with the same
+	// identity, before the rule moves on.
+	if !previous.Notified {
+		if err := e.notify(ctx, rule, &previous); err != nil {
+			return previous, emitted, err
+		}
+		emitted++
+	}
+
+	value, measured, err := e.measure(ctx, rule, now)
+	if err != nil {
+		return previous, emitted, err
+	}
+
+	next := Transition(rule, previous, measured && rule.Breached(value), now)
+	next.LastValue = nil
+	if measured {
+		next.LastValue = &value
+	}
+
+	if next.State == previous.State || (next.State != persistence.AlertStateFiring && next.State != persistence.AlertStateResolved) {
+		return next, emitted, e.store.SaveAlertState(ctx, next)
+	}
+
+	// Record the transition before its event, so a failed insert is retried.
+	next.Notified = false
+	if err := e.store.SaveAlertState(ctx, next); err != nil {
+		return previous, emitted, err
+	}
+	if err := e.notify(ctx, rule, &next); err != nil {
+		return next, emitted, err
+	}
+	return next, emitted + 1, nil
+}
+
+// Transition returns the state after an evaluation at now that found the
+// rule breaching or not. A breach fires once it has lasted the rule's
+// for_seconds; a firing rule resolves on the first evaluation without one.
+func Transition(rule persistence.AlertRule, previous persistence.AlertState, breaching bool, now time.Time) persistence.AlertState {
+	next := previous
+	next.RuleID = rule.RuleID
+	next.EvaluatedAt = now
+
+	forDuration := time.Duration(rule.ForSeconds) * time.Second
+	switch previous.State {
+	case persistence.AlertStatePending:
+		switch {
+		case !breaching:
+			next.State, next.PendingSince, next.ChangedAt = persistence.AlertStateOK, nil, now
+		case previous.PendingSince == nil || now.Sub(*previous.PendingSince) >= forDuration:
+			next = fire(rule, next, now)
+		}
+	case persistence.AlertStateFiring:
+		if !breaching {
+			next.State, next.ChangedAt = persistence.AlertStateResolved, now
+		}
+	default:
+		if !breaching {
+			break
+		}
+		if forDuration == 0 {
+			next = fire(rule, next, now)
+			break
+		}
+		pendingSince := now
+		next.State, next.PendingSince, next.ChangedAt = persistence.AlertStatePending, &pendingSince, now
+	}
+	return next
+}
+
+func fire(rule persistence.AlertRule, state persistence.AlertState, now time.Time) persistence.AlertState {
+	state.State = persistence.AlertStateFiring
+	state.AlertID = AlertID(rule.RuleID, now)
+	state.PendingSince = nil
+	state.ChangedAt = now
+	return state
+}
+
+// measure reads the rule's metric over its window. It reports false when
+// the window has no value for the metric, which never breaches.
+func (e *Engine) measure(ctx context.Context, rule persistence.AlertRule, now time.Time) (float64, bool, error) {
+	filter := rule.Filter(now)
+	if rule.Metric == persistence.AlertMetricPolicyViolations {
+		violations, err := e.store.CountPolicyViolations(ctx, filter)
+		if err != nil {
+			return 0, false, err
+		}
+		return float64(violations), true, nil
+	}
+
+	metrics, err := e.store.GetOverviewMetrics(ctx, filter)
+	if err != nil {
+		return 0, false, err
+	}
+	value, ok := persistence.AlertMetricValue(rule.Metric, metrics)
+	return value, ok, nil
+}
+
+// notify stores state's alert.emitted event and marks it notified. The event
+// identity comes from the stored state, so a retry is a duplicate InsertEvent
+// ignores rather than a second event.
+func (e *Engine) notify(ctx context.Context, rule persistence.AlertRule, state *persistence.AlertState) error {
+	payload := alertEvent(rule, *state)
+	if errs := e.validator.Validate(payload); len(errs) > 0 {
+		return fmt.Errorf("alert event failed validation: %s", errs[0].Message)
+	}
+	if _, err := e.store.InsertEvent(ctx, payload); err != nil {
+		return err
+	}
+
+	state.Notified = true
+	return e.store.SaveAlertState(ctx, *state)
+}
+
+// AlertID identifies one firing of a rule, from when it started.
+func AlertID(ruleID string, firedAt time.Time) string {
+	return fmt.Sprintf("%s-%s", ruleID, firedAt.UTC().Format("20060102T150405Z"))
+}
+
+// AlertEventID derives the event_id of an alert's firing or resolved event.
+func AlertEventID(alertID string, state string) string {
+	return synthetic.EventID(alertEventNamespace, alertID, state)
+}
+
+// alertEvent builds the alert.emitted event for state. The run is the alert,
+// so its firing and resolved events share a trace.
+func alertEvent(rule persistence.AlertRule, state persistence.AlertState) map[string]any {
+	workflowID := rule.WorkflowID
+	if workflowID == "" {
+		workflowID = engineWorkflowID
+	}
+	// A rule resolved by a window without data reports 0.
+	currentValue := 0.0
+	if state.LastValue != nil {
+		currentValue = *state.LastValue
+	}
+
+	return map[string]any{
+		"event_version": "v0",
+		"event_id":      AlertEventID(state.AlertID, state.State),
+		"event_type":    "alert.emitted",
+		"occurred_at":   state.ChangedAt.UTC().Format(time.RFC3339Nano),
+		"tenant": map[string]any{
+			"tenant_id":    rule.TenantID,
+			"workspace_id": synthetic.Scoped(rule.WorkspaceID),
+			"project_id":   synthetic.Scoped(rule.ProjectID),
+		},
+		"run": map[string]any{
+			"run_id":      "alert-" + state.AlertID,
+			"agent_id":    synthetic.Scoped(rule.AgentID),
+			"workflow_id": workflowID,
+			"status":      "success",
+		},
+		"trace": map[string]any{
+			"trace_id": state.AlertID,
+			"span_id":  state.State,
+		},
+		"alert": map[string]any{
+			"alert_id":      state.AlertID,
+			"type":          rule.AlertType,
+			"scope":         rule.Scope,
+			"threshold":     rule.Threshold,
+			"current_value": currentValue,
+			"state":         state.State,
+		},
+	}
+}
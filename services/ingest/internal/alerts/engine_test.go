@@ -0,0 +1,273 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/synthetic"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
+)
+
+// fakeStore keeps rule states in memory the way alert_states does and
+// dedupes inserted events by event_id and occurred_at.
+type fakeStore struct {
+	rules      []persistence.AlertRule
+	states     map[string]persistence.AlertState
+	overview   persistence.OverviewMetrics
+	violations int64
+	filters    []persistence.OverviewFilter
+	events     map[string]map[string]any
+	inserts    int
+	insertErr  error
+}
+
+func newFakeStore(rules ...persistence.AlertRule) *fakeStore {
+	return &fakeStore{
+		rules:  rules,
+		states: make(map[string]persistence.AlertState),
+		events: make(map[string]map[string]any),
+	}
+}
+
+func (f *fakeStore) ListAlertRules(context.Context, persistence.AlertRuleFilter) ([]persistence.AlertRule, error) {
+	out := make([]persistence.AlertRule, 0, len(f.rules))
+	for _, rule := range f.rules {
+		if state, ok := f.states[rule.RuleID]; ok {
+			rule.State = &state
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+func (f *fakeStore) GetOverviewMetrics(_ context.Context, filter persistence.OverviewFilter) (persistence.OverviewMetrics, error) {
+	f.filters = append(f.filters, filter)
+	return f.overview, nil
+}
+
+func (f *fakeStore) CountPolicyViolations(_ context.Context, filter persistence.OverviewFilter) (int64, error) {
+	f.filters = append(f.filters, filter)
+	return f.violations, nil
+}
+
+func (f *fakeStore) SaveAlertState(_ context.Context, state persistence.AlertState) error {
+	f.states[state.RuleID] = state
+	return nil
+}
+
+func (f *fakeStore) InsertEvent(_ context.Context, payload map[string]any) (bool, error) {
+	f.inserts++
+	if f.insertErr != nil {
+		return false, f.insertErr
+	}
+	key := payload["event_id"].(string) + "|" + payload["occurred_at"].(string)
+	if _, ok := f.events[key]; ok {
+		return false, nil
+	}
+	f.events[key] = payload
+	return true, nil
+}
+
+func (f *fakeStore) alerts(state string) []map[string]any {
+	var out []map[string]any
+	for _, event := range f.events {
+		if event["alert"].(map[string]any)["state"] == state {
+			out = append(out, event)
+		}
+	}
+	return out
+}
+
+func schemaValidator(t *testing.T) validation.Validator {
+	t.Helper()
+
+	_, testFile, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("failed to resolve caller path")
+	}
+	registry, err := validation.NewRegistry(filepath.Join(filepath.Dir(testFile), "../../../../packages/schemas"))
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	return registry
+}
+
+func errorRateRule() persistence.AlertRule {
+	return persistence.AlertRule{
+		RuleID: "rule-1", AlertType: persistence.AlertTypeErrorRateSpike, Scope: persistence.BudgetScopeProject,
+		TenantID: "tenant-1", WorkspaceID: "workspace-1", ProjectID: "project-1",
+		Metric: persistence.AlertMetricErrorRate, Comparison: persistence.AlertComparisonGT, Threshold: 10,
+		WindowSeconds: 900, ForSeconds: 120,
+	}
+}
+
+func failing(failed int64) persistence.OverviewMetrics {
+	return persistence.OverviewMetrics{TotalRuns: 10, FailedRuns: failed, SuccessfulRuns: 10 - failed}
+}
+
+func newEngine(t *testing.T, store *fakeStore) *Engine {
+	t.Helper()
+
+	engine, err := NewEngine(store, schemaValidator(t))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	return engine
+}
+
+func TestEvaluateFiresAfterForDurationAndResolves(t *testing.T) {
+	store := newFakeStore(errorRateRule())
+	engine := newEngine(t, store)
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+
+	evaluate := func(at time.Time) Pass {
+		t.Helper()
+		pass, err := engine.Evaluate(context.Background(), at)
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		return pass
+	}
+
+	// A 30% error rate is a breach, but it must last two minutes to fire.
+	store.overview = failing(3)
+	if pass := evaluate(now); pass.Emitted != 0 || store.states["rule-1"].State != persistence.AlertStatePending {
+		t.Fatalf("pass = %+v, state = %+v, want pending", pass, store.states["rule-1"])
+	}
+	if filter := store.filters[0]; !filter.Start.Equal(now.Add(-15*time.Minute)) || filter.ProjectID != "project-1" {
+		t.Fatalf("filter = %+v, want the rule's 15 minute window and scope", filter)
+	}
+	evaluate(now.Add(time.Minute))
+	if pass := evaluate(now.Add(2 * time.Minute)); pass.Emitted != 1 || pass.Firing != 1 {
+		t.Fatalf("pass = %+v, want the alert fired", pass)
+	}
+	// Still breaching: no further events.
+	evaluate(now.Add(3 * time.Minute))
+
+	store.overview = failing(0)
+	if pass := evaluate(now.Add(4 * time.Minute)); pass.Emitted != 1 || pass.Firing != 0 {
+		t.Fatalf("pass = %+v, want the alert resolved", pass)
+	}
+
+	fired, resolved := store.alerts("firing"), store.alerts("resolved")
+	if len(fired) != 1 || len(resolved) != 1 || store.inserts != 2 {
+		t.Fatalf("fired = %d, resolved = %d, inserts = %d", len(fired), len(resolved), store.inserts)
+	}
+	alert := fired[0]["alert"].(map[string]any)
+	if alert["alert_id"] != resolved[0]["alert"].(map[string]any)["alert_id"] || alert["current_value"] != 30.0 || alert["scope"] != "project" {
+		t.Fatalf("alert = %v, want both transitions of one alert", alert)
+	}
+	if fired[0]["occurred_at"] != now.Add(2*time.Minute).Format(time.RFC3339Nano) {
+		t.Fatalf("occurred_at = %v", fired[0]["occurred_at"])
+	}
+	if run := fired[0]["run"].(map[string]any); run["agent_id"] != synthetic.Unscoped || run["workflow_id"] != engineWorkflowID {
+		t.Fatalf("run = %v", run)
+	}
+}
+
+func TestEvaluatePendingBreachThatClearsNeverFires(t *testing.T) {
+	store := newFakeStore(errorRateRule())
+	engine := newEngine(t, store)
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+
+	store.overview = failing(5)
+	engine.Evaluate(context.Background(), now)
+	store.overview = failing(1)
+	engine.Evaluate(context.Background(), now.Add(time.Minute))
+	store.overview = failing(5)
+	engine.Evaluate(context.Background(), now.Add(2*time.Minute))
+
+	// The breach restarted a minute ago, so the for-duration starts over.
+	if state := store.states["rule-1"]; state.State != persistence.AlertStatePending || !state.PendingSince.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("state = %+v, want pending since the new breach", state)
+	}
+	if len(store.events) != 0 {
+		t.Fatalf("events = %d, want none", len(store.events))
+	}
+}
+
+func TestEvaluateWithoutDataDoesNotBreach(t *testing.T) {
+	rule := errorRateRule()
+	rule.ForSeconds = 0
+	store := newFakeStore(rule)
+	engine := newEngine(t, store)
+
+	// No finished runs: the error rate has no value, even against "lt" rules.
+	if pass, err := engine.Evaluate(context.Background(), time.Now()); err != nil || pass.Emitted != 0 {
+		t.Fatalf("pass = %+v, %v", pass, err)
+	}
+	if state := store.states["rule-1"]; state.State != persistence.AlertStateOK || state.LastValue != nil {
+		t.Fatalf("state = %+v, want ok with no value", state)
+	}
+}
+
+func TestEvaluatePolicyViolationsFireImmediately(t *testing.T) {
+	rule := persistence.AlertRule{
+		RuleID: "rule-2", AlertType: persistence.AlertTypePolicyViolationBurst, Scope: persistence.AlertScopeWorkflow,
+		TenantID: "tenant-1", WorkflowID: "checkout",
+		Metric: persistence.AlertMetricPolicyViolations, Comparison: persistence.AlertComparisonGTE, Threshold: 3,
+		WindowSeconds: 300,
+	}
+	store := newFakeStore(rule)
+	store.violations = 3
+	engine := newEngine(t, store)
+
+	if pass, err := engine.Evaluate(context.Background(), time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)); err != nil || pass.Emitted != 1 {
+		t.Fatalf("pass = %+v, %v, want fired on the first breach", pass, err)
+	}
+	event := store.alerts("firing")[0]
+	if tenant := event["tenant"].(map[string]any); tenant["workspace_id"] != synthetic.Unscoped || tenant["project_id"] != synthetic.Unscoped {
+		t.Fatalf("tenant = %v", tenant)
+	}
+	if run := event["run"].(map[string]any); run["workflow_id"] != "checkout" {
+		t.Fatalf("run = %v, want the rule's workflow", run)
+	}
+}
+
+func TestEvaluateRetriesUnsentTransitionWithSameIdentity(t *testing.T) {
+	rule := errorRateRule()
+	rule.ForSeconds = 0
+	store := newFakeStore(rule)
+	store.overview = failing(5)
+	store.insertErr = errors.New("database unavailable")
+	engine := newEngine(t, store)
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+
+	if _, err := engine.Evaluate(context.Background(), now); err == nil {
+		t.Fatal("expected insert failure to be reported")
+	}
+	if state := store.states["rule-1"]; state.State != persistence.AlertStateFiring || state.Notified {
+		t.Fatalf("state = %+v, want firing and not yet notified", state)
+	}
+
+	store.insertErr = nil
+	pass, err := engine.Evaluate(context.Background(), now.Add(time.Minute))
+	if err != nil || pass.Emitted != 1 || !store.states["rule-1"].Notified {
+		t.Fatalf("retry pass = %+v, %v, state = %+v", pass, err, store.states["rule-1"])
+	}
+	for _, event := range store.events {
+		if event["occurred_at"] != now.Format(time.RFC3339Nano) {
+			t.Fatalf("occurred_at = %v, want the original transition's %v", event["occurred_at"], now)
+		}
+	}
+}
+
+func TestAlertEventIDIsStableUUID(t *testing.T) {
+	alertID := AlertID("rule-1", time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC))
+
+	id := AlertEventID(alertID, persistence.AlertStateFiring)
+	if id != AlertEventID(alertID, persistence.AlertStateFiring) {
+		t.Fatal("event id must be deterministic")
+	}
+	if id == AlertEventID(alertID, persistence.AlertStateResolved) {
+		t.Fatal("firing and resolved events must differ")
+	}
+	if len(id) != 36 || id[14] != '5' {
+		t.Fatalf("event id = %q, want a version 5 UUID", id)
+	}
+}
@@ -9,9 +9,16 @@ import (
 	"os"
 	"time"
 
+	"github.com/francisbulus/agent-ops/services/ingest/internal/alerts"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/budgets"
 	"github.com/francisbulus/agent-ops/services/ingest/internal/config"
 	"github.com/francisbulus/agent-ops/services/ingest/internal/httpserver"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/partitions"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
 	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence/postgres"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/pipeline"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/rollup"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/spool"
 	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
 )
 
@@ -26,9 +33,13 @@ func Run(ctx context.Context, cfg config.Config, logger *slog.Logger, signals <-
 		logger = slog.Default()
 	}
 
-	validator, err := validation.NewEventValidator(cfg.SchemaPath)
+	registry, err := validation.NewReloadingRegistry(cfg.SchemaPath)
 	if err != nil {
-		return fmt.Errorf("initialize event validator: %w", err)
+		return fmt.Errorf("initialize schema registry: %w", err)
+	}
+	validator, err := newSemanticValidator(registry, cfg)
+	if err != nil {
+		return fmt.Errorf("initialize semantic rules: %w", err)
 	}
 	store, err := postgres.NewStore(cfg.DatabaseURL)
 	if err != nil {
@@ -40,9 +51,127 @@ func Run(ctx context.Context, cfg config.Config, logger *slog.Logger, signals <-
 		}
 	}()
 
+	// Events reach the store through the handler, queue and spool; each newly
+	// inserted one also updates the spend cache behind budget checks.
+	spend := budgets.NewSpendCache(store, cfg.BudgetReservationTTL)
+	ingestStore := spendObservingStore{Store: store, spend: spend}
+	// Budget changes reload the cache, so checks see them at once.
+	budgetStore := budgetRefreshingStore{Store: store, spend: spend, logger: logger}
+
+	handlerOpts := []httpserver.Option{
+		httpserver.WithSchemaCatalog(registry),
+		httpserver.WithSchemaReloader(registry),
+		httpserver.WithAdminToken(cfg.AdminToken),
+		httpserver.WithRunReader(store),
+		httpserver.WithFailureReader(store),
+		httpserver.WithMetricsReader(store),
+		httpserver.WithBudgetStore(budgetStore),
+		httpserver.WithBudgetChecker(spend),
+		httpserver.WithAlertRuleStore(store),
+	}
+	var shutdownHooks []shutdownHook
+	// Until runServer owns the hooks, a setup error must still stop the loops already started.
+	serving := false
+	defer func() {
+		if serving {
+			return
+		}
+		stopCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := runShutdownHooks(stopCtx, shutdownHooks); err != nil {
+			logger.Error("background_shutdown_failed", slog.String("error", err.Error()))
+		}
+	}()
+
+	shutdownHooks = append(shutdownHooks, startBackground(func(ctx context.Context) {
+		spend.Run(ctx, logger, cfg.BudgetCacheRefreshInterval)
+	}))
+
+	if cfg.SchemaWatchInterval > 0 {
+		shutdownHooks = append(shutdownHooks, startBackground(func(ctx context.Context) {
+			watchSchemas(ctx, logger, registry, cfg.SchemaWatchInterval)
+		}))
+	}
+
+	if cfg.RollupInterval > 0 {
+		shutdownHooks = append(shutdownHooks, startBackground(func(ctx context.Context) {
+			rollup.Run(ctx, logger, store, cfg.RollupInterval, cfg.RollupSettleDelay)
+		}))
+	}
+
+	if cfg.PartitionInterval > 0 {
+		policy := persistence.PartitionPolicy{
+			PrecreateDays:        cfg.PartitionPrecreateDays,
+			DefaultRetentionDays: cfg.EventRetentionDays,
+			Archive:              cfg.EventRetentionArchive,
+		}
+		shutdownHooks = append(shutdownHooks, startBackground(func(ctx context.Context) {
+			partitions.Run(ctx, logger, store, policy, cfg.PartitionInterval)
+		}))
+	}
+
+	if cfg.BudgetEvalInterval > 0 {
+		worker, err := budgets.NewWorker(store, validator, cfg.BudgetThresholds)
+		if err != nil {
+			return fmt.Errorf("initialize budget worker: %w", err)
+		}
+		shutdownHooks = append(shutdownHooks, startBackground(func(ctx context.Context) {
+			worker.Run(ctx, logger, cfg.BudgetEvalInterval)
+		}))
+	}
+
+	if cfg.AlertEvalInterval > 0 {
+		engine, err := alerts.NewEngine(store, validator)
+		if err != nil {
+			return fmt.Errorf("initialize alert engine: %w", err)
+		}
+		shutdownHooks = append(shutdownHooks, startBackground(func(ctx context.Context) {
+			engine.Run(ctx, logger, cfg.AlertEvalInterval)
+		}))
+	}
+
+	var eventSpool *spool.Spool
+	if cfg.SpoolDir != "" {
+		eventSpool, err = spool.Open(cfg.SpoolDir, int64(cfg.SpoolSegmentBytes), logger)
+		if err != nil {
+			return fmt.Errorf("initialize event spool: %w", err)
+		}
+		handlerOpts = append(handlerOpts, httpserver.WithSpool(eventSpool))
+	}
+
+	if cfg.AsyncIngest {
+		queueCfg := pipeline.Config{
+			QueueSize:     cfg.IngestQueueSize,
+			Workers:       cfg.IngestWorkers,
+			BatchSize:     cfg.IngestBatchSize,
+			FlushInterval: cfg.IngestFlushInterval,
+		}
+		if eventSpool != nil {
+			queueCfg.Spool = eventSpool
+		}
+
+		queue, err := pipeline.New(logger, ingestStore, queueCfg)
+		if err != nil {
+			return fmt.Errorf("initialize ingest queue: %w", err)
+		}
+		queue.Start()
+		handlerOpts = append(handlerOpts, httpserver.WithEventQueue(queue))
+		shutdownHooks = append(shutdownHooks, queue.Shutdown)
+	}
+
+	// The spool outlives the queue during shutdown so a final failed flush can still be spooled.
+	if eventSpool != nil {
+		shutdownHooks = append(shutdownHooks,
+			startBackground(func(ctx context.Context) {
+				eventSpool.Run(ctx, ingestStore, cfg.SpoolReplayInterval)
+			}),
+			func(context.Context) error { return eventSpool.Close() },
+		)
+	}
+
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%d", cfg.Port),
-		Handler:           httpserver.NewHandler(logger, validator, store),
+		Handler:           httpserver.NewHandler(logger, validator, ingestStore, handlerOpts...),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
@@ -50,12 +179,157 @@ func Run(ctx context.Context, cfg config.Config, logger *slog.Logger, signals <-
 		slog.String("addr", srv.Addr),
 		slog.String("env", cfg.Env),
 		slog.String("schema_path", cfg.SchemaPath),
+		slog.Any("event_versions", registry.Versions()),
+		slog.String("schema_hash", registry.Hash()),
+		slog.Any("semantic_rules", validator.Actions()),
 		slog.Bool("db_enabled", cfg.DatabaseURL != ""),
+		slog.Bool("async_ingest", cfg.AsyncIngest),
+		slog.String("spool_dir", cfg.SpoolDir),
+	)
+	serving = true
+	return runServer(ctx, logger, cfg.ShutdownTimeout, signals, srv, shutdownHooks...)
+}
+
+// spendObservingStore feeds every newly inserted event to the spend cache.
+// Duplicates are not observed, so retries never count spend twice.
+type spendObservingStore struct {
+	*postgres.Store
+	spend *budgets.SpendCache
+}
+
+func (s spendObservingStore) InsertEvent(ctx context.Context, payload map[string]any) (bool, error) {
+	inserted, err := s.Store.InsertEvent(ctx, payload)
+	if inserted {
+		s.spend.Observe(payload)
+	}
+	return inserted, err
+}
+
+func (s spendObservingStore) InsertEvents(ctx context.Context, payloads []map[string]any) ([]bool, error) {
+	inserted, err := s.Store.InsertEvents(ctx, payloads)
+	for i, ok := range inserted {
+		if ok {
+			s.spend.Observe(payloads[i])
+		}
+	}
+	return inserted, err
+}
+
+// budgetRefreshingStore reloads the spend cache after each budget create,
+// update or delete. A failed reload is logged and left to the next refresh;
+// the change itself is already stored.
+type budgetRefreshingStore struct {
+	*postgres.Store
+	spend  *budgets.SpendCache
+	logger *slog.Logger
+}
+
+func (s budgetRefreshingStore) CreateBudget(ctx context.Context, budget persistence.Budget) (persistence.Budget, error) {
+	created, err := s.Store.CreateBudget(ctx, budget)
+	if err == nil {
+		s.refresh(ctx)
+	}
+	return created, err
+}
+
+func (s budgetRefreshingStore) UpdateBudget(ctx context.Context, budgetID string, update persistence.BudgetUpdate) (persistence.Budget, error) {
+	updated, err := s.Store.UpdateBudget(ctx, budgetID, update)
+	if err == nil {
+		s.refresh(ctx)
+	}
+	return updated, err
+}
+
+func (s budgetRefreshingStore) DeleteBudget(ctx context.Context, budgetID string) error {
+	err := s.Store.DeleteBudget(ctx, budgetID)
+	if err == nil {
+		s.refresh(ctx)
+	}
+	return err
+}
+
+func (s budgetRefreshingStore) refresh(ctx context.Context) {
+	// The change is stored; a client hanging up must not cut the reload short.
+	if _, err := s.spend.Refresh(context.WithoutCancel(ctx)); err != nil {
+		s.logger.Error("budget_cache_refresh_failed", slog.String("error", err.Error()))
+	}
+}
+
+func newSemanticValidator(base validation.Validator, cfg config.Config) (*validation.SemanticValidator, error) {
+	actions := make(map[string]validation.RuleAction, len(cfg.SemanticRuleActions))
+	for code, action := range cfg.SemanticRuleActions {
+		actions[code] = validation.RuleAction(action)
+	}
+
+	return validation.NewSemanticValidator(
+		base,
+		validation.DefaultSemanticRules(cfg.SemanticMaxFutureSkew),
+		actions,
+		validation.RuleAction(cfg.SemanticDefaultAction),
 	)
-	return runServer(ctx, logger, cfg.ShutdownTimeout, signals, srv)
 }
 
-func runServer(ctx context.Context, logger *slog.Logger, shutdownTimeout time.Duration, signals <-chan os.Signal, srv server) error {
+// watchSchemas polls the schema path and swaps in changed schemas. A broken
+// schema set is logged once per distinct error while the previous one keeps serving.
+func watchSchemas(ctx context.Context, logger *slog.Logger, reloader httpserver.SchemaReloader, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result, err := reloader.Reload()
+		if err != nil {
+			if err.Error() != lastErr {
+				lastErr = err.Error()
+				logger.Error("schema_reload_failed",
+					slog.String("error", lastErr),
+					slog.String("schema_hash", result.Hash),
+				)
+			}
+			continue
+		}
+
+		lastErr = ""
+		if result.Changed {
+			logger.Info("schema_reloaded",
+				slog.String("schema_hash", result.Hash),
+				slog.String("previous_schema_hash", result.PreviousHash),
+				slog.Any("event_versions", result.EventVersions),
+			)
+		}
+	}
+}
+
+// shutdownHook releases a background component after the HTTP server stops accepting requests.
+type shutdownHook func(context.Context) error
+
+// startBackground runs loop in a goroutine and returns a hook that cancels it and waits for it to return.
+func startBackground(loop func(context.Context)) shutdownHook {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		loop(ctx)
+	}()
+
+	return func(shutdownCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-shutdownCtx.Done():
+			return fmt.Errorf("stop background worker: %w", shutdownCtx.Err())
+		}
+	}
+}
+
+func runServer(ctx context.Context, logger *slog.Logger, shutdownTimeout time.Duration, signals <-chan os.Signal, srv server, hooks ...shutdownHook) error {
 	errCh := make(chan error, 1)
 	go func() {
 		logger.Info("server_starting")
@@ -67,26 +341,50 @@ func runServer(ctx context.Context, logger *slog.Logger, shutdownTimeout time.Du
 		errCh <- nil
 	}()
 
+	var serveErr error
 	select {
-	case err := <-errCh:
-		return err
+	case serveErr = <-errCh:
+		// The server stopped on its own; the hooks below still stop background work.
 	case <-ctx.Done():
 		logger.Info("server_shutdown_requested", slog.String("reason", "context_cancelled"))
+		serveErr = shutdownServer(srv, shutdownTimeout, errCh)
 	case sig := <-signals:
 		logger.Info("server_shutdown_requested", slog.String("reason", "signal"), slog.String("signal", sig.String()))
+		serveErr = shutdownServer(srv, shutdownTimeout, errCh)
 	}
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	// Hooks run once in-flight requests have finished so nothing new is enqueued mid-drain.
+	// They get their own timeout so a slow HTTP drain cannot cut the queue drain short.
+	hookCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
-
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		return fmt.Errorf("graceful shutdown failed: %w", err)
-	}
-
-	if err := <-errCh; err != nil {
+	if err := errors.Join(serveErr, runShutdownHooks(hookCtx, hooks)); err != nil {
 		return err
 	}
 
 	logger.Info("server_stopped")
 	return nil
 }
+
+// shutdownServer stops srv accepting requests and waits for ListenAndServe to return.
+func shutdownServer(srv server, shutdownTimeout time.Duration, errCh <-chan error) error {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Shutdown closes the listeners first, so ListenAndServe returns even when draining times out.
+	shutdownErr := srv.Shutdown(shutdownCtx)
+	if shutdownErr != nil {
+		shutdownErr = fmt.Errorf("graceful shutdown failed: %w", shutdownErr)
+	}
+	return errors.Join(shutdownErr, <-errCh)
+}
+
+// runShutdownHooks runs every hook in order, even after one fails, and joins their errors.
+func runShutdownHooks(ctx context.Context, hooks []shutdownHook) error {
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("graceful shutdown failed: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -9,6 +9,8 @@ import (
 	"os"
 	"testing"
 	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
 )
 
 type fakeServer struct {
@@ -88,3 +90,161 @@ func (e *errorServer) ListenAndServe() error {
 func (e *errorServer) Shutdown(context.Context) error {
 	return nil
 }
+
+func TestRunServerRunsShutdownHooksAfterServerStops(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := newFakeServer()
+	done := make(chan error, 1)
+
+	var hookSawServerStopped bool
+	hook := func(context.Context) error {
+		select {
+		case <-srv.shutdownCalled:
+			hookSawServerStopped = true
+		default:
+		}
+		return nil
+	}
+
+	go func() {
+		done <- runServer(ctx, logger, time.Second, nil, srv, hook)
+	}()
+
+	<-srv.listenCalled
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runServer() error = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("runServer() did not shut down in time")
+	}
+	if !hookSawServerStopped {
+		t.Fatal("shutdown hook ran before server shutdown")
+	}
+}
+
+func TestRunServerReturnsShutdownHookError(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := newFakeServer()
+	wantErr := errors.New("drain failed")
+	done := make(chan error, 1)
+
+	go func() {
+		done <- runServer(ctx, logger, time.Second, nil, srv, func(context.Context) error { return wantErr })
+	}()
+
+	<-srv.listenCalled
+	cancel()
+
+	if err := <-done; !errors.Is(err, wantErr) {
+		t.Fatalf("runServer() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestRunServerRunsShutdownHooksWhenListenFails(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	wantErr := errors.New("address in use")
+
+	stopped := false
+	err := runServer(context.Background(), logger, time.Second, nil, &errorServer{err: wantErr}, func(context.Context) error {
+		stopped = true
+		return nil
+	})
+	if !errors.Is(err, wantErr) || !stopped {
+		t.Fatalf("runServer() error = %v, hook ran = %v, want listen error and hooks run", err, stopped)
+	}
+}
+
+type stuckServer struct {
+	*fakeServer
+	err error
+}
+
+func (s stuckServer) Shutdown(ctx context.Context) error {
+	_ = s.fakeServer.Shutdown(ctx)
+	return s.err
+}
+
+func TestRunServerRunsShutdownHooksWhenShutdownFails(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := stuckServer{fakeServer: newFakeServer(), err: context.DeadlineExceeded}
+	hookErr := errors.New("drain failed")
+	done := make(chan error, 1)
+
+	var ran []int
+	go func() {
+		done <- runServer(ctx, logger, time.Second, nil, srv,
+			func(context.Context) error { ran = append(ran, 1); return hookErr },
+			func(context.Context) error { ran = append(ran, 2); return nil },
+		)
+	}()
+
+	<-srv.listenCalled
+	cancel()
+
+	err := <-done
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, hookErr) {
+		t.Fatalf("runServer() error = %v, want both the shutdown and hook errors", err)
+	}
+	if len(ran) != 2 {
+		t.Fatalf("hooks ran = %v, want every hook despite the failures", ran)
+	}
+}
+
+func TestStartBackgroundStopsLoopOnHook(t *testing.T) {
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+
+	hook := startBackground(func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+	})
+	<-started
+
+	if err := hook(context.Background()); err != nil {
+		t.Fatalf("hook() error = %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("background loop still running after hook returned")
+	}
+}
+
+type countingReloader struct {
+	calls chan struct{}
+}
+
+func (c *countingReloader) Reload() (validation.ReloadResult, error) {
+	select {
+	case c.calls <- struct{}{}:
+	default:
+	}
+	return validation.ReloadResult{Hash: "sha256:test"}, nil
+}
+
+func TestWatchSchemasReloadsUntilCancelled(t *testing.T) {
+	reloader := &countingReloader{calls: make(chan struct{}, 8)}
+	hook := startBackground(func(ctx context.Context) {
+		watchSchemas(ctx, slog.New(slog.NewJSONHandler(io.Discard, nil)), reloader, time.Millisecond)
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-reloader.calls:
+		case <-time.After(time.Second):
+			t.Fatal("watchSchemas did not poll for schema changes")
+		}
+	}
+
+	if err := hook(context.Background()); err != nil {
+		t.Fatalf("hook() error = %v", err)
+	}
+}
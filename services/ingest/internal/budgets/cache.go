@@ -0,0 +1,364 @@
+package budgets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// ErrSpendCacheNotReady is returned by checks made before the first load.
+var ErrSpendCacheNotReady = errors.New("budget spend cache has not loaded yet")
+
+// callRunMemory is how long a run that reported call costs is remembered, so
+// its run.completed/run.failed cost is not counted a second time.
+const callRunMemory = 24 * time.Hour
+
+// SpendSource loads budgets and their spend from the event store.
+type SpendSource interface {
+	ListBudgets(ctx context.Context, filter persistence.BudgetFilter) ([]persistence.Budget, error)
+	BudgetSpend(ctx context.Context, budget persistence.Budget, start time.Time, end time.Time) (float64, error)
+}
+
+// SpendCache holds every budget with its current-period spend so checks are
+// answered from memory. Refresh loads it from the event store and Observe
+// adds the cost of each newly inserted event in between. It also holds the
+// reservations of in-flight runs, which count as spent until the run ends.
+type SpendCache struct {
+	source         SpendSource
+	now            func() time.Time
+	reservationTTL time.Duration
+
+	mu       sync.Mutex
+	ready    bool
+	byTenant map[string][]*cachedBudget
+	// callRuns are runs seen with call costs, by when they were last seen.
+	callRuns map[runKey]time.Time
+	// replay collects spend observed while a Refresh is loading; nil otherwise.
+	replay []spendEvent
+	// reservations are held by tenant and run_id.
+	reservations map[runKey]*reservation
+}
+
+// runKey identifies a run: run_ids are only unique within a tenant.
+type runKey struct {
+	tenantID, runID string
+}
+
+// reservation holds amountUSD of a run's spend. Call costs the run reports
+// draw it down; its run.completed or run.failed releases it.
+type reservation struct {
+	tenantID, workspaceID, projectID, agentID string
+	amountUSD                                 float64
+	usedUSD                                   float64
+	expiresAt                                 time.Time
+}
+
+type cachedBudget struct {
+	budget     persistence.Budget
+	start, end time.Time
+	spent      float64
+}
+
+type spendEvent struct {
+	tenantID, workspaceID, projectID, agentID string
+	occurredAt                                time.Time
+	costUSD                                   float64
+}
+
+// NewSpendCache returns an empty cache whose reservations last
+// reservationTTL unless a request asks otherwise. Checks fail with
+// ErrSpendCacheNotReady until the first Refresh succeeds.
+func NewSpendCache(source SpendSource, reservationTTL time.Duration) *SpendCache {
+	return &SpendCache{
+		source:         source,
+		now:            time.Now,
+		reservationTTL: reservationTTL,
+		byTenant:       make(map[string][]*cachedBudget),
+		callRuns:       make(map[runKey]time.Time),
+		reservations:   make(map[runKey]*reservation),
+	}
+}
+
+// Run refreshes the cache immediately and then every interval until ctx is cancelled.
+func (c *SpendCache) Run(ctx context.Context, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Refresh(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("budget_cache_refresh_failed", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh replaces the cached budgets and spend with the event store's and
+// returns the number of budgets loaded. Spend observed while loading is
+// applied again on top, so an event stored before the load finished can be
+// counted twice until the next refresh but is never missed.
+func (c *SpendCache) Refresh(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	c.replay = make([]spendEvent, 0)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.replay = nil
+		c.mu.Unlock()
+	}()
+
+	now := c.now()
+	list, err := c.source.ListBudgets(ctx, persistence.BudgetFilter{})
+	if err != nil {
+		return 0, err
+	}
+
+	byTenant := make(map[string][]*cachedBudget)
+	for _, budget := range list {
+		start, end, err := persistence.BudgetPeriodBounds(budget.Period, now)
+		if err != nil {
+			return 0, fmt.Errorf("budget %s: %w", budget.BudgetID, err)
+		}
+		spent, err := c.source.BudgetSpend(ctx, budget, start, end)
+		if err != nil {
+			return 0, fmt.Errorf("budget %s: %w", budget.BudgetID, err)
+		}
+		byTenant[budget.TenantID] = append(byTenant[budget.TenantID], &cachedBudget{
+			budget: budget, start: start, end: end, spent: spent,
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.byTenant = byTenant
+	for _, event := range c.replay {
+		c.addLocked(event)
+	}
+	for key, seen := range c.callRuns {
+		if now.Sub(seen) > callRunMemory {
+			delete(c.callRuns, key)
+		}
+	}
+	for key, held := range c.reservations {
+		if !now.Before(held.expiresAt) {
+			delete(c.reservations, key)
+		}
+	}
+	c.ready = true
+	return len(list), nil
+}
+
+// Observe adds a newly inserted event's cost to the budgets covering it. It
+// counts the same events as the budget spend query: call costs, plus the run
+// cost of runs that reported none. A run's call costs draw down its
+// reservation and its run.completed or run.failed settles it, leaving the
+// actual cost in its place. Duplicates must not be observed.
+func (c *SpendCache) Observe(payload map[string]any) {
+	eventType := stringAt(payload, "event_type")
+	tenantID := stringAt(payload, "tenant", "tenant_id")
+	run := runKey{tenantID: tenantID, runID: stringAt(payload, "run", "run_id")}
+	terminal := eventType == "run.completed" || eventType == "run.failed"
+	costUSD, hasCost := floatAt(payload, "cost", "cost_usd")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if held, ok := c.reservations[run]; ok {
+		switch {
+		case terminal:
+			delete(c.reservations, run)
+		case hasCost && isCallOutcome(eventType):
+			held.usedUSD += costUSD
+		}
+	}
+
+	occurredAt, err := time.Parse(time.RFC3339, stringAt(payload, "occurred_at"))
+	if !hasCost || err != nil {
+		return
+	}
+
+	switch {
+	case isCallOutcome(eventType):
+		c.callRuns[run] = c.now()
+	case terminal:
+		if _, ok := c.callRuns[run]; ok {
+			delete(c.callRuns, run)
+			return
+		}
+	default:
+		return
+	}
+
+	event := spendEvent{
+		tenantID:    tenantID,
+		workspaceID: stringAt(payload, "tenant", "workspace_id"),
+		projectID:   stringAt(payload, "tenant", "project_id"),
+		agentID:     stringAt(payload, "run", "agent_id"),
+		occurredAt:  occurredAt,
+		costUSD:     costUSD,
+	}
+	c.addLocked(event)
+	if c.replay != nil {
+		c.replay = append(c.replay, event)
+	}
+}
+
+// CheckBudget reports whether spending estimateUSD now fits every budget
+// covering the given ids, counting reservations as spent.
+func (c *SpendCache) CheckBudget(tenantID, workspaceID, projectID, agentID string, estimateUSD float64) (persistence.BudgetCheck, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.ready {
+		return persistence.BudgetCheck{}, ErrSpendCacheNotReady
+	}
+	return c.checkLocked(tenantID, workspaceID, projectID, agentID, estimateUSD, runKey{}), nil
+}
+
+// ReserveBudget checks the estimate and, unless a hard budget blocks it,
+// holds it for the run. Reserving again for a run replaces its reservation;
+// a blocked re-reservation keeps the previous one. Check and hold happen under
+// one lock, so concurrent runs cannot all take the same headroom.
+func (c *SpendCache) ReserveBudget(req persistence.BudgetReservationRequest) (persistence.BudgetReservation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.ready {
+		return persistence.BudgetReservation{}, ErrSpendCacheNotReady
+	}
+
+	run := runKey{tenantID: req.TenantID, runID: req.RunID}
+	check := c.checkLocked(req.TenantID, req.WorkspaceID, req.ProjectID, req.AgentID, req.EstimatedCostUSD, run)
+	out := persistence.BudgetReservation{BudgetCheck: check, RunID: req.RunID}
+	if check.Result == persistence.BudgetHardLimitBlocked {
+		return out, nil
+	}
+
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = c.reservationTTL
+	}
+	expiresAt := c.now().Add(ttl)
+	held := &reservation{
+		tenantID:    req.TenantID,
+		workspaceID: req.WorkspaceID,
+		projectID:   req.ProjectID,
+		agentID:     req.AgentID,
+		amountUSD:   req.EstimatedCostUSD,
+		expiresAt:   expiresAt,
+	}
+	// Costs already reported keep drawing down the replacement.
+	if previous, ok := c.reservations[run]; ok {
+		held.usedUSD = previous.usedUSD
+	}
+	c.reservations[run] = held
+	out.Reserved, out.ExpiresAt = true, &expiresAt
+	return out, nil
+}
+
+// checkLocked builds a check, leaving out except's reservation.
+func (c *SpendCache) checkLocked(tenantID, workspaceID, projectID, agentID string, estimateUSD float64, except runKey) persistence.BudgetCheck {
+	now := c.now()
+	var headrooms []persistence.BudgetHeadroom
+	for _, cached := range c.byTenant[tenantID] {
+		if !cached.budget.Matches(tenantID, workspaceID, projectID, agentID) {
+			continue
+		}
+		cached.roll(now)
+		reserved := c.reservedLocked(cached.budget, now, except)
+		headrooms = append(headrooms, persistence.NewBudgetHeadroom(cached.budget, cached.end, cached.spent, reserved, estimateUSD))
+	}
+	return persistence.NewBudgetCheck(estimateUSD, headrooms)
+}
+
+// reservedLocked sums what unexpired reservations still hold against budget.
+func (c *SpendCache) reservedLocked(budget persistence.Budget, now time.Time, except runKey) float64 {
+	var reserved float64
+	for key, held := range c.reservations {
+		if key == except || !now.Before(held.expiresAt) {
+			continue
+		}
+		if budget.Matches(held.tenantID, held.workspaceID, held.projectID, held.agentID) {
+			reserved += math.Max(held.amountUSD-held.usedUSD, 0)
+		}
+	}
+	return reserved
+}
+
+func (c *SpendCache) addLocked(event spendEvent) {
+	now := c.now()
+	for _, cached := range c.byTenant[event.tenantID] {
+		if !cached.budget.Matches(event.tenantID, event.workspaceID, event.projectID, event.agentID) {
+			continue
+		}
+		cached.roll(now)
+		if !event.occurredAt.Before(cached.start) && event.occurredAt.Before(cached.end) {
+			cached.spent += event.costUSD
+		}
+	}
+}
+
+// roll starts a new period with no spend once now has passed the cached one.
+func (b *cachedBudget) roll(now time.Time) {
+	if now.Before(b.end) {
+		return
+	}
+	start, end, err := persistence.BudgetPeriodBounds(b.budget.Period, now)
+	if err != nil {
+		return
+	}
+	b.start, b.end, b.spent = start, end, 0
+}
+
+func isCallOutcome(eventType string) bool {
+	return (strings.HasPrefix(eventType, "model.call.") || strings.HasPrefix(eventType, "tool.call.")) &&
+		(strings.HasSuffix(eventType, ".completed") || strings.HasSuffix(eventType, ".failed"))
+}
+
+func stringAt(payload map[string]any, path ...string) string {
+	value, _ := valueAt(payload, path...).(string)
+	return value
+}
+
+// floatAt reads a number the way the postgres store does: ingest decodes with
+// UseNumber, so payloads carry json.Number, while synthetic events use Go types.
+func floatAt(payload map[string]any, path ...string) (float64, bool) {
+	switch v := valueAt(payload, path...).(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func valueAt(payload map[string]any, path ...string) any {
+	var current any = payload
+	for _, key := range path {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = object[key]
+	}
+	return current
+}
@@ -0,0 +1,343 @@
+package budgets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+func costEvent(eventType string, runID string, agentID string, at time.Time, costUSD float64) map[string]any {
+	return map[string]any{
+		"event_type":  eventType,
+		"occurred_at": at.Format(time.RFC3339),
+		"tenant":      map[string]any{"tenant_id": "tenant-1", "workspace_id": "workspace-1", "project_id": "project-1"},
+		"run":         map[string]any{"run_id": runID, "agent_id": agentID},
+		"cost":        map[string]any{"cost_usd": costUSD},
+	}
+}
+
+// ingested round-trips payload through JSON decoded with UseNumber, the way
+// the ingest handlers decode request bodies.
+func ingested(t *testing.T, payload map[string]any) map[string]any {
+	t.Helper()
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var out map[string]any
+	if err := dec.Decode(&out); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	return out
+}
+
+func loadedCache(t *testing.T, now time.Time, spend map[string]float64, list ...persistence.Budget) *SpendCache {
+	t.Helper()
+
+	cache := NewSpendCache(newFakeStore(spend, list...), time.Hour)
+	cache.now = func() time.Time { return now }
+	if _, err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	return cache
+}
+
+func TestCheckBudgetBeforeLoadIsNotReady(t *testing.T) {
+	cache := NewSpendCache(newFakeStore(nil, projectBudget()), time.Hour)
+
+	if _, err := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 1); !errors.Is(err, ErrSpendCacheNotReady) {
+		t.Fatalf("CheckBudget() error = %v, want ErrSpendCacheNotReady", err)
+	}
+}
+
+func TestCheckBudgetReportsMostSevereBudget(t *testing.T) {
+	soft := persistence.Budget{
+		BudgetID: "tenant-soft", Scope: persistence.BudgetScopeTenant, TenantID: "tenant-1",
+		Period: persistence.BudgetPeriodDaily, LimitUSD: 1000, Enforcement: persistence.BudgetEnforcementSoft,
+	}
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 90, "tenant-soft": 100}, projectBudget(), soft)
+
+	check, err := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 10)
+	if err != nil {
+		t.Fatalf("CheckBudget() error = %v", err)
+	}
+	if check.Result != persistence.BudgetCheckAllow || len(check.Budgets) != 2 || *check.RemainingUSD != 10 {
+		t.Fatalf("check = %+v, want allowed with 10 left on the project budget", check)
+	}
+
+	check, _ = cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 10.01)
+	if check.Result != persistence.BudgetHardLimitBlocked {
+		t.Fatalf("Result = %q, want the hard project budget to block", check.Result)
+	}
+
+	// Another project is only covered by the soft tenant budget.
+	check, _ = cache.CheckBudget("tenant-1", "workspace-1", "project-2", "agent-1", 950)
+	if check.Result != persistence.BudgetSoftLimitExceeded || len(check.Budgets) != 1 {
+		t.Fatalf("check = %+v, want the soft tenant budget exceeded", check)
+	}
+
+	check, _ = cache.CheckBudget("tenant-2", "", "", "", 5)
+	if check.Result != persistence.BudgetCheckAllow || check.RemainingUSD != nil || len(check.Budgets) != 0 {
+		t.Fatalf("check = %+v, want allow with no budgets", check)
+	}
+}
+
+func TestObserveCountsSpendLikeTheSpendQuery(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 10}, projectBudget())
+
+	cache.Observe(costEvent("model.call.completed", "run-1", "agent-1", now, 2))
+	cache.Observe(costEvent("tool.call.failed", "run-1", "agent-1", now, 1))
+	// run-1 reported call costs, so its run total is not counted again.
+	cache.Observe(costEvent("run.completed", "run-1", "agent-1", now, 3))
+	// run-2 reported none, so its run total is its spend.
+	cache.Observe(costEvent("run.failed", "run-2", "agent-2", now, 4))
+	// Not spend: a started call, and a call from last month.
+	cache.Observe(costEvent("model.call.started", "run-3", "agent-1", now, 5))
+	cache.Observe(costEvent("model.call.completed", "run-3", "agent-1", now.AddDate(0, -1, 0), 6))
+
+	check, err := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 0)
+	if err != nil {
+		t.Fatalf("CheckBudget() error = %v", err)
+	}
+	if got := check.Budgets[0].SpentUSD; got != 17 {
+		t.Fatalf("SpentUSD = %v, want 10 loaded + 2 + 1 + 4", got)
+	}
+}
+
+func TestObserveCountsDecodedJSONNumbers(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 10}, projectBudget())
+
+	event := ingested(t, costEvent("model.call.completed", "run-1", "agent-1", now, 2.5))
+	if _, ok := event["cost"].(map[string]any)["cost_usd"].(json.Number); !ok {
+		t.Fatalf("cost_usd = %T, want json.Number", event["cost"].(map[string]any)["cost_usd"])
+	}
+	cache.Observe(event)
+
+	check, err := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 0)
+	if err != nil {
+		t.Fatalf("CheckBudget() error = %v", err)
+	}
+	if got := check.Budgets[0].SpentUSD; got != 12.5 {
+		t.Fatalf("SpentUSD = %v, want 10 loaded + 2.5 observed", got)
+	}
+}
+
+func TestCheckBudgetRollsIntoNewPeriod(t *testing.T) {
+	now := time.Date(2026, 2, 28, 23, 59, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 100}, projectBudget())
+
+	if check, _ := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "", 1); check.Result != persistence.BudgetHardLimitBlocked {
+		t.Fatalf("Result = %q, want blocked at the limit", check.Result)
+	}
+
+	cache.now = func() time.Time { return now.Add(2 * time.Minute) }
+	check, _ := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "", 1)
+	if check.Result != persistence.BudgetCheckAllow || check.Budgets[0].SpentUSD != 0 {
+		t.Fatalf("check = %+v, want March to start with no spend", check)
+	}
+	if !check.Budgets[0].PeriodEnd.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("PeriodEnd = %v, want 1 April", check.Budgets[0].PeriodEnd)
+	}
+}
+
+// blockingSource pauses BudgetSpend so events can be observed mid-refresh.
+type blockingSource struct {
+	*fakeStore
+	loading chan struct{}
+	resume  chan struct{}
+}
+
+func (b blockingSource) BudgetSpend(ctx context.Context, budget persistence.Budget, start time.Time, end time.Time) (float64, error) {
+	close(b.loading)
+	<-b.resume
+	return b.fakeStore.BudgetSpend(ctx, budget, start, end)
+}
+
+func TestRefreshReplaysSpendObservedWhileLoading(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 10}, projectBudget())
+	source := blockingSource{
+		fakeStore: newFakeStore(map[string]float64{"budget-1": 10}, projectBudget()),
+		loading:   make(chan struct{}),
+		resume:    make(chan struct{}),
+	}
+	cache.source = source
+
+	done := make(chan error)
+	go func() {
+		_, err := cache.Refresh(context.Background())
+		done <- err
+	}()
+	<-source.loading
+	cache.Observe(costEvent("model.call.completed", "run-1", "agent-1", now, 5))
+	close(source.resume)
+	if err := <-done; err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	check, _ := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 0)
+	if got := check.Budgets[0].SpentUSD; got != 15 {
+		t.Fatalf("SpentUSD = %v, want the event observed during the load kept", got)
+	}
+}
+
+func reserve(t *testing.T, cache *SpendCache, runID string, estimateUSD float64) persistence.BudgetReservation {
+	t.Helper()
+
+	out, err := cache.ReserveBudget(persistence.BudgetReservationRequest{
+		RunID: runID, TenantID: "tenant-1", WorkspaceID: "workspace-1", ProjectID: "project-1", AgentID: "agent-1",
+		EstimatedCostUSD: estimateUSD,
+	})
+	if err != nil {
+		t.Fatalf("ReserveBudget(%s) error = %v", runID, err)
+	}
+	return out
+}
+
+func TestReservationsHoldHardBudgetUnderConcurrency(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 70}, projectBudget())
+
+	if out := reserve(t, cache, "run-1", 20); !out.Reserved || out.ExpiresAt == nil || !out.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("run-1 = %+v, want reserved for the default TTL", out)
+	}
+	// Only 10 is left once run-1 holds 20, so run-2 cannot take 20 too.
+	out := reserve(t, cache, "run-2", 20)
+	if out.Reserved || out.Result != persistence.BudgetHardLimitBlocked || out.Budgets[0].ReservedUSD != 20 {
+		t.Fatalf("run-2 = %+v, want blocked by run-1's reservation", out)
+	}
+	check, _ := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 0)
+	if *check.RemainingUSD != 10 {
+		t.Fatalf("RemainingUSD = %v, want 10", *check.RemainingUSD)
+	}
+
+	// Re-reserving a run replaces its own hold rather than adding to it.
+	if out := reserve(t, cache, "run-1", 25); !out.Reserved || out.Budgets[0].ReservedUSD != 0 {
+		t.Fatalf("run-1 again = %+v, want its earlier hold left out", out)
+	}
+}
+
+func TestRunEventsSettleReservation(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 0}, projectBudget())
+	reserve(t, cache, "run-1", 50)
+
+	// Call costs move from reserved to spent.
+	cache.Observe(costEvent("model.call.completed", "run-1", "agent-1", now, 15))
+	headroom := func() persistence.BudgetHeadroom {
+		check, _ := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 0)
+		return check.Budgets[0]
+	}
+	if h := headroom(); h.SpentUSD != 15 || h.ReservedUSD != 35 || h.RemainingUSD != 50 {
+		t.Fatalf("headroom = %+v, want 15 spent and 35 still held", h)
+	}
+
+	cache.Observe(costEvent("run.completed", "run-1", "agent-1", now, 15))
+	if h := headroom(); h.SpentUSD != 15 || h.ReservedUSD != 0 || h.RemainingUSD != 85 {
+		t.Fatalf("headroom = %+v, want the reservation settled to the actual 15", h)
+	}
+
+	// A run that reports only its total settles to that total.
+	reserve(t, cache, "run-2", 40)
+	cache.Observe(costEvent("run.failed", "run-2", "agent-1", now, 5))
+	if h := headroom(); h.SpentUSD != 20 || h.ReservedUSD != 0 {
+		t.Fatalf("headroom = %+v, want run-2's 5 spent and nothing held", h)
+	}
+}
+
+func TestDecodedCallCostsDrawDownReservation(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 0}, projectBudget())
+	reserve(t, cache, "run-1", 50)
+
+	cache.Observe(ingested(t, costEvent("model.call.completed", "run-1", "agent-1", now, 15)))
+	check, _ := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 0)
+	if h := check.Budgets[0]; h.SpentUSD != 15 || h.ReservedUSD != 35 {
+		t.Fatalf("headroom = %+v, want the decoded call cost drawn from the reservation", h)
+	}
+}
+
+func TestReservationsExpire(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 0}, projectBudget())
+
+	if _, err := cache.ReserveBudget(persistence.BudgetReservationRequest{
+		RunID: "run-1", TenantID: "tenant-1", WorkspaceID: "workspace-1", ProjectID: "project-1",
+		EstimatedCostUSD: 100, TTL: time.Minute,
+	}); err != nil {
+		t.Fatalf("ReserveBudget() error = %v", err)
+	}
+	if out := reserve(t, cache, "run-2", 1); out.Reserved {
+		t.Fatalf("run-2 = %+v, want blocked while run-1 holds the whole budget", out)
+	}
+
+	cache.now = func() time.Time { return now.Add(time.Minute) }
+	if out := reserve(t, cache, "run-2", 1); !out.Reserved || out.Budgets[0].ReservedUSD != 0 {
+		t.Fatalf("run-2 = %+v, want run-1's reservation expired", out)
+	}
+	if _, err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if _, ok := cache.reservations[runKey{tenantID: "tenant-1", runID: "run-1"}]; ok {
+		t.Fatal("refresh must prune expired reservations")
+	}
+}
+
+func TestReservationsAreKeyedByTenantAndRun(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	other := projectBudget()
+	other.BudgetID, other.TenantID = "budget-2", "tenant-2"
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 0, "budget-2": 0}, projectBudget(), other)
+
+	reserve(t, cache, "run-1", 60)
+	// tenant-2 reusing the run_id holds its own reservation ...
+	if out, err := cache.ReserveBudget(persistence.BudgetReservationRequest{
+		RunID: "run-1", TenantID: "tenant-2", WorkspaceID: "workspace-1", ProjectID: "project-1", AgentID: "agent-1",
+		EstimatedCostUSD: 30,
+	}); err != nil || !out.Reserved {
+		t.Fatalf("tenant-2 ReserveBudget() = %+v, %v, want reserved", out, err)
+	}
+	// ... and settling it leaves tenant-1's hold in place.
+	completed := costEvent("run.completed", "run-1", "agent-1", now, 5)
+	completed["tenant"].(map[string]any)["tenant_id"] = "tenant-2"
+	cache.Observe(completed)
+
+	check, _ := cache.CheckBudget("tenant-1", "workspace-1", "project-1", "agent-1", 0)
+	if h := check.Budgets[0]; h.ReservedUSD != 60 {
+		t.Fatalf("tenant-1 headroom = %+v, want its 60 still held", h)
+	}
+	check, _ = cache.CheckBudget("tenant-2", "workspace-1", "project-1", "agent-1", 0)
+	if h := check.Budgets[0]; h.SpentUSD != 5 || h.ReservedUSD != 0 {
+		t.Fatalf("tenant-2 headroom = %+v, want its run settled to 5", h)
+	}
+}
+
+func TestObserveKeysCallRunsByTenant(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	other := projectBudget()
+	other.BudgetID, other.TenantID = "budget-2", "tenant-2"
+	cache := loadedCache(t, now, map[string]float64{"budget-1": 0, "budget-2": 0}, projectBudget(), other)
+
+	// tenant-1's run-1 reported call costs; tenant-2's run-1 reported none,
+	// so its run total is still its spend.
+	cache.Observe(costEvent("model.call.completed", "run-1", "agent-1", now, 2))
+	failed := costEvent("run.failed", "run-1", "agent-1", now, 4)
+	failed["tenant"].(map[string]any)["tenant_id"] = "tenant-2"
+	cache.Observe(failed)
+
+	check, _ := cache.CheckBudget("tenant-2", "workspace-1", "project-1", "agent-1", 0)
+	if got := check.Budgets[0].SpentUSD; got != 4 {
+		t.Fatalf("tenant-2 SpentUSD = %v, want its run total 4", got)
+	}
+}
@@ -0,0 +1,199 @@
+// Package budgets evaluates spend against the configured budgets.
+package budgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/synthetic"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
+)
+
+// DefaultThresholds are the utilization percentages that fire a
+// budget.threshold_hit event when no others are configured.
+var DefaultThresholds = []int{50, 80, 100}
+
+// workerWorkflowID is the workflow_id of the events the worker emits.
+const workerWorkflowID = "budget-worker"
+
+// thresholdEventNamespace seeds the name-based event_ids of threshold events.
+const thresholdEventNamespace = "agent-ops/budget.threshold_hit"
+
+// Store is what the worker needs from the event store: budgets, their spend,
+// threshold claims and the InsertEvent path that ingested events take.
+type Store interface {
+	ListBudgets(ctx context.Context, filter persistence.BudgetFilter) ([]persistence.Budget, error)
+	BudgetSpend(ctx context.Context, budget persistence.Budget, start time.Time, end time.Time) (float64, error)
+	ClaimBudgetThreshold(ctx context.Context, hit persistence.BudgetThresholdHit) (persistence.BudgetThresholdHit, error)
+	MarkBudgetThresholdEmitted(ctx context.Context, hit persistence.BudgetThresholdHit) error
+	InsertEvent(ctx context.Context, payload map[string]any) (bool, error)
+}
+
+// Worker emits a budget.threshold_hit event the first time each budget
+// crosses each threshold in a period.
+type Worker struct {
+	store      Store
+	validator  validation.Validator
+	thresholds []int
+}
+
+// Pass summarizes one evaluation of every budget.
+type Pass struct {
+	Budgets int
+	Emitted int
+}
+
+// NewWorker constructs a worker firing at thresholds, in percent of each
+// budget's limit. Nil or empty thresholds use DefaultThresholds.
+func NewWorker(store Store, validator validation.Validator, thresholds []int) (*Worker, error) {
+	if store == nil || validator == nil {
+		return nil, errors.New("budget worker requires a store and a validator")
+	}
+	if len(thresholds) == 0 {
+		thresholds = DefaultThresholds
+	}
+	for _, pct := range thresholds {
+		if pct <= 0 {
+			return nil, fmt.Errorf("budget threshold must be positive: %d", pct)
+		}
+	}
+	return &Worker{store: store, validator: validator, thresholds: thresholds}, nil
+}
+
+// Run evaluates the budgets every interval and logs each pass that emitted
+// thresholds, until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context, logger *slog.Logger, interval time.Duration) {
+	synthetic.Every(ctx, interval, func(now time.Time) {
+		pass, err := w.Evaluate(ctx, now)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("budget_evaluation_failed", slog.String("error", err.Error()))
+		}
+		if pass.Emitted > 0 {
+			logger.Info("budget_thresholds_emitted",
+				slog.Int("budgets", pass.Budgets),
+				slog.Int("emitted", pass.Emitted),
+			)
+		}
+	})
+}
+
+// Evaluate computes current-period spend for every budget and emits the
+// thresholds it has crossed. A failing budget does not stop the others; their
+// errors are joined.
+func (w *Worker) Evaluate(ctx context.Context, now time.Time) (Pass, error) {
+	list, err := w.store.ListBudgets(ctx, persistence.BudgetFilter{})
+	if err != nil {
+		return Pass{}, err
+	}
+
+	pass := Pass{Budgets: len(list)}
+	var errs []error
+	for _, budget := range list {
+		emitted, err := w.evaluateBudget(ctx, budget, now)
+		pass.Emitted += emitted
+		if err != nil {
+			errs = append(errs, fmt.Errorf("budget %s: %w", budget.BudgetID, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return pass, errors.Join(errs...)
+}
+
+func (w *Worker) evaluateBudget(ctx context.Context, budget persistence.Budget, now time.Time) (int, error) {
+	start, end, err := persistence.BudgetPeriodBounds(budget.Period, now)
+	if err != nil {
+		return 0, err
+	}
+	spent, err := w.store.BudgetSpend(ctx, budget, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	emitted := 0
+	for _, pct := range w.thresholds {
+		if !budget.Crossed(spent, pct) {
+			continue
+		}
+
+		hit, err := w.store.ClaimBudgetThreshold(ctx, persistence.BudgetThresholdHit{
+			BudgetID:     budget.BudgetID,
+			PeriodStart:  start,
+			ThresholdPct: pct,
+			EventID:      ThresholdEventID(budget.BudgetID, start, pct),
+			OccurredAt:   now.UTC(),
+			SpentUSD:     spent,
+		})
+		if err != nil {
+			return emitted, err
+		}
+		if hit.Emitted {
+			continue
+		}
+
+		// An unmarked claim is either new or left by a pass that failed after
+		// claiming; the claim's event_id and occurred_at make the retry a duplicate
+		// InsertEvent ignores rather than a second event.
+		payload := thresholdEvent(budget, hit)
+		if errs := w.validator.Validate(payload); len(errs) > 0 {
+			return emitted, fmt.Errorf("threshold event failed validation: %s", errs[0].Message)
+		}
+		if _, err := w.store.InsertEvent(ctx, payload); err != nil {
+			return emitted, err
+		}
+		if err := w.store.MarkBudgetThresholdEmitted(ctx, hit); err != nil {
+			return emitted, err
+		}
+		emitted++
+	}
+	return emitted, nil
+}
+
+// ThresholdEventID derives the event_id of a crossing from the budget, its
+// period and the threshold, which together identify it.
+func ThresholdEventID(budgetID string, periodStart time.Time, thresholdPct int) string {
+	return synthetic.EventID(thresholdEventNamespace, budgetID, periodStart.UTC().Format(time.RFC3339), strconv.Itoa(thresholdPct))
+}
+
+// thresholdEvent builds the budget.threshold_hit event for hit. The run is
+// the budget's period, so every threshold in a period shares a trace.
+func thresholdEvent(budget persistence.Budget, hit persistence.BudgetThresholdHit) map[string]any {
+	runID := fmt.Sprintf("budget-%s-%s", budget.BudgetID, hit.PeriodStart.UTC().Format("20060102T150405Z"))
+
+	return map[string]any{
+		"event_version": "v0",
+		"event_id":      hit.EventID,
+		"event_type":    "budget.threshold_hit",
+		"occurred_at":   hit.OccurredAt.UTC().Format(time.RFC3339Nano),
+		"tenant": map[string]any{
+			"tenant_id":    budget.TenantID,
+			"workspace_id": synthetic.Scoped(budget.WorkspaceID),
+			"project_id":   synthetic.Scoped(budget.ProjectID),
+		},
+		"run": map[string]any{
+			"run_id":      runID,
+			"agent_id":    synthetic.Scoped(budget.AgentID),
+			"workflow_id": workerWorkflowID,
+			"status":      "success",
+		},
+		"trace": map[string]any{
+			"trace_id": runID,
+			"span_id":  fmt.Sprintf("threshold-%d", hit.ThresholdPct),
+		},
+		"budget": map[string]any{
+			"budget_id":       budget.BudgetID,
+			"scope":           budget.Scope,
+			"period":          budget.Period,
+			"limit_usd":       budget.LimitUSD,
+			"spent_after_usd": hit.SpentUSD,
+			"enforcement":     budget.Enforcement,
+			"result":          budget.Result(hit.SpentUSD),
+		},
+	}
+}
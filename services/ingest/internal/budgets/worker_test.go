@@ -0,0 +1,204 @@
+package budgets
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/synthetic"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
+)
+
+// fakeStore claims thresholds in memory the way budget_threshold_hits does
+// and dedupes inserted events by event_id and occurred_at.
+type fakeStore struct {
+	budgets   []persistence.Budget
+	spend     map[string]float64
+	claims    map[string]persistence.BudgetThresholdHit
+	events    map[string]map[string]any
+	inserts   int
+	insertErr error
+}
+
+func newFakeStore(spend map[string]float64, budgets ...persistence.Budget) *fakeStore {
+	return &fakeStore{
+		budgets: budgets,
+		spend:   spend,
+		claims:  make(map[string]persistence.BudgetThresholdHit),
+		events:  make(map[string]map[string]any),
+	}
+}
+
+func claimKey(hit persistence.BudgetThresholdHit) string {
+	return fmt.Sprintf("%s|%s|%d", hit.BudgetID, hit.PeriodStart.Format(time.RFC3339), hit.ThresholdPct)
+}
+
+func (f *fakeStore) ListBudgets(context.Context, persistence.BudgetFilter) ([]persistence.Budget, error) {
+	return f.budgets, nil
+}
+
+func (f *fakeStore) BudgetSpend(_ context.Context, budget persistence.Budget, _ time.Time, _ time.Time) (float64, error) {
+	return f.spend[budget.BudgetID], nil
+}
+
+func (f *fakeStore) ClaimBudgetThreshold(_ context.Context, hit persistence.BudgetThresholdHit) (persistence.BudgetThresholdHit, error) {
+	if claimed, ok := f.claims[claimKey(hit)]; ok {
+		return claimed, nil
+	}
+	f.claims[claimKey(hit)] = hit
+	return hit, nil
+}
+
+func (f *fakeStore) MarkBudgetThresholdEmitted(_ context.Context, hit persistence.BudgetThresholdHit) error {
+	claimed := f.claims[claimKey(hit)]
+	claimed.Emitted = true
+	f.claims[claimKey(hit)] = claimed
+	return nil
+}
+
+func (f *fakeStore) InsertEvent(_ context.Context, payload map[string]any) (bool, error) {
+	f.inserts++
+	if f.insertErr != nil {
+		return false, f.insertErr
+	}
+	key := payload["event_id"].(string) + "|" + payload["occurred_at"].(string)
+	if _, ok := f.events[key]; ok {
+		return false, nil
+	}
+	f.events[key] = payload
+	return true, nil
+}
+
+func schemaValidator(t *testing.T) validation.Validator {
+	t.Helper()
+
+	_, testFile, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("failed to resolve caller path")
+	}
+	registry, err := validation.NewRegistry(filepath.Join(filepath.Dir(testFile), "../../../../packages/schemas"))
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	return registry
+}
+
+func projectBudget() persistence.Budget {
+	return persistence.Budget{
+		BudgetID: "budget-1", Scope: persistence.BudgetScopeProject,
+		TenantID: "tenant-1", WorkspaceID: "workspace-1", ProjectID: "project-1",
+		Period: persistence.BudgetPeriodMonthly, LimitUSD: 100, Enforcement: persistence.BudgetEnforcementHard,
+	}
+}
+
+func TestEvaluateEmitsEachCrossedThresholdOnce(t *testing.T) {
+	store := newFakeStore(map[string]float64{"budget-1": 85}, projectBudget())
+	worker, err := NewWorker(store, schemaValidator(t), nil)
+	if err != nil {
+		t.Fatalf("NewWorker() error = %v", err)
+	}
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+
+	pass, err := worker.Evaluate(context.Background(), now)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if pass.Budgets != 1 || pass.Emitted != 2 || len(store.events) != 2 {
+		t.Fatalf("pass = %+v, events = %d, want 50%% and 80%% emitted", pass, len(store.events))
+	}
+
+	// Later passes in the same period only emit newly crossed thresholds.
+	store.spend["budget-1"] = 120
+	for i := 0; i < 2; i++ {
+		pass, err = worker.Evaluate(context.Background(), now.Add(time.Duration(i+1)*time.Hour))
+		if err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+	}
+	if len(store.events) != 3 || store.inserts != 3 {
+		t.Fatalf("events = %d, inserts = %d, want the 100%% crossing added once", len(store.events), store.inserts)
+	}
+
+	full := store.claims[claimKey(persistence.BudgetThresholdHit{
+		BudgetID: "budget-1", PeriodStart: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), ThresholdPct: 100,
+	})]
+	event := store.events[full.EventID+"|"+full.OccurredAt.Format(time.RFC3339Nano)]
+	budget := event["budget"].(map[string]any)
+	tenant := event["tenant"].(map[string]any)
+	run := event["run"].(map[string]any)
+	if budget["result"] != persistence.BudgetHardLimitBlocked || budget["spent_after_usd"] != 120.0 {
+		t.Fatalf("budget = %v", budget)
+	}
+	if tenant["project_id"] != "project-1" || run["agent_id"] != synthetic.Unscoped {
+		t.Fatalf("tenant = %v, run = %v, want the project and no agent", tenant, run)
+	}
+
+	// A new period starts the thresholds over.
+	if pass, err = worker.Evaluate(context.Background(), time.Date(2026, 3, 1, 0, 5, 0, 0, time.UTC)); err != nil || pass.Emitted != 3 {
+		t.Fatalf("March pass = %+v, %v, want all three thresholds again", pass, err)
+	}
+}
+
+func TestEvaluateRetriesClaimedEventWithSameIdentity(t *testing.T) {
+	store := newFakeStore(map[string]float64{"budget-1": 60}, projectBudget())
+	store.insertErr = fmt.Errorf("database unavailable")
+	worker, err := NewWorker(store, schemaValidator(t), []int{50})
+	if err != nil {
+		t.Fatalf("NewWorker() error = %v", err)
+	}
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+
+	if _, err := worker.Evaluate(context.Background(), now); err == nil {
+		t.Fatal("expected insert failure to be reported")
+	}
+
+	store.insertErr = nil
+	pass, err := worker.Evaluate(context.Background(), now.Add(time.Minute))
+	if err != nil || pass.Emitted != 1 {
+		t.Fatalf("retry pass = %+v, %v", pass, err)
+	}
+	for _, event := range store.events {
+		if event["occurred_at"] != now.Format(time.RFC3339Nano) {
+			t.Fatalf("occurred_at = %v, want the first claim's %v", event["occurred_at"], now)
+		}
+	}
+}
+
+func TestEvaluateSkipsUnspentZeroBudget(t *testing.T) {
+	zero := projectBudget()
+	zero.LimitUSD = 0
+	store := newFakeStore(map[string]float64{}, zero)
+	worker, err := NewWorker(store, schemaValidator(t), nil)
+	if err != nil {
+		t.Fatalf("NewWorker() error = %v", err)
+	}
+
+	if pass, err := worker.Evaluate(context.Background(), time.Now()); err != nil || pass.Emitted != 0 {
+		t.Fatalf("pass = %+v, %v, want nothing emitted", pass, err)
+	}
+}
+
+func TestThresholdEventIDIsStableUUID(t *testing.T) {
+	start := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	id := ThresholdEventID("budget-1", start, 80)
+	if id != ThresholdEventID("budget-1", start, 80) {
+		t.Fatal("event id must be deterministic")
+	}
+	if id == ThresholdEventID("budget-1", start, 100) || id == ThresholdEventID("budget-1", start.AddDate(0, 1, 0), 80) {
+		t.Fatal("event id must differ per threshold and period")
+	}
+	if len(id) != 36 || id[14] != '5' {
+		t.Fatalf("event id = %q, want a version 5 UUID", id)
+	}
+}
+
+func TestNewWorkerRejectsInvalidThresholds(t *testing.T) {
+	if _, err := NewWorker(newFakeStore(nil), schemaValidator(t), []int{50, 0}); err == nil {
+		t.Fatal("expected error for a zero threshold")
+	}
+}
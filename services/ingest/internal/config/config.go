@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,7 +13,24 @@ const (
 	defaultEnv             = "dev"
 	defaultLogLevel        = "info"
 	defaultShutdownTimeout = 10 * time.Second
-	defaultSchemaPath      = "packages/schemas/agent-event-v0.schema.json"
+	defaultSchemaPath      = "packages/schemas"
+	defaultSchemaWatch     = 10 * time.Second
+	defaultQueueSize       = 10000
+	defaultIngestWorkers   = 4
+	defaultIngestBatchSize = 200
+	defaultFlushInterval   = 250 * time.Millisecond
+	defaultSpoolSegment    = 64 << 20 // 64MB
+	defaultSpoolReplay     = 5 * time.Second
+	defaultSemanticAction  = "warn"
+	defaultMaxFutureSkew   = 5 * time.Minute
+	defaultRollupInterval  = time.Minute
+	defaultRollupSettle    = 30 * time.Second
+	defaultPartitionCheck  = time.Hour
+	defaultPrecreateDays   = 7
+	defaultBudgetInterval  = time.Minute
+	defaultBudgetCache     = time.Minute
+	defaultReservationTTL  = time.Hour
+	defaultAlertInterval   = time.Minute
 )
 
 // Config holds runtime settings for the ingest service.
@@ -21,8 +39,57 @@ type Config struct {
 	Env             string
 	LogLevel        string
 	ShutdownTimeout time.Duration
-	SchemaPath      string
+	SchemaPath      string // schema file, or directory with one *.schema.json per event_version
 	DatabaseURL     string
+
+	// SchemaWatchInterval is how often SCHEMA_PATH is polled for changes; zero disables watching.
+	SchemaWatchInterval time.Duration
+
+	// AdminToken is the bearer token the /admin endpoints require; empty disables them.
+	AdminToken string
+
+	// AsyncIngest queues validated events for background writers instead of writing inline.
+	AsyncIngest         bool
+	IngestQueueSize     int
+	IngestWorkers       int
+	IngestBatchSize     int
+	IngestFlushInterval time.Duration
+
+	// SpoolDir enables the disk spool used when Postgres writes fail; empty disables it.
+	SpoolDir            string
+	SpoolSegmentBytes   int
+	SpoolReplayInterval time.Duration
+
+	// SemanticRuleActions overrides the action (reject|warn|off) per semantic rule code.
+	SemanticRuleActions   map[string]string
+	SemanticDefaultAction string
+	SemanticMaxFutureSkew time.Duration
+
+	// RollupInterval is how often metrics rollups are refreshed; zero disables the aggregator.
+	RollupInterval time.Duration
+	// RollupSettleDelay is how far behind now each aggregation pass stops.
+	RollupSettleDelay time.Duration
+
+	// PartitionInterval is how often agent_events partitions are maintained; zero disables maintenance.
+	PartitionInterval      time.Duration
+	PartitionPrecreateDays int
+	// EventRetentionDays applies to tenants without a retention policy; zero keeps events forever.
+	EventRetentionDays int
+	// EventRetentionArchive detaches expired partitions into agent_events_archive instead of dropping them.
+	EventRetentionArchive bool
+
+	// BudgetEvalInterval is how often spend is checked against budgets; zero disables the budget worker.
+	BudgetEvalInterval time.Duration
+	// BudgetThresholds are the utilization percentages that emit budget.threshold_hit; empty uses 50, 80 and 100.
+	BudgetThresholds []int
+	// BudgetCacheRefreshInterval is how often the in-memory spend cache behind
+	// POST /v1/budgets/check is reloaded from Postgres.
+	BudgetCacheRefreshInterval time.Duration
+	// BudgetReservationTTL is how long a run's spend reservation is held when it never completes.
+	BudgetReservationTTL time.Duration
+
+	// AlertEvalInterval is how often alert rules are evaluated; zero disables the alert engine.
+	AlertEvalInterval time.Duration
 }
 
 // Load reads config from environment with sensible defaults.
@@ -33,6 +100,31 @@ func Load() (Config, error) {
 		LogLevel:        defaultLogLevel,
 		ShutdownTimeout: defaultShutdownTimeout,
 		SchemaPath:      defaultSchemaPath,
+
+		SchemaWatchInterval: defaultSchemaWatch,
+
+		IngestQueueSize:     defaultQueueSize,
+		IngestWorkers:       defaultIngestWorkers,
+		IngestBatchSize:     defaultIngestBatchSize,
+		IngestFlushInterval: defaultFlushInterval,
+
+		SpoolSegmentBytes:   defaultSpoolSegment,
+		SpoolReplayInterval: defaultSpoolReplay,
+
+		SemanticDefaultAction: defaultSemanticAction,
+		SemanticMaxFutureSkew: defaultMaxFutureSkew,
+
+		RollupInterval:    defaultRollupInterval,
+		RollupSettleDelay: defaultRollupSettle,
+
+		PartitionInterval:      defaultPartitionCheck,
+		PartitionPrecreateDays: defaultPrecreateDays,
+
+		BudgetEvalInterval:         defaultBudgetInterval,
+		BudgetCacheRefreshInterval: defaultBudgetCache,
+		BudgetReservationTTL:       defaultReservationTTL,
+
+		AlertEvalInterval: defaultAlertInterval,
 	}
 
 	if raw := os.Getenv("PORT"); raw != "" {
@@ -63,9 +155,196 @@ func Load() (Config, error) {
 		cfg.SchemaPath = raw
 	}
 
+	if raw := os.Getenv("SCHEMA_WATCH_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval < 0 {
+			return Config{}, fmt.Errorf("invalid SCHEMA_WATCH_INTERVAL: %q", raw)
+		}
+		cfg.SchemaWatchInterval = interval
+	}
+
 	if raw := os.Getenv("DATABASE_URL"); raw != "" {
 		cfg.DatabaseURL = raw
 	}
 
+	if raw := os.Getenv("ADMIN_TOKEN"); raw != "" {
+		cfg.AdminToken = raw
+	}
+
+	if raw := os.Getenv("INGEST_ASYNC"); raw != "" {
+		async, err := strconv.ParseBool(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid INGEST_ASYNC: %q", raw)
+		}
+		cfg.AsyncIngest = async
+	}
+
+	var err error
+	if cfg.IngestQueueSize, err = positiveIntEnv("INGEST_QUEUE_SIZE", cfg.IngestQueueSize); err != nil {
+		return Config{}, err
+	}
+	if cfg.IngestWorkers, err = positiveIntEnv("INGEST_WRITERS", cfg.IngestWorkers); err != nil {
+		return Config{}, err
+	}
+	if cfg.IngestBatchSize, err = positiveIntEnv("INGEST_BATCH_SIZE", cfg.IngestBatchSize); err != nil {
+		return Config{}, err
+	}
+	if cfg.IngestFlushInterval, err = positiveDurationEnv("INGEST_FLUSH_INTERVAL", cfg.IngestFlushInterval); err != nil {
+		return Config{}, err
+	}
+
+	if raw := os.Getenv("SPOOL_DIR"); raw != "" {
+		cfg.SpoolDir = raw
+	}
+	if cfg.SpoolSegmentBytes, err = positiveIntEnv("SPOOL_SEGMENT_BYTES", cfg.SpoolSegmentBytes); err != nil {
+		return Config{}, err
+	}
+	if cfg.SpoolReplayInterval, err = positiveDurationEnv("SPOOL_REPLAY_INTERVAL", cfg.SpoolReplayInterval); err != nil {
+		return Config{}, err
+	}
+
+	if raw := os.Getenv("SEMANTIC_DEFAULT_ACTION"); raw != "" {
+		if !isRuleAction(raw) {
+			return Config{}, fmt.Errorf("invalid SEMANTIC_DEFAULT_ACTION: %q", raw)
+		}
+		cfg.SemanticDefaultAction = raw
+	}
+	if cfg.SemanticRuleActions, err = parseRuleActions(os.Getenv("SEMANTIC_RULES")); err != nil {
+		return Config{}, err
+	}
+	if cfg.SemanticMaxFutureSkew, err = positiveDurationEnv("SEMANTIC_MAX_FUTURE_SKEW", cfg.SemanticMaxFutureSkew); err != nil {
+		return Config{}, err
+	}
+
+	if raw := os.Getenv("ROLLUP_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval < 0 {
+			return Config{}, fmt.Errorf("invalid ROLLUP_INTERVAL: %q", raw)
+		}
+		cfg.RollupInterval = interval
+	}
+	if cfg.RollupSettleDelay, err = positiveDurationEnv("ROLLUP_SETTLE_DELAY", cfg.RollupSettleDelay); err != nil {
+		return Config{}, err
+	}
+
+	if raw := os.Getenv("PARTITION_MAINTENANCE_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval < 0 {
+			return Config{}, fmt.Errorf("invalid PARTITION_MAINTENANCE_INTERVAL: %q", raw)
+		}
+		cfg.PartitionInterval = interval
+	}
+	if cfg.PartitionPrecreateDays, err = positiveIntEnv("PARTITION_PRECREATE_DAYS", cfg.PartitionPrecreateDays); err != nil {
+		return Config{}, err
+	}
+	if raw := os.Getenv("EVENT_RETENTION_DAYS"); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days < 0 {
+			return Config{}, fmt.Errorf("invalid EVENT_RETENTION_DAYS: %q", raw)
+		}
+		cfg.EventRetentionDays = days
+	}
+	if raw := os.Getenv("EVENT_RETENTION_ARCHIVE"); raw != "" {
+		archive, err := strconv.ParseBool(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid EVENT_RETENTION_ARCHIVE: %q", raw)
+		}
+		cfg.EventRetentionArchive = archive
+	}
+
+	if raw := os.Getenv("BUDGET_EVAL_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval < 0 {
+			return Config{}, fmt.Errorf("invalid BUDGET_EVAL_INTERVAL: %q", raw)
+		}
+		cfg.BudgetEvalInterval = interval
+	}
+	if raw := os.Getenv("BUDGET_THRESHOLDS"); raw != "" {
+		if cfg.BudgetThresholds, err = parseThresholds(raw); err != nil {
+			return Config{}, err
+		}
+	}
+	if cfg.BudgetCacheRefreshInterval, err = positiveDurationEnv("BUDGET_CACHE_REFRESH_INTERVAL", cfg.BudgetCacheRefreshInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.BudgetReservationTTL, err = positiveDurationEnv("BUDGET_RESERVATION_TTL", cfg.BudgetReservationTTL); err != nil {
+		return Config{}, err
+	}
+
+	if raw := os.Getenv("ALERT_EVAL_INTERVAL"); raw != "" {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval < 0 {
+			return Config{}, fmt.Errorf("invalid ALERT_EVAL_INTERVAL: %q", raw)
+		}
+		cfg.AlertEvalInterval = interval
+	}
+
 	return cfg, nil
 }
+
+// parseThresholds reads comma-separated positive percentages.
+func parseThresholds(raw string) ([]int, error) {
+	var thresholds []int
+	for _, part := range strings.Split(raw, ",") {
+		pct, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || pct <= 0 {
+			return nil, fmt.Errorf("invalid BUDGET_THRESHOLDS: %q (want comma-separated positive percentages)", raw)
+		}
+		thresholds = append(thresholds, pct)
+	}
+	return thresholds, nil
+}
+
+// parseRuleActions reads "code=action" pairs separated by commas.
+func parseRuleActions(raw string) (map[string]string, error) {
+	actions := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		code, action, ok := strings.Cut(pair, "=")
+		code, action = strings.TrimSpace(code), strings.TrimSpace(action)
+		if !ok || code == "" || !isRuleAction(action) {
+			return nil, fmt.Errorf("invalid SEMANTIC_RULES entry: %q (want code=reject|warn|off)", pair)
+		}
+		actions[code] = action
+	}
+	return actions, nil
+}
+
+func isRuleAction(action string) bool {
+	switch action {
+	case "reject", "warn", "off":
+		return true
+	default:
+		return false
+	}
+}
+
+func positiveIntEnv(name string, fallback int) (int, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return value, nil
+}
+
+func positiveDurationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return value, nil
+}
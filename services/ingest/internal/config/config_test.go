@@ -12,6 +12,22 @@ func TestLoadDefaults(t *testing.T) {
 	t.Setenv("SHUTDOWN_TIMEOUT", "")
 	t.Setenv("SCHEMA_PATH", "")
 	t.Setenv("DATABASE_URL", "")
+	t.Setenv("INGEST_ASYNC", "")
+	t.Setenv("SPOOL_DIR", "")
+	t.Setenv("SCHEMA_WATCH_INTERVAL", "")
+	t.Setenv("SEMANTIC_RULES", "")
+	t.Setenv("SEMANTIC_DEFAULT_ACTION", "")
+	t.Setenv("ROLLUP_INTERVAL", "")
+	t.Setenv("ROLLUP_SETTLE_DELAY", "")
+	t.Setenv("PARTITION_MAINTENANCE_INTERVAL", "")
+	t.Setenv("PARTITION_PRECREATE_DAYS", "")
+	t.Setenv("EVENT_RETENTION_DAYS", "")
+	t.Setenv("EVENT_RETENTION_ARCHIVE", "")
+	t.Setenv("BUDGET_EVAL_INTERVAL", "")
+	t.Setenv("BUDGET_THRESHOLDS", "")
+	t.Setenv("BUDGET_CACHE_REFRESH_INTERVAL", "")
+	t.Setenv("BUDGET_RESERVATION_TTL", "")
+	t.Setenv("ALERT_EVAL_INTERVAL", "")
 
 	cfg, err := Load()
 	if err != nil {
@@ -30,12 +46,41 @@ func TestLoadDefaults(t *testing.T) {
 	if cfg.ShutdownTimeout != 10*time.Second {
 		t.Fatalf("cfg.ShutdownTimeout = %v, want 10s", cfg.ShutdownTimeout)
 	}
-	if cfg.SchemaPath != "packages/schemas/agent-event-v0.schema.json" {
-		t.Fatalf("cfg.SchemaPath = %q, want default schema path", cfg.SchemaPath)
+	if cfg.SchemaPath != "packages/schemas" {
+		t.Fatalf("cfg.SchemaPath = %q, want default schema directory", cfg.SchemaPath)
 	}
 	if cfg.DatabaseURL != "" {
 		t.Fatalf("cfg.DatabaseURL = %q, want empty", cfg.DatabaseURL)
 	}
+	if cfg.AsyncIngest {
+		t.Fatal("cfg.AsyncIngest = true, want false by default")
+	}
+	if cfg.SpoolDir != "" {
+		t.Fatalf("cfg.SpoolDir = %q, want spool disabled by default", cfg.SpoolDir)
+	}
+	if cfg.SchemaWatchInterval != 10*time.Second {
+		t.Fatalf("cfg.SchemaWatchInterval = %v, want 10s", cfg.SchemaWatchInterval)
+	}
+	if cfg.SemanticDefaultAction != "warn" || len(cfg.SemanticRuleActions) != 0 {
+		t.Fatalf("semantic rules = %q %v, want warn with no overrides", cfg.SemanticDefaultAction, cfg.SemanticRuleActions)
+	}
+	if cfg.RollupInterval != time.Minute || cfg.RollupSettleDelay != 30*time.Second {
+		t.Fatalf("rollups = %v/%v, want 1m every pass, 30s behind now", cfg.RollupInterval, cfg.RollupSettleDelay)
+	}
+	if cfg.PartitionInterval != time.Hour || cfg.PartitionPrecreateDays != 7 || cfg.EventRetentionDays != 0 || cfg.EventRetentionArchive {
+		t.Fatalf("partitions = %v/%d, retention = %d/%v, want hourly, a week ahead, kept forever",
+			cfg.PartitionInterval, cfg.PartitionPrecreateDays, cfg.EventRetentionDays, cfg.EventRetentionArchive)
+	}
+	if cfg.BudgetEvalInterval != time.Minute || cfg.BudgetThresholds != nil || cfg.BudgetCacheRefreshInterval != time.Minute {
+		t.Fatalf("budgets = %v/%v, cache = %v, want every minute at the default thresholds",
+			cfg.BudgetEvalInterval, cfg.BudgetThresholds, cfg.BudgetCacheRefreshInterval)
+	}
+	if cfg.BudgetReservationTTL != time.Hour {
+		t.Fatalf("cfg.BudgetReservationTTL = %v, want 1h", cfg.BudgetReservationTTL)
+	}
+	if cfg.AlertEvalInterval != time.Minute {
+		t.Fatalf("cfg.AlertEvalInterval = %v, want 1m", cfg.AlertEvalInterval)
+	}
 }
 
 func TestLoadAppliesSchemaPathOverride(t *testing.T) {
@@ -62,6 +107,21 @@ func TestLoadAppliesDatabaseURLOverride(t *testing.T) {
 	}
 }
 
+func TestLoadAppliesAdminToken(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AdminToken != "" {
+		t.Fatalf("cfg.AdminToken = %q, want admin endpoints disabled by default", cfg.AdminToken)
+	}
+
+	t.Setenv("ADMIN_TOKEN", "secret")
+	if cfg, err = Load(); err != nil || cfg.AdminToken != "secret" {
+		t.Fatalf("Load() = %q, %v, want the configured token", cfg.AdminToken, err)
+	}
+}
+
 func TestLoadRejectsInvalidPort(t *testing.T) {
 	t.Setenv("PORT", "abc")
 
@@ -79,3 +139,222 @@ func TestLoadRejectsInvalidShutdownTimeout(t *testing.T) {
 		t.Fatal("expected error for invalid SHUTDOWN_TIMEOUT")
 	}
 }
+
+func TestLoadAsyncIngestSettings(t *testing.T) {
+	t.Setenv("INGEST_ASYNC", "true")
+	t.Setenv("INGEST_QUEUE_SIZE", "500")
+	t.Setenv("INGEST_WRITERS", "2")
+	t.Setenv("INGEST_BATCH_SIZE", "50")
+	t.Setenv("INGEST_FLUSH_INTERVAL", "1s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !cfg.AsyncIngest {
+		t.Fatal("cfg.AsyncIngest = false, want true")
+	}
+	if cfg.IngestQueueSize != 500 || cfg.IngestWorkers != 2 || cfg.IngestBatchSize != 50 {
+		t.Fatalf("unexpected queue settings: %+v", cfg)
+	}
+	if cfg.IngestFlushInterval != time.Second {
+		t.Fatalf("cfg.IngestFlushInterval = %v, want 1s", cfg.IngestFlushInterval)
+	}
+}
+
+func TestLoadRejectsInvalidAsyncIngestSettings(t *testing.T) {
+	tests := map[string]string{
+		"INGEST_ASYNC":          "maybe",
+		"INGEST_QUEUE_SIZE":     "0",
+		"INGEST_WRITERS":        "-1",
+		"INGEST_BATCH_SIZE":     "many",
+		"INGEST_FLUSH_INTERVAL": "soon",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for invalid %s", name)
+			}
+		})
+	}
+}
+
+func TestLoadSpoolSettings(t *testing.T) {
+	t.Setenv("SPOOL_DIR", "/var/spool/ingest")
+	t.Setenv("SPOOL_SEGMENT_BYTES", "1048576")
+	t.Setenv("SPOOL_REPLAY_INTERVAL", "30s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.SpoolDir != "/var/spool/ingest" {
+		t.Fatalf("cfg.SpoolDir = %q, want /var/spool/ingest", cfg.SpoolDir)
+	}
+	if cfg.SpoolSegmentBytes != 1<<20 {
+		t.Fatalf("cfg.SpoolSegmentBytes = %d, want 1048576", cfg.SpoolSegmentBytes)
+	}
+	if cfg.SpoolReplayInterval != 30*time.Second {
+		t.Fatalf("cfg.SpoolReplayInterval = %v, want 30s", cfg.SpoolReplayInterval)
+	}
+}
+
+func TestLoadRejectsInvalidSpoolReplayInterval(t *testing.T) {
+	t.Setenv("SPOOL_REPLAY_INTERVAL", "0s")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for invalid SPOOL_REPLAY_INTERVAL")
+	}
+}
+
+func TestLoadSemanticRuleSettings(t *testing.T) {
+	t.Setenv("SEMANTIC_RULES", "token_total_mismatch=reject, occurred_at_in_future=off")
+	t.Setenv("SEMANTIC_DEFAULT_ACTION", "reject")
+	t.Setenv("SEMANTIC_MAX_FUTURE_SKEW", "2m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.SemanticRuleActions["token_total_mismatch"] != "reject" || cfg.SemanticRuleActions["occurred_at_in_future"] != "off" {
+		t.Fatalf("cfg.SemanticRuleActions = %v, want parsed overrides", cfg.SemanticRuleActions)
+	}
+	if cfg.SemanticDefaultAction != "reject" {
+		t.Fatalf("cfg.SemanticDefaultAction = %q, want reject", cfg.SemanticDefaultAction)
+	}
+	if cfg.SemanticMaxFutureSkew != 2*time.Minute {
+		t.Fatalf("cfg.SemanticMaxFutureSkew = %v, want 2m", cfg.SemanticMaxFutureSkew)
+	}
+}
+
+func TestLoadRejectsInvalidSemanticRules(t *testing.T) {
+	for _, raw := range []string{"token_total_mismatch", "token_total_mismatch=drop", "=warn"} {
+		t.Setenv("SEMANTIC_RULES", raw)
+		if _, err := Load(); err == nil {
+			t.Fatalf("SEMANTIC_RULES=%q: expected error", raw)
+		}
+	}
+
+	t.Setenv("SEMANTIC_RULES", "")
+	t.Setenv("SEMANTIC_DEFAULT_ACTION", "maybe")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for invalid SEMANTIC_DEFAULT_ACTION")
+	}
+}
+
+func TestLoadSchemaWatchInterval(t *testing.T) {
+	t.Setenv("SCHEMA_WATCH_INTERVAL", "0")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.SchemaWatchInterval != 0 {
+		t.Fatalf("cfg.SchemaWatchInterval = %v, want watching disabled", cfg.SchemaWatchInterval)
+	}
+
+	t.Setenv("SCHEMA_WATCH_INTERVAL", "-1s")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for negative SCHEMA_WATCH_INTERVAL")
+	}
+}
+
+func TestLoadRollupSettings(t *testing.T) {
+	t.Setenv("ROLLUP_INTERVAL", "0")
+	t.Setenv("ROLLUP_SETTLE_DELAY", "2m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.RollupInterval != 0 || cfg.RollupSettleDelay != 2*time.Minute {
+		t.Fatalf("rollups = %v/%v, want disabled with 2m settle delay", cfg.RollupInterval, cfg.RollupSettleDelay)
+	}
+
+	t.Setenv("ROLLUP_INTERVAL", "-1m")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for negative ROLLUP_INTERVAL")
+	}
+	t.Setenv("ROLLUP_INTERVAL", "")
+	t.Setenv("ROLLUP_SETTLE_DELAY", "0s")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for zero ROLLUP_SETTLE_DELAY")
+	}
+}
+
+func TestLoadPartitionSettings(t *testing.T) {
+	t.Setenv("PARTITION_MAINTENANCE_INTERVAL", "15m")
+	t.Setenv("PARTITION_PRECREATE_DAYS", "14")
+	t.Setenv("EVENT_RETENTION_DAYS", "90")
+	t.Setenv("EVENT_RETENTION_ARCHIVE", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.PartitionInterval != 15*time.Minute || cfg.PartitionPrecreateDays != 14 || cfg.EventRetentionDays != 90 || !cfg.EventRetentionArchive {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+}
+
+func TestLoadRejectsInvalidPartitionSettings(t *testing.T) {
+	for name, value := range map[string]string{
+		"PARTITION_MAINTENANCE_INTERVAL": "-1h",
+		"PARTITION_PRECREATE_DAYS":       "0",
+		"EVENT_RETENTION_DAYS":           "-1",
+		"EVENT_RETENTION_ARCHIVE":        "maybe",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%q", name, value)
+			}
+		})
+	}
+}
+
+func TestLoadBudgetSettings(t *testing.T) {
+	t.Setenv("BUDGET_EVAL_INTERVAL", "30s")
+	t.Setenv("BUDGET_THRESHOLDS", "75, 90,100")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BudgetEvalInterval != 30*time.Second || len(cfg.BudgetThresholds) != 3 || cfg.BudgetThresholds[0] != 75 || cfg.BudgetThresholds[2] != 100 {
+		t.Fatalf("budgets = %v/%v", cfg.BudgetEvalInterval, cfg.BudgetThresholds)
+	}
+
+	for name, value := range map[string]string{
+		"BUDGET_EVAL_INTERVAL":          "-1m",
+		"BUDGET_THRESHOLDS":             "50,,100",
+		"BUDGET_CACHE_REFRESH_INTERVAL": "0s",
+		"BUDGET_RESERVATION_TTL":        "-5m",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%q", name, value)
+			}
+		})
+	}
+}
+
+func TestLoadAlertEvalInterval(t *testing.T) {
+	t.Setenv("ALERT_EVAL_INTERVAL", "0")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AlertEvalInterval != 0 {
+		t.Fatalf("cfg.AlertEvalInterval = %v, want 0 to disable the engine", cfg.AlertEvalInterval)
+	}
+
+	t.Setenv("ALERT_EVAL_INTERVAL", "soon")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for an unparseable ALERT_EVAL_INTERVAL")
+	}
+}
@@ -0,0 +1,158 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// alertRuleRequest is the POST /v1/alert-rules body.
+type alertRuleRequest struct {
+	Name          string   `json:"name"`
+	AlertType     string   `json:"alert_type"`
+	Scope         string   `json:"scope"`
+	TenantID      string   `json:"tenant_id"`
+	WorkspaceID   string   `json:"workspace_id"`
+	ProjectID     string   `json:"project_id"`
+	AgentID       string   `json:"agent_id"`
+	WorkflowID    string   `json:"workflow_id"`
+	Metric        string   `json:"metric"`
+	Comparison    string   `json:"comparison"`
+	Threshold     *float64 `json:"threshold"`
+	WindowSeconds int      `json:"window_seconds"`
+	ForSeconds    int      `json:"for_seconds"`
+}
+
+func handleCreateAlertRule(w http.ResponseWriter, r *http.Request, rules AlertRuleStore) {
+	if rules == nil {
+		writeAlertRulesNotConfigured(w)
+		return
+	}
+
+	var req alertRuleRequest
+	if err := decodeStrictJSON(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json", "message": err.Error()})
+		return
+	}
+	if req.Threshold == nil {
+		writeInvalidAlertRule(w, errors.New("threshold is required"))
+		return
+	}
+
+	rule := persistence.AlertRule{
+		Name:          req.Name,
+		AlertType:     req.AlertType,
+		Scope:         req.Scope,
+		TenantID:      req.TenantID,
+		WorkspaceID:   req.WorkspaceID,
+		ProjectID:     req.ProjectID,
+		AgentID:       req.AgentID,
+		WorkflowID:    req.WorkflowID,
+		Metric:        req.Metric,
+		Comparison:    req.Comparison,
+		Threshold:     *req.Threshold,
+		WindowSeconds: req.WindowSeconds,
+		ForSeconds:    req.ForSeconds,
+	}
+	if err := rule.Validate(); err != nil {
+		writeInvalidAlertRule(w, err)
+		return
+	}
+
+	created, err := rules.CreateAlertRule(r.Context(), rule)
+	if err != nil {
+		writeAlertRulesQueryFailed(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func handleListAlertRules(w http.ResponseWriter, r *http.Request, rules AlertRuleStore) {
+	if rules == nil {
+		writeAlertRulesNotConfigured(w)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := persistence.AlertRuleFilter{
+		TenantID:  query.Get("tenant_id"),
+		AlertType: query.Get("alert_type"),
+	}
+	switch filter.AlertType {
+	case "", persistence.AlertTypeSpendSpike, persistence.AlertTypeSuccessRateDrop, persistence.AlertTypeLatencyBreach,
+		persistence.AlertTypeErrorRateSpike, persistence.AlertTypePolicyViolationBurst:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":   "invalid_query",
+			"message": "alert_type must be one of spend_spike, success_rate_drop, latency_breach, error_rate_spike, policy_violation_burst",
+		})
+		return
+	}
+
+	list, err := rules.ListAlertRules(r.Context(), filter)
+	if err != nil {
+		writeAlertRulesQueryFailed(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"alert_rules": list})
+}
+
+func handleGetAlertRule(w http.ResponseWriter, r *http.Request, rules AlertRuleStore) {
+	if rules == nil {
+		writeAlertRulesNotConfigured(w)
+		return
+	}
+
+	ruleID := r.PathValue("rule_id")
+	rule, err := rules.GetAlertRule(r.Context(), ruleID)
+	if err != nil {
+		writeAlertRuleError(w, ruleID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func handleDeleteAlertRule(w http.ResponseWriter, r *http.Request, rules AlertRuleStore) {
+	if rules == nil {
+		writeAlertRulesNotConfigured(w)
+		return
+	}
+
+	ruleID := r.PathValue("rule_id")
+	if err := rules.DeleteAlertRule(r.Context(), ruleID); err != nil {
+		writeAlertRuleError(w, ruleID, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeAlertRuleError(w http.ResponseWriter, ruleID string, err error) {
+	if errors.Is(err, persistence.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error":   "alert_rule_not_found",
+			"message": fmt.Sprintf("no alert rule with rule_id %q", ruleID),
+		})
+		return
+	}
+	writeAlertRulesQueryFailed(w, err)
+}
+
+func writeInvalidAlertRule(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":   "invalid_alert_rule",
+		"message": err.Error(),
+	})
+}
+
+func writeAlertRulesNotConfigured(w http.ResponseWriter) {
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "alert_rules_not_configured"})
+}
+
+func writeAlertRulesQueryFailed(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusInternalServerError, map[string]string{
+		"error":   "alert_rules_query_failed",
+		"message": err.Error(),
+	})
+}
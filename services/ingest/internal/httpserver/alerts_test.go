@@ -0,0 +1,127 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+type stubAlertRuleStore struct {
+	created []persistence.AlertRule
+	filters []persistence.AlertRuleFilter
+	deleted []string
+	err     error
+}
+
+func (s *stubAlertRuleStore) CreateAlertRule(_ context.Context, rule persistence.AlertRule) (persistence.AlertRule, error) {
+	s.created = append(s.created, rule)
+	rule.RuleID = "rule-1"
+	return rule, s.err
+}
+
+func (s *stubAlertRuleStore) ListAlertRules(_ context.Context, filter persistence.AlertRuleFilter) ([]persistence.AlertRule, error) {
+	s.filters = append(s.filters, filter)
+	return []persistence.AlertRule{{RuleID: "rule-1"}}, s.err
+}
+
+func (s *stubAlertRuleStore) GetAlertRule(_ context.Context, ruleID string) (persistence.AlertRule, error) {
+	return persistence.AlertRule{RuleID: ruleID, State: &persistence.AlertState{State: persistence.AlertStateFiring}}, s.err
+}
+
+func (s *stubAlertRuleStore) DeleteAlertRule(_ context.Context, ruleID string) error {
+	s.deleted = append(s.deleted, ruleID)
+	return s.err
+}
+
+func alertRuleHandler(rules *stubAlertRuleStore) http.Handler {
+	return NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithAlertRuleStore(rules))
+}
+
+func TestCreateAlertRule(t *testing.T) {
+	rules := &stubAlertRuleStore{}
+
+	rr := httptest.NewRecorder()
+	alertRuleHandler(rules).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/alert-rules", strings.NewReader(`{
+		"alert_type": "latency_breach", "scope": "workflow", "tenant_id": "t1", "workflow_id": "checkout",
+		"metric": "run_latency_p95_ms", "comparison": "gt", "threshold": 2000, "window_seconds": 600, "for_seconds": 120
+	}`)))
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"rule_id":"rule-1"`) {
+		t.Fatalf("response = %d %s", rr.Code, rr.Body.String())
+	}
+	if got := rules.created[0]; got.WorkflowID != "checkout" || got.Threshold != 2000 || got.ForSeconds != 120 {
+		t.Fatalf("created = %+v", got)
+	}
+}
+
+func TestCreateAlertRuleRejectsInvalidRules(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body string
+		code string
+	}{
+		"unknown field":     {`{"alert_type": "spend_spike", "extra": 1}`, "invalid_json"},
+		"missing threshold": {`{"alert_type": "spend_spike", "scope": "tenant", "tenant_id": "t1", "metric": "cost_usd", "comparison": "gt", "window_seconds": 60}`, "invalid_alert_rule"},
+		"wrong metric":      {`{"alert_type": "spend_spike", "scope": "tenant", "tenant_id": "t1", "metric": "error_rate", "comparison": "gt", "threshold": 1, "window_seconds": 60}`, "invalid_alert_rule"},
+		"no window":         {`{"alert_type": "spend_spike", "scope": "tenant", "tenant_id": "t1", "metric": "cost_usd", "comparison": "gt", "threshold": 1}`, "invalid_alert_rule"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rules := &stubAlertRuleStore{}
+			rr := httptest.NewRecorder()
+			alertRuleHandler(rules).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/alert-rules", strings.NewReader(tc.body)))
+
+			if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), tc.code) {
+				t.Fatalf("response = %d %s, want 400 %s", rr.Code, rr.Body.String(), tc.code)
+			}
+			if len(rules.created) != 0 {
+				t.Fatal("invalid rule must not be stored")
+			}
+		})
+	}
+}
+
+func TestListAlertRulesPassesFilters(t *testing.T) {
+	rules := &stubAlertRuleStore{}
+
+	rr := httptest.NewRecorder()
+	alertRuleHandler(rules).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/alert-rules?tenant_id=t1&alert_type=spend_spike", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"alert_rules":[`) {
+		t.Fatalf("response = %d %s", rr.Code, rr.Body.String())
+	}
+	if got := rules.filters[0]; got.TenantID != "t1" || got.AlertType != "spend_spike" {
+		t.Fatalf("filter = %+v", got)
+	}
+
+	rr = httptest.NewRecorder()
+	alertRuleHandler(rules).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/alert-rules?alert_type=budget_threshold_hit", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAlertRuleErrorsMapToStatusCodes(t *testing.T) {
+	rr := httptest.NewRecorder()
+	alertRuleHandler(&stubAlertRuleStore{}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/alert-rules/rule-1", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"state":"firing"`) {
+		t.Fatalf("response = %d %s, want the rule with its state", rr.Code, rr.Body.String())
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		rr := httptest.NewRecorder()
+		alertRuleHandler(&stubAlertRuleStore{err: persistence.ErrNotFound}).ServeHTTP(rr, httptest.NewRequest(method, "/v1/alert-rules/missing", nil))
+		if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "alert_rule_not_found") {
+			t.Fatalf("%s response = %d %s", method, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}).
+		ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/alert-rules", nil))
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "alert_rules_not_configured") {
+		t.Fatalf("response = %d %s", rr.Code, rr.Body.String())
+	}
+}
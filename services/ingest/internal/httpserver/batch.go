@@ -0,0 +1,404 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
+)
+
+const (
+	maxBatchBodyBytes int64 = 10 << 20 // 10MB
+	maxBatchEvents          = 1000
+)
+
+var errBatchTooLarge = fmt.Errorf("batch must contain at most %d events", maxBatchEvents)
+
+var errBatchBodyTooLarge = fmt.Errorf("batch body must be at most %d bytes", maxBatchBodyBytes)
+
+// errEventLineTooLarge rejects one NDJSON line over the single-event limit;
+// the rest of the batch is still processed.
+var errEventLineTooLarge = fmt.Errorf("event line must be at most %d bytes", maxEventBodyBytes)
+
+const (
+	batchStatusAccepted  = "accepted"
+	batchStatusDuplicate = "duplicate"
+	batchStatusQueued    = "queued"
+	batchStatusSpooled   = "spooled"
+	batchStatusRejected  = "rejected"
+	batchStatusFailed    = "failed"
+)
+
+// batchItem is one decoded entry of a batch request body. Err is set when the
+// entry itself could not be decoded (NDJSON lines are decoded independently).
+type batchItem struct {
+	Payload any
+	Err     error
+}
+
+type batchResult struct {
+	Index    int                `json:"index"`
+	EventID  string             `json:"event_id,omitempty"`
+	Status   string             `json:"status"`
+	Error    string             `json:"error,omitempty"`
+	Message  string             `json:"message,omitempty"`
+	Errors   []validation.Error `json:"errors,omitempty"`
+	Warnings []validation.Error `json:"warnings,omitempty"`
+}
+
+type batchSummary struct {
+	Accepted   int `json:"accepted"`
+	Duplicates int `json:"duplicates"`
+	Queued     int `json:"queued"`
+	Spooled    int `json:"spooled"`
+	Rejected   int `json:"rejected"`
+	Failed     int `json:"failed"`
+}
+
+func handlePostEventsBatch(w http.ResponseWriter, r *http.Request, validator EventValidator, store EventStore, o options) {
+	if validator == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "validator_not_configured"})
+		return
+	}
+	if store == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store_not_configured"})
+		return
+	}
+
+	items, err := decodeBatchBody(r.Body, r.Header.Get("Content-Type"))
+	if errors.Is(err, errBatchTooLarge) || errors.Is(err, errBatchBodyTooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{
+			"error":   "batch_too_large",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":   "invalid_json",
+			"message": err.Error(),
+		})
+		return
+	}
+	if len(items) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":   "empty_batch",
+			"message": "batch must contain at least one event",
+		})
+		return
+	}
+
+	results := make([]batchResult, len(items))
+	valid := make([]map[string]any, 0, len(items))
+	validIndexes := make([]int, 0, len(items))
+	for idx, item := range items {
+		result := batchResult{Index: idx, EventID: eventIDOf(item.Payload)}
+		if item.Err != nil {
+			result.Status = batchStatusRejected
+			result.Error = "invalid_json"
+			if errors.Is(item.Err, errEventLineTooLarge) {
+				result.Error = "event_too_large"
+			}
+			result.Message = item.Err.Error()
+			results[idx] = result
+			continue
+		}
+
+		payloadMap, result := validateBatchItem(validator, result, item.Payload)
+		results[idx] = result
+		if payloadMap != nil {
+			valid = append(valid, payloadMap)
+			validIndexes = append(validIndexes, idx)
+		}
+	}
+
+	var queueErr error
+	if o.queue != nil {
+		for pos, idx := range validIndexes {
+			if err := o.queue.Enqueue(valid[pos]); err != nil {
+				results[idx].Status = batchStatusFailed
+				results[idx].Error = queueErrorCode(err)
+				results[idx].Message = err.Error()
+				queueErr = err
+				continue
+			}
+			results[idx].Status = batchStatusQueued
+		}
+	} else if len(valid) > 0 {
+		inserted, err := store.InsertEvents(r.Context(), valid)
+		var invalid *persistence.InvalidEventsError
+		if errors.As(err, &invalid) {
+			err = nil
+		}
+		for pos, idx := range validIndexes {
+			invalidErr := invalidEventErr(invalid, pos)
+			switch {
+			case invalidErr != nil:
+				results[idx].Status = batchStatusRejected
+				results[idx].Error = "invalid_event"
+				results[idx].Message = invalidErr.Error()
+			case err != nil:
+				results[idx] = spoolBatchItem(o.spool, results[idx], valid[pos], err)
+			case inserted[pos]:
+				results[idx].Status = batchStatusAccepted
+			default:
+				results[idx].Status = batchStatusDuplicate
+			}
+		}
+	}
+
+	var summary batchSummary
+	for _, result := range results {
+		switch result.Status {
+		case batchStatusAccepted:
+			summary.Accepted++
+		case batchStatusDuplicate:
+			summary.Duplicates++
+		case batchStatusQueued:
+			summary.Queued++
+		case batchStatusSpooled:
+			summary.Spooled++
+		case batchStatusRejected:
+			summary.Rejected++
+		case batchStatusFailed:
+			summary.Failed++
+		}
+	}
+
+	// Persistence failures are retryable, so surface them as a server error while
+	// still returning per-event results; retries are safe because inserts are idempotent.
+	statusCode := http.StatusOK
+	body := map[string]any{
+		"status":  "processed",
+		"summary": summary,
+		"results": results,
+	}
+	switch {
+	case queueErr != nil:
+		w.Header().Set("Retry-After", strconv.Itoa(queueRetryAfterSeconds))
+		statusCode = http.StatusServiceUnavailable
+		body["status"] = "partial_failure"
+		body["error"] = queueErrorCode(queueErr)
+	case summary.Failed > 0:
+		statusCode = http.StatusInternalServerError
+		body["status"] = "partial_failure"
+		body["error"] = "persist_failed"
+	}
+
+	writeJSON(w, statusCode, body)
+}
+
+// validateBatchItem returns the payload when it is ready to persist, otherwise a rejected result.
+func validateBatchItem(validator EventValidator, result batchResult, payload any) (map[string]any, batchResult) {
+	validationErrors, warnings := validatePayload(validator, payload)
+	if len(validationErrors) > 0 {
+		result.Status = batchStatusRejected
+		result.Error = "validation_failed"
+		result.Errors = validationErrors
+		return nil, result
+	}
+	result.Warnings = warnings
+
+	payloadMap, ok := payload.(map[string]any)
+	if !ok {
+		result.Status = batchStatusRejected
+		result.Error = "invalid_payload_type"
+		result.Message = "batch entries must be JSON objects"
+		return nil, result
+	}
+
+	return payloadMap, result
+}
+
+// invalidEventErr returns why the store skipped payload pos, or nil.
+func invalidEventErr(invalid *persistence.InvalidEventsError, pos int) error {
+	if invalid == nil {
+		return nil
+	}
+	return invalid.Errs[pos]
+}
+
+// spoolBatchItem falls back to the spool after a persistence failure.
+func spoolBatchItem(spool EventSpool, result batchResult, payload map[string]any, persistErr error) batchResult {
+	if spool != nil {
+		if err := spool.Append(payload); err == nil {
+			result.Status = batchStatusSpooled
+			return result
+		}
+	}
+
+	result.Status = batchStatusFailed
+	result.Error = "persist_failed"
+	result.Message = persistErr.Error()
+	return result
+}
+
+// decodeBatchBody accepts either a JSON array of events or an NDJSON stream
+// (one event per line). NDJSON is selected by content type, or by sniffing
+// the first non-whitespace byte when the content type is generic JSON.
+func decodeBatchBody(body io.ReadCloser, contentType string) ([]batchItem, error) {
+	defer body.Close()
+
+	reader := bufio.NewReader(&bodyLimitReader{r: body, remaining: maxBatchBodyBytes})
+
+	if isNDJSONContentType(contentType) {
+		return decodeNDJSON(reader)
+	}
+
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if first == '[' {
+		return decodeJSONArray(reader)
+	}
+
+	return decodeNDJSON(reader)
+}
+
+// bodyLimitReader reads up to remaining bytes plus one more, and fails with
+// errBatchBodyTooLarge when that extra byte exists, so an oversized body is
+// rejected instead of being decoded as a shorter batch.
+type bodyLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *bodyLimitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		n, l.remaining = int(l.remaining), 0
+		return n, errBatchBodyTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+func decodeJSONArray(reader io.Reader) ([]batchItem, error) {
+	dec := json.NewDecoder(reader)
+	dec.UseNumber()
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	items := make([]batchItem, 0)
+	for dec.More() {
+		if len(items) >= maxBatchEvents {
+			return nil, errBatchTooLarge
+		}
+
+		var payload any
+		if err := dec.Decode(&payload); err != nil {
+			return nil, err
+		}
+		items = append(items, batchItem{Payload: payload})
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var trailing any
+	if err := dec.Decode(&trailing); !errors.Is(err, io.EOF) {
+		return nil, errors.New("request body must contain a single JSON array")
+	}
+
+	return items, nil
+}
+
+func decodeNDJSON(reader *bufio.Reader) ([]batchItem, error) {
+	items := make([]batchItem, 0)
+	for {
+		line, tooLarge, readErr := readNDJSONLine(reader)
+		if errors.Is(readErr, errBatchBodyTooLarge) {
+			return nil, readErr
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, fmt.Errorf("read ndjson body: %w", readErr)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 || tooLarge {
+			if len(items) >= maxBatchEvents {
+				return nil, errBatchTooLarge
+			}
+			if tooLarge {
+				items = append(items, batchItem{Err: errEventLineTooLarge})
+			} else {
+				payload, err := decodeJSONBody(io.NopCloser(bytes.NewReader(line)))
+				items = append(items, batchItem{Payload: payload, Err: err})
+			}
+		}
+
+		if readErr != nil {
+			return items, nil
+		}
+	}
+}
+
+// readNDJSONLine reads through the next newline. A line longer than
+// maxEventBodyBytes is consumed but not kept, and reported as tooLarge.
+func readNDJSONLine(reader *bufio.Reader) (line []byte, tooLarge bool, err error) {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLarge {
+			line = append(line, chunk...)
+			if int64(len(bytes.TrimRight(line, "\r\n"))) > maxEventBodyBytes {
+				line, tooLarge = nil, true
+			}
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, tooLarge, err
+		}
+	}
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		if err := reader.UnreadByte(); err != nil {
+			return 0, err
+		}
+		return b, nil
+	}
+}
+
+func isNDJSONContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return true
+	default:
+		return false
+	}
+}
+
+func eventIDOf(payload any) string {
+	obj, ok := payload.(map[string]any)
+	if !ok {
+		return ""
+	}
+	eventID, _ := obj["event_id"].(string)
+	return eventID
+}
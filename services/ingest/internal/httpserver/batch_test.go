@@ -0,0 +1,379 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/pipeline"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
+)
+
+type funcValidator func(payload any) []validation.Error
+
+func (f funcValidator) Validate(payload any) []validation.Error {
+	return f(payload)
+}
+
+// rejectEventType fails validation for payloads whose event_type is "bad".
+var rejectEventType = funcValidator(func(payload any) []validation.Error {
+	obj, ok := payload.(map[string]any)
+	if ok && obj["event_type"] == "bad" {
+		return []validation.Error{{Path: "$.event_type", Message: "must be one of allowed enum values"}}
+	}
+	return nil
+})
+
+type batchStore struct {
+	stubStore
+	duplicates map[string]bool
+	failing    map[string]bool
+	invalid    map[string]bool
+	inserted   []string
+}
+
+func (b *batchStore) InsertEvents(_ context.Context, payloads []map[string]any) ([]bool, error) {
+	inserted := make([]bool, len(payloads))
+	invalid := make(map[int]error)
+	for idx, payload := range payloads {
+		eventID, _ := payload["event_id"].(string)
+		if b.failing[eventID] {
+			return nil, errors.New("db down")
+		}
+		if b.invalid[eventID] {
+			invalid[idx] = errors.New("$.resource_usage.total_tokens must be an integer")
+			continue
+		}
+		if b.duplicates[eventID] {
+			continue
+		}
+		b.inserted = append(b.inserted, eventID)
+		inserted[idx] = true
+	}
+	if len(invalid) > 0 {
+		return inserted, &persistence.InvalidEventsError{Errs: invalid}
+	}
+	return inserted, nil
+}
+
+type batchResponse struct {
+	Status  string        `json:"status"`
+	Error   string        `json:"error"`
+	Summary batchSummary  `json:"summary"`
+	Results []batchResult `json:"results"`
+}
+
+func serveBatch(t *testing.T, store EventStore, contentType string, body string) (*httptest.ResponseRecorder, batchResponse) {
+	t.Helper()
+
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), rejectEventType, store)
+	req := httptest.NewRequest(http.MethodPost, "/v1/events:batch", bytes.NewBufferString(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	var resp batchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	return rr, resp
+}
+
+func TestPostEventsBatchJSONArrayPerEventResults(t *testing.T) {
+	store := &batchStore{duplicates: map[string]bool{"e2": true}}
+
+	rr, resp := serveBatch(t, store, "application/json", `[
+		{"event_id":"e1","event_type":"run.started"},
+		{"event_id":"e2","event_type":"run.started"},
+		{"event_id":"e3","event_type":"bad"},
+		"not-an-object"
+	]`)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("results len = %d, want 4", len(resp.Results))
+	}
+
+	wantStatuses := []string{batchStatusAccepted, batchStatusDuplicate, batchStatusRejected, batchStatusRejected}
+	for idx, want := range wantStatuses {
+		if resp.Results[idx].Index != idx {
+			t.Fatalf("results[%d].index = %d, want %d", idx, resp.Results[idx].Index, idx)
+		}
+		if resp.Results[idx].Status != want {
+			t.Fatalf("results[%d].status = %q, want %q", idx, resp.Results[idx].Status, want)
+		}
+	}
+	if resp.Results[2].Error != "validation_failed" || len(resp.Results[2].Errors) == 0 {
+		t.Fatalf("results[2] = %+v, want validation errors", resp.Results[2])
+	}
+	if resp.Results[3].Error != "invalid_payload_type" {
+		t.Fatalf("results[3].error = %q, want invalid_payload_type", resp.Results[3].Error)
+	}
+	if resp.Summary != (batchSummary{Accepted: 1, Duplicates: 1, Rejected: 2}) {
+		t.Fatalf("summary = %+v", resp.Summary)
+	}
+	if len(store.inserted) != 1 || store.inserted[0] != "e1" {
+		t.Fatalf("inserted = %v, want [e1]", store.inserted)
+	}
+}
+
+func TestPostEventsBatchRejectsEventsTheStoreCannotWrite(t *testing.T) {
+	store := &batchStore{invalid: map[string]bool{"e2": true}}
+
+	rr, resp := serveBatch(t, store, "application/json", `[
+		{"event_id":"e1","event_type":"run.started"},
+		{"event_id":"e2","event_type":"run.started"}
+	]`)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got := resp.Results[1]; got.Status != batchStatusRejected || got.Error != "invalid_event" || !strings.Contains(got.Message, "total_tokens") {
+		t.Fatalf("results[1] = %+v, want rejected invalid_event", got)
+	}
+	if resp.Summary != (batchSummary{Accepted: 1, Rejected: 1}) {
+		t.Fatalf("summary = %+v, want the valid event still accepted", resp.Summary)
+	}
+}
+
+func TestPostEventsBatchNDJSONIsolatesBadLines(t *testing.T) {
+	store := &batchStore{}
+
+	rr, resp := serveBatch(t, store, "application/x-ndjson",
+		"{\"event_id\":\"e1\",\"event_type\":\"run.started\"}\n"+
+			"{\"broken\":\n"+
+			"\n"+
+			"{\"event_id\":\"e2\",\"event_type\":\"run.started\"}\n")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("results len = %d, want 3", len(resp.Results))
+	}
+	if resp.Results[1].Status != batchStatusRejected || resp.Results[1].Error != "invalid_json" {
+		t.Fatalf("results[1] = %+v, want rejected invalid_json", resp.Results[1])
+	}
+	if resp.Summary.Accepted != 2 {
+		t.Fatalf("summary.accepted = %d, want 2", resp.Summary.Accepted)
+	}
+}
+
+func TestPostEventsBatchNDJSONRejectsOnlyOversizedLine(t *testing.T) {
+	store := &batchStore{}
+	oversized := `{"event_id":"big","padding":"` + strings.Repeat("x", int(maxEventBodyBytes)) + `"}`
+
+	rr, resp := serveBatch(t, store, "application/x-ndjson",
+		"{\"event_id\":\"e1\",\"event_type\":\"run.started\"}\n"+
+			oversized+"\n"+
+			"{\"event_id\":\"e2\",\"event_type\":\"run.started\"}\n")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("results len = %d, want 3", len(resp.Results))
+	}
+	if got := resp.Results[1]; got.Status != batchStatusRejected || got.Error != "event_too_large" || !strings.Contains(got.Message, "1048576 bytes") {
+		t.Fatalf("results[1] = %+v, want rejected event_too_large naming the limit", got)
+	}
+	if resp.Summary.Accepted != 2 {
+		t.Fatalf("summary.accepted = %d, want the lines around it accepted", resp.Summary.Accepted)
+	}
+}
+
+func TestPostEventsBatchSniffsNDJSONWithoutContentType(t *testing.T) {
+	store := &batchStore{}
+
+	rr, resp := serveBatch(t, store, "",
+		"{\"event_id\":\"e1\",\"event_type\":\"run.started\"}\n{\"event_id\":\"e2\",\"event_type\":\"run.started\"}")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if resp.Summary.Accepted != 2 {
+		t.Fatalf("summary.accepted = %d, want 2", resp.Summary.Accepted)
+	}
+}
+
+func TestPostEventsBatchPersistFailureIsRetryable(t *testing.T) {
+	store := &batchStore{failing: map[string]bool{"e2": true}}
+
+	rr, resp := serveBatch(t, store, "application/json",
+		`[{"event_id":"e1","event_type":"run.started"},{"event_id":"e2","event_type":"run.started"}]`)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if resp.Error != "persist_failed" {
+		t.Fatalf("error = %q, want persist_failed", resp.Error)
+	}
+	for _, result := range resp.Results {
+		if result.Status != batchStatusFailed {
+			t.Fatalf("results = %+v, want every persistable event failed", resp.Results)
+		}
+	}
+}
+
+func TestPostEventsBatchRejectsMalformedArray(t *testing.T) {
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, &batchStore{})
+
+	for _, body := range []string{`[{"event_id":"e1"},`, `[]`, ``, `[{"event_id":"e1"}] []`} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/events:batch", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("body %q status = %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestPostEventsBatchRejectsOversizedBatch(t *testing.T) {
+	var body bytes.Buffer
+	body.WriteString("[")
+	for i := 0; i <= maxBatchEvents; i++ {
+		if i > 0 {
+			body.WriteString(",")
+		}
+		body.WriteString(`{"event_id":"e"}`)
+	}
+	body.WriteString("]")
+
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, &batchStore{})
+	req := httptest.NewRequest(http.MethodPost, "/v1/events:batch", &body)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestPostEventsBatchRejectsOversizedBody(t *testing.T) {
+	// The limit falls on a line boundary, so a truncating reader would accept
+	// the first event and silently drop the second.
+	first := `{"event_id":"e1","event_type":"run.started"}` + "\n"
+	body := first + strings.Repeat("\n", int(maxBatchBodyBytes)-len(first)) + `{"event_id":"e2","event_type":"run.started"}` + "\n"
+
+	store := &batchStore{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, store)
+	req := httptest.NewRequest(http.MethodPost, "/v1/events:batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rr.Body.String(), "batch_too_large") {
+		t.Fatalf("status = %d, body = %s, want 413 batch_too_large", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPostEventsBatchQueuedWhenAsync(t *testing.T) {
+	queue := &stubQueue{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), rejectEventType, &batchStore{}, WithEventQueue(queue))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events:batch", bytes.NewBufferString(
+		`[{"event_id":"e1","event_type":"run.started"},{"event_id":"e2","event_type":"bad"}]`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var resp batchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if resp.Results[0].Status != batchStatusQueued || resp.Results[1].Status != batchStatusRejected {
+		t.Fatalf("results = %+v, want queued then rejected", resp.Results)
+	}
+	if len(queue.enqueued) != 1 {
+		t.Fatalf("enqueued = %d, want 1", len(queue.enqueued))
+	}
+}
+
+func TestPostEventsBatchQueueFullReturnsRetryAfter(t *testing.T) {
+	queue := &stubQueue{err: pipeline.ErrQueueFull}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, &batchStore{}, WithEventQueue(queue))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events:batch", bytes.NewBufferString(`[{"event_id":"e1"}]`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Fatal("Retry-After header is empty")
+	}
+}
+
+func TestPostEventsBatchSpooledWhenPersistFails(t *testing.T) {
+	spool := &stubSpool{}
+	store := &batchStore{failing: map[string]bool{"e1": true}}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, store, WithSpool(spool))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events:batch", bytes.NewBufferString(
+		`[{"event_id":"e1"},{"event_id":"e2"}]`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var resp batchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if resp.Summary.Spooled != 2 {
+		t.Fatalf("summary = %+v, want 2 spooled", resp.Summary)
+	}
+	if len(spool.appended) != 2 {
+		t.Fatalf("spooled events = %d, want 2", len(spool.appended))
+	}
+}
+
+func TestPostEventsBatchReportsWarnings(t *testing.T) {
+	validator := warningStubValidator{warnings: []validation.Error{
+		{Path: "$.occurred_at", Code: "occurred_at_in_future", Message: "must not be more than 5m0s in the future"},
+	}}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), validator, &batchStore{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events:batch", bytes.NewBufferString(`[{"event_id":"e1"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	var resp batchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Status != batchStatusAccepted {
+		t.Fatalf("results = %+v, want one accepted result", resp.Results)
+	}
+	if len(resp.Results[0].Warnings) != 1 || resp.Results[0].Warnings[0].Code != "occurred_at_in_future" {
+		t.Fatalf("warnings = %+v, want occurred_at_in_future", resp.Results[0].Warnings)
+	}
+}
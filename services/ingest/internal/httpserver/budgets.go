@@ -0,0 +1,350 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// budgetRequest is the POST /v1/budgets body. PUT takes the same terms
+// without the scope ids, plus an optional version to guard against lost updates.
+type budgetRequest struct {
+	Name        string   `json:"name"`
+	Scope       string   `json:"scope"`
+	TenantID    string   `json:"tenant_id"`
+	WorkspaceID string   `json:"workspace_id"`
+	ProjectID   string   `json:"project_id"`
+	AgentID     string   `json:"agent_id"`
+	Period      string   `json:"period"`
+	LimitUSD    *float64 `json:"limit_usd"`
+	Enforcement string   `json:"enforcement"`
+}
+
+type budgetUpdateRequest struct {
+	Name        string   `json:"name"`
+	Period      string   `json:"period"`
+	LimitUSD    *float64 `json:"limit_usd"`
+	Enforcement string   `json:"enforcement"`
+	Version     *int     `json:"version"`
+}
+
+// budgetCheckRequest is the POST /v1/budgets/check body.
+type budgetCheckRequest struct {
+	TenantID         string   `json:"tenant_id"`
+	WorkspaceID      string   `json:"workspace_id"`
+	ProjectID        string   `json:"project_id"`
+	AgentID          string   `json:"agent_id"`
+	EstimatedCostUSD *float64 `json:"estimated_cost_usd"`
+}
+
+// budgetReservationRequest is the POST /v1/budgets/reservations body.
+type budgetReservationRequest struct {
+	RunID string `json:"run_id"`
+	budgetCheckRequest
+	TTLSeconds *int `json:"ttl_seconds"`
+}
+
+// maxReservationTTL bounds ttl_seconds.
+const maxReservationTTL = 24 * time.Hour
+
+func handleCreateBudget(w http.ResponseWriter, r *http.Request, budgets BudgetStore) {
+	if budgets == nil {
+		writeBudgetsNotConfigured(w)
+		return
+	}
+
+	var req budgetRequest
+	if err := decodeStrictJSON(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json", "message": err.Error()})
+		return
+	}
+	if req.LimitUSD == nil {
+		writeInvalidBudget(w, errors.New("limit_usd is required"))
+		return
+	}
+
+	budget := persistence.Budget{
+		Name:        req.Name,
+		Scope:       req.Scope,
+		TenantID:    req.TenantID,
+		WorkspaceID: req.WorkspaceID,
+		ProjectID:   req.ProjectID,
+		AgentID:     req.AgentID,
+		Period:      req.Period,
+		LimitUSD:    *req.LimitUSD,
+		Enforcement: req.Enforcement,
+	}
+	if err := budget.Validate(); err != nil {
+		writeInvalidBudget(w, err)
+		return
+	}
+
+	created, err := budgets.CreateBudget(r.Context(), budget)
+	if err != nil {
+		writeBudgetsQueryFailed(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func handleListBudgets(w http.ResponseWriter, r *http.Request, budgets BudgetStore) {
+	if budgets == nil {
+		writeBudgetsNotConfigured(w)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := persistence.BudgetFilter{
+		TenantID:    query.Get("tenant_id"),
+		WorkspaceID: query.Get("workspace_id"),
+		ProjectID:   query.Get("project_id"),
+		AgentID:     query.Get("agent_id"),
+		Scope:       query.Get("scope"),
+	}
+	switch filter.Scope {
+	case "", persistence.BudgetScopeTenant, persistence.BudgetScopeWorkspace, persistence.BudgetScopeProject, persistence.BudgetScopeAgent:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":   "invalid_query",
+			"message": "scope must be one of tenant, workspace, project, agent",
+		})
+		return
+	}
+
+	list, err := budgets.ListBudgets(r.Context(), filter)
+	if err != nil {
+		writeBudgetsQueryFailed(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"budgets": list})
+}
+
+func handleGetBudget(w http.ResponseWriter, r *http.Request, budgets BudgetStore) {
+	if budgets == nil {
+		writeBudgetsNotConfigured(w)
+		return
+	}
+
+	budgetID := r.PathValue("budget_id")
+	detail, err := budgets.GetBudget(r.Context(), budgetID)
+	if err != nil {
+		writeBudgetError(w, budgetID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+func handleUpdateBudget(w http.ResponseWriter, r *http.Request, budgets BudgetStore) {
+	if budgets == nil {
+		writeBudgetsNotConfigured(w)
+		return
+	}
+
+	var req budgetUpdateRequest
+	if err := decodeStrictJSON(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json", "message": err.Error()})
+		return
+	}
+	if req.LimitUSD == nil {
+		writeInvalidBudget(w, errors.New("limit_usd is required"))
+		return
+	}
+
+	update := persistence.BudgetUpdate{
+		Name:            req.Name,
+		Period:          req.Period,
+		LimitUSD:        *req.LimitUSD,
+		Enforcement:     req.Enforcement,
+		ExpectedVersion: req.Version,
+	}
+	if err := update.Validate(); err != nil {
+		writeInvalidBudget(w, err)
+		return
+	}
+
+	budgetID := r.PathValue("budget_id")
+	updated, err := budgets.UpdateBudget(r.Context(), budgetID, update)
+	if err != nil {
+		writeBudgetError(w, budgetID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func handleDeleteBudget(w http.ResponseWriter, r *http.Request, budgets BudgetStore) {
+	if budgets == nil {
+		writeBudgetsNotConfigured(w)
+		return
+	}
+
+	budgetID := r.PathValue("budget_id")
+	if err := budgets.DeleteBudget(r.Context(), budgetID); err != nil {
+		writeBudgetError(w, budgetID, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleGetBudgetStatus(w http.ResponseWriter, r *http.Request, budgets BudgetStore) {
+	if budgets == nil {
+		writeBudgetsNotConfigured(w)
+		return
+	}
+
+	budgetID := r.PathValue("budget_id")
+	status, err := budgets.GetBudgetStatus(r.Context(), budgetID, time.Now())
+	if err != nil {
+		writeBudgetError(w, budgetID, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func handleCheckBudget(w http.ResponseWriter, r *http.Request, checker BudgetChecker) {
+	if checker == nil {
+		writeBudgetsNotConfigured(w)
+		return
+	}
+
+	var req budgetCheckRequest
+	if err := decodeStrictJSON(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json", "message": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeInvalidBudgetCheck(w, err.Error())
+		return
+	}
+
+	check, err := checker.CheckBudget(req.TenantID, req.WorkspaceID, req.ProjectID, req.AgentID, *req.EstimatedCostUSD)
+	if err != nil {
+		writeBudgetCheckUnavailable(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, check)
+}
+
+func handleReserveBudget(w http.ResponseWriter, r *http.Request, checker BudgetChecker) {
+	if checker == nil {
+		writeBudgetsNotConfigured(w)
+		return
+	}
+
+	var req budgetReservationRequest
+	if err := decodeStrictJSON(r.Body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_json", "message": err.Error()})
+		return
+	}
+	if req.RunID == "" {
+		writeInvalidBudgetCheck(w, "run_id is required")
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeInvalidBudgetCheck(w, err.Error())
+		return
+	}
+	var ttl time.Duration
+	if req.TTLSeconds != nil {
+		maxSeconds := int(maxReservationTTL / time.Second)
+		if *req.TTLSeconds <= 0 || *req.TTLSeconds > maxSeconds {
+			writeInvalidBudgetCheck(w, fmt.Sprintf("ttl_seconds must be between 1 and %d", maxSeconds))
+			return
+		}
+		ttl = time.Duration(*req.TTLSeconds) * time.Second
+	}
+
+	reservation, err := checker.ReserveBudget(persistence.BudgetReservationRequest{
+		RunID:            req.RunID,
+		TenantID:         req.TenantID,
+		WorkspaceID:      req.WorkspaceID,
+		ProjectID:        req.ProjectID,
+		AgentID:          req.AgentID,
+		EstimatedCostUSD: *req.EstimatedCostUSD,
+		TTL:              ttl,
+	})
+	if err != nil {
+		writeBudgetCheckUnavailable(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reservation)
+}
+
+func (req budgetCheckRequest) validate() error {
+	if req.TenantID == "" {
+		return errors.New("tenant_id is required")
+	}
+	if req.EstimatedCostUSD == nil || *req.EstimatedCostUSD < 0 {
+		return errors.New("estimated_cost_usd must be a non-negative number")
+	}
+	return nil
+}
+
+// writeBudgetError maps store errors for a single budget to responses.
+func writeBudgetError(w http.ResponseWriter, budgetID string, err error) {
+	switch {
+	case errors.Is(err, persistence.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error":   "budget_not_found",
+			"message": fmt.Sprintf("no budget with budget_id %q", budgetID),
+		})
+	case errors.Is(err, persistence.ErrVersionConflict):
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error":   "budget_version_conflict",
+			"message": "budget was updated since the given version; reload it and retry",
+		})
+	default:
+		writeBudgetsQueryFailed(w, err)
+	}
+}
+
+func writeInvalidBudget(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":   "invalid_budget",
+		"message": err.Error(),
+	})
+}
+
+func writeInvalidBudgetCheck(w http.ResponseWriter, message string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error":   "invalid_budget_check",
+		"message": message,
+	})
+}
+
+func writeBudgetCheckUnavailable(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+		"error":   "budget_check_unavailable",
+		"message": err.Error(),
+	})
+}
+
+func writeBudgetsNotConfigured(w http.ResponseWriter) {
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "budgets_not_configured"})
+}
+
+func writeBudgetsQueryFailed(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusInternalServerError, map[string]string{
+		"error":   "budgets_query_failed",
+		"message": err.Error(),
+	})
+}
+
+// decodeStrictJSON decodes a single JSON object into dest, rejecting unknown fields.
+func decodeStrictJSON(body io.ReadCloser, dest any) error {
+	defer body.Close()
+
+	dec := json.NewDecoder(io.LimitReader(body, maxEventBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dest); err != nil {
+		return err
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("request body must contain a single JSON object")
+	}
+	return nil
+}
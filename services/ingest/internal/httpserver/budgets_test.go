@@ -0,0 +1,317 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+type stubBudgetStore struct {
+	created []persistence.Budget
+	updates []persistence.BudgetUpdate
+	filters []persistence.BudgetFilter
+	deleted []string
+	err     error
+}
+
+func (s *stubBudgetStore) CreateBudget(_ context.Context, budget persistence.Budget) (persistence.Budget, error) {
+	s.created = append(s.created, budget)
+	budget.BudgetID, budget.Version = "budget-1", 1
+	return budget, s.err
+}
+
+func (s *stubBudgetStore) ListBudgets(_ context.Context, filter persistence.BudgetFilter) ([]persistence.Budget, error) {
+	s.filters = append(s.filters, filter)
+	return []persistence.Budget{{BudgetID: "budget-1"}}, s.err
+}
+
+func (s *stubBudgetStore) GetBudget(_ context.Context, budgetID string) (persistence.BudgetDetail, error) {
+	return persistence.BudgetDetail{
+		Budget:   persistence.Budget{BudgetID: budgetID, Version: 2},
+		Versions: []persistence.BudgetVersion{{Version: 1, LimitUSD: 10}, {Version: 2, LimitUSD: 20}},
+	}, s.err
+}
+
+func (s *stubBudgetStore) UpdateBudget(_ context.Context, budgetID string, update persistence.BudgetUpdate) (persistence.Budget, error) {
+	s.updates = append(s.updates, update)
+	return persistence.Budget{BudgetID: budgetID, LimitUSD: update.LimitUSD, Version: 2}, s.err
+}
+
+func (s *stubBudgetStore) DeleteBudget(_ context.Context, budgetID string) error {
+	s.deleted = append(s.deleted, budgetID)
+	return s.err
+}
+
+func (s *stubBudgetStore) GetBudgetStatus(_ context.Context, budgetID string, now time.Time) (persistence.BudgetStatus, error) {
+	budget := persistence.Budget{BudgetID: budgetID, LimitUSD: 100, Enforcement: persistence.BudgetEnforcementHard}
+	return persistence.NewBudgetStatus(budget, now.Truncate(time.Hour), now.Truncate(time.Hour).Add(time.Hour), 80), s.err
+}
+
+func budgetHandler(budgets *stubBudgetStore) http.Handler {
+	return NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithBudgetStore(budgets))
+}
+
+func TestCreateBudget(t *testing.T) {
+	budgets := &stubBudgetStore{}
+
+	rr := httptest.NewRecorder()
+	budgetHandler(budgets).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/budgets", strings.NewReader(`{
+		"scope": "project", "tenant_id": "t1", "workspace_id": "w1", "project_id": "p1",
+		"period": "monthly", "limit_usd": 250, "enforcement": "hard"
+	}`)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+
+	if got := budgets.created[0]; got.Scope != "project" || got.ProjectID != "p1" || got.LimitUSD != 250 {
+		t.Fatalf("created = %+v", got)
+	}
+	var body persistence.Budget
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.BudgetID != "budget-1" || body.Version != 1 {
+		t.Fatalf("body = %+v", body)
+	}
+}
+
+func TestCreateBudgetRejectsInvalidBodies(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body string
+		code string
+	}{
+		"unknown field":       {`{"scope": "tenant", "tenant_id": "t1", "period": "daily", "limit_usd": 1, "enforcement": "soft", "extra": 1}`, "invalid_json"},
+		"missing limit":       {`{"scope": "tenant", "tenant_id": "t1", "period": "daily", "enforcement": "soft"}`, "invalid_budget"},
+		"negative limit":      {`{"scope": "tenant", "tenant_id": "t1", "period": "daily", "limit_usd": -1, "enforcement": "soft"}`, "invalid_budget"},
+		"agent without ids":   {`{"scope": "agent", "tenant_id": "t1", "agent_id": "a1", "period": "daily", "limit_usd": 1, "enforcement": "soft"}`, "invalid_budget"},
+		"unsupported period":  {`{"scope": "tenant", "tenant_id": "t1", "period": "yearly", "limit_usd": 1, "enforcement": "soft"}`, "invalid_budget"},
+		"trailing json value": {`{"scope": "tenant"} {}`, "invalid_json"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			budgets := &stubBudgetStore{}
+			rr := httptest.NewRecorder()
+			budgetHandler(budgets).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/budgets", strings.NewReader(tc.body)))
+
+			if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), tc.code) {
+				t.Fatalf("response = %d %s, want 400 %s", rr.Code, rr.Body.String(), tc.code)
+			}
+			if len(budgets.created) != 0 {
+				t.Fatal("invalid budget must not be stored")
+			}
+		})
+	}
+}
+
+func TestListBudgetsPassesFilters(t *testing.T) {
+	budgets := &stubBudgetStore{}
+
+	rr := httptest.NewRecorder()
+	budgetHandler(budgets).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/budgets?tenant_id=t1&scope=agent", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"budgets":[`) {
+		t.Fatalf("response = %d %s", rr.Code, rr.Body.String())
+	}
+	if got := budgets.filters[0]; got.TenantID != "t1" || got.Scope != "agent" {
+		t.Fatalf("filter = %+v", got)
+	}
+
+	rr = httptest.NewRecorder()
+	budgetHandler(budgets).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/budgets?scope=org", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestUpdateBudgetPassesExpectedVersion(t *testing.T) {
+	budgets := &stubBudgetStore{}
+
+	rr := httptest.NewRecorder()
+	budgetHandler(budgets).ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/v1/budgets/budget-1", strings.NewReader(
+		`{"period": "monthly", "limit_usd": 500, "enforcement": "soft", "version": 1}`,
+	)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if got := budgets.updates[0]; got.LimitUSD != 500 || got.ExpectedVersion == nil || *got.ExpectedVersion != 1 {
+		t.Fatalf("update = %+v", got)
+	}
+
+	// The scope is fixed at creation.
+	rr = httptest.NewRecorder()
+	budgetHandler(budgets).ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/v1/budgets/budget-1", strings.NewReader(
+		`{"scope": "tenant", "period": "monthly", "limit_usd": 500, "enforcement": "soft"}`,
+	)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestBudgetErrorsMapToStatusCodes(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{persistence.ErrNotFound, http.MethodGet, "/v1/budgets/missing", "", http.StatusNotFound, "budget_not_found"},
+		{persistence.ErrNotFound, http.MethodDelete, "/v1/budgets/missing", "", http.StatusNotFound, "budget_not_found"},
+		{persistence.ErrNotFound, http.MethodGet, "/v1/budgets/missing/status", "", http.StatusNotFound, "budget_not_found"},
+		{persistence.ErrVersionConflict, http.MethodPut, "/v1/budgets/budget-1", `{"period": "daily", "limit_usd": 1, "enforcement": "soft", "version": 3}`, http.StatusConflict, "budget_version_conflict"},
+	} {
+		rr := httptest.NewRecorder()
+		budgetHandler(&stubBudgetStore{err: tc.err}).ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if rr.Code != tc.status || !strings.Contains(rr.Body.String(), tc.code) {
+			t.Fatalf("%s %s = %d %s, want %d %s", tc.method, tc.path, rr.Code, rr.Body.String(), tc.status, tc.code)
+		}
+	}
+}
+
+func TestDeleteBudget(t *testing.T) {
+	budgets := &stubBudgetStore{}
+
+	rr := httptest.NewRecorder()
+	budgetHandler(budgets).ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/v1/budgets/budget-1", nil))
+	if rr.Code != http.StatusNoContent || len(budgets.deleted) != 1 || budgets.deleted[0] != "budget-1" {
+		t.Fatalf("status = %d, deleted = %v", rr.Code, budgets.deleted)
+	}
+}
+
+func TestGetBudgetStatus(t *testing.T) {
+	rr := httptest.NewRecorder()
+	budgetHandler(&stubBudgetStore{}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/budgets/budget-1/status", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var body persistence.BudgetStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.SpentUSD != 80 || body.RemainingUSD != 20 || body.UtilizationPct != 80 || body.Result != persistence.BudgetWithinLimit {
+		t.Fatalf("body = %+v", body)
+	}
+}
+
+func TestBudgetsNotConfigured(t *testing.T) {
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/budgets", nil))
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "budgets_not_configured") {
+		t.Fatalf("response = %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+type stubBudgetChecker struct {
+	calls    []string
+	reserved []persistence.BudgetReservationRequest
+	err      error
+}
+
+func (s *stubBudgetChecker) CheckBudget(tenantID, workspaceID, projectID, agentID string, estimateUSD float64) (persistence.BudgetCheck, error) {
+	s.calls = append(s.calls, strings.Join([]string{tenantID, workspaceID, projectID, agentID}, "/"))
+	budget := persistence.Budget{BudgetID: "budget-1", LimitUSD: 100, Enforcement: persistence.BudgetEnforcementHard}
+	headroom := persistence.NewBudgetHeadroom(budget, time.Time{}, 95, 0, estimateUSD)
+	return persistence.NewBudgetCheck(estimateUSD, []persistence.BudgetHeadroom{headroom}), s.err
+}
+
+func TestCheckBudget(t *testing.T) {
+	checker := &stubBudgetChecker{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithBudgetChecker(checker))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/budgets/check", strings.NewReader(
+		`{"tenant_id": "t1", "workspace_id": "w1", "project_id": "p1", "agent_id": "a1", "estimated_cost_usd": 10}`,
+	)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var body persistence.BudgetCheck
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Result != persistence.BudgetHardLimitBlocked || body.RemainingUSD == nil || *body.RemainingUSD != 5 {
+		t.Fatalf("body = %+v", body)
+	}
+	if len(checker.calls) != 1 || checker.calls[0] != "t1/w1/p1/a1" {
+		t.Fatalf("calls = %v", checker.calls)
+	}
+
+	for _, bad := range []string{
+		`{"estimated_cost_usd": 1}`,
+		`{"tenant_id": "t1"}`,
+		`{"tenant_id": "t1", "estimated_cost_usd": -1}`,
+	} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/budgets/check", strings.NewReader(bad)))
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_budget_check") {
+			t.Fatalf("%s = %d %s, want 400 invalid_budget_check", bad, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestCheckBudgetUnavailableUntilCacheLoads(t *testing.T) {
+	checker := &stubBudgetChecker{err: errors.New("budget spend cache has not loaded yet")}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithBudgetChecker(checker))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/budgets/check", strings.NewReader(`{"tenant_id": "t1", "estimated_cost_usd": 1}`)))
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "budget_check_unavailable") {
+		t.Fatalf("response = %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func (s *stubBudgetChecker) ReserveBudget(req persistence.BudgetReservationRequest) (persistence.BudgetReservation, error) {
+	s.reserved = append(s.reserved, req)
+	expiresAt := time.Date(2026, 2, 7, 13, 0, 0, 0, time.UTC)
+	return persistence.BudgetReservation{
+		BudgetCheck: persistence.NewBudgetCheck(req.EstimatedCostUSD, nil),
+		RunID:       req.RunID,
+		Reserved:    true,
+		ExpiresAt:   &expiresAt,
+	}, s.err
+}
+
+func TestReserveBudget(t *testing.T) {
+	checker := &stubBudgetChecker{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithBudgetChecker(checker))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/budgets/reservations", strings.NewReader(
+		`{"run_id": "run-1", "tenant_id": "t1", "project_id": "p1", "estimated_cost_usd": 2.5, "ttl_seconds": 600}`,
+	)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	for _, want := range []string{`"run_id":"run-1"`, `"reserved":true`, `"result":"allow"`, `"expires_at":"2026-02-07T13:00:00Z"`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Fatalf("body missing %s: %s", want, rr.Body.String())
+		}
+	}
+	if got := checker.reserved[0]; got.RunID != "run-1" || got.ProjectID != "p1" || got.EstimatedCostUSD != 2.5 || got.TTL != 10*time.Minute {
+		t.Fatalf("reservation request = %+v", got)
+	}
+
+	for _, bad := range []string{
+		`{"tenant_id": "t1", "estimated_cost_usd": 1}`,
+		`{"run_id": "run-1", "tenant_id": "t1"}`,
+		`{"run_id": "run-1", "tenant_id": "t1", "estimated_cost_usd": 1, "ttl_seconds": 0}`,
+		`{"run_id": "run-1", "tenant_id": "t1", "estimated_cost_usd": 1, "ttl_seconds": 86401}`,
+	} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/budgets/reservations", strings.NewReader(bad)))
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_budget_check") {
+			t.Fatalf("%s = %d %s, want 400 invalid_budget_check", bad, rr.Code, rr.Body.String())
+		}
+	}
+}
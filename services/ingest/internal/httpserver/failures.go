@@ -0,0 +1,84 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const maxFailuresLimit = 200
+
+func handleListFailures(w http.ResponseWriter, r *http.Request, failures FailureReader) {
+	if failures == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failures_not_configured"})
+		return
+	}
+
+	query, err := parseFailureQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":   "invalid_query",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var page any
+	if query.GroupBy == "" {
+		page, err = failures.ListFailures(r.Context(), query)
+	} else {
+		page, err = failures.GroupFailures(r.Context(), query)
+	}
+	if errors.Is(err, persistence.ErrInvalidCursor) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":   "invalid_query",
+			"message": "cursor is invalid or belongs to a different group_by",
+		})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error":   "failures_query_failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func parseFailureQuery(r *http.Request) (persistence.FailureQuery, error) {
+	filter, err := parseOverviewFilter(r)
+	if err != nil {
+		return persistence.FailureQuery{}, err
+	}
+
+	values := r.URL.Query()
+	query := persistence.FailureQuery{
+		Filter:  filter,
+		GroupBy: values.Get("group_by"),
+		Cursor:  values.Get("cursor"),
+	}
+
+	if query.GroupBy != "" && !slices.Contains(persistence.FailureGroupDimensions, query.GroupBy) {
+		return query, fmt.Errorf("group_by must be one of %s", strings.Join(persistence.FailureGroupDimensions, ", "))
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			return query, fmt.Errorf("limit must be an integer")
+		}
+		if limit < 1 || limit > maxFailuresLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxFailuresLimit)
+		}
+		query.Limit = limit
+	}
+
+	return query, nil
+}
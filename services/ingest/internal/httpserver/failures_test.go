@@ -0,0 +1,114 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+type stubFailureReader struct {
+	queries []persistence.FailureQuery
+	err     error
+}
+
+func (s *stubFailureReader) ListFailures(_ context.Context, query persistence.FailureQuery) (persistence.FailurePage, error) {
+	s.queries = append(s.queries, query)
+	return persistence.FailurePage{
+		Filters:    query.Filter,
+		Failures:   []persistence.Failure{{EventID: "e1", EventType: "run.failed", RunID: "run-1"}},
+		NextCursor: "next",
+	}, s.err
+}
+
+func (s *stubFailureReader) GroupFailures(_ context.Context, query persistence.FailureQuery) (persistence.FailureGroupPage, error) {
+	s.queries = append(s.queries, query)
+	key := "timeout"
+	return persistence.FailureGroupPage{
+		Filters: query.Filter,
+		GroupBy: query.GroupBy,
+		Groups:  []persistence.FailureGroup{{Key: &key, Count: 3, SampleRunIDs: []string{"run-1"}}},
+	}, s.err
+}
+
+func TestListFailuresPassesFiltersAndCursor(t *testing.T) {
+	failures := &stubFailureReader{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithFailureReader(failures))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/failures?tenant_id=t1&agent_id=a1&window_hours=6&cursor=abc&limit=10", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	query := failures.queries[0]
+	if query.Filter.TenantID != "t1" || query.Filter.AgentID != "a1" || query.Filter.WindowHours != 6 || query.Cursor != "abc" || query.Limit != 10 {
+		t.Fatalf("query = %+v", query)
+	}
+
+	var body persistence.FailurePage
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(body.Failures) != 1 || body.NextCursor != "next" {
+		t.Fatalf("body = %+v", body)
+	}
+}
+
+func TestListFailuresGroupBy(t *testing.T) {
+	failures := &stubFailureReader{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithFailureReader(failures))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/failures?group_by=tool", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var body persistence.FailureGroupPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.GroupBy != "tool" || len(body.Groups) != 1 || body.Groups[0].Count != 3 {
+		t.Fatalf("body = %+v, want grouped response", body)
+	}
+}
+
+func TestListFailuresRejectsBadQuery(t *testing.T) {
+	tests := map[string]string{
+		"group_by":     "/v1/failures?group_by=payload",
+		"limit":        "/v1/failures?limit=0",
+		"window_hours": "/v1/failures?window_hours=500",
+	}
+	for name, target := range tests {
+		t.Run(name, func(t *testing.T) {
+			failures := &stubFailureReader{}
+			handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithFailureReader(failures))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+			}
+			if len(failures.queries) != 0 {
+				t.Fatalf("reader called for invalid query: %+v", failures.queries)
+			}
+		})
+	}
+}
+
+func TestListFailuresInvalidCursor(t *testing.T) {
+	failures := &stubFailureReader{err: persistence.ErrInvalidCursor}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithFailureReader(failures))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/failures?cursor=bogus", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
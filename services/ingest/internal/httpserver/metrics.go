@@ -0,0 +1,140 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const (
+	defaultTimeseriesBucket = "1h"
+	maxBreakdownLimit       = 100
+)
+
+func handleGetMetricsTimeseries(w http.ResponseWriter, r *http.Request, metrics MetricsReader) {
+	if metrics == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "metrics_not_configured"})
+		return
+	}
+
+	filter, err := parseOverviewFilter(r)
+	var bucket string
+	if err == nil {
+		bucket, err = parseTimeseriesBucket(r, filter)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":   "invalid_query",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	series, err := metrics.GetMetricsTimeseries(r.Context(), filter, bucket)
+	if err != nil {
+		writeMetricsQueryError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, series)
+}
+
+// writeMetricsQueryError reports a failed metrics query. Long windows the
+// rollups do not cover yet are unavailable rather than failed.
+func writeMetricsQueryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, persistence.ErrRollupsUnavailable) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"error":   "rollups_unavailable",
+			"message": err.Error(),
+		})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]string{
+		"error":   "metrics_query_failed",
+		"message": err.Error(),
+	})
+}
+
+// parseTimeseriesBucket reads bucket (default 1h) and rejects sizes that
+// would split the window into more than persistence.MaxTimeseriesPoints, or
+// that are finer than the hourly rollups serving windows longer than 24h.
+func parseTimeseriesBucket(r *http.Request, filter persistence.OverviewFilter) (string, error) {
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = defaultTimeseriesBucket
+	}
+
+	width, ok := persistence.TimeseriesBuckets[bucket]
+	if !ok {
+		return "", fmt.Errorf("bucket must be one of 1m, 5m, 1h, 1d")
+	}
+	start, end, err := filter.Window(time.Now())
+	if err != nil {
+		return "", err
+	}
+	if points := end.Sub(start) / width; points > persistence.MaxTimeseriesPoints {
+		return "", fmt.Errorf("window of %s in %s buckets exceeds %d points; use a larger bucket", end.Sub(start).Round(time.Minute), bucket, persistence.MaxTimeseriesPoints)
+	}
+	if end.Sub(start) > 24*time.Hour && width < time.Hour {
+		return "", fmt.Errorf("windows longer than 24h need a 1h or 1d bucket")
+	}
+	return bucket, nil
+}
+
+func handleGetMetricsBreakdown(w http.ResponseWriter, r *http.Request, metrics MetricsReader) {
+	if metrics == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "metrics_not_configured"})
+		return
+	}
+
+	filter, err := parseOverviewFilter(r)
+	var groupBy string
+	var limit int
+	if err == nil {
+		groupBy, limit, err = parseBreakdownQuery(r)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":   "invalid_query",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	breakdown, err := metrics.GetMetricsBreakdown(r.Context(), filter, groupBy, limit)
+	if err != nil {
+		writeMetricsQueryError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, breakdown)
+}
+
+// parseBreakdownQuery reads the required group_by and the optional top-N limit.
+func parseBreakdownQuery(r *http.Request) (string, int, error) {
+	query := r.URL.Query()
+
+	groupBy := query.Get("group_by")
+	if !slices.Contains(persistence.BreakdownDimensions, groupBy) {
+		return "", 0, fmt.Errorf("group_by must be one of %s", strings.Join(persistence.BreakdownDimensions, ", "))
+	}
+
+	raw := query.Get("limit")
+	if raw == "" {
+		return groupBy, 0, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		return "", 0, fmt.Errorf("limit must be an integer")
+	}
+	if limit < 1 || limit > maxBreakdownLimit {
+		return "", 0, fmt.Errorf("limit must be between 1 and %d", maxBreakdownLimit)
+	}
+	return groupBy, limit, nil
+}
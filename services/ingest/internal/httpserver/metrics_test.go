@@ -0,0 +1,148 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+type stubMetricsReader struct {
+	filter  persistence.OverviewFilter
+	bucket  string
+	groupBy string
+	limit   int
+	err     error
+}
+
+func (s *stubMetricsReader) GetMetricsTimeseries(_ context.Context, filter persistence.OverviewFilter, bucket string) (persistence.MetricsTimeseries, error) {
+	s.filter, s.bucket = filter, bucket
+	return persistence.MetricsTimeseries{
+		WindowHours: filter.WindowHours,
+		Bucket:      bucket,
+		Filters:     filter,
+		Points:      []persistence.TimeseriesPoint{{TotalRuns: 2}},
+	}, nil
+}
+
+func (s *stubMetricsReader) GetMetricsBreakdown(_ context.Context, filter persistence.OverviewFilter, groupBy string, limit int) (persistence.MetricsBreakdown, error) {
+	s.filter, s.groupBy, s.limit = filter, groupBy, limit
+	if s.err != nil {
+		return persistence.MetricsBreakdown{}, s.err
+	}
+	return persistence.MetricsBreakdown{
+		GroupBy: groupBy,
+		Unit:    persistence.BreakdownUnitModelCalls,
+		Rows:    []persistence.BreakdownRow{{Key: "gpt-4o", TotalRuns: 3, TotalCostUSD: 1.2}},
+		Other:   &persistence.BreakdownRow{TotalRuns: 1},
+	}, nil
+}
+
+func TestGetMetricsTimeseries(t *testing.T) {
+	metrics := &stubMetricsReader{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithMetricsReader(metrics))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/metrics/timeseries?window_hours=6&bucket=5m&workflow_id=wf1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if metrics.bucket != "5m" || metrics.filter.WindowHours != 6 || metrics.filter.WorkflowID != "wf1" {
+		t.Fatalf("reader got bucket %q filter %+v", metrics.bucket, metrics.filter)
+	}
+
+	var body persistence.MetricsTimeseries
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(body.Points) != 1 || body.Points[0].TotalRuns != 2 {
+		t.Fatalf("body = %+v", body)
+	}
+}
+
+func TestGetMetricsTimeseriesDefaultsToHourlyBuckets(t *testing.T) {
+	metrics := &stubMetricsReader{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithMetricsReader(metrics))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/metrics/timeseries", nil))
+	if rr.Code != http.StatusOK || metrics.bucket != "1h" || metrics.filter.WindowHours != 24 {
+		t.Fatalf("status = %d, bucket = %q, window = %d", rr.Code, metrics.bucket, metrics.filter.WindowHours)
+	}
+}
+
+func TestGetMetricsTimeseriesRejectsBadBucket(t *testing.T) {
+	for _, target := range []string{
+		"/v1/metrics/timeseries?bucket=15m",
+		"/v1/metrics/timeseries?bucket=1m&window_hours=168",
+		"/v1/metrics/timeseries?bucket=5m&window_hours=48",
+	} {
+		handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithMetricsReader(&stubMetricsReader{}))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetMetricsBreakdownReportsUncoveredRollups(t *testing.T) {
+	metrics := &stubMetricsReader{err: fmt.Errorf("%w: not aggregated yet", persistence.ErrRollupsUnavailable)}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithMetricsReader(metrics))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/metrics/breakdown?group_by=agent&window_hours=72", nil))
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "rollups_unavailable") {
+		t.Fatalf("status = %d, body = %s, want 503 rollups_unavailable", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGetMetricsBreakdown(t *testing.T) {
+	metrics := &stubMetricsReader{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithMetricsReader(metrics))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/metrics/breakdown?group_by=model&limit=5&tenant_id=t1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if metrics.groupBy != "model" || metrics.limit != 5 || metrics.filter.TenantID != "t1" {
+		t.Fatalf("reader got group_by %q limit %d filter %+v", metrics.groupBy, metrics.limit, metrics.filter)
+	}
+
+	var body persistence.MetricsBreakdown
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(body.Rows) != 1 || body.Rows[0].Key != "gpt-4o" || body.Other == nil || body.Other.TotalRuns != 1 {
+		t.Fatalf("body = %+v", body)
+	}
+}
+
+func TestGetMetricsBreakdownRejectsBadQuery(t *testing.T) {
+	for _, target := range []string{
+		"/v1/metrics/breakdown",
+		"/v1/metrics/breakdown?group_by=region",
+		"/v1/metrics/breakdown?group_by=agent&limit=1000",
+	} {
+		metrics := &stubMetricsReader{}
+		handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithMetricsReader(metrics))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+		if metrics.groupBy != "" {
+			t.Fatalf("%s: reader called for invalid query", target)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+func handleGetRun(w http.ResponseWriter, r *http.Request, runs RunReader) {
+	if runs == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "runs_not_configured"})
+		return
+	}
+
+	// run_id is only unique within a tenant, so lookups are always scoped.
+	tenantID := r.URL.Query().Get("tenant_id")
+	if tenantID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":   "invalid_query",
+			"message": "tenant_id is required",
+		})
+		return
+	}
+
+	runID := r.PathValue("run_id")
+	detail, err := runs.GetRun(r.Context(), tenantID, runID)
+	if errors.Is(err, persistence.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error":   "run_not_found",
+			"message": fmt.Sprintf("no run with run_id %q in tenant %q", runID, tenantID),
+		})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error":   "run_query_failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, detail)
+}
@@ -0,0 +1,82 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// stubRunReader holds runs of tenant-1 by run_id.
+type stubRunReader map[string]persistence.RunDetail
+
+func (s stubRunReader) GetRun(_ context.Context, tenantID string, runID string) (persistence.RunDetail, error) {
+	detail, ok := s[runID]
+	if !ok || tenantID != "tenant-1" {
+		return persistence.RunDetail{}, persistence.ErrNotFound
+	}
+	return detail, nil
+}
+
+func TestGetRunReturnsDetail(t *testing.T) {
+	runs := stubRunReader{"run-1": {
+		Run:        persistence.Run{RunID: "run-1", Status: "failure"},
+		Spans:      []*persistence.Span{{SpanID: "span-1", Kind: persistence.SpanKindRun, Children: []*persistence.Span{}}},
+		EventCount: 2,
+	}}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithRunReader(runs))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/runs/run-1?tenant_id=tenant-1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var body persistence.RunDetail
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body.Run.RunID != "run-1" || len(body.Spans) != 1 || body.Spans[0].SpanID != "span-1" {
+		t.Fatalf("body = %+v, want run-1 with one span", body)
+	}
+}
+
+func TestGetRunNotFound(t *testing.T) {
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithRunReader(stubRunReader{}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/runs/missing?tenant_id=tenant-1", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body["error"] != "run_not_found" {
+		t.Fatalf("error = %q, want run_not_found", body["error"])
+	}
+}
+
+func TestGetRunIsScopedToTenant(t *testing.T) {
+	runs := stubRunReader{"run-1": {Run: persistence.Run{RunID: "run-1"}}}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithRunReader(runs))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/runs/run-1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d without tenant_id", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/runs/run-1?tenant_id=tenant-2", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d for another tenant's run", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,70 @@
+package httpserver
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+func handleListSchemas(w http.ResponseWriter, catalog SchemaCatalog) {
+	if catalog == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "schemas_not_configured"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"schema_hash": catalog.Hash(),
+		"schemas":     catalog.Schemas(),
+	})
+}
+
+func handleGetSchema(w http.ResponseWriter, r *http.Request, catalog SchemaCatalog) {
+	if catalog == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "schemas_not_configured"})
+		return
+	}
+
+	version := r.PathValue("version")
+	doc, ok := catalog.Schema(version)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{
+			"error":   "schema_not_found",
+			"message": fmt.Sprintf("no schema registered for event_version %q", version),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(doc)
+}
+
+func handleReloadSchema(w http.ResponseWriter, logger *slog.Logger, reloader SchemaReloader) {
+	if reloader == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "schema_reload_not_configured"})
+		return
+	}
+
+	result, err := reloader.Reload()
+	if err != nil {
+		logger.Error("schema_reload_failed",
+			slog.String("error", err.Error()),
+			slog.String("schema_hash", result.Hash),
+		)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{
+			"error":       "schema_reload_failed",
+			"message":     err.Error(),
+			"schema_hash": result.Hash,
+		})
+		return
+	}
+
+	if result.Changed {
+		logger.Info("schema_reloaded",
+			slog.String("schema_hash", result.Hash),
+			slog.String("previous_schema_hash", result.PreviousHash),
+			slog.Any("event_versions", result.EventVersions),
+		)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,186 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
+)
+
+type stubCatalog map[string]json.RawMessage
+
+func (s stubCatalog) Schemas() []validation.SchemaInfo {
+	return []validation.SchemaInfo{{Version: "v0"}, {Version: "v1"}}
+}
+
+func (s stubCatalog) Schema(version string) (json.RawMessage, bool) {
+	doc, ok := s[version]
+	return doc, ok
+}
+
+func (s stubCatalog) Hash() string {
+	return "sha256:test"
+}
+
+func TestGetSchemasListsVersions(t *testing.T) {
+	catalog := stubCatalog{"v0": json.RawMessage(`{"title":"v0"}`), "v1": json.RawMessage(`{"title":"v1"}`)}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithSchemaCatalog(catalog))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/schemas", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var body struct {
+		SchemaHash string                  `json:"schema_hash"`
+		Schemas    []validation.SchemaInfo `json:"schemas"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(body.Schemas) != 2 || body.Schemas[1].Version != "v1" {
+		t.Fatalf("schemas = %+v, want v0 and v1", body.Schemas)
+	}
+	if body.SchemaHash != "sha256:test" {
+		t.Fatalf("schema_hash = %q, want sha256:test", body.SchemaHash)
+	}
+}
+
+func TestGetSchemaByVersion(t *testing.T) {
+	catalog := stubCatalog{"v1": json.RawMessage(`{"title":"v1"}`)}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithSchemaCatalog(catalog))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/schemas/v1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if rr.Body.String() != `{"title":"v1"}` {
+		t.Fatalf("body = %s, want raw schema document", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/schemas/v7", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown version status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetSchemasWithoutCatalog(t *testing.T) {
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/schemas", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+type stubReloader struct {
+	result validation.ReloadResult
+	err    error
+}
+
+func (s stubReloader) Reload() (validation.ReloadResult, error) {
+	return s.result, s.err
+}
+
+func TestReloadSchema(t *testing.T) {
+	reloader := stubReloader{result: validation.ReloadResult{
+		Hash:          "sha256:new",
+		PreviousHash:  "sha256:old",
+		Changed:       true,
+		EventVersions: []string{"v0", "v1"},
+	}}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithSchemaReloader(reloader), WithAdminToken("secret"))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, adminRequest("/admin/schema/reload", "secret"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var body validation.ReloadResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !body.Changed || body.Hash != "sha256:new" || body.PreviousHash != "sha256:old" {
+		t.Fatalf("body = %+v, want reload result", body)
+	}
+}
+
+func TestReloadSchemaFailureKeepsActiveHash(t *testing.T) {
+	reloader := stubReloader{result: validation.ReloadResult{Hash: "sha256:old"}, err: errors.New("load schema v1: bad json")}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithSchemaReloader(reloader), WithAdminToken("secret"))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, adminRequest("/admin/schema/reload", "secret"))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if body["error"] != "schema_reload_failed" || body["schema_hash"] != "sha256:old" {
+		t.Fatalf("body = %v, want schema_reload_failed with active hash", body)
+	}
+
+	handler = NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithAdminToken("secret"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, adminRequest("/admin/schema/reload", "secret"))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("unconfigured status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestReloadSchemaRequiresAdminToken(t *testing.T) {
+	reloader := &countingReloader{}
+	for _, tc := range []struct {
+		name  string
+		admin string
+		token string
+		want  int
+	}{
+		{name: "disabled without ADMIN_TOKEN", token: "secret", want: http.StatusForbidden},
+		{name: "missing token", admin: "secret", want: http.StatusUnauthorized},
+		{name: "wrong token", admin: "secret", token: "guess", want: http.StatusUnauthorized},
+	} {
+		handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithSchemaReloader(reloader), WithAdminToken(tc.admin))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, adminRequest("/admin/schema/reload", tc.token))
+		if rr.Code != tc.want {
+			t.Fatalf("%s: status = %d, want %d", tc.name, rr.Code, tc.want)
+		}
+	}
+	if reloader.calls != 0 {
+		t.Fatalf("reloads = %d, want none without a valid token", reloader.calls)
+	}
+}
+
+// countingReloader counts reloads to prove refused requests never reach it.
+type countingReloader struct {
+	calls int
+}
+
+func (r *countingReloader) Reload() (validation.ReloadResult, error) {
+	r.calls++
+	return validation.ReloadResult{}, nil
+}
+
+// adminRequest builds a POST to path, with token as the bearer token when set.
+func adminRequest(path string, token string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
@@ -2,6 +2,7 @@ package httpserver
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,27 +10,215 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/pipeline"
 	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
 )
 
-const maxEventBodyBytes int64 = 1 << 20 // 1MB
+const (
+	maxEventBodyBytes      int64 = 1 << 20 // 1MB
+	queueRetryAfterSeconds       = 1
+)
 
 // EventValidator validates event payloads.
 type EventValidator interface {
 	Validate(payload any) []validation.Error
 }
 
+// warningValidator is implemented by validators that can accept an event
+// while reporting non-fatal rule violations.
+type warningValidator interface {
+	ValidateWithWarnings(payload any) (errList []validation.Error, warnings []validation.Error)
+}
+
+// validatePayload returns blocking errors and, when the validator supports them, warnings.
+func validatePayload(validator EventValidator, payload any) ([]validation.Error, []validation.Error) {
+	if wv, ok := validator.(warningValidator); ok {
+		return wv.ValidateWithWarnings(payload)
+	}
+	return validator.Validate(payload), nil
+}
+
 // EventStore persists validated events.
 type EventStore interface {
 	InsertEvent(ctx context.Context, payload map[string]any) (bool, error)
+	InsertEvents(ctx context.Context, payloads []map[string]any) ([]bool, error)
 	GetOverviewMetrics(ctx context.Context, filter persistence.OverviewFilter) (persistence.OverviewMetrics, error)
 }
 
+// EventQueue accepts validated events for asynchronous persistence.
+type EventQueue interface {
+	Enqueue(payload map[string]any) error
+}
+
+// EventSpool durably buffers accepted events when the store is unavailable.
+type EventSpool interface {
+	Append(payload map[string]any) error
+}
+
+// SchemaCatalog exposes the event schemas the validator accepts.
+type SchemaCatalog interface {
+	Schemas() []validation.SchemaInfo
+	Schema(version string) (json.RawMessage, bool)
+	Hash() string
+}
+
+// SchemaReloader reloads the event schemas from disk, keeping the active set on failure.
+type SchemaReloader interface {
+	Reload() (validation.ReloadResult, error)
+}
+
+// RunReader loads materialized runs and their traces.
+type RunReader interface {
+	GetRun(ctx context.Context, tenantID string, runID string) (persistence.RunDetail, error)
+}
+
+// FailureReader lists recent failed events, individually or grouped by error signature.
+type FailureReader interface {
+	ListFailures(ctx context.Context, query persistence.FailureQuery) (persistence.FailurePage, error)
+	GroupFailures(ctx context.Context, query persistence.FailureQuery) (persistence.FailureGroupPage, error)
+}
+
+// MetricsReader serves chartable metrics beyond the overview aggregate.
+type MetricsReader interface {
+	GetMetricsTimeseries(ctx context.Context, filter persistence.OverviewFilter, bucket string) (persistence.MetricsTimeseries, error)
+	GetMetricsBreakdown(ctx context.Context, filter persistence.OverviewFilter, groupBy string, limit int) (persistence.MetricsBreakdown, error)
+}
+
+// BudgetStore manages budget definitions and reports their current-period spend.
+type BudgetStore interface {
+	CreateBudget(ctx context.Context, budget persistence.Budget) (persistence.Budget, error)
+	ListBudgets(ctx context.Context, filter persistence.BudgetFilter) ([]persistence.Budget, error)
+	GetBudget(ctx context.Context, budgetID string) (persistence.BudgetDetail, error)
+	UpdateBudget(ctx context.Context, budgetID string, update persistence.BudgetUpdate) (persistence.Budget, error)
+	DeleteBudget(ctx context.Context, budgetID string) error
+	GetBudgetStatus(ctx context.Context, budgetID string, now time.Time) (persistence.BudgetStatus, error)
+}
+
+// BudgetChecker answers pre-flight budget checks and holds spend
+// reservations for in-flight runs, from memory.
+type BudgetChecker interface {
+	CheckBudget(tenantID, workspaceID, projectID, agentID string, estimateUSD float64) (persistence.BudgetCheck, error)
+	ReserveBudget(req persistence.BudgetReservationRequest) (persistence.BudgetReservation, error)
+}
+
+// AlertRuleStore manages alert rules and reports their current state.
+type AlertRuleStore interface {
+	CreateAlertRule(ctx context.Context, rule persistence.AlertRule) (persistence.AlertRule, error)
+	ListAlertRules(ctx context.Context, filter persistence.AlertRuleFilter) ([]persistence.AlertRule, error)
+	GetAlertRule(ctx context.Context, ruleID string) (persistence.AlertRule, error)
+	DeleteAlertRule(ctx context.Context, ruleID string) error
+}
+
+// Option customizes optional handler behavior.
+type Option func(*options)
+
+type options struct {
+	queue    EventQueue
+	spool    EventSpool
+	schemas  SchemaCatalog
+	reloader SchemaReloader
+	admin    string
+	runs     RunReader
+	failures FailureReader
+	metrics  MetricsReader
+	budgets  BudgetStore
+	checker  BudgetChecker
+	alerts   AlertRuleStore
+}
+
+// WithEventQueue hands validated events to queue instead of writing them to the store inline.
+func WithEventQueue(queue EventQueue) Option {
+	return func(o *options) {
+		o.queue = queue
+	}
+}
+
+// WithSpool writes events to spool when inline persistence fails so they are replayed later.
+func WithSpool(spool EventSpool) Option {
+	return func(o *options) {
+		o.spool = spool
+	}
+}
+
+// WithSchemaCatalog serves the registered event schemas under /v1/schemas.
+func WithSchemaCatalog(catalog SchemaCatalog) Option {
+	return func(o *options) {
+		o.schemas = catalog
+	}
+}
+
+// WithSchemaReloader enables POST /admin/schema/reload.
+func WithSchemaReloader(reloader SchemaReloader) Option {
+	return func(o *options) {
+		o.reloader = reloader
+	}
+}
+
+// WithAdminToken serves the /admin endpoints to requests carrying token as a
+// bearer token. Without it they refuse every request.
+func WithAdminToken(token string) Option {
+	return func(o *options) {
+		o.admin = token
+	}
+}
+
+// WithRunReader serves run details under /v1/runs.
+func WithRunReader(runs RunReader) Option {
+	return func(o *options) {
+		o.runs = runs
+	}
+}
+
+// WithFailureReader serves recent failures under /v1/failures.
+func WithFailureReader(failures FailureReader) Option {
+	return func(o *options) {
+		o.failures = failures
+	}
+}
+
+// WithMetricsReader serves GET /v1/metrics/timeseries and /v1/metrics/breakdown.
+func WithMetricsReader(metrics MetricsReader) Option {
+	return func(o *options) {
+		o.metrics = metrics
+	}
+}
+
+// WithBudgetStore serves budget management under /v1/budgets.
+func WithBudgetStore(budgets BudgetStore) Option {
+	return func(o *options) {
+		o.budgets = budgets
+	}
+}
+
+// WithBudgetChecker serves POST /v1/budgets/check and /v1/budgets/reservations.
+func WithBudgetChecker(checker BudgetChecker) Option {
+	return func(o *options) {
+		o.checker = checker
+	}
+}
+
+// WithAlertRuleStore serves alert rule management under /v1/alert-rules.
+func WithAlertRuleStore(alerts AlertRuleStore) Option {
+	return func(o *options) {
+		o.alerts = alerts
+	}
+}
+
 // NewHandler returns the ingest service HTTP handler tree.
-func NewHandler(logger *slog.Logger, validator EventValidator, store EventStore) http.Handler {
+func NewHandler(logger *slog.Logger, validator EventValidator, store EventStore, opts ...Option) http.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -41,16 +230,78 @@ func NewHandler(logger *slog.Logger, validator EventValidator, store EventStore)
 	})
 
 	mux.HandleFunc("POST /v1/events", func(w http.ResponseWriter, r *http.Request) {
-		handlePostEvents(w, r, validator, store)
+		handlePostEvents(w, r, validator, store, o)
+	})
+	mux.HandleFunc("POST /v1/events:batch", func(w http.ResponseWriter, r *http.Request) {
+		handlePostEventsBatch(w, r, validator, store, o)
+	})
+	mux.HandleFunc("GET /v1/schemas", func(w http.ResponseWriter, r *http.Request) {
+		handleListSchemas(w, o.schemas)
+	})
+	mux.HandleFunc("GET /v1/schemas/{version}", func(w http.ResponseWriter, r *http.Request) {
+		handleGetSchema(w, r, o.schemas)
+	})
+	mux.HandleFunc("POST /admin/schema/reload", func(w http.ResponseWriter, r *http.Request) {
+		if authorizeAdmin(w, r, o.admin) {
+			handleReloadSchema(w, logger, o.reloader)
+		}
+	})
+	mux.HandleFunc("GET /v1/runs/{run_id}", func(w http.ResponseWriter, r *http.Request) {
+		handleGetRun(w, r, o.runs)
+	})
+	mux.HandleFunc("GET /v1/failures", func(w http.ResponseWriter, r *http.Request) {
+		handleListFailures(w, r, o.failures)
 	})
 	mux.HandleFunc("GET /v1/metrics/overview", func(w http.ResponseWriter, r *http.Request) {
 		handleGetMetricsOverview(w, r, store)
 	})
+	mux.HandleFunc("GET /v1/metrics/timeseries", func(w http.ResponseWriter, r *http.Request) {
+		handleGetMetricsTimeseries(w, r, o.metrics)
+	})
+	mux.HandleFunc("GET /v1/metrics/breakdown", func(w http.ResponseWriter, r *http.Request) {
+		handleGetMetricsBreakdown(w, r, o.metrics)
+	})
+	mux.HandleFunc("POST /v1/budgets", func(w http.ResponseWriter, r *http.Request) {
+		handleCreateBudget(w, r, o.budgets)
+	})
+	mux.HandleFunc("GET /v1/budgets", func(w http.ResponseWriter, r *http.Request) {
+		handleListBudgets(w, r, o.budgets)
+	})
+	mux.HandleFunc("GET /v1/budgets/{budget_id}", func(w http.ResponseWriter, r *http.Request) {
+		handleGetBudget(w, r, o.budgets)
+	})
+	mux.HandleFunc("PUT /v1/budgets/{budget_id}", func(w http.ResponseWriter, r *http.Request) {
+		handleUpdateBudget(w, r, o.budgets)
+	})
+	mux.HandleFunc("DELETE /v1/budgets/{budget_id}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteBudget(w, r, o.budgets)
+	})
+	mux.HandleFunc("GET /v1/budgets/{budget_id}/status", func(w http.ResponseWriter, r *http.Request) {
+		handleGetBudgetStatus(w, r, o.budgets)
+	})
+	mux.HandleFunc("POST /v1/budgets/check", func(w http.ResponseWriter, r *http.Request) {
+		handleCheckBudget(w, r, o.checker)
+	})
+	mux.HandleFunc("POST /v1/budgets/reservations", func(w http.ResponseWriter, r *http.Request) {
+		handleReserveBudget(w, r, o.checker)
+	})
+	mux.HandleFunc("POST /v1/alert-rules", func(w http.ResponseWriter, r *http.Request) {
+		handleCreateAlertRule(w, r, o.alerts)
+	})
+	mux.HandleFunc("GET /v1/alert-rules", func(w http.ResponseWriter, r *http.Request) {
+		handleListAlertRules(w, r, o.alerts)
+	})
+	mux.HandleFunc("GET /v1/alert-rules/{rule_id}", func(w http.ResponseWriter, r *http.Request) {
+		handleGetAlertRule(w, r, o.alerts)
+	})
+	mux.HandleFunc("DELETE /v1/alert-rules/{rule_id}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteAlertRule(w, r, o.alerts)
+	})
 
 	return requestLogger(logger, mux)
 }
 
-func handlePostEvents(w http.ResponseWriter, r *http.Request, validator EventValidator, store EventStore) {
+func handlePostEvents(w http.ResponseWriter, r *http.Request, validator EventValidator, store EventStore, o options) {
 	if validator == nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "validator_not_configured"})
 		return
@@ -69,7 +320,7 @@ func handlePostEvents(w http.ResponseWriter, r *http.Request, validator EventVal
 		return
 	}
 
-	validationErrors := validator.Validate(payload)
+	validationErrors, warnings := validatePayload(validator, payload)
 	if len(validationErrors) > 0 {
 		writeJSON(w, http.StatusBadRequest, map[string]any{
 			"error":  "validation_failed",
@@ -87,7 +338,37 @@ func handlePostEvents(w http.ResponseWriter, r *http.Request, validator EventVal
 		return
 	}
 
+	if o.queue != nil {
+		if err := o.queue.Enqueue(payloadMap); err != nil {
+			writeQueueUnavailable(w, err)
+			return
+		}
+		writeAccepted(w, warnings, map[string]any{
+			"status": "accepted",
+			"queued": true,
+		})
+		return
+	}
+
 	inserted, err := store.InsertEvent(r.Context(), payloadMap)
+	if errors.Is(err, persistence.ErrInvalidEvent) {
+		// Retrying cannot fix the event, so it is rejected rather than spooled.
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":   "invalid_event",
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil && o.spool != nil {
+		if spoolErr := o.spool.Append(payloadMap); spoolErr == nil {
+			writeAccepted(w, warnings, map[string]any{
+				"status":    "accepted",
+				"persisted": false,
+				"spooled":   true,
+			})
+			return
+		}
+	}
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]any{
 			"error":   "persist_failed",
@@ -96,12 +377,20 @@ func handlePostEvents(w http.ResponseWriter, r *http.Request, validator EventVal
 		return
 	}
 
-	writeJSON(w, http.StatusAccepted, map[string]any{
+	writeAccepted(w, warnings, map[string]any{
 		"status":    "accepted",
 		"persisted": inserted,
 	})
 }
 
+// writeAccepted writes a 202 body, attaching semantic rule warnings when present.
+func writeAccepted(w http.ResponseWriter, warnings []validation.Error, body map[string]any) {
+	if len(warnings) > 0 {
+		body["warnings"] = warnings
+	}
+	writeJSON(w, http.StatusAccepted, body)
+}
+
 func handleGetMetricsOverview(w http.ResponseWriter, r *http.Request, store EventStore) {
 	if store == nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "store_not_configured"})
@@ -117,7 +406,29 @@ func handleGetMetricsOverview(w http.ResponseWriter, r *http.Request, store Even
 		return
 	}
 
+	compare := r.URL.Query().Get("compare")
+	if compare != "" && compare != "previous_period" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":   "invalid_query",
+			"message": "compare must be previous_period",
+		})
+		return
+	}
+
 	overview, err := store.GetOverviewMetrics(r.Context(), filter)
+	if err == nil && compare != "" {
+		// The comparison window derives from the resolved current window so
+		// both periods line up exactly.
+		previousStart, previousEnd := filter.PreviousWindow(overview.WindowStart, overview.WindowEnd)
+		previousFilter := filter
+		previousFilter.WindowHours, previousFilter.Range = 0, ""
+		previousFilter.Start, previousFilter.End = &previousStart, &previousEnd
+
+		var previous persistence.OverviewMetrics
+		if previous, err = store.GetOverviewMetrics(r.Context(), previousFilter); err == nil {
+			overview.Previous = &previous
+		}
+	}
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{
 			"error":   "metrics_query_failed",
@@ -138,25 +449,63 @@ func parseOverviewFilter(r *http.Request) (persistence.OverviewFilter, error) {
 	filter.ProjectID = query.Get("project_id")
 	filter.AgentID = query.Get("agent_id")
 	filter.WorkflowID = query.Get("workflow_id")
+	filter.Range = query.Get("range")
+
+	for _, bound := range []struct {
+		name string
+		dest **time.Time
+	}{{"start", &filter.Start}, {"end", &filter.End}} {
+		raw := query.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC3339 timestamp", bound.name)
+		}
+		*bound.dest = &parsed
+	}
 
 	windowHoursRaw := query.Get("window_hours")
 	if windowHoursRaw == "" {
-		filter.WindowHours = 24
-		return filter, nil
+		if filter.Start == nil && filter.End == nil && filter.Range == "" {
+			filter.WindowHours = persistence.DefaultWindowHours
+		}
+		_, _, err := filter.Window(time.Now())
+		return filter, err
+	}
+	if filter.Start != nil || filter.End != nil || filter.Range != "" {
+		return filter, fmt.Errorf("window_hours cannot be combined with start, end or range")
 	}
 
 	windowHours, err := strconv.Atoi(windowHoursRaw)
 	if err != nil {
 		return filter, fmt.Errorf("window_hours must be an integer")
 	}
-	if windowHours < 1 || windowHours > 168 {
-		return filter, fmt.Errorf("window_hours must be between 1 and 168")
+	if windowHours < 1 || windowHours > persistence.MaxWindowHours {
+		return filter, fmt.Errorf("window_hours must be between 1 and %d", persistence.MaxWindowHours)
 	}
 	filter.WindowHours = windowHours
 
 	return filter, nil
 }
 
+// writeQueueUnavailable reports back-pressure from the async ingest queue.
+func writeQueueUnavailable(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(queueRetryAfterSeconds))
+	writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+		"error":   queueErrorCode(err),
+		"message": err.Error(),
+	})
+}
+
+func queueErrorCode(err error) string {
+	if errors.Is(err, pipeline.ErrQueueFull) {
+		return "queue_full"
+	}
+	return "queue_closed"
+}
+
 func decodeJSONBody(body io.ReadCloser) (any, error) {
 	defer body.Close()
 
@@ -211,6 +560,27 @@ func requestLogger(logger *slog.Logger, next http.Handler) http.Handler {
 	})
 }
 
+// authorizeAdmin reports whether r carries the admin bearer token, writing
+// the refusal when it does not. Without a configured token admin endpoints
+// are disabled rather than open.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error":   "admin_disabled",
+			"message": "set ADMIN_TOKEN to enable admin endpoints",
+		})
+		return false
+	}
+
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return false
+	}
+	return true
+}
+
 func writeJSON(w http.ResponseWriter, statusCode int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
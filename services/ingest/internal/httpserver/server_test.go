@@ -5,14 +5,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/francisbulus/agent-ops/services/ingest/internal/pipeline"
 	"github.com/francisbulus/agent-ops/services/ingest/internal/validation"
 )
 
@@ -37,6 +40,17 @@ func (s stubStore) InsertEvent(context.Context, map[string]any) (bool, error) {
 	return s.inserted, nil
 }
 
+func (s stubStore) InsertEvents(_ context.Context, payloads []map[string]any) ([]bool, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	inserted := make([]bool, len(payloads))
+	for idx := range inserted {
+		inserted[idx] = s.inserted
+	}
+	return inserted, nil
+}
+
 func (s stubStore) GetOverviewMetrics(context.Context, persistence.OverviewFilter) (persistence.OverviewMetrics, error) {
 	if s.err != nil {
 		return persistence.OverviewMetrics{}, s.err
@@ -216,6 +230,77 @@ func TestGetMetricsOverviewInvalidWindowQuery(t *testing.T) {
 	}
 }
 
+// overviewRecorder records the filters GetOverviewMetrics is called with.
+type overviewRecorder struct {
+	stubStore
+	filters []persistence.OverviewFilter
+}
+
+func (s *overviewRecorder) GetOverviewMetrics(_ context.Context, filter persistence.OverviewFilter) (persistence.OverviewMetrics, error) {
+	s.filters = append(s.filters, filter)
+	start, end, err := filter.Window(time.Now())
+	return persistence.OverviewMetrics{WindowStart: start, WindowEnd: end, Filters: filter, TotalRuns: int64(len(s.filters))}, err
+}
+
+func TestGetMetricsOverviewStartEnd(t *testing.T) {
+	store := &overviewRecorder{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, store)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/metrics/overview?start=2026-01-01T00:00:00Z&end=2026-02-01T00:00:00Z", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	filter := store.filters[0]
+	if filter.WindowHours != 0 || filter.Start == nil || !filter.Start.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) || filter.End == nil {
+		t.Fatalf("filter = %+v", filter)
+	}
+}
+
+func TestGetMetricsOverviewComparesPreviousPeriod(t *testing.T) {
+	store := &overviewRecorder{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, store)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/metrics/overview?window_hours=6&compare=previous_period&agent_id=a1", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var body persistence.OverviewMetrics
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if body.Previous == nil {
+		t.Fatal("previous = nil, want comparison period")
+	}
+	if !body.Previous.WindowEnd.Equal(body.WindowStart) || !body.Previous.WindowStart.Equal(body.WindowStart.Add(-6*time.Hour)) {
+		t.Fatalf("previous window = [%v, %v], current starts %v", body.Previous.WindowStart, body.Previous.WindowEnd, body.WindowStart)
+	}
+	if previous := store.filters[1]; previous.AgentID != "a1" || previous.WindowHours != 0 {
+		t.Fatalf("previous filter = %+v, want agent filter with explicit start/end", previous)
+	}
+}
+
+func TestGetMetricsOverviewRejectsBadRange(t *testing.T) {
+	for _, target := range []string{
+		"/v1/metrics/overview?start=yesterday",
+		"/v1/metrics/overview?start=2026-01-01T00:00:00Z&window_hours=24",
+		"/v1/metrics/overview?start=2024-01-01T00:00:00Z&end=2026-01-01T00:00:00Z",
+		"/v1/metrics/overview?range=ytd",
+		"/v1/metrics/overview?compare=last_year",
+	} {
+		handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{})
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
 func TestGetMetricsOverviewStoreFailure(t *testing.T) {
 	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{err: errors.New("db unavailable")})
 
@@ -236,3 +321,175 @@ func TestGetMetricsOverviewStoreFailure(t *testing.T) {
 		t.Fatalf("error = %v, want metrics_query_failed", body["error"])
 	}
 }
+
+type stubQueue struct {
+	err      error
+	enqueued []map[string]any
+}
+
+func (s *stubQueue) Enqueue(payload map[string]any) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.enqueued = append(s.enqueued, payload)
+	return nil
+}
+
+func TestPostEventsQueuedWhenAsync(t *testing.T) {
+	queue := &stubQueue{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{err: errors.New("store must not be called")}, WithEventQueue(queue))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewBufferString(`{"event_id":"x"}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusAccepted)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if body["queued"] != true {
+		t.Fatalf("queued = %v, want true", body["queued"])
+	}
+	if len(queue.enqueued) != 1 {
+		t.Fatalf("enqueued = %d, want 1", len(queue.enqueued))
+	}
+}
+
+func TestPostEventsQueueFullReturnsRetryAfter(t *testing.T) {
+	queue := &stubQueue{err: pipeline.ErrQueueFull}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{}, WithEventQueue(queue))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewBufferString(`{"event_id":"x"}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Fatal("Retry-After header is empty")
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if body["error"] != "queue_full" {
+		t.Fatalf("error = %v, want queue_full", body["error"])
+	}
+}
+
+type stubSpool struct {
+	err      error
+	appended []map[string]any
+}
+
+func (s *stubSpool) Append(payload map[string]any) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.appended = append(s.appended, payload)
+	return nil
+}
+
+func TestPostEventsSpooledWhenPersistFails(t *testing.T) {
+	spool := &stubSpool{}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{err: errors.New("db down")}, WithSpool(spool))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewBufferString(`{"event_id":"x"}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusAccepted)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if body["spooled"] != true || body["persisted"] != false {
+		t.Fatalf("body = %v, want spooled and not persisted", body)
+	}
+	if len(spool.appended) != 1 {
+		t.Fatalf("spooled events = %d, want 1", len(spool.appended))
+	}
+}
+
+func TestPostEventsPersistFailureWhenSpoolFails(t *testing.T) {
+	spool := &stubSpool{err: errors.New("disk full")}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, stubStore{err: errors.New("db down")}, WithSpool(spool))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewBufferString(`{"event_id":"x"}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestPostEventsRejectsInvalidEventWithoutSpooling(t *testing.T) {
+	spool := &stubSpool{}
+	store := stubStore{err: fmt.Errorf("%w: $.resource_usage.total_tokens must be an integer", persistence.ErrInvalidEvent)}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), stubValidator{}, store, WithSpool(spool))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewBufferString(`{"event_id":"x"}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_event") {
+		t.Fatalf("response = %d %s, want 400 invalid_event", rr.Code, rr.Body.String())
+	}
+	if len(spool.appended) != 0 {
+		t.Fatalf("spooled events = %d, want none", len(spool.appended))
+	}
+}
+
+type warningStubValidator struct {
+	warnings []validation.Error
+}
+
+func (s warningStubValidator) Validate(any) []validation.Error {
+	return nil
+}
+
+func (s warningStubValidator) ValidateWithWarnings(any) ([]validation.Error, []validation.Error) {
+	return nil, s.warnings
+}
+
+func TestPostEventsAcceptedWithWarnings(t *testing.T) {
+	validator := warningStubValidator{warnings: []validation.Error{
+		{Path: "$.resource_usage.total_tokens", Code: "token_total_mismatch", Message: "must equal input_tokens + output_tokens (15)"},
+	}}
+	handler := NewHandler(slog.New(slog.NewJSONHandler(io.Discard, nil)), validator, stubStore{inserted: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/events", bytes.NewBufferString(`{"event_id":"x"}`))
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusAccepted)
+	}
+
+	var body struct {
+		Status   string             `json:"status"`
+		Warnings []validation.Error `json:"warnings"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if body.Status != "accepted" || len(body.Warnings) != 1 || body.Warnings[0].Code != "token_total_mismatch" {
+		t.Fatalf("body = %+v, want accepted with token_total_mismatch warning", body)
+	}
+}
@@ -0,0 +1,48 @@
+// Package partitions keeps agent_events partitioned ahead of ingest and
+// enforces event retention.
+package partitions
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// Maintainer creates, drops and archives agent_events partitions.
+type Maintainer interface {
+	MaintainEventPartitions(ctx context.Context, policy persistence.PartitionPolicy) (persistence.PartitionMaintenance, error)
+}
+
+// Run performs one maintenance pass immediately, so today's partition exists
+// as soon as the service starts, and then one every interval until ctx is
+// cancelled. policy.Now is set for each pass.
+func Run(ctx context.Context, logger *slog.Logger, maintainer Maintainer, policy persistence.PartitionPolicy, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		policy.Now = time.Now()
+		result, err := maintainer.MaintainEventPartitions(ctx, policy)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("partition_maintenance_failed", slog.String("error", err.Error()))
+		}
+		if len(result.Created)+len(result.Dropped)+len(result.Archived) > 0 || result.PurgedEvents+result.PurgedRuns+result.PurgedRollups > 0 {
+			logger.Info("partitions_maintained",
+				slog.Any("created", result.Created),
+				slog.Any("dropped", result.Dropped),
+				slog.Any("archived", result.Archived),
+				slog.Int64("purged_events", result.PurgedEvents),
+				slog.Int64("purged_runs", result.PurgedRuns),
+				slog.Int64("purged_rollups", result.PurgedRollups),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
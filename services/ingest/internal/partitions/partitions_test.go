@@ -0,0 +1,61 @@
+package partitions
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+type recordingMaintainer struct {
+	mu       sync.Mutex
+	policies []persistence.PartitionPolicy
+}
+
+func (r *recordingMaintainer) MaintainEventPartitions(_ context.Context, policy persistence.PartitionPolicy) (persistence.PartitionMaintenance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policies = append(r.policies, policy)
+	return persistence.PartitionMaintenance{}, nil
+}
+
+func (r *recordingMaintainer) snapshot() []persistence.PartitionPolicy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]persistence.PartitionPolicy(nil), r.policies...)
+}
+
+func TestRunMaintainsOnStartAndEveryInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	maintainer := &recordingMaintainer{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	policy := persistence.PartitionPolicy{PrecreateDays: 7, DefaultRetentionDays: 30}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, logger, maintainer, policy, 5*time.Millisecond)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(maintainer.snapshot()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("partitions were not maintained in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	got := maintainer.snapshot()
+	if got[0].PrecreateDays != 7 || got[0].DefaultRetentionDays != 30 || got[0].Now.IsZero() {
+		t.Fatalf("policy = %+v, want configured policy stamped with now", got[0])
+	}
+	if !got[1].Now.After(got[0].Now) {
+		t.Fatalf("second pass Now = %v, want later than %v", got[1].Now, got[0].Now)
+	}
+}
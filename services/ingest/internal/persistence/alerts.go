@@ -0,0 +1,245 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// Alert types a rule can raise, matching alert.type in the event schema.
+// budget_threshold_hit is left to the budget worker.
+const (
+	AlertTypeSpendSpike           = "spend_spike"
+	AlertTypeSuccessRateDrop      = "success_rate_drop"
+	AlertTypeLatencyBreach        = "latency_breach"
+	AlertTypeErrorRateSpike       = "error_rate_spike"
+	AlertTypePolicyViolationBurst = "policy_violation_burst"
+)
+
+// AlertScopeWorkflow scopes a rule to one workflow of a tenant. Rules also
+// take the tenant, workspace, project and agent budget scopes.
+const AlertScopeWorkflow = "workflow"
+
+// Alert rule metrics. Rates are percentages of finished runs and latencies
+// are of finished runs, in milliseconds.
+const (
+	AlertMetricCostUSD          = "cost_usd"
+	AlertMetricSuccessRate      = "success_rate"
+	AlertMetricErrorRate        = "error_rate"
+	AlertMetricFailedRuns       = "failed_runs"
+	AlertMetricAvgLatency       = "avg_latency_ms"
+	AlertMetricLatencyP50       = "run_latency_p50_ms"
+	AlertMetricLatencyP90       = "run_latency_p90_ms"
+	AlertMetricLatencyP95       = "run_latency_p95_ms"
+	AlertMetricLatencyP99       = "run_latency_p99_ms"
+	AlertMetricPolicyViolations = "policy_violations"
+)
+
+// alertTypeMetrics lists the metrics each alert type may watch.
+var alertTypeMetrics = map[string][]string{
+	AlertTypeSpendSpike:      {AlertMetricCostUSD},
+	AlertTypeSuccessRateDrop: {AlertMetricSuccessRate},
+	AlertTypeLatencyBreach: {
+		AlertMetricAvgLatency, AlertMetricLatencyP50, AlertMetricLatencyP90, AlertMetricLatencyP95, AlertMetricLatencyP99,
+	},
+	AlertTypeErrorRateSpike:       {AlertMetricErrorRate, AlertMetricFailedRuns},
+	AlertTypePolicyViolationBurst: {AlertMetricPolicyViolations},
+}
+
+// Alert rule comparisons of the metric against the threshold.
+const (
+	AlertComparisonGT  = "gt"
+	AlertComparisonGTE = "gte"
+	AlertComparisonLT  = "lt"
+	AlertComparisonLTE = "lte"
+)
+
+// Alert rule states. A breach is pending until it has lasted for_seconds,
+// then firing; a firing rule that stops breaching is resolved. Firing and
+// resolved transitions emit an alert.emitted event.
+const (
+	AlertStateOK       = "ok"
+	AlertStatePending  = "pending"
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// MaxAlertWindow bounds an alert rule's evaluation window and for-duration.
+const MaxAlertWindow = 7 * 24 * time.Hour
+
+// AlertRule is one row of alert_rules, with its current state when it has
+// been evaluated.
+type AlertRule struct {
+	RuleID        string      `json:"rule_id"`
+	Name          string      `json:"name,omitempty"`
+	AlertType     string      `json:"alert_type"`
+	Scope         string      `json:"scope"`
+	TenantID      string      `json:"tenant_id"`
+	WorkspaceID   string      `json:"workspace_id,omitempty"`
+	ProjectID     string      `json:"project_id,omitempty"`
+	AgentID       string      `json:"agent_id,omitempty"`
+	WorkflowID    string      `json:"workflow_id,omitempty"`
+	Metric        string      `json:"metric"`
+	Comparison    string      `json:"comparison"`
+	Threshold     float64     `json:"threshold"`
+	WindowSeconds int         `json:"window_seconds"`
+	ForSeconds    int         `json:"for_seconds"`
+	CreatedAt     time.Time   `json:"created_at"`
+	State         *AlertState `json:"state,omitempty"`
+}
+
+// AlertState is a rule's evaluation state.
+type AlertState struct {
+	RuleID string `json:"-"`
+	State  string `json:"state"`
+	// AlertID identifies the current or last firing; empty before the first.
+	AlertID      string     `json:"alert_id,omitempty"`
+	PendingSince *time.Time `json:"pending_since,omitempty"`
+	ChangedAt    time.Time  `json:"changed_at"`
+	// LastValue is nil when the window had no data for the metric.
+	LastValue   *float64  `json:"last_value"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+	// Notified is false until the alert.emitted event for a firing or
+	// resolved transition is stored.
+	Notified bool `json:"-"`
+}
+
+// AlertRuleFilter narrows GET /v1/alert-rules; empty fields match everything.
+type AlertRuleFilter struct {
+	TenantID  string
+	AlertType string
+}
+
+// Validate checks a rule being created.
+func (r AlertRule) Validate() error {
+	if r.TenantID == "" {
+		return errors.New("tenant_id is required")
+	}
+	if len(r.Name) > MaxBudgetNameLength {
+		return fmt.Errorf("name may be at most %d bytes", MaxBudgetNameLength)
+	}
+
+	var required, forbidden []string
+	switch r.Scope {
+	case BudgetScopeTenant:
+		forbidden = []string{r.WorkspaceID, r.ProjectID, r.AgentID, r.WorkflowID}
+	case BudgetScopeWorkspace:
+		required, forbidden = []string{r.WorkspaceID}, []string{r.ProjectID, r.AgentID, r.WorkflowID}
+	case BudgetScopeProject:
+		required, forbidden = []string{r.WorkspaceID, r.ProjectID}, []string{r.AgentID, r.WorkflowID}
+	case BudgetScopeAgent:
+		required, forbidden = []string{r.WorkspaceID, r.ProjectID, r.AgentID}, []string{r.WorkflowID}
+	case AlertScopeWorkflow:
+		required, forbidden = []string{r.WorkflowID}, []string{r.WorkspaceID, r.ProjectID, r.AgentID}
+	default:
+		return errors.New("scope must be one of tenant, workspace, project, agent, workflow")
+	}
+	for _, id := range required {
+		if id == "" {
+			return fmt.Errorf("a %s rule requires %s", r.Scope, alertScopeIDs(r.Scope))
+		}
+	}
+	for _, id := range forbidden {
+		if id != "" {
+			return fmt.Errorf("a %s rule takes only %s", r.Scope, alertScopeIDs(r.Scope))
+		}
+	}
+
+	metrics, ok := alertTypeMetrics[r.AlertType]
+	if !ok {
+		return errors.New("alert_type must be one of spend_spike, success_rate_drop, latency_breach, error_rate_spike, policy_violation_burst")
+	}
+	if !slices.Contains(metrics, r.Metric) {
+		return fmt.Errorf("a %s rule watches one of %v", r.AlertType, metrics)
+	}
+	switch r.Comparison {
+	case AlertComparisonGT, AlertComparisonGTE, AlertComparisonLT, AlertComparisonLTE:
+	default:
+		return errors.New("comparison must be one of gt, gte, lt, lte")
+	}
+	if math.IsNaN(r.Threshold) || math.IsInf(r.Threshold, 0) {
+		return errors.New("threshold must be a number")
+	}
+
+	maxSeconds := int(MaxAlertWindow / time.Second)
+	if r.WindowSeconds <= 0 || r.WindowSeconds > maxSeconds {
+		return fmt.Errorf("window_seconds must be between 1 and %d", maxSeconds)
+	}
+	if r.ForSeconds < 0 || r.ForSeconds > maxSeconds {
+		return fmt.Errorf("for_seconds must be between 0 and %d", maxSeconds)
+	}
+	return nil
+}
+
+// Breached reports whether value crosses the rule's threshold.
+func (r AlertRule) Breached(value float64) bool {
+	switch r.Comparison {
+	case AlertComparisonGT:
+		return value > r.Threshold
+	case AlertComparisonGTE:
+		return value >= r.Threshold
+	case AlertComparisonLT:
+		return value < r.Threshold
+	case AlertComparisonLTE:
+		return value <= r.Threshold
+	default:
+		return false
+	}
+}
+
+// Filter returns the metrics filter for the rule's window ending at now.
+func (r AlertRule) Filter(now time.Time) OverviewFilter {
+	end := now.UTC()
+	start := end.Add(-time.Duration(r.WindowSeconds) * time.Second)
+	return OverviewFilter{
+		Start:       &start,
+		End:         &end,
+		TenantID:    r.TenantID,
+		WorkspaceID: r.WorkspaceID,
+		ProjectID:   r.ProjectID,
+		AgentID:     r.AgentID,
+		WorkflowID:  r.WorkflowID,
+	}
+}
+
+// AlertMetricValue reads metric from an overview. Rate and latency metrics
+// have no value when no run finished in the window.
+func AlertMetricValue(metric string, m OverviewMetrics) (float64, bool) {
+	switch metric {
+	case AlertMetricCostUSD:
+		return m.TotalCostUSD, true
+	case AlertMetricFailedRuns:
+		return float64(m.FailedRuns), true
+	}
+	if m.TotalRuns == 0 {
+		return 0, false
+	}
+
+	switch metric {
+	case AlertMetricSuccessRate:
+		return m.SuccessRate, true
+	case AlertMetricErrorRate:
+		return float64(m.FailedRuns) / float64(m.TotalRuns) * 100, true
+	case AlertMetricAvgLatency:
+		return m.AvgLatencyMS, true
+	case AlertMetricLatencyP50:
+		return m.RunLatency.P50, true
+	case AlertMetricLatencyP90:
+		return m.RunLatency.P90, true
+	case AlertMetricLatencyP95:
+		return m.RunLatency.P95, true
+	case AlertMetricLatencyP99:
+		return m.RunLatency.P99, true
+	default:
+		return 0, false
+	}
+}
+
+func alertScopeIDs(scope string) string {
+	if scope == AlertScopeWorkflow {
+		return "tenant_id and workflow_id"
+	}
+	return scopeIDs(scope)
+}
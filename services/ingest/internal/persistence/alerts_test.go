@@ -0,0 +1,93 @@
+package persistence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlertRuleValidate(t *testing.T) {
+	valid := AlertRule{
+		AlertType: AlertTypeSuccessRateDrop, Scope: BudgetScopeProject,
+		TenantID: "t1", WorkspaceID: "w1", ProjectID: "p1",
+		Metric: AlertMetricSuccessRate, Comparison: AlertComparisonLT, Threshold: 90,
+		WindowSeconds: 900, ForSeconds: 300,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	workflow := valid
+	workflow.Scope, workflow.WorkspaceID, workflow.ProjectID, workflow.WorkflowID = AlertScopeWorkflow, "", "", "wf1"
+	if err := workflow.Validate(); err != nil {
+		t.Fatalf("workflow Validate() error = %v", err)
+	}
+
+	for want, mutate := range map[string]func(*AlertRule){
+		"requires tenant_id and workflow_id": func(r *AlertRule) { r.Scope, r.WorkspaceID, r.ProjectID = AlertScopeWorkflow, "", "" },
+		"takes only tenant_id, workspace_id": func(r *AlertRule) { r.AgentID = "a1" },
+		"scope must be one of":               func(r *AlertRule) { r.Scope = "org" },
+		"alert_type must be one of":          func(r *AlertRule) { r.AlertType = "budget_threshold_hit" },
+		"a success_rate_drop rule watches":   func(r *AlertRule) { r.Metric = AlertMetricCostUSD },
+		"comparison must be one of":          func(r *AlertRule) { r.Comparison = "eq" },
+		"window_seconds must be between":     func(r *AlertRule) { r.WindowSeconds = 0 },
+		"for_seconds must be between":        func(r *AlertRule) { r.ForSeconds = -1 },
+		"name may be at most":                func(r *AlertRule) { r.Name = strings.Repeat("x", MaxBudgetNameLength+1) },
+		"tenant_id is required":              func(r *AlertRule) { r.TenantID = "" },
+	} {
+		rule := valid
+		mutate(&rule)
+		if err := rule.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Validate(%+v) error = %v, want %q", rule, err, want)
+		}
+	}
+}
+
+func TestAlertRuleBreached(t *testing.T) {
+	rule := AlertRule{Threshold: 10}
+	for comparison, want := range map[string][3]bool{
+		AlertComparisonGT:  {false, false, true},
+		AlertComparisonGTE: {false, true, true},
+		AlertComparisonLT:  {true, false, false},
+		AlertComparisonLTE: {true, true, false},
+	} {
+		rule.Comparison = comparison
+		for i, value := range []float64{9, 10, 11} {
+			if got := rule.Breached(value); got != want[i] {
+				t.Fatalf("%s Breached(%v) = %v, want %v", comparison, value, got, want[i])
+			}
+		}
+	}
+}
+
+func TestAlertRuleFilterCoversWindow(t *testing.T) {
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	rule := AlertRule{TenantID: "t1", WorkflowID: "wf1", WindowSeconds: 600}
+
+	filter := rule.Filter(now)
+	if !filter.Start.Equal(now.Add(-10*time.Minute)) || !filter.End.Equal(now) || filter.WorkflowID != "wf1" {
+		t.Fatalf("filter = %+v", filter)
+	}
+}
+
+func TestAlertMetricValue(t *testing.T) {
+	m := OverviewMetrics{TotalRuns: 4, FailedRuns: 1, SuccessRate: 75, TotalCostUSD: 2.5, RunLatency: LatencyPercentiles{P95: 1200}}
+
+	for metric, want := range map[string]float64{
+		AlertMetricCostUSD:    2.5,
+		AlertMetricErrorRate:  25,
+		AlertMetricFailedRuns: 1,
+		AlertMetricLatencyP95: 1200,
+	} {
+		if got, ok := AlertMetricValue(metric, m); !ok || got != want {
+			t.Fatalf("AlertMetricValue(%s) = %v, %v, want %v", metric, got, ok, want)
+		}
+	}
+
+	// Without finished runs a rate has no value, but spend is simply zero.
+	if _, ok := AlertMetricValue(AlertMetricSuccessRate, OverviewMetrics{}); ok {
+		t.Fatal("success_rate must have no value without runs")
+	}
+	if got, ok := AlertMetricValue(AlertMetricCostUSD, OverviewMetrics{}); !ok || got != 0 {
+		t.Fatalf("cost_usd = %v, %v, want 0", got, ok)
+	}
+}
@@ -0,0 +1,368 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Budget scopes, narrowest last. A budget covers every event matching the
+// ids up to its scope: a project budget needs tenant, workspace and project.
+const (
+	BudgetScopeTenant    = "tenant"
+	BudgetScopeWorkspace = "workspace"
+	BudgetScopeProject   = "project"
+	BudgetScopeAgent     = "agent"
+)
+
+// Budget periods. Periods are calendar aligned in UTC; weeks start on Monday.
+const (
+	BudgetPeriodHourly  = "hourly"
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodWeekly  = "weekly"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// Budget enforcement modes: soft budgets report overspend, hard budgets block it.
+const (
+	BudgetEnforcementSoft = "soft"
+	BudgetEnforcementHard = "hard"
+)
+
+// Budget results, matching the budget.result values in the event schema.
+const (
+	BudgetWithinLimit       = "within_limit"
+	BudgetSoftLimitExceeded = "soft_limit_exceeded"
+	BudgetHardLimitBlocked  = "hard_limit_blocked"
+)
+
+// BudgetCheckAllow is the pre-flight check result when the estimated cost
+// fits every budget; otherwise the check reports the budget results above.
+const BudgetCheckAllow = "allow"
+
+// MaxBudgetNameLength bounds Budget.Name.
+const MaxBudgetNameLength = 200
+
+// ErrVersionConflict is returned when an update names a version that is no longer current.
+var ErrVersionConflict = errors.New("version conflict")
+
+// Budget is one row of the budgets table.
+type Budget struct {
+	BudgetID    string    `json:"budget_id"`
+	Name        string    `json:"name,omitempty"`
+	Scope       string    `json:"scope"`
+	TenantID    string    `json:"tenant_id"`
+	WorkspaceID string    `json:"workspace_id,omitempty"`
+	ProjectID   string    `json:"project_id,omitempty"`
+	AgentID     string    `json:"agent_id,omitempty"`
+	Period      string    `json:"period"`
+	LimitUSD    float64   `json:"limit_usd"`
+	Enforcement string    `json:"enforcement"`
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BudgetVersion records the terms a budget had at one version.
+type BudgetVersion struct {
+	Version     int       `json:"version"`
+	Name        string    `json:"name,omitempty"`
+	Period      string    `json:"period"`
+	LimitUSD    float64   `json:"limit_usd"`
+	Enforcement string    `json:"enforcement"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BudgetDetail is a budget with its version history, oldest first.
+type BudgetDetail struct {
+	Budget
+	Versions []BudgetVersion `json:"versions"`
+}
+
+// BudgetUpdate replaces a budget's mutable terms. The scope is fixed at creation.
+type BudgetUpdate struct {
+	Name        string
+	Period      string
+	LimitUSD    float64
+	Enforcement string
+	// ExpectedVersion, when set, must match the current version.
+	ExpectedVersion *int
+}
+
+// BudgetFilter narrows GET /v1/budgets; empty fields match everything.
+type BudgetFilter struct {
+	TenantID    string
+	WorkspaceID string
+	ProjectID   string
+	AgentID     string
+	Scope       string
+}
+
+// BudgetStatus is current-period spend against a budget.
+type BudgetStatus struct {
+	Budget       Budget    `json:"budget"`
+	PeriodStart  time.Time `json:"period_start"`
+	PeriodEnd    time.Time `json:"period_end"`
+	SpentUSD     float64   `json:"spent_usd"`
+	RemainingUSD float64   `json:"remaining_usd"`
+	// UtilizationPct is spend as a percentage of the limit. Any spend against a
+	// zero limit counts as 100.
+	UtilizationPct float64 `json:"utilization_pct"`
+	Result         string  `json:"result"`
+}
+
+// BudgetHeadroom is one budget's share of a pre-flight check.
+type BudgetHeadroom struct {
+	BudgetID    string  `json:"budget_id"`
+	Scope       string  `json:"scope"`
+	Period      string  `json:"period"`
+	Enforcement string  `json:"enforcement"`
+	LimitUSD    float64 `json:"limit_usd"`
+	SpentUSD    float64 `json:"spent_usd"`
+	// ReservedUSD is held by in-flight runs' reservations and not yet spent.
+	ReservedUSD float64   `json:"reserved_usd"`
+	PeriodEnd   time.Time `json:"period_end"`
+	// RemainingUSD is the spend left before the estimate is applied.
+	RemainingUSD float64 `json:"remaining_usd"`
+	Result       string  `json:"result"`
+}
+
+// BudgetCheck answers whether spending EstimatedCostUSD fits every budget
+// covering the caller. Result is the most severe result across Budgets.
+type BudgetCheck struct {
+	Result           string  `json:"result"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+	// RemainingUSD is the smallest headroom across Budgets; it is omitted when
+	// no budget applies.
+	RemainingUSD *float64         `json:"remaining_usd,omitempty"`
+	Budgets      []BudgetHeadroom `json:"budgets"`
+}
+
+// BudgetReservationRequest holds EstimatedCostUSD against every budget
+// covering the ids until the run ends or TTL passes.
+type BudgetReservationRequest struct {
+	RunID            string
+	TenantID         string
+	WorkspaceID      string
+	ProjectID        string
+	AgentID          string
+	EstimatedCostUSD float64
+	// TTL, when zero, defaults to the service's reservation TTL.
+	TTL time.Duration
+}
+
+// BudgetReservation is the check made for a reservation. Reserved is false,
+// and nothing is held, when a hard budget blocks the estimate.
+type BudgetReservation struct {
+	BudgetCheck
+	RunID     string     `json:"run_id"`
+	Reserved  bool       `json:"reserved"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// BudgetThresholdHit is a budget crossing ThresholdPct percent of its limit in
+// the period starting PeriodStart. The first claim of a crossing fixes its
+// EventID, OccurredAt and SpentUSD; Emitted is set once its
+// budget.threshold_hit event is stored.
+type BudgetThresholdHit struct {
+	BudgetID     string
+	PeriodStart  time.Time
+	ThresholdPct int
+	EventID      string
+	OccurredAt   time.Time
+	SpentUSD     float64
+	Emitted      bool
+}
+
+// Validate checks the scope ids and terms of a budget being created.
+func (b Budget) Validate() error {
+	if b.TenantID == "" {
+		return errors.New("tenant_id is required")
+	}
+
+	var required, forbidden []string
+	switch b.Scope {
+	case BudgetScopeTenant:
+		forbidden = []string{b.WorkspaceID, b.ProjectID, b.AgentID}
+	case BudgetScopeWorkspace:
+		required, forbidden = []string{b.WorkspaceID}, []string{b.ProjectID, b.AgentID}
+	case BudgetScopeProject:
+		required, forbidden = []string{b.WorkspaceID, b.ProjectID}, []string{b.AgentID}
+	case BudgetScopeAgent:
+		required = []string{b.WorkspaceID, b.ProjectID, b.AgentID}
+	default:
+		return errors.New("scope must be one of tenant, workspace, project, agent")
+	}
+	for _, id := range required {
+		if id == "" {
+			return fmt.Errorf("a %s budget requires %s", b.Scope, scopeIDs(b.Scope))
+		}
+	}
+	for _, id := range forbidden {
+		if id != "" {
+			return fmt.Errorf("a %s budget takes only %s", b.Scope, scopeIDs(b.Scope))
+		}
+	}
+
+	return validateBudgetTerms(b.Name, b.Period, b.LimitUSD, b.Enforcement)
+}
+
+// Validate checks the replacement terms.
+func (u BudgetUpdate) Validate() error {
+	return validateBudgetTerms(u.Name, u.Period, u.LimitUSD, u.Enforcement)
+}
+
+// Matches reports whether an event with these ids counts against the budget.
+func (b Budget) Matches(tenantID, workspaceID, projectID, agentID string) bool {
+	return b.TenantID == tenantID &&
+		(b.WorkspaceID == "" || b.WorkspaceID == workspaceID) &&
+		(b.ProjectID == "" || b.ProjectID == projectID) &&
+		(b.AgentID == "" || b.AgentID == agentID)
+}
+
+// Result classifies spend against the limit.
+func (b Budget) Result(spentUSD float64) string {
+	if spentUSD < b.LimitUSD || (spentUSD == 0 && b.LimitUSD == 0) {
+		return BudgetWithinLimit
+	}
+	if b.Enforcement == BudgetEnforcementHard {
+		return BudgetHardLimitBlocked
+	}
+	return BudgetSoftLimitExceeded
+}
+
+// Crossed reports whether spend has reached pct percent of the limit. No
+// spend never crosses a threshold, even against a zero limit.
+func (b Budget) Crossed(spentUSD float64, pct int) bool {
+	return spentUSD > 0 && spentUSD*100 >= b.LimitUSD*float64(pct)
+}
+
+// CheckResult classifies spending estimateUSD on top of spentUSD. Spending up
+// to the limit is allowed; a budget already at its limit admits nothing more.
+func (b Budget) CheckResult(spentUSD float64, estimateUSD float64) string {
+	if spentUSD+estimateUSD <= b.LimitUSD && b.Result(spentUSD) == BudgetWithinLimit {
+		return BudgetCheckAllow
+	}
+	if b.Enforcement == BudgetEnforcementHard {
+		return BudgetHardLimitBlocked
+	}
+	return BudgetSoftLimitExceeded
+}
+
+// NewBudgetHeadroom reports spend and reservations against b ahead of a
+// check for estimateUSD. Reserved spend counts as spent.
+func NewBudgetHeadroom(b Budget, periodEnd time.Time, spentUSD float64, reservedUSD float64, estimateUSD float64) BudgetHeadroom {
+	committed := spentUSD + reservedUSD
+	return BudgetHeadroom{
+		BudgetID:     b.BudgetID,
+		Scope:        b.Scope,
+		Period:       b.Period,
+		Enforcement:  b.Enforcement,
+		LimitUSD:     b.LimitUSD,
+		SpentUSD:     spentUSD,
+		ReservedUSD:  reservedUSD,
+		PeriodEnd:    periodEnd,
+		RemainingUSD: math.Max(b.LimitUSD-committed, 0),
+		Result:       b.CheckResult(committed, estimateUSD),
+	}
+}
+
+// NewBudgetCheck combines the per-budget headrooms of a check.
+func NewBudgetCheck(estimateUSD float64, headrooms []BudgetHeadroom) BudgetCheck {
+	check := BudgetCheck{Result: BudgetCheckAllow, EstimatedCostUSD: estimateUSD, Budgets: headrooms}
+	if check.Budgets == nil {
+		check.Budgets = []BudgetHeadroom{}
+	}
+	for _, h := range headrooms {
+		if check.RemainingUSD == nil || h.RemainingUSD < *check.RemainingUSD {
+			remaining := h.RemainingUSD
+			check.RemainingUSD = &remaining
+		}
+		if checkSeverity(h.Result) > checkSeverity(check.Result) {
+			check.Result = h.Result
+		}
+	}
+	return check
+}
+
+func checkSeverity(result string) int {
+	switch result {
+	case BudgetHardLimitBlocked:
+		return 2
+	case BudgetSoftLimitExceeded:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// NewBudgetStatus summarizes spend in the period [start, end).
+func NewBudgetStatus(b Budget, start time.Time, end time.Time, spentUSD float64) BudgetStatus {
+	status := BudgetStatus{
+		Budget:       b,
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		SpentUSD:     spentUSD,
+		RemainingUSD: math.Max(b.LimitUSD-spentUSD, 0),
+		Result:       b.Result(spentUSD),
+	}
+	if b.LimitUSD > 0 {
+		status.UtilizationPct = spentUSD / b.LimitUSD * 100
+	} else if spentUSD > 0 {
+		status.UtilizationPct = 100
+	}
+	return status
+}
+
+// BudgetPeriodBounds returns the UTC calendar period containing now as [start, end).
+func BudgetPeriodBounds(period string, now time.Time) (time.Time, time.Time, error) {
+	now = now.UTC()
+
+	switch period {
+	case BudgetPeriodHourly:
+		start := now.Truncate(time.Hour)
+		return start, start.Add(time.Hour), nil
+	case BudgetPeriodDaily:
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1), nil
+	case BudgetPeriodWeekly:
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		start := time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 7), nil
+	case BudgetPeriodMonthly:
+		start := monthStart(now)
+		return start, start.AddDate(0, 1, 0), nil
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("unsupported budget period %q", period)
+	}
+}
+
+func validateBudgetTerms(name string, period string, limitUSD float64, enforcement string) error {
+	if len(name) > MaxBudgetNameLength {
+		return fmt.Errorf("name may be at most %d bytes", MaxBudgetNameLength)
+	}
+	if _, _, err := BudgetPeriodBounds(period, time.Time{}); err != nil {
+		return errors.New("period must be one of hourly, daily, weekly, monthly")
+	}
+	if limitUSD < 0 || math.IsNaN(limitUSD) || math.IsInf(limitUSD, 0) {
+		return errors.New("limit_usd must be a non-negative number")
+	}
+	if enforcement != BudgetEnforcementSoft && enforcement != BudgetEnforcementHard {
+		return errors.New("enforcement must be soft or hard")
+	}
+	return nil
+}
+
+func scopeIDs(scope string) string {
+	switch scope {
+	case BudgetScopeTenant:
+		return "tenant_id"
+	case BudgetScopeWorkspace:
+		return "tenant_id and workspace_id"
+	case BudgetScopeProject:
+		return "tenant_id, workspace_id and project_id"
+	default:
+		return "tenant_id, workspace_id, project_id and agent_id"
+	}
+}
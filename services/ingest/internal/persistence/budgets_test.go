@@ -0,0 +1,143 @@
+package persistence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudgetValidateScopes(t *testing.T) {
+	terms := Budget{Period: BudgetPeriodDaily, LimitUSD: 10, Enforcement: BudgetEnforcementSoft}
+	with := func(scope, workspace, project, agent string) Budget {
+		b := terms
+		b.Scope, b.TenantID, b.WorkspaceID, b.ProjectID, b.AgentID = scope, "t1", workspace, project, agent
+		return b
+	}
+
+	for _, b := range []Budget{
+		with(BudgetScopeTenant, "", "", ""),
+		with(BudgetScopeWorkspace, "w1", "", ""),
+		with(BudgetScopeProject, "w1", "p1", ""),
+		with(BudgetScopeAgent, "w1", "p1", "a1"),
+	} {
+		if err := b.Validate(); err != nil {
+			t.Fatalf("%s budget Validate() error = %v", b.Scope, err)
+		}
+	}
+
+	for want, b := range map[string]Budget{
+		"requires tenant_id, workspace_id and project_id": with(BudgetScopeProject, "w1", "", ""),
+		"takes only tenant_id":                            with(BudgetScopeTenant, "w1", "", ""),
+		"scope must be one of":                            with("org", "", "", ""),
+	} {
+		if err := b.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Validate(%+v) error = %v, want %q", b, err, want)
+		}
+	}
+
+	missingTenant := with(BudgetScopeTenant, "", "", "")
+	missingTenant.TenantID = ""
+	if err := missingTenant.Validate(); err == nil {
+		t.Fatal("expected error for missing tenant_id")
+	}
+}
+
+func TestBudgetUpdateValidateTerms(t *testing.T) {
+	for _, u := range []BudgetUpdate{
+		{Period: "yearly", LimitUSD: 1, Enforcement: BudgetEnforcementSoft},
+		{Period: BudgetPeriodDaily, LimitUSD: -1, Enforcement: BudgetEnforcementSoft},
+		{Period: BudgetPeriodDaily, LimitUSD: 1, Enforcement: "block"},
+		{Name: strings.Repeat("x", MaxBudgetNameLength+1), Period: BudgetPeriodDaily, LimitUSD: 1, Enforcement: BudgetEnforcementHard},
+	} {
+		if err := u.Validate(); err == nil {
+			t.Fatalf("Validate(%+v) = nil, want error", u)
+		}
+	}
+}
+
+func TestBudgetPeriodBounds(t *testing.T) {
+	// Sunday 1 March 2026: the week started Monday 23 February.
+	now := time.Date(2026, 3, 1, 17, 45, 0, 0, time.UTC)
+
+	for period, want := range map[string][2]time.Time{
+		BudgetPeriodHourly:  {time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 18, 0, 0, 0, time.UTC)},
+		BudgetPeriodDaily:   {time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+		BudgetPeriodWeekly:  {time.Date(2026, 2, 23, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+		BudgetPeriodMonthly: {time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		start, end, err := BudgetPeriodBounds(period, now)
+		if err != nil {
+			t.Fatalf("BudgetPeriodBounds(%s) error = %v", period, err)
+		}
+		if !start.Equal(want[0]) || !end.Equal(want[1]) {
+			t.Fatalf("BudgetPeriodBounds(%s) = %v..%v, want %v..%v", period, start, end, want[0], want[1])
+		}
+	}
+}
+
+func TestNewBudgetStatus(t *testing.T) {
+	soft := Budget{LimitUSD: 100, Enforcement: BudgetEnforcementSoft}
+	hard := Budget{LimitUSD: 100, Enforcement: BudgetEnforcementHard}
+
+	if s := NewBudgetStatus(soft, time.Time{}, time.Time{}, 40); s.Result != BudgetWithinLimit || s.RemainingUSD != 60 || s.UtilizationPct != 40 {
+		t.Fatalf("status = %+v", s)
+	}
+	if s := NewBudgetStatus(soft, time.Time{}, time.Time{}, 120); s.Result != BudgetSoftLimitExceeded || s.RemainingUSD != 0 || s.UtilizationPct != 120 {
+		t.Fatalf("status = %+v", s)
+	}
+	if s := NewBudgetStatus(hard, time.Time{}, time.Time{}, 100); s.Result != BudgetHardLimitBlocked {
+		t.Fatalf("status = %+v, want hard limit reached at exactly the limit", s)
+	}
+	if s := NewBudgetStatus(Budget{Enforcement: BudgetEnforcementHard}, time.Time{}, time.Time{}, 0.01); s.Result != BudgetHardLimitBlocked || s.UtilizationPct != 100 {
+		t.Fatalf("status = %+v, want any spend to exhaust a zero budget", s)
+	}
+}
+
+func TestBudgetMatches(t *testing.T) {
+	project := Budget{TenantID: "t1", WorkspaceID: "w1", ProjectID: "p1"}
+
+	if !project.Matches("t1", "w1", "p1", "any-agent") {
+		t.Fatal("project budget must match every agent in the project")
+	}
+	if project.Matches("t1", "w1", "p2", "any-agent") || project.Matches("t2", "w1", "p1", "") {
+		t.Fatal("project budget must not match other projects or tenants")
+	}
+}
+
+func TestBudgetCrossed(t *testing.T) {
+	b := Budget{LimitUSD: 250}
+
+	if !b.Crossed(200, 80) || b.Crossed(199.99, 80) || !b.Crossed(250, 100) {
+		t.Fatal("crossing must be inclusive of the threshold amount")
+	}
+	zero := Budget{}
+	if zero.Crossed(0, 50) || !zero.Crossed(0.01, 100) {
+		t.Fatal("a zero budget is crossed by any spend and only by spend")
+	}
+}
+
+func TestBudgetCheckResult(t *testing.T) {
+	hard := Budget{LimitUSD: 100, Enforcement: BudgetEnforcementHard}
+	soft := Budget{LimitUSD: 100, Enforcement: BudgetEnforcementSoft}
+
+	if got := hard.CheckResult(90, 10); got != BudgetCheckAllow {
+		t.Fatalf("CheckResult(90, 10) = %q, want spending up to the limit allowed", got)
+	}
+	if got := hard.CheckResult(90, 10.5); got != BudgetHardLimitBlocked {
+		t.Fatalf("CheckResult(90, 10.5) = %q", got)
+	}
+	if got := hard.CheckResult(100, 0); got != BudgetHardLimitBlocked {
+		t.Fatalf("CheckResult(100, 0) = %q, want nothing admitted at the limit", got)
+	}
+	if got := soft.CheckResult(90, 20); got != BudgetSoftLimitExceeded {
+		t.Fatalf("soft CheckResult(90, 20) = %q", got)
+	}
+
+	check := NewBudgetCheck(20, []BudgetHeadroom{
+		NewBudgetHeadroom(soft, time.Time{}, 80, 10, 20),
+		NewBudgetHeadroom(Budget{LimitUSD: 500, Enforcement: BudgetEnforcementHard}, time.Time{}, 0, 0, 20),
+	})
+	if check.Result != BudgetSoftLimitExceeded || *check.RemainingUSD != 10 {
+		t.Fatalf("check = %+v, want the soft budget's result and headroom", check)
+	}
+}
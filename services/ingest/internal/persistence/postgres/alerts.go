@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const alertRuleColumns = `rule_id, name, alert_type, scope, tenant_id, workspace_id, project_id, agent_id, workflow_id,
+  metric, comparison, threshold, window_seconds, for_seconds, created_at`
+
+const prefixedAlertRuleColumns = `r.rule_id, r.name, r.alert_type, r.scope, r.tenant_id, r.workspace_id, r.project_id,
+  r.agent_id, r.workflow_id, r.metric, r.comparison, r.threshold, r.window_seconds, r.for_seconds, r.created_at`
+
+// alertStateColumns are NULL for a rule that has not been evaluated.
+const alertStateColumns = `s.state, s.alert_id, s.pending_since, s.changed_at, s.last_value, s.evaluated_at, s.notified`
+
+const createAlertRuleSQL = `
+INSERT INTO alert_rules (name, alert_type, scope, tenant_id, workspace_id, project_id, agent_id, workflow_id,
+  metric, comparison, threshold, window_seconds, for_seconds)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+RETURNING ` + alertRuleColumns
+
+const selectAlertRuleSQL = `
+SELECT ` + prefixedAlertRuleColumns + `, ` + alertStateColumns + `
+FROM alert_rules r
+LEFT JOIN alert_states s ON s.rule_id = r.rule_id
+WHERE r.rule_id = $1
+`
+
+const deleteAlertRuleSQL = `DELETE FROM alert_rules WHERE rule_id = $1`
+
+const saveAlertStateSQL = `
+INSERT INTO alert_states (rule_id, state, alert_id, pending_since, changed_at, last_value, evaluated_at, notified)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (rule_id) DO UPDATE SET
+  state = EXCLUDED.state,
+  alert_id = EXCLUDED.alert_id,
+  pending_since = EXCLUDED.pending_since,
+  changed_at = EXCLUDED.changed_at,
+  last_value = EXCLUDED.last_value,
+  evaluated_at = EXCLUDED.evaluated_at,
+  notified = EXCLUDED.notified
+`
+
+// CreateAlertRule stores a validated alert rule.
+func (s *Store) CreateAlertRule(ctx context.Context, rule persistence.AlertRule) (persistence.AlertRule, error) {
+	if s == nil || s.db == nil || s.queryRow == nil {
+		return persistence.AlertRule{}, errors.New("event store is not configured")
+	}
+
+	var created persistence.AlertRule
+	err := s.queryRow(ctx, createAlertRuleSQL,
+		rule.Name, rule.AlertType, rule.Scope, rule.TenantID, rule.WorkspaceID, rule.ProjectID, rule.AgentID, rule.WorkflowID,
+		rule.Metric, rule.Comparison, rule.Threshold, rule.WindowSeconds, rule.ForSeconds,
+	).Scan(alertRuleDest(&created)...)
+	if err != nil {
+		return persistence.AlertRule{}, fmt.Errorf("create alert rule: %w", err)
+	}
+	return created, nil
+}
+
+// ListAlertRules returns rules matching filter with their current state,
+// grouped by tenant and oldest first.
+func (s *Store) ListAlertRules(ctx context.Context, filter persistence.AlertRuleFilter) ([]persistence.AlertRule, error) {
+	if s == nil || s.db == nil || s.queryRows == nil {
+		return nil, errors.New("event store is not configured")
+	}
+
+	query, args := buildListAlertRulesQuery(filter)
+	rows, err := s.queryRows(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]persistence.AlertRule, 0)
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan alert rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query alert rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetAlertRule loads a rule with its current state. It returns
+// persistence.ErrNotFound when no rule has ruleID.
+func (s *Store) GetAlertRule(ctx context.Context, ruleID string) (persistence.AlertRule, error) {
+	if s == nil || s.db == nil || s.queryRow == nil {
+		return persistence.AlertRule{}, errors.New("event store is not configured")
+	}
+
+	rule, err := scanAlertRule(s.queryRow(ctx, selectAlertRuleSQL, ruleID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return persistence.AlertRule{}, persistence.ErrNotFound
+	}
+	if err != nil {
+		return persistence.AlertRule{}, fmt.Errorf("query alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// DeleteAlertRule removes a rule and its state. It returns
+// persistence.ErrNotFound when no rule has ruleID.
+func (s *Store) DeleteAlertRule(ctx context.Context, ruleID string) error {
+	if s == nil || s.db == nil {
+		return errors.New("event store is not configured")
+	}
+
+	result, err := s.db.ExecContext(ctx, deleteAlertRuleSQL, ruleID)
+	if err != nil {
+		return fmt.Errorf("delete alert rule: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("read delete rows affected: %w", err)
+	}
+	if deleted == 0 {
+		return persistence.ErrNotFound
+	}
+	return nil
+}
+
+// SaveAlertState records a rule's evaluation state, replacing the previous one.
+func (s *Store) SaveAlertState(ctx context.Context, state persistence.AlertState) error {
+	if s == nil || s.db == nil {
+		return errors.New("event store is not configured")
+	}
+
+	if _, err := s.db.ExecContext(ctx, saveAlertStateSQL,
+		state.RuleID, state.State, state.AlertID, state.PendingSince, state.ChangedAt,
+		state.LastValue, state.EvaluatedAt, state.Notified,
+	); err != nil {
+		return fmt.Errorf("save alert state: %w", err)
+	}
+	return nil
+}
+
+func alertRuleDest(r *persistence.AlertRule) []any {
+	return []any{
+		&r.RuleID, &r.Name, &r.AlertType, &r.Scope, &r.TenantID, &r.WorkspaceID, &r.ProjectID, &r.AgentID, &r.WorkflowID,
+		&r.Metric, &r.Comparison, &r.Threshold, &r.WindowSeconds, &r.ForSeconds, &r.CreatedAt,
+	}
+}
+
+// scanAlertRule scans a rule joined with its state columns.
+func scanAlertRule(row rowScanner) (persistence.AlertRule, error) {
+	var r persistence.AlertRule
+	var state, alertID *string
+	var pendingSince, changedAt, evaluatedAt *time.Time
+	var lastValue *float64
+	var notified *bool
+
+	dest := append(alertRuleDest(&r), &state, &alertID, &pendingSince, &changedAt, &lastValue, &evaluatedAt, &notified)
+	if err := row.Scan(dest...); err != nil {
+		return r, err
+	}
+	if state != nil {
+		r.State = &persistence.AlertState{
+			RuleID:       r.RuleID,
+			State:        *state,
+			PendingSince: pendingSince,
+			LastValue:    lastValue,
+		}
+		if alertID != nil {
+			r.State.AlertID = *alertID
+		}
+		if changedAt != nil {
+			r.State.ChangedAt = *changedAt
+		}
+		if evaluatedAt != nil {
+			r.State.EvaluatedAt = *evaluatedAt
+		}
+		if notified != nil {
+			r.State.Notified = *notified
+		}
+	}
+	return r, nil
+}
+
+func buildListAlertRulesQuery(filter persistence.AlertRuleFilter) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 2)
+
+	b.WriteString("SELECT " + prefixedAlertRuleColumns + ", " + alertStateColumns + `
+FROM alert_rules r
+LEFT JOIN alert_states s ON s.rule_id = r.rule_id
+WHERE TRUE`)
+	if filter.TenantID != "" {
+		args = append(args, filter.TenantID)
+		b.WriteString(fmt.Sprintf(" AND r.tenant_id = $%d", len(args)))
+	}
+	if filter.AlertType != "" {
+		args = append(args, filter.AlertType)
+		b.WriteString(fmt.Sprintf(" AND r.alert_type = $%d", len(args)))
+	}
+	b.WriteString("\nORDER BY r.tenant_id, r.created_at, r.rule_id\n")
+
+	return b.String(), args
+}
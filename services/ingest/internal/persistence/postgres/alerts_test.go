@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+func alertRuleValues(ruleID string) []any {
+	at := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	return []any{
+		ruleID, "", "error_rate_spike", "project", "tenant-1", "workspace-1", "project-1", "", "",
+		"error_rate", "gt", 5.0, 900, 300, at,
+	}
+}
+
+func TestListAlertRulesJoinsState(t *testing.T) {
+	changed := time.Date(2026, 2, 7, 12, 5, 0, 0, time.UTC)
+	var query string
+	var args []any
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, q string, a ...any) (rowsScanner, error) {
+			query, args = q, a
+			return &valuesRows{rows: [][]any{
+				append(alertRuleValues("rule-1"), nil, nil, nil, nil, nil, nil, nil),
+				append(alertRuleValues("rule-2"), "firing", "rule-2-20260207T120500Z", nil, changed, 7.5, changed, true),
+			}}, nil
+		},
+	}
+
+	rules, err := store.ListAlertRules(context.Background(), persistence.AlertRuleFilter{TenantID: "tenant-1"})
+	if err != nil {
+		t.Fatalf("ListAlertRules() error = %v", err)
+	}
+	if len(rules) != 2 || rules[0].State != nil {
+		t.Fatalf("rules = %+v, want an unevaluated rule without state", rules)
+	}
+	state := rules[1].State
+	if state == nil || state.State != "firing" || *state.LastValue != 7.5 || !state.ChangedAt.Equal(changed) || !state.Notified {
+		t.Fatalf("state = %+v", state)
+	}
+	if !strings.Contains(query, "LEFT JOIN alert_states") || !strings.Contains(query, "r.tenant_id = $1") || len(args) != 1 {
+		t.Fatalf("query = %s, args = %v", query, args)
+	}
+}
+
+func TestGetAlertRuleNotFound(t *testing.T) {
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(context.Context, string, ...any) rowScanner {
+			return valuesRow{err: sql.ErrNoRows}
+		},
+	}
+
+	if _, err := store.GetAlertRule(context.Background(), "missing"); !errors.Is(err, persistence.ErrNotFound) {
+		t.Fatalf("GetAlertRule() error = %v, want ErrNotFound", err)
+	}
+	if err := (&Store{db: &fakeDB{result: fakeResult{rows: 0}}}).DeleteAlertRule(context.Background(), "missing"); !errors.Is(err, persistence.ErrNotFound) {
+		t.Fatalf("DeleteAlertRule() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSaveAlertStateUpserts(t *testing.T) {
+	db := &fakeDB{result: fakeResult{rows: 1}}
+	store := &Store{db: db}
+	at := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+
+	err := store.SaveAlertState(context.Background(), persistence.AlertState{
+		RuleID: "rule-1", State: persistence.AlertStateResolved, AlertID: "alert-1", ChangedAt: at, EvaluatedAt: at,
+	})
+	if err != nil {
+		t.Fatalf("SaveAlertState() error = %v", err)
+	}
+	if !strings.Contains(db.query, "ON CONFLICT (rule_id) DO UPDATE") || db.args[1] != persistence.AlertStateResolved || db.args[7] != false {
+		t.Fatalf("query = %s, args = %v", db.query, db.args)
+	}
+}
+
+func TestCountPolicyViolationsFiltersScope(t *testing.T) {
+	var query string
+	var args []any
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, q string, a ...any) rowScanner {
+			query, args = q, a
+			return valuesRow{values: []any{int64(4)}}
+		},
+	}
+	start := time.Date(2026, 2, 7, 11, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	count, err := store.CountPolicyViolations(context.Background(), persistence.OverviewFilter{
+		Start: &start, End: &end, TenantID: "tenant-1", WorkflowID: "wf-1",
+	})
+	if err != nil || count != 4 {
+		t.Fatalf("CountPolicyViolations() = %d, %v", count, err)
+	}
+	for _, want := range []string{"event_type = 'policy.decision'", "'decision' = 'block'", "tenant_id = $3", "workflow_id = $4"} {
+		if !strings.Contains(query, want) {
+			t.Fatalf("query missing %q:\n%s", want, query)
+		}
+	}
+	if len(args) != 4 || args[0] != start || args[1] != end {
+		t.Fatalf("args = %v", args)
+	}
+}
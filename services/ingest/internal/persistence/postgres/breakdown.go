@@ -0,0 +1,235 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const (
+	defaultBreakdownLimit = 10
+	maxBreakdownLimit     = 100
+)
+
+// breakdownSource describes how one group_by dimension aggregates: which
+// rows it reads, the grouping key, and what counts as success or failure.
+// rollupKind and rollupKey select the same rows and key from rollups.
+type breakdownSource struct {
+	unit       string
+	sql        string
+	rollupKind string
+	rollupKey  string
+}
+
+// Each source selects group_key, the counters, and latency sum/count so the
+// "other" bucket can average over its members' runs rather than their averages.
+const (
+	runBreakdownSQL = `
+  SELECT
+    %s AS group_key,
+    COUNT(*) AS total,
+    COUNT(*) FILTER (WHERE status = 'success') AS successful,
+    COUNT(*) FILTER (WHERE status = 'failure') AS failed,
+    COALESCE(SUM(total_cost_usd), 0) AS cost_usd,
+    COALESCE(SUM(total_tokens), 0) AS tokens,
+    COALESCE(SUM(latency_ms), 0) AS latency_sum,
+    COUNT(latency_ms) AS latency_count
+  FROM runs
+  WHERE status <> 'started' AND ended_at >= $1 AND ended_at <= $2`
+
+	modelCallBreakdownSQL = `
+  SELECT
+    %s AS group_key,
+    COUNT(*) AS total,
+    COUNT(*) FILTER (WHERE event_type = 'model.call.completed') AS successful,
+    COUNT(*) FILTER (WHERE event_type = 'model.call.failed') AS failed,
+    COALESCE(SUM(cost_usd), 0) AS cost_usd,
+    COALESCE(SUM(total_tokens), 0) AS tokens,
+    COALESCE(SUM((payload->'step'->>'latency_ms')::NUMERIC::BIGINT), 0) AS latency_sum,
+    COUNT(payload->'step'->>'latency_ms') AS latency_count
+  FROM agent_events
+  WHERE event_type IN ('model.call.completed', 'model.call.failed') AND occurred_at >= $1 AND occurred_at <= $2`
+)
+
+// runBreakdownSource groups finished runs by column.
+func runBreakdownSource(column string) breakdownSource {
+	return breakdownSource{
+		unit:       persistence.BreakdownUnitRuns,
+		sql:        fmt.Sprintf(runBreakdownSQL, column),
+		rollupKind: "run",
+		rollupKey:  column,
+	}
+}
+
+// modelCallBreakdownSource groups model calls by a model_call payload field,
+// which rollups store as an empty string when it is missing.
+func modelCallBreakdownSource(field string) breakdownSource {
+	return breakdownSource{
+		unit:       persistence.BreakdownUnitModelCalls,
+		sql:        fmt.Sprintf(modelCallBreakdownSQL, "payload->'model_call'->>'"+field+"'"),
+		rollupKind: "model_call",
+		rollupKey:  "NULLIF(" + field + ", '')",
+	}
+}
+
+var breakdownSources = map[string]breakdownSource{
+	persistence.BreakdownTenant:    runBreakdownSource("tenant_id"),
+	persistence.BreakdownWorkspace: runBreakdownSource("workspace_id"),
+	persistence.BreakdownProject:   runBreakdownSource("project_id"),
+	persistence.BreakdownAgent:     runBreakdownSource("agent_id"),
+	persistence.BreakdownWorkflow:  runBreakdownSource("workflow_id"),
+	persistence.BreakdownProvider:  modelCallBreakdownSource("provider"),
+	persistence.BreakdownModel:     modelCallBreakdownSource("model"),
+}
+
+// GetMetricsBreakdown returns overview metrics per groupBy value, most
+// expensive first. Values beyond the top limit are folded into Other.
+// Windows longer than rollupMinWindow are read from rollups.
+func (s *Store) GetMetricsBreakdown(ctx context.Context, filter persistence.OverviewFilter, groupBy string, limit int) (persistence.MetricsBreakdown, error) {
+	var out persistence.MetricsBreakdown
+
+	if s == nil || s.db == nil || s.queryRows == nil {
+		return out, errors.New("event store is not configured")
+	}
+
+	source, ok := breakdownSources[groupBy]
+	if !ok {
+		return out, fmt.Errorf("unsupported breakdown group_by %q", groupBy)
+	}
+	if limit == 0 {
+		limit = defaultBreakdownLimit
+	}
+	if limit < 1 || limit > maxBreakdownLimit {
+		return out, fmt.Errorf("limit must be between 1 and %d", maxBreakdownLimit)
+	}
+	windowStart, windowEnd, windowHours, err := overviewWindow(filter)
+	if err != nil {
+		return out, err
+	}
+
+	var query string
+	var args []any
+	sourceName := persistence.OverviewSourceRaw
+	if windowEnd.Sub(windowStart) > rollupMinWindow {
+		plan, err := s.rollupWindowPlan(ctx, windowStart, windowEnd)
+		if err != nil {
+			return out, err
+		}
+		query, args = buildRollupBreakdownQuery(plan, filter, source, limit)
+		sourceName = persistence.OverviewSourceRollups
+	} else {
+		query, args = buildBreakdownQuery(windowStart, windowEnd, filter, source, limit)
+	}
+	rows, err := s.queryRows(ctx, query, args...)
+	if err != nil {
+		return out, fmt.Errorf("query metrics breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	filter.WindowHours = windowHours
+	out = persistence.MetricsBreakdown{
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
+		WindowHours: windowHours,
+		Filters:     filter,
+		GroupBy:     groupBy,
+		Unit:        source.unit,
+		Limit:       limit,
+		Rows:        make([]persistence.BreakdownRow, 0, limit),
+		Source:      sourceName,
+	}
+	for rows.Next() {
+		var isOther bool
+		var key *string
+		var row persistence.BreakdownRow
+		if err := rows.Scan(
+			&isOther, &key, &row.TotalRuns, &row.SuccessfulRuns, &row.FailedRuns,
+			&row.TotalCostUSD, &row.TotalTokens, &row.AvgLatencyMS,
+		); err != nil {
+			return out, fmt.Errorf("scan metrics breakdown: %w", err)
+		}
+		if row.TotalRuns > 0 {
+			row.SuccessRate = (float64(row.SuccessfulRuns) / float64(row.TotalRuns)) * 100
+		}
+
+		if isOther {
+			out.Other = &row
+			continue
+		}
+		if key != nil {
+			row.Key = *key
+		}
+		out.Rows = append(out.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return out, fmt.Errorf("query metrics breakdown: %w", err)
+	}
+
+	return out, nil
+}
+
+func buildBreakdownQuery(windowStart time.Time, windowEnd time.Time, filter persistence.OverviewFilter, source breakdownSource, limit int) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 8)
+
+	b.WriteString("\nWITH grouped AS (")
+	b.WriteString(source.sql)
+	args = append(args, windowStart, windowEnd, limit)
+	args = appendOverviewFilters(&b, args, filter)
+
+	b.WriteString("\n  GROUP BY group_key\n)," + breakdownRankSQL(3))
+
+	return b.String(), args
+}
+
+// buildRollupBreakdownQuery groups the plan's rollup segments of the source's
+// kind by its rollup key, ranking them like buildBreakdownQuery.
+func buildRollupBreakdownQuery(plan rollupPlan, filter persistence.OverviewFilter, source breakdownSource, limit int) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 25)
+
+	b.WriteString(`
+WITH grouped AS (
+  SELECT
+    ` + source.rollupKey + ` AS group_key,
+    SUM(total_count) AS total,
+    SUM(success_count) AS successful,
+    SUM(failure_count) AS failed,
+    COALESCE(SUM(cost_usd), 0) AS cost_usd,
+    COALESCE(SUM(total_tokens), 0) AS tokens,
+    COALESCE(SUM(latency_sum_ms), 0) AS latency_sum,
+    COALESCE(SUM(latency_count), 0) AS latency_count
+  FROM (`)
+	args = appendRollupSegments(&b, args, plan, filter)
+	args = append(args, limit)
+	b.WriteString("\n  ) segments\n  WHERE kind = '" + source.rollupKind + "'\n  GROUP BY group_key\n)," + breakdownRankSQL(len(args)))
+
+	return b.String(), args
+}
+
+// breakdownRankSQL folds the grouped CTE into the top limitArg keys by cost
+// plus one "other" row. Ties on cost rank by key so the cut is deterministic.
+func breakdownRankSQL(limitArg int) string {
+	return fmt.Sprintf(`
+ranked AS (
+  SELECT grouped.*, ROW_NUMBER() OVER (ORDER BY cost_usd DESC, group_key) AS cost_rank
+  FROM grouped
+)
+SELECT
+  cost_rank > $%[1]d AS is_other,
+  CASE WHEN cost_rank <= $%[1]d THEN group_key END AS group_key,
+  SUM(total)::BIGINT AS total,
+  SUM(successful)::BIGINT AS successful,
+  SUM(failed)::BIGINT AS failed,
+  SUM(cost_usd) AS cost_usd,
+  SUM(tokens)::BIGINT AS tokens,
+  COALESCE(SUM(latency_sum)::DOUBLE PRECISION / NULLIF(SUM(latency_count), 0), 0) AS avg_latency_ms
+FROM ranked
+GROUP BY 1, 2
+ORDER BY is_other, cost_usd DESC, group_key
+`, limitArg)
+}
@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+func TestGetMetricsBreakdownSplitsTopAndOther(t *testing.T) {
+	var captured recordedQuery
+
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, query string, args ...any) (rowsScanner, error) {
+			captured = recordedQuery{query: query, args: args}
+			return &valuesRows{rows: [][]any{
+				{false, "agent-a", int64(10), int64(9), int64(1), 5.0, int64(5000), 120.0},
+				{false, "agent-b", int64(4), int64(2), int64(2), 2.0, int64(800), 300.0},
+				{true, nil, int64(6), int64(6), int64(0), 0.5, int64(60), 50.0},
+			}}, nil
+		},
+	}
+
+	breakdown, err := store.GetMetricsBreakdown(context.Background(), persistence.OverviewFilter{TenantID: "tenant-1"}, persistence.BreakdownAgent, 2)
+	if err != nil {
+		t.Fatalf("GetMetricsBreakdown() error = %v", err)
+	}
+
+	if !strings.Contains(captured.query, "agent_id AS group_key") || !strings.Contains(captured.query, "FROM runs") || !strings.Contains(captured.query, "tenant_id = $4") {
+		t.Fatalf("breakdown query = %s", captured.query)
+	}
+	if captured.args[2] != 2 {
+		t.Fatalf("limit arg = %v, want 2", captured.args[2])
+	}
+
+	if breakdown.Unit != persistence.BreakdownUnitRuns || breakdown.Limit != 2 || len(breakdown.Rows) != 2 {
+		t.Fatalf("breakdown = %+v", breakdown)
+	}
+	if row := breakdown.Rows[1]; row.Key != "agent-b" || row.SuccessRate != 50 || row.AvgLatencyMS != 300 {
+		t.Fatalf("second row = %+v", row)
+	}
+	if breakdown.Other == nil || breakdown.Other.TotalRuns != 6 || breakdown.Other.SuccessRate != 100 || breakdown.Other.Key != "" {
+		t.Fatalf("other = %+v", breakdown.Other)
+	}
+}
+
+func TestGetMetricsBreakdownByModelReadsModelCalls(t *testing.T) {
+	var captured string
+
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, query string, _ ...any) (rowsScanner, error) {
+			captured = query
+			return &valuesRows{}, nil
+		},
+	}
+
+	breakdown, err := store.GetMetricsBreakdown(context.Background(), persistence.OverviewFilter{}, persistence.BreakdownModel, 0)
+	if err != nil {
+		t.Fatalf("GetMetricsBreakdown() error = %v", err)
+	}
+
+	if !strings.Contains(captured, "payload->'model_call'->>'model' AS group_key") || !strings.Contains(captured, "FROM agent_events") {
+		t.Fatalf("breakdown query = %s", captured)
+	}
+	if breakdown.Unit != persistence.BreakdownUnitModelCalls || breakdown.Limit != defaultBreakdownLimit {
+		t.Fatalf("breakdown = %+v", breakdown)
+	}
+	if breakdown.Rows == nil || len(breakdown.Rows) != 0 || breakdown.Other != nil {
+		t.Fatalf("empty breakdown = %+v, want empty rows and no other bucket", breakdown)
+	}
+}
+
+func TestGetMetricsBreakdownByProviderReadsRollupsForLongWindows(t *testing.T) {
+	end := time.Now().UTC()
+	start := end.Add(-7 * 24 * time.Hour)
+
+	var captured recordedQuery
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
+			return valuesRow{values: []any{end.Add(-10 * time.Minute)}}
+		},
+		queryRows: func(_ context.Context, query string, args ...any) (rowsScanner, error) {
+			captured = recordedQuery{query: query, args: args}
+			return &valuesRows{rows: [][]any{
+				{false, "openai", int64(5), int64(4), int64(1), 3.0, int64(900), 200.0},
+			}}, nil
+		},
+	}
+
+	breakdown, err := store.GetMetricsBreakdown(context.Background(), persistence.OverviewFilter{Start: &start, End: &end, TenantID: "tenant-1"}, persistence.BreakdownProvider, 5)
+	if err != nil {
+		t.Fatalf("GetMetricsBreakdown() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"NULLIF(provider, '') AS group_key",
+		"FROM rollups_daily",
+		"WHERE kind = 'model_call'",
+		"cost_rank > $14",
+	} {
+		if !strings.Contains(captured.query, want) {
+			t.Fatalf("breakdown query missing %q:\n%s", want, captured.query)
+		}
+	}
+	if len(captured.args) != 14 || captured.args[13] != 5 {
+		t.Fatalf("args = %v, want the limit last", captured.args)
+	}
+	if breakdown.Source != persistence.OverviewSourceRollups || len(breakdown.Rows) != 1 || breakdown.Rows[0].Key != "openai" || breakdown.Rows[0].SuccessRate != 80 {
+		t.Fatalf("breakdown = %+v", breakdown)
+	}
+}
@@ -0,0 +1,344 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const budgetColumns = `budget_id, name, scope, tenant_id, workspace_id, project_id, agent_id,
+  period, limit_usd, enforcement, version, created_at, updated_at`
+
+// recordBudgetVersionSQL appends the row returned by a budgets write to budget_versions.
+const recordBudgetVersionSQL = `
+versioned AS (
+  INSERT INTO budget_versions (budget_id, version, name, period, limit_usd, enforcement, created_at)
+  SELECT budget_id, version, name, period, limit_usd, enforcement, updated_at FROM written
+)
+SELECT ` + budgetColumns + ` FROM written
+`
+
+const createBudgetSQL = `
+WITH written AS (
+  INSERT INTO budgets (name, scope, tenant_id, workspace_id, project_id, agent_id, period, limit_usd, enforcement)
+  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+  RETURNING ` + budgetColumns + `
+),` + recordBudgetVersionSQL
+
+const updateBudgetSQL = `
+WITH written AS (
+  UPDATE budgets
+  SET name = $2, period = $3, limit_usd = $4, enforcement = $5, version = version + 1, updated_at = NOW()
+  WHERE budget_id = $1 AND ($6::INTEGER IS NULL OR version = $6)
+  RETURNING ` + budgetColumns + `
+),` + recordBudgetVersionSQL
+
+const selectBudgetSQL = `SELECT ` + budgetColumns + ` FROM budgets WHERE budget_id = $1`
+
+const selectBudgetVersionsSQL = `
+SELECT version, name, period, limit_usd, enforcement, created_at
+FROM budget_versions
+WHERE budget_id = $1
+ORDER BY version
+`
+
+const deleteBudgetSQL = `DELETE FROM budgets WHERE budget_id = $1`
+
+// claimBudgetThresholdSQL records a crossing unless it was already claimed
+// and returns the stored claim either way. The second SELECT runs against the
+// statement's snapshot, so it only finds a row the INSERT skipped.
+const claimBudgetThresholdSQL = `
+WITH claimed AS (
+  INSERT INTO budget_threshold_hits (budget_id, period_start, threshold_pct, event_id, occurred_at, spent_usd)
+  VALUES ($1, $2, $3, $4, $5, $6)
+  ON CONFLICT (budget_id, period_start, threshold_pct) DO NOTHING
+  RETURNING event_id::TEXT, occurred_at, spent_usd, emitted_at IS NOT NULL
+)
+SELECT * FROM claimed
+UNION ALL
+SELECT event_id::TEXT, occurred_at, spent_usd, emitted_at IS NOT NULL
+FROM budget_threshold_hits
+WHERE budget_id = $1 AND period_start = $2 AND threshold_pct = $3
+LIMIT 1
+`
+
+const markBudgetThresholdEmittedSQL = `
+UPDATE budget_threshold_hits
+SET emitted_at = NOW()
+WHERE budget_id = $1 AND period_start = $2 AND threshold_pct = $3 AND emitted_at IS NULL
+`
+
+// spendEventsSQL selects the events whose cost_usd is spend: completed and
+// failed model and tool calls, plus the terminal event of runs that reported
+// no call costs. A run's cost therefore counts once whether it is reported
+// per call or only on run.completed/run.failed.
+const spendEventsSQL = `cost_usd IS NOT NULL AND (
+    event_type IN ('model.call.completed', 'model.call.failed', 'tool.call.completed', 'tool.call.failed')
+    OR (event_type IN ('run.completed', 'run.failed') AND NOT EXISTS (
+      SELECT 1 FROM agent_events calls
+      WHERE calls.tenant_id = agent_events.tenant_id
+        AND calls.run_id = agent_events.run_id
+        AND calls.cost_usd IS NOT NULL
+        AND calls.event_type IN ('model.call.completed', 'model.call.failed', 'tool.call.completed', 'tool.call.failed')
+    ))
+  )`
+
+// CreateBudget stores a validated budget as version 1.
+func (s *Store) CreateBudget(ctx context.Context, budget persistence.Budget) (persistence.Budget, error) {
+	if s == nil || s.db == nil || s.queryRow == nil {
+		return persistence.Budget{}, errors.New("event store is not configured")
+	}
+
+	created, err := scanBudget(s.queryRow(ctx, createBudgetSQL,
+		budget.Name, budget.Scope, budget.TenantID, budget.WorkspaceID, budget.ProjectID, budget.AgentID,
+		budget.Period, budget.LimitUSD, budget.Enforcement,
+	))
+	if err != nil {
+		return persistence.Budget{}, fmt.Errorf("create budget: %w", err)
+	}
+	return created, nil
+}
+
+// ListBudgets returns budgets matching filter, grouped by tenant and oldest first.
+func (s *Store) ListBudgets(ctx context.Context, filter persistence.BudgetFilter) ([]persistence.Budget, error) {
+	if s == nil || s.db == nil || s.queryRows == nil {
+		return nil, errors.New("event store is not configured")
+	}
+
+	query, args := buildListBudgetsQuery(filter)
+	rows, err := s.queryRows(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query budgets: %w", err)
+	}
+	defer rows.Close()
+
+	budgets := make([]persistence.Budget, 0)
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan budget: %w", err)
+		}
+		budgets = append(budgets, budget)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query budgets: %w", err)
+	}
+	return budgets, nil
+}
+
+// GetBudget loads a budget and its version history. It returns
+// persistence.ErrNotFound when no budget has budgetID.
+func (s *Store) GetBudget(ctx context.Context, budgetID string) (persistence.BudgetDetail, error) {
+	var out persistence.BudgetDetail
+
+	if s == nil || s.db == nil || s.queryRow == nil || s.queryRows == nil {
+		return out, errors.New("event store is not configured")
+	}
+
+	budget, err := s.getBudget(ctx, budgetID)
+	if err != nil {
+		return out, err
+	}
+
+	rows, err := s.queryRows(ctx, selectBudgetVersionsSQL, budgetID)
+	if err != nil {
+		return out, fmt.Errorf("query budget versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make([]persistence.BudgetVersion, 0, budget.Version)
+	for rows.Next() {
+		var v persistence.BudgetVersion
+		if err := rows.Scan(&v.Version, &v.Name, &v.Period, &v.LimitUSD, &v.Enforcement, &v.CreatedAt); err != nil {
+			return out, fmt.Errorf("scan budget version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return out, fmt.Errorf("query budget versions: %w", err)
+	}
+
+	return persistence.BudgetDetail{Budget: budget, Versions: versions}, nil
+}
+
+// UpdateBudget replaces a budget's terms and records the new version. It
+// returns persistence.ErrNotFound for a missing budget and
+// persistence.ErrVersionConflict when update.ExpectedVersion is stale.
+func (s *Store) UpdateBudget(ctx context.Context, budgetID string, update persistence.BudgetUpdate) (persistence.Budget, error) {
+	if s == nil || s.db == nil || s.queryRow == nil {
+		return persistence.Budget{}, errors.New("event store is not configured")
+	}
+
+	updated, err := scanBudget(s.queryRow(ctx, updateBudgetSQL,
+		budgetID, update.Name, update.Period, update.LimitUSD, update.Enforcement, update.ExpectedVersion,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Nothing matched: either the budget is gone or its version moved on.
+		if _, getErr := s.getBudget(ctx, budgetID); getErr != nil {
+			return persistence.Budget{}, getErr
+		}
+		return persistence.Budget{}, persistence.ErrVersionConflict
+	}
+	if err != nil {
+		return persistence.Budget{}, fmt.Errorf("update budget: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteBudget removes a budget and its history. It returns
+// persistence.ErrNotFound when no budget has budgetID.
+func (s *Store) DeleteBudget(ctx context.Context, budgetID string) error {
+	if s == nil || s.db == nil {
+		return errors.New("event store is not configured")
+	}
+
+	result, err := s.db.ExecContext(ctx, deleteBudgetSQL, budgetID)
+	if err != nil {
+		return fmt.Errorf("delete budget: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("read delete rows affected: %w", err)
+	}
+	if deleted == 0 {
+		return persistence.ErrNotFound
+	}
+	return nil
+}
+
+// GetBudgetStatus computes spend in the budget's period containing now.
+func (s *Store) GetBudgetStatus(ctx context.Context, budgetID string, now time.Time) (persistence.BudgetStatus, error) {
+	if s == nil || s.db == nil || s.queryRow == nil {
+		return persistence.BudgetStatus{}, errors.New("event store is not configured")
+	}
+
+	budget, err := s.getBudget(ctx, budgetID)
+	if err != nil {
+		return persistence.BudgetStatus{}, err
+	}
+
+	periodStart, periodEnd, err := persistence.BudgetPeriodBounds(budget.Period, now)
+	if err != nil {
+		return persistence.BudgetStatus{}, err
+	}
+
+	spent, err := s.BudgetSpend(ctx, budget, periodStart, periodEnd)
+	if err != nil {
+		return persistence.BudgetStatus{}, err
+	}
+	return persistence.NewBudgetStatus(budget, periodStart, periodEnd, spent), nil
+}
+
+// BudgetSpend sums the spend events within the budget's scope in [start, end).
+func (s *Store) BudgetSpend(ctx context.Context, budget persistence.Budget, start time.Time, end time.Time) (float64, error) {
+	if s == nil || s.db == nil || s.queryRow == nil {
+		return 0, errors.New("event store is not configured")
+	}
+
+	query, args := buildBudgetSpendQuery(budget, start, end)
+	var spent float64
+	if err := s.queryRow(ctx, query, args...).Scan(&spent); err != nil {
+		return 0, fmt.Errorf("query budget spend: %w", err)
+	}
+	return spent, nil
+}
+
+// ClaimBudgetThreshold records hit as the crossing for its budget, period and
+// threshold, or returns the crossing claimed earlier with its original
+// EventID, OccurredAt and SpentUSD.
+func (s *Store) ClaimBudgetThreshold(ctx context.Context, hit persistence.BudgetThresholdHit) (persistence.BudgetThresholdHit, error) {
+	if s == nil || s.db == nil || s.queryRow == nil {
+		return persistence.BudgetThresholdHit{}, errors.New("event store is not configured")
+	}
+
+	claimed := persistence.BudgetThresholdHit{
+		BudgetID:     hit.BudgetID,
+		PeriodStart:  hit.PeriodStart,
+		ThresholdPct: hit.ThresholdPct,
+	}
+	err := s.queryRow(ctx, claimBudgetThresholdSQL,
+		hit.BudgetID, hit.PeriodStart, hit.ThresholdPct, hit.EventID, hit.OccurredAt, hit.SpentUSD,
+	).Scan(&claimed.EventID, &claimed.OccurredAt, &claimed.SpentUSD, &claimed.Emitted)
+	if err != nil {
+		return persistence.BudgetThresholdHit{}, fmt.Errorf("claim budget threshold: %w", err)
+	}
+	return claimed, nil
+}
+
+// MarkBudgetThresholdEmitted records that hit's event has been stored.
+func (s *Store) MarkBudgetThresholdEmitted(ctx context.Context, hit persistence.BudgetThresholdHit) error {
+	if s == nil || s.db == nil {
+		return errors.New("event store is not configured")
+	}
+
+	if _, err := s.db.ExecContext(ctx, markBudgetThresholdEmittedSQL, hit.BudgetID, hit.PeriodStart, hit.ThresholdPct); err != nil {
+		return fmt.Errorf("mark budget threshold emitted: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) getBudget(ctx context.Context, budgetID string) (persistence.Budget, error) {
+	budget, err := scanBudget(s.queryRow(ctx, selectBudgetSQL, budgetID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return persistence.Budget{}, persistence.ErrNotFound
+	}
+	if err != nil {
+		return persistence.Budget{}, fmt.Errorf("query budget: %w", err)
+	}
+	return budget, nil
+}
+
+func scanBudget(row rowScanner) (persistence.Budget, error) {
+	var b persistence.Budget
+	err := row.Scan(
+		&b.BudgetID, &b.Name, &b.Scope, &b.TenantID, &b.WorkspaceID, &b.ProjectID, &b.AgentID,
+		&b.Period, &b.LimitUSD, &b.Enforcement, &b.Version, &b.CreatedAt, &b.UpdatedAt,
+	)
+	return b, err
+}
+
+func buildListBudgetsQuery(filter persistence.BudgetFilter) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 5)
+
+	b.WriteString("SELECT " + budgetColumns + "\nFROM budgets\nWHERE TRUE")
+	args = appendOverviewFilters(&b, args, persistence.OverviewFilter{
+		TenantID:    filter.TenantID,
+		WorkspaceID: filter.WorkspaceID,
+		ProjectID:   filter.ProjectID,
+		AgentID:     filter.AgentID,
+	})
+	if filter.Scope != "" {
+		args = append(args, filter.Scope)
+		b.WriteString(fmt.Sprintf(" AND scope = $%d", len(args)))
+	}
+	b.WriteString("\nORDER BY tenant_id, created_at, budget_id\n")
+
+	return b.String(), args
+}
+
+// buildBudgetSpendQuery sums spend for every event under the budget's scope:
+// ids past the scope are empty and so are not filtered on.
+func buildBudgetSpendQuery(budget persistence.Budget, start time.Time, end time.Time) (string, []any) {
+	var b strings.Builder
+	args := []any{start, end}
+
+	b.WriteString(`
+SELECT COALESCE(SUM(cost_usd), 0)
+FROM agent_events
+WHERE occurred_at >= $1 AND occurred_at < $2
+  AND ` + spendEventsSQL)
+	args = appendOverviewFilters(&b, args, persistence.OverviewFilter{
+		TenantID:    budget.TenantID,
+		WorkspaceID: budget.WorkspaceID,
+		ProjectID:   budget.ProjectID,
+		AgentID:     budget.AgentID,
+	})
+
+	return b.String(), args
+}
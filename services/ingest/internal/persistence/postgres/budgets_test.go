@@ -0,0 +1,236 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+func budgetValues(budgetID string, version int) []any {
+	at := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	return []any{
+		budgetID, "", "project", "tenant-1", "workspace-1", "project-1", "",
+		"monthly", 250.0, "hard", version, at, at,
+	}
+}
+
+func TestCreateBudgetRecordsFirstVersion(t *testing.T) {
+	var query string
+	var args []any
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, q string, a ...any) rowScanner {
+			query, args = q, a
+			return valuesRow{values: budgetValues("budget-1", 1)}
+		},
+	}
+
+	created, err := store.CreateBudget(context.Background(), persistence.Budget{
+		Scope: "project", TenantID: "tenant-1", WorkspaceID: "workspace-1", ProjectID: "project-1",
+		Period: "monthly", LimitUSD: 250, Enforcement: "hard",
+	})
+	if err != nil {
+		t.Fatalf("CreateBudget() error = %v", err)
+	}
+	if created.BudgetID != "budget-1" || created.Version != 1 || created.LimitUSD != 250 {
+		t.Fatalf("created = %+v", created)
+	}
+	for _, want := range []string{"INSERT INTO budgets", "INSERT INTO budget_versions", "FROM written"} {
+		if !strings.Contains(query, want) {
+			t.Fatalf("query missing %q:\n%s", want, query)
+		}
+	}
+	if len(args) != 9 || args[1] != "project" || args[7] != 250.0 {
+		t.Fatalf("args = %v", args)
+	}
+}
+
+func TestUpdateBudgetDistinguishesConflictFromMissing(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		exists bool
+		want   error
+	}{
+		{name: "stale version", exists: true, want: persistence.ErrVersionConflict},
+		{name: "missing budget", want: persistence.ErrNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var updateArgs []any
+			store := &Store{
+				db: &fakeDB{},
+				queryRow: func(_ context.Context, query string, args ...any) rowScanner {
+					if strings.Contains(query, "UPDATE budgets") {
+						updateArgs = args
+						return valuesRow{err: sql.ErrNoRows}
+					}
+					if tc.exists {
+						return valuesRow{values: budgetValues("budget-1", 4)}
+					}
+					return valuesRow{err: sql.ErrNoRows}
+				},
+			}
+
+			expected := 3
+			_, err := store.UpdateBudget(context.Background(), "budget-1", persistence.BudgetUpdate{
+				Period: "monthly", LimitUSD: 300, Enforcement: "hard", ExpectedVersion: &expected,
+			})
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("UpdateBudget() error = %v, want %v", err, tc.want)
+			}
+			if len(updateArgs) != 6 || updateArgs[5] != &expected {
+				t.Fatalf("update args = %v, want expected version last", updateArgs)
+			}
+		})
+	}
+}
+
+func TestUpdateBudgetRecordsVersion(t *testing.T) {
+	var query string
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, q string, _ ...any) rowScanner {
+			query = q
+			return valuesRow{values: budgetValues("budget-1", 2)}
+		},
+	}
+
+	updated, err := store.UpdateBudget(context.Background(), "budget-1", persistence.BudgetUpdate{
+		Period: "monthly", LimitUSD: 250, Enforcement: "hard",
+	})
+	if err != nil {
+		t.Fatalf("UpdateBudget() error = %v", err)
+	}
+	if updated.Version != 2 {
+		t.Fatalf("Version = %d, want 2", updated.Version)
+	}
+	for _, want := range []string{"version = version + 1", "($6::INTEGER IS NULL OR version = $6)", "INSERT INTO budget_versions"} {
+		if !strings.Contains(query, want) {
+			t.Fatalf("query missing %q:\n%s", want, query)
+		}
+	}
+}
+
+func TestDeleteBudgetNotFound(t *testing.T) {
+	store := &Store{db: &fakeDB{result: fakeResult{rows: 0}}}
+
+	if err := store.DeleteBudget(context.Background(), "missing"); !errors.Is(err, persistence.ErrNotFound) {
+		t.Fatalf("DeleteBudget() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetBudgetIncludesVersions(t *testing.T) {
+	at := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
+			return valuesRow{values: budgetValues("budget-1", 2)}
+		},
+		queryRows: func(_ context.Context, _ string, args ...any) (rowsScanner, error) {
+			if args[0] != "budget-1" {
+				t.Fatalf("versions args = %v", args)
+			}
+			return &valuesRows{rows: [][]any{
+				{1, "", "monthly", 100.0, "soft", at},
+				{2, "", "monthly", 250.0, "hard", at.Add(time.Hour)},
+			}}, nil
+		},
+	}
+
+	detail, err := store.GetBudget(context.Background(), "budget-1")
+	if err != nil {
+		t.Fatalf("GetBudget() error = %v", err)
+	}
+	if len(detail.Versions) != 2 || detail.Versions[0].LimitUSD != 100 || detail.Versions[1].Enforcement != "hard" {
+		t.Fatalf("versions = %+v", detail.Versions)
+	}
+}
+
+func TestGetBudgetStatusSumsCurrentPeriodSpend(t *testing.T) {
+	var spendQuery string
+	var spendArgs []any
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, query string, args ...any) rowScanner {
+			if strings.Contains(query, "FROM budgets") {
+				return valuesRow{values: budgetValues("budget-1", 1)}
+			}
+			spendQuery, spendArgs = query, args
+			return valuesRow{values: []any{200.0}}
+		},
+	}
+
+	now := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	status, err := store.GetBudgetStatus(context.Background(), "budget-1", now)
+	if err != nil {
+		t.Fatalf("GetBudgetStatus() error = %v", err)
+	}
+	if status.SpentUSD != 200 || status.RemainingUSD != 50 || status.UtilizationPct != 80 || status.Result != persistence.BudgetWithinLimit {
+		t.Fatalf("status = %+v", status)
+	}
+	if !status.PeriodStart.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) || !status.PeriodEnd.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("period = %v..%v, want February", status.PeriodStart, status.PeriodEnd)
+	}
+
+	// The agent_id past the project scope is not filtered on.
+	for _, want := range []string{
+		"occurred_at >= $1 AND occurred_at < $2",
+		"AND tenant_id = $3 AND workspace_id = $4 AND project_id = $5",
+		"NOT EXISTS",
+	} {
+		if !strings.Contains(spendQuery, want) {
+			t.Fatalf("spend query missing %q:\n%s", want, spendQuery)
+		}
+	}
+	if strings.Contains(spendQuery, "agent_id =") || len(spendArgs) != 5 {
+		t.Fatalf("spend query = %s, args = %v", spendQuery, spendArgs)
+	}
+}
+
+func TestBuildListBudgetsQuery(t *testing.T) {
+	query, args := buildListBudgetsQuery(persistence.BudgetFilter{TenantID: "tenant-1", Scope: "agent"})
+
+	if !strings.Contains(query, "WHERE TRUE AND tenant_id = $1 AND scope = $2") || len(args) != 2 {
+		t.Fatalf("query = %s, args = %v", query, args)
+	}
+}
+
+func TestClaimBudgetThresholdReturnsStoredClaim(t *testing.T) {
+	first := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	var query string
+	var args []any
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, q string, a ...any) rowScanner {
+			query, args = q, a
+			return valuesRow{values: []any{"event-1", first, 60.0, true}}
+		},
+	}
+
+	start := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	claimed, err := store.ClaimBudgetThreshold(context.Background(), persistence.BudgetThresholdHit{
+		BudgetID: "budget-1", PeriodStart: start, ThresholdPct: 50,
+		EventID: "event-2", OccurredAt: first.Add(time.Hour), SpentUSD: 70,
+	})
+	if err != nil {
+		t.Fatalf("ClaimBudgetThreshold() error = %v", err)
+	}
+	if claimed.EventID != "event-1" || !claimed.OccurredAt.Equal(first) || claimed.SpentUSD != 60 || !claimed.Emitted {
+		t.Fatalf("claimed = %+v, want the stored claim", claimed)
+	}
+	if claimed.BudgetID != "budget-1" || !claimed.PeriodStart.Equal(start) || claimed.ThresholdPct != 50 {
+		t.Fatalf("claimed key = %+v", claimed)
+	}
+	for _, want := range []string{"ON CONFLICT (budget_id, period_start, threshold_pct) DO NOTHING", "UNION ALL"} {
+		if !strings.Contains(query, want) {
+			t.Fatalf("query missing %q:\n%s", want, query)
+		}
+	}
+	if len(args) != 6 || args[3] != "event-2" {
+		t.Fatalf("args = %v", args)
+	}
+}
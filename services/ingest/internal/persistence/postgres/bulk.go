@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// eventColumns is the agent_events column order shared by single and bulk inserts.
+var eventColumns = []string{
+	"event_id",
+	"event_version",
+	"event_type",
+	"occurred_at",
+	"tenant_id",
+	"workspace_id",
+	"project_id",
+	"run_id",
+	"agent_id",
+	"workflow_id",
+	"trace_id",
+	"span_id",
+	"parent_span_id",
+	"run_status",
+	"error_type",
+	"total_tokens",
+	"cost_usd",
+	"payload",
+}
+
+// maxBulkInsertRows keeps each statement well under the postgres limit of 65535 bind parameters.
+const maxBulkInsertRows = 500
+
+// InsertEvents writes validated events using multi-row inserts. inserted[i] reports whether
+// payloads[i] was newly written; false marks an idempotent duplicate, including repeats of
+// an event_id earlier in the same call. Payloads that can never be stored are skipped and
+// reported in a *persistence.InvalidEventsError alongside the results for the rest.
+func (s *Store) InsertEvents(ctx context.Context, payloads []map[string]any) ([]bool, error) {
+	if s == nil || s.db == nil || s.queryRows == nil {
+		return nil, errors.New("event store is not configured")
+	}
+
+	inserted := make([]bool, len(payloads))
+	invalid := make(map[int]error)
+	rows := make([]eventRow, 0, len(payloads))
+	rowIndexes := make([]int, 0, len(payloads))
+	seen := make(map[string]struct{}, len(payloads))
+
+	for idx, payload := range payloads {
+		row, err := buildEventRow(payload)
+		if err != nil {
+			invalid[idx] = err
+			continue
+		}
+
+		key := strings.ToLower(row.EventID)
+		if _, dup := seen[key]; dup {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		rows = append(rows, row)
+		rowIndexes = append(rowIndexes, idx)
+	}
+
+	for start := 0; start < len(rows); start += maxBulkInsertRows {
+		end := min(start+maxBulkInsertRows, len(rows))
+
+		newIDs, err := s.insertEventChunk(ctx, rows[start:end])
+		if isDataException(err) {
+			// One bad value fails the whole statement; retry row by row to isolate it.
+			newIDs, err = s.insertEventRows(ctx, rows[start:end], rowIndexes[start:end], invalid)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for offset, row := range rows[start:end] {
+			if _, ok := newIDs[strings.ToLower(row.EventID)]; ok {
+				inserted[rowIndexes[start+offset]] = true
+			}
+		}
+	}
+
+	if len(invalid) > 0 {
+		return inserted, &persistence.InvalidEventsError{Errs: invalid}
+	}
+	return inserted, nil
+}
+
+// insertEventRows inserts rows one statement each, recording the ones postgres
+// rejects as data exceptions in invalid under their payload index.
+func (s *Store) insertEventRows(ctx context.Context, rows []eventRow, indexes []int, invalid map[int]error) (map[string]struct{}, error) {
+	newIDs := make(map[string]struct{}, len(rows))
+	for offset := range rows {
+		ids, err := s.insertEventChunk(ctx, rows[offset:offset+1])
+		if isDataException(err) {
+			invalid[indexes[offset]] = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for id := range ids {
+			newIDs[id] = struct{}{}
+		}
+	}
+	return newIDs, nil
+}
+
+func (s *Store) insertEventChunk(ctx context.Context, rows []eventRow) (map[string]struct{}, error) {
+	query, args := buildBulkInsertQuery(rows)
+
+	result, err := s.queryRows(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("bulk insert agent events: %w", err)
+	}
+	defer result.Close()
+
+	newIDs := make(map[string]struct{}, len(rows))
+	for result.Next() {
+		var eventID string
+		if err := result.Scan(&eventID); err != nil {
+			return nil, fmt.Errorf("scan inserted event id: %w", err)
+		}
+		newIDs[strings.ToLower(eventID)] = struct{}{}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("bulk insert agent events: %w", err)
+	}
+
+	return newIDs, nil
+}
+
+func buildBulkInsertQuery(rows []eventRow) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, len(rows)*len(eventColumns))
+
+	b.WriteString("\nINSERT INTO agent_events (\n  ")
+	b.WriteString(strings.Join(eventColumns, ",\n  "))
+	b.WriteString("\n)\nVALUES")
+
+	nextArg := 1
+	for idx, row := range rows {
+		if idx > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  (")
+		for col := range eventColumns {
+			if col > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(fmt.Sprintf("$%d", nextArg))
+			nextArg++
+		}
+		b.WriteString(")")
+		args = append(args, row.args()...)
+	}
+
+	b.WriteString("\nON CONFLICT (event_id, occurred_at) DO NOTHING\n")
+
+	return withRunMaterialization(b.String()), args
+}
@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type fakeRows struct {
+	values []string
+	idx    int
+}
+
+func (f *fakeRows) Next() bool {
+	if f.idx >= len(f.values) {
+		return false
+	}
+	f.idx++
+	return true
+}
+
+func (f *fakeRows) Scan(dest ...any) error {
+	*(dest[0].(*string)) = f.values[f.idx-1]
+	return nil
+}
+
+func (f *fakeRows) Err() error {
+	return nil
+}
+
+func (f *fakeRows) Close() error {
+	return nil
+}
+
+type recordedQuery struct {
+	query string
+	args  []any
+}
+
+// returningStore reports every event_id in returned as newly inserted.
+func returningStore(returned map[string]bool, queries *[]recordedQuery) *Store {
+	return &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, query string, args ...any) (rowsScanner, error) {
+			*queries = append(*queries, recordedQuery{query: query, args: args})
+
+			rows := &fakeRows{}
+			for i := 0; i < len(args); i += len(eventColumns) {
+				eventID := args[i].(string)
+				if returned[eventID] {
+					rows.values = append(rows.values, strings.ToLower(eventID))
+				}
+			}
+			return rows, nil
+		},
+	}
+}
+
+func payloadWithID(eventID string) map[string]any {
+	payload := validPayload()
+	payload["event_id"] = eventID
+	return payload
+}
+
+func TestInsertEventsReportsNewAndDuplicateIDs(t *testing.T) {
+	var queries []recordedQuery
+	store := returningStore(map[string]bool{
+		"550e8400-e29b-41d4-a716-446655440001": true,
+		"550E8400-E29B-41D4-A716-446655440003": true,
+	}, &queries)
+
+	inserted, err := store.InsertEvents(context.Background(), []map[string]any{
+		payloadWithID("550e8400-e29b-41d4-a716-446655440001"),
+		payloadWithID("550e8400-e29b-41d4-a716-446655440002"),
+		payloadWithID("550E8400-E29B-41D4-A716-446655440003"),
+		payloadWithID("550e8400-e29b-41d4-a716-446655440001"),
+	})
+	if err != nil {
+		t.Fatalf("InsertEvents() error = %v", err)
+	}
+
+	want := []bool{true, false, true, false}
+	for idx := range want {
+		if inserted[idx] != want[idx] {
+			t.Fatalf("inserted = %v, want %v", inserted, want)
+		}
+	}
+
+	if len(queries) != 1 {
+		t.Fatalf("queries = %d, want 1", len(queries))
+	}
+	if got := len(queries[0].args); got != 3*len(eventColumns) {
+		t.Fatalf("args len = %d, want %d (in-call duplicate skipped)", got, 3*len(eventColumns))
+	}
+	if !strings.Contains(queries[0].query, "ON CONFLICT (event_id, occurred_at) DO NOTHING") {
+		t.Fatalf("query = %q, want idempotent insert", queries[0].query)
+	}
+	if !strings.Contains(queries[0].query, "RETURNING event_id") {
+		t.Fatalf("query = %q, want RETURNING event_id", queries[0].query)
+	}
+}
+
+func TestInsertEventsChunksLargeBatches(t *testing.T) {
+	var queries []recordedQuery
+	store := returningStore(map[string]bool{}, &queries)
+
+	payloads := make([]map[string]any, 0, maxBulkInsertRows+1)
+	for i := 0; i <= maxBulkInsertRows; i++ {
+		payloads = append(payloads, payloadWithID(fmt.Sprintf("00000000-0000-4000-8000-%012d", i)))
+	}
+
+	if _, err := store.InsertEvents(context.Background(), payloads); err != nil {
+		t.Fatalf("InsertEvents() error = %v", err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("queries = %d, want 2", len(queries))
+	}
+	if got := len(queries[1].args); got != len(eventColumns) {
+		t.Fatalf("second chunk args = %d, want %d", got, len(eventColumns))
+	}
+}
+
+func TestInsertEventsSkipsUnbuildablePayload(t *testing.T) {
+	var queries []recordedQuery
+	store := returningStore(map[string]bool{"550e8400-e29b-41d4-a716-446655440000": true}, &queries)
+
+	bad := payloadWithID("550e8400-e29b-41d4-a716-446655440001")
+	delete(bad, "event_type")
+
+	inserted, err := store.InsertEvents(context.Background(), []map[string]any{validPayload(), bad})
+	var invalid *persistence.InvalidEventsError
+	if !errors.As(err, &invalid) || !errors.Is(err, persistence.ErrInvalidEvent) {
+		t.Fatalf("error = %v, want InvalidEventsError", err)
+	}
+	if len(invalid.Errs) != 1 || !strings.Contains(invalid.Errs[1].Error(), "$.event_type") {
+		t.Fatalf("invalid = %v, want event 1", invalid.Errs)
+	}
+	if len(inserted) != 2 || !inserted[0] || inserted[1] {
+		t.Fatalf("inserted = %v, want the valid event written", inserted)
+	}
+	if len(queries) != 1 || len(queries[0].args) != len(eventColumns) {
+		t.Fatalf("queries = %+v, want one single-row insert", queries)
+	}
+}
+
+func TestInsertEventsIsolatesDataExceptions(t *testing.T) {
+	var statements int
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, _ string, args ...any) (rowsScanner, error) {
+			statements++
+			rows := &fakeRows{}
+			for i := 0; i < len(args); i += len(eventColumns) {
+				if args[i] == "550e8400-e29b-41d4-a716-446655440002" {
+					return nil, &pgconn.PgError{Code: "22003", Message: "numeric field overflow"}
+				}
+				rows.values = append(rows.values, args[i].(string))
+			}
+			return rows, nil
+		},
+	}
+
+	inserted, err := store.InsertEvents(context.Background(), []map[string]any{
+		payloadWithID("550e8400-e29b-41d4-a716-446655440001"),
+		payloadWithID("550e8400-e29b-41d4-a716-446655440002"),
+		payloadWithID("550e8400-e29b-41d4-a716-446655440003"),
+	})
+	var invalid *persistence.InvalidEventsError
+	if !errors.As(err, &invalid) || len(invalid.Errs) != 1 || invalid.Errs[1] == nil {
+		t.Fatalf("error = %v, want event 1 invalid", err)
+	}
+	if !inserted[0] || inserted[1] || !inserted[2] {
+		t.Fatalf("inserted = %v, want the other events written", inserted)
+	}
+	if statements != 4 {
+		t.Fatalf("statements = %d, want the chunk then one per row", statements)
+	}
+}
+
+func TestInsertEventsWriteError(t *testing.T) {
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(context.Context, string, ...any) (rowsScanner, error) {
+			return nil, errors.New("write failed")
+		},
+	}
+
+	_, err := store.InsertEvents(context.Background(), []map[string]any{validPayload()})
+	if err == nil || !strings.Contains(err.Error(), "bulk insert agent events") {
+		t.Fatalf("error = %v, want bulk insert context", err)
+	}
+}
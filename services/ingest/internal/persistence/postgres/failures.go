@@ -0,0 +1,337 @@
+package postgres
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const (
+	defaultFailureLimit = 50
+	maxFailureLimit     = 200
+	// failureSampleRuns is how many distinct run_ids each failure group reports.
+	failureSampleRuns = 5
+)
+
+const (
+	failureEventTypesSQL = `event_type IN ('run.failed', 'step.failed', 'model.call.failed', 'tool.call.failed')`
+	failureModelSQL      = `CASE WHEN event_type LIKE 'model.call.%' THEN (payload->'model_call'->>'provider') || '/' || (payload->'model_call'->>'model') END`
+	failureToolSQL       = `CASE WHEN event_type LIKE 'tool.call.%' THEN COALESCE(payload->'step'->>'name', payload->'step'->>'step_id') END`
+)
+
+// failureGroup is how one group_by dimension groups failures. eventFilter,
+// when set, keeps only the event types the dimension applies to, so their
+// counts are not mixed with a null group of every other failure.
+type failureGroup struct {
+	key         string
+	eventFilter string
+}
+
+// failureGroups maps each group_by dimension to its grouping.
+var failureGroups = map[string]failureGroup{
+	persistence.FailureGroupErrorType:        {key: `error_type`},
+	persistence.FailureGroupErrorCode:        {key: `payload->'error'->>'error_code'`},
+	persistence.FailureGroupErrorMessageHash: {key: `payload->'error'->>'error_message_hash'`},
+	persistence.FailureGroupModel:            {key: failureModelSQL, eventFilter: `event_type LIKE 'model.call.%'`},
+	persistence.FailureGroupTool:             {key: failureToolSQL, eventFilter: `event_type LIKE 'tool.call.%'`},
+}
+
+// ListFailures returns failed run, step, model call and tool call events in
+// the window, newest first. Pages continue from query.Cursor.
+func (s *Store) ListFailures(ctx context.Context, query persistence.FailureQuery) (persistence.FailurePage, error) {
+	var out persistence.FailurePage
+
+	if s == nil || s.db == nil || s.queryRows == nil {
+		return out, errors.New("event store is not configured")
+	}
+
+	windowStart, windowEnd, windowHours, err := overviewWindow(query.Filter)
+	if err != nil {
+		return out, err
+	}
+	limit, err := failureLimit(query.Limit)
+	if err != nil {
+		return out, err
+	}
+
+	var after *failureCursor
+	if query.Cursor != "" {
+		cursor, err := decodeFailureCursor(query.Cursor)
+		if err != nil {
+			return out, err
+		}
+		after = &cursor
+	}
+
+	sqlQuery, args := buildListFailuresQuery(windowStart, windowEnd, query.Filter, after, limit)
+	rows, err := s.queryRows(ctx, sqlQuery, args...)
+	if err != nil {
+		return out, fmt.Errorf("query failures: %w", err)
+	}
+	defer rows.Close()
+
+	failures := make([]persistence.Failure, 0, limit)
+	var last failureCursor
+	hasMore := false
+	for rows.Next() {
+		if len(failures) == limit {
+			hasMore = true
+			break
+		}
+
+		var id int64
+		var f persistence.Failure
+		if err := rows.Scan(
+			&id, &f.EventID, &f.EventType, &f.OccurredAt, &f.RunID,
+			&f.TenantID, &f.WorkspaceID, &f.ProjectID, &f.AgentID, &f.WorkflowID, &f.SpanID,
+			&f.ErrorType, &f.ErrorCode, &f.ErrorMessageHash, &f.Retryable, &f.Model, &f.Tool,
+		); err != nil {
+			return out, fmt.Errorf("scan failure: %w", err)
+		}
+		failures = append(failures, f)
+		last = failureCursor{occurredAt: f.OccurredAt, id: id}
+	}
+	if err := rows.Err(); err != nil {
+		return out, fmt.Errorf("query failures: %w", err)
+	}
+
+	query.Filter.WindowHours = windowHours
+	out = persistence.FailurePage{
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
+		Filters:     query.Filter,
+		Failures:    failures,
+	}
+	if hasMore {
+		out.NextCursor = last.encode()
+	}
+	return out, nil
+}
+
+// GroupFailures aggregates the failures in the window by query.GroupBy,
+// largest groups first. Pages continue from query.Cursor.
+func (s *Store) GroupFailures(ctx context.Context, query persistence.FailureQuery) (persistence.FailureGroupPage, error) {
+	var out persistence.FailureGroupPage
+
+	if s == nil || s.db == nil || s.queryRows == nil {
+		return out, errors.New("event store is not configured")
+	}
+
+	if _, ok := failureGroups[query.GroupBy]; !ok {
+		return out, fmt.Errorf("unsupported failure group_by %q", query.GroupBy)
+	}
+	windowStart, windowEnd, windowHours, err := overviewWindow(query.Filter)
+	if err != nil {
+		return out, err
+	}
+	limit, err := failureLimit(query.Limit)
+	if err != nil {
+		return out, err
+	}
+
+	offset := 0
+	if query.Cursor != "" {
+		if offset, err = decodeGroupCursor(query.Cursor); err != nil {
+			return out, err
+		}
+	}
+
+	sqlQuery, args := buildGroupFailuresQuery(windowStart, windowEnd, query.Filter, query.GroupBy, offset, limit)
+	rows, err := s.queryRows(ctx, sqlQuery, args...)
+	if err != nil {
+		return out, fmt.Errorf("query failure groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make([]persistence.FailureGroup, 0, limit)
+	hasMore := false
+	for rows.Next() {
+		if len(groups) == limit {
+			hasMore = true
+			break
+		}
+
+		var g persistence.FailureGroup
+		var recentRuns string
+		if err := rows.Scan(&g.Key, &g.Count, &g.FirstSeen, &g.LastSeen, &recentRuns); err != nil {
+			return out, fmt.Errorf("scan failure group: %w", err)
+		}
+		if g.SampleRunIDs, err = sampleRunIDs(recentRuns); err != nil {
+			return out, fmt.Errorf("scan failure group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return out, fmt.Errorf("query failure groups: %w", err)
+	}
+
+	query.Filter.WindowHours = windowHours
+	out = persistence.FailureGroupPage{
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
+		Filters:     query.Filter,
+		GroupBy:     query.GroupBy,
+		Groups:      groups,
+	}
+	if hasMore {
+		out.NextCursor = encodeGroupCursor(offset + limit)
+	}
+	return out, nil
+}
+
+func failureLimit(limit int) (int, error) {
+	if limit == 0 {
+		return defaultFailureLimit, nil
+	}
+	if limit < 1 || limit > maxFailureLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxFailureLimit)
+	}
+	return limit, nil
+}
+
+func buildListFailuresQuery(windowStart time.Time, windowEnd time.Time, filter persistence.OverviewFilter, after *failureCursor, limit int) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 10)
+
+	b.WriteString(`
+SELECT
+  id, event_id::TEXT, event_type, occurred_at, run_id,
+  tenant_id, workspace_id, project_id, agent_id, workflow_id, span_id,
+  error_type,
+  payload->'error'->>'error_code',
+  payload->'error'->>'error_message_hash',
+  (payload->'error'->>'retryable')::BOOLEAN,
+  ` + failureModelSQL + `,
+  ` + failureToolSQL + `
+FROM agent_events
+WHERE ` + failureEventTypesSQL + ` AND occurred_at >= $1 AND occurred_at <= $2`)
+	args = append(args, windowStart, windowEnd)
+	args = appendOverviewFilters(&b, args, filter)
+
+	if after != nil {
+		args = append(args, after.occurredAt, after.id)
+		b.WriteString(fmt.Sprintf(" AND (occurred_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	// One extra row tells whether another page follows.
+	args = append(args, limit+1)
+	b.WriteString(fmt.Sprintf("\nORDER BY occurred_at DESC, id DESC\nLIMIT $%d\n", len(args)))
+
+	return b.String(), args
+}
+
+func buildGroupFailuresQuery(windowStart time.Time, windowEnd time.Time, filter persistence.OverviewFilter, groupBy string, offset int, limit int) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 9)
+	group := failureGroups[groupBy]
+
+	// Recent run_ids are over-fetched so duplicates can be dropped and still fill the sample.
+	b.WriteString(`
+SELECT
+  ` + group.key + ` AS group_key,
+  COUNT(*) AS failure_count,
+  MIN(occurred_at) AS first_seen,
+  MAX(occurred_at) AS last_seen,
+  to_json((ARRAY_AGG(run_id ORDER BY occurred_at DESC))[1:` + strconv.Itoa(failureSampleRuns*4) + `])::TEXT AS recent_run_ids
+FROM agent_events
+WHERE ` + failureEventTypesSQL + ` AND occurred_at >= $1 AND occurred_at <= $2`)
+	if group.eventFilter != "" {
+		b.WriteString(" AND " + group.eventFilter)
+	}
+	args = append(args, windowStart, windowEnd)
+	args = appendOverviewFilters(&b, args, filter)
+
+	args = append(args, limit+1, offset)
+	b.WriteString(fmt.Sprintf("\nGROUP BY group_key\nORDER BY failure_count DESC, group_key NULLS LAST\nLIMIT $%d OFFSET $%d\n", len(args)-1, len(args)))
+
+	return b.String(), args
+}
+
+// sampleRunIDs decodes a JSON array of run_ids, newest first, into up to failureSampleRuns distinct ids.
+func sampleRunIDs(raw string) ([]string, error) {
+	var recent []string
+	if err := json.Unmarshal([]byte(raw), &recent); err != nil {
+		return nil, err
+	}
+
+	sample := make([]string, 0, failureSampleRuns)
+	seen := make(map[string]bool, len(recent))
+	for _, runID := range recent {
+		if seen[runID] {
+			continue
+		}
+		seen[runID] = true
+		sample = append(sample, runID)
+		if len(sample) == failureSampleRuns {
+			break
+		}
+	}
+	return sample, nil
+}
+
+// failureCursor is the keyset position of the last failure on a page.
+type failureCursor struct {
+	occurredAt time.Time
+	id         int64
+}
+
+// Cursors are opaque to clients: "e:<occurred_at unix micros>:<id>" for the
+// event list and "g:<offset>" for groups, base64url-encoded.
+func (c failureCursor) encode() string {
+	raw := fmt.Sprintf("e:%d:%d", c.occurredAt.UnixMicro(), c.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeFailureCursor(cursor string) (failureCursor, error) {
+	fields, err := cursorFields(cursor, "e", 2)
+	if err != nil {
+		return failureCursor{}, err
+	}
+
+	micros, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return failureCursor{}, persistence.ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return failureCursor{}, persistence.ErrInvalidCursor
+	}
+	return failureCursor{occurredAt: time.UnixMicro(micros).UTC(), id: id}, nil
+}
+
+func encodeGroupCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("g:" + strconv.Itoa(offset)))
+}
+
+func decodeGroupCursor(cursor string) (int, error) {
+	fields, err := cursorFields(cursor, "g", 1)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := strconv.Atoi(fields[0])
+	if err != nil || offset < 0 {
+		return 0, persistence.ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+func cursorFields(cursor string, kind string, n int) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, persistence.ErrInvalidCursor
+	}
+
+	fields := strings.Split(string(raw), ":")
+	if len(fields) != n+1 || fields[0] != kind {
+		return nil, persistence.ErrInvalidCursor
+	}
+	return fields[1:], nil
+}
@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+func failureRow(id int64, eventID string, occurredAt time.Time) []any {
+	return []any{
+		id, eventID, "model.call.failed", occurredAt, "run-" + eventID,
+		"tenant-1", "workspace-1", "project-1", "agent-1", "workflow-1", "span-" + eventID,
+		"timeout", "E_TIMEOUT", nil, true, "openai/gpt-4o", nil,
+	}
+}
+
+func TestListFailuresPaginatesWithCursor(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	var queries []recordedQuery
+
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, query string, args ...any) (rowsScanner, error) {
+			queries = append(queries, recordedQuery{query: query, args: args})
+			if len(queries) == 1 {
+				return &valuesRows{rows: [][]any{
+					failureRow(30, "e3", now),
+					failureRow(20, "e2", now.Add(-time.Minute)),
+					failureRow(10, "e1", now.Add(-2*time.Minute)),
+				}}, nil
+			}
+			return &valuesRows{rows: [][]any{failureRow(10, "e1", now.Add(-2*time.Minute))}}, nil
+		},
+	}
+
+	page, err := store.ListFailures(context.Background(), persistence.FailureQuery{
+		Filter: persistence.OverviewFilter{TenantID: "tenant-1"},
+		Limit:  2,
+	})
+	if err != nil {
+		t.Fatalf("ListFailures() error = %v", err)
+	}
+	if len(page.Failures) != 2 || page.NextCursor == "" {
+		t.Fatalf("page = %+v, want two failures and a next cursor", page)
+	}
+	if f := page.Failures[0]; f.EventID != "e3" || *f.ErrorCode != "E_TIMEOUT" || !*f.Retryable || *f.Model != "openai/gpt-4o" || f.Tool != nil {
+		t.Fatalf("failure = %+v", f)
+	}
+	if page.Filters.WindowHours != persistence.DefaultWindowHours {
+		t.Fatalf("window_hours = %d, want default", page.Filters.WindowHours)
+	}
+
+	first := queries[0]
+	if !strings.Contains(first.query, "tenant_id = $3") || strings.Contains(first.query, "(occurred_at, id) <") {
+		t.Fatalf("first page query = %s", first.query)
+	}
+	if got := first.args[len(first.args)-1]; got != 3 {
+		t.Fatalf("limit arg = %v, want limit+1", got)
+	}
+
+	next, err := store.ListFailures(context.Background(), persistence.FailureQuery{
+		Filter: persistence.OverviewFilter{TenantID: "tenant-1"},
+		Cursor: page.NextCursor,
+		Limit:  2,
+	})
+	if err != nil {
+		t.Fatalf("ListFailures(cursor) error = %v", err)
+	}
+	if len(next.Failures) != 1 || next.NextCursor != "" {
+		t.Fatalf("next page = %+v, want last failure and no cursor", next)
+	}
+
+	second := queries[1]
+	if !strings.Contains(second.query, "(occurred_at, id) < ($4, $5)") {
+		t.Fatalf("second page query missing keyset predicate: %s", second.query)
+	}
+	if !second.args[3].(time.Time).Equal(now.Add(-time.Minute)) || second.args[4] != int64(20) {
+		t.Fatalf("keyset args = %v, want last row of first page", second.args[3:5])
+	}
+}
+
+func TestListFailuresRejectsBadCursor(t *testing.T) {
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, _ string, _ ...any) (rowsScanner, error) {
+			t.Fatal("query must not run for an invalid cursor")
+			return nil, nil
+		},
+	}
+
+	for _, cursor := range []string{"not base64!", encodeGroupCursor(10), failureCursor{}.encode()[:4]} {
+		_, err := store.ListFailures(context.Background(), persistence.FailureQuery{Cursor: cursor})
+		if !errors.Is(err, persistence.ErrInvalidCursor) {
+			t.Fatalf("ListFailures(%q) error = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestGroupFailuresReturnsSamples(t *testing.T) {
+	now := time.Now().UTC()
+	var captured recordedQuery
+
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, query string, args ...any) (rowsScanner, error) {
+			captured = recordedQuery{query: query, args: args}
+			return &valuesRows{rows: [][]any{
+				{"E_TIMEOUT", int64(9), now.Add(-time.Hour), now, `["r3","r3","r2","r1","r1","r4","r5","r6"]`},
+				{nil, int64(2), now.Add(-time.Hour), now, `["r7"]`},
+				{"E_RATE", int64(1), now, now, `["r8"]`},
+			}}, nil
+		},
+	}
+
+	page, err := store.GroupFailures(context.Background(), persistence.FailureQuery{
+		Filter:  persistence.OverviewFilter{AgentID: "agent-1"},
+		GroupBy: persistence.FailureGroupErrorCode,
+		Cursor:  encodeGroupCursor(4),
+		Limit:   2,
+	})
+	if err != nil {
+		t.Fatalf("GroupFailures() error = %v", err)
+	}
+
+	if !strings.Contains(captured.query, "payload->'error'->>'error_code' AS group_key") || !strings.Contains(captured.query, "agent_id = $3") {
+		t.Fatalf("group query = %s", captured.query)
+	}
+	if got := captured.args[len(captured.args)-2:]; got[0] != 3 || got[1] != 4 {
+		t.Fatalf("limit/offset args = %v, want [3 4]", got)
+	}
+
+	if len(page.Groups) != 2 || page.GroupBy != "error_code" {
+		t.Fatalf("page = %+v, want two error_code groups", page)
+	}
+	if got := page.Groups[0].SampleRunIDs; !reflect.DeepEqual(got, []string{"r3", "r2", "r1", "r4", "r5"}) {
+		t.Fatalf("sample run ids = %v, want five distinct newest first", got)
+	}
+	if page.Groups[1].Key != nil || page.Groups[1].Count != 2 {
+		t.Fatalf("null group = %+v", page.Groups[1])
+	}
+	if offset, err := decodeGroupCursor(page.NextCursor); err != nil || offset != 6 {
+		t.Fatalf("next cursor offset = %d, %v, want 6", offset, err)
+	}
+}
+
+func TestGroupFailuresByModelOrToolKeepsOnlyThoseCalls(t *testing.T) {
+	start := time.Date(2026, 2, 7, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	query, _ := buildGroupFailuresQuery(start, end, persistence.OverviewFilter{}, persistence.FailureGroupModel, 0, 10)
+	if !strings.Contains(query, "AND event_type LIKE 'model.call.%'") {
+		t.Fatalf("model group query must keep only model calls:\n%s", query)
+	}
+	query, _ = buildGroupFailuresQuery(start, end, persistence.OverviewFilter{}, persistence.FailureGroupTool, 0, 10)
+	if !strings.Contains(query, "AND event_type LIKE 'tool.call.%'") {
+		t.Fatalf("tool group query must keep only tool calls:\n%s", query)
+	}
+	query, _ = buildGroupFailuresQuery(start, end, persistence.OverviewFilter{}, persistence.FailureGroupErrorType, 0, 10)
+	if strings.Contains(query, "event_type LIKE") {
+		t.Fatalf("error_type group query must keep every failure:\n%s", query)
+	}
+}
+
+func TestGroupFailuresRejectsUnknownDimension(t *testing.T) {
+	store := &Store{db: &fakeDB{}, queryRows: func(_ context.Context, _ string, _ ...any) (rowsScanner, error) {
+		t.Fatal("query must not run for an unknown group_by")
+		return nil, nil
+	}}
+
+	if _, err := store.GroupFailures(context.Background(), persistence.FailureQuery{GroupBy: "payload"}); err == nil {
+		t.Fatal("GroupFailures() error = nil, want unsupported group_by")
+	}
+}
@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// integrationStore returns a store on a fresh schema of the database named
+// by INGEST_TEST_DATABASE_URL with every migration applied, and skips the
+// test when the variable is unset.
+func integrationStore(t *testing.T) *Store {
+	t.Helper()
+
+	databaseURL := os.Getenv("INGEST_TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("INGEST_TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	admin, err := NewStore(databaseURL)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	schema := fmt.Sprintf("ingest_test_%d", time.Now().UnixNano())
+	if _, err := admin.db.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.db.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+		_ = admin.Close()
+	})
+
+	scoped, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatalf("parse INGEST_TEST_DATABASE_URL: %v", err)
+	}
+	query := scoped.Query()
+	query.Set("search_path", schema)
+	scoped.RawQuery = query.Encode()
+
+	store, err := NewStore(scoped.String())
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	migrations, err := filepath.Glob(filepath.Join("..", "..", "..", "migrations", "*.sql"))
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	sort.Strings(migrations)
+	for _, path := range migrations {
+		migration, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if _, err := store.db.ExecContext(ctx, string(migration)); err != nil {
+			t.Fatalf("apply %s: %v", filepath.Base(path), err)
+		}
+	}
+	return store
+}
+
+func TestIntegrationRetryWithNewOccurredAtIsADuplicate(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+
+	const eventID = "550e8400-e29b-41d4-a716-446655440001"
+	event := func(occurredAt string) map[string]any {
+		payload := payloadWithID(eventID)
+		payload["event_type"] = "model.call.completed"
+		payload["occurred_at"] = occurredAt
+		return payload
+	}
+
+	inserted, err := store.InsertEvent(ctx, event("2026-02-07T23:59:59Z"))
+	if err != nil || !inserted {
+		t.Fatalf("InsertEvent() = %v, %v, want inserted", inserted, err)
+	}
+	// The retries land in the next day's partition, past the composite key.
+	inserted, err = store.InsertEvent(ctx, event("2026-02-08T00:00:01Z"))
+	if err != nil || inserted {
+		t.Fatalf("InsertEvent(retry) = %v, %v, want a duplicate", inserted, err)
+	}
+	batch, err := store.InsertEvents(ctx, []map[string]any{event("2026-02-08T00:00:02Z")})
+	if err != nil || batch[0] {
+		t.Fatalf("InsertEvents(retry) = %v, %v, want a duplicate", batch, err)
+	}
+
+	var events, modelCalls int64
+	if err := store.queryRow(ctx, `SELECT COUNT(*) FROM agent_events WHERE event_id = $1`, eventID).Scan(&events); err != nil {
+		t.Fatalf("count events: %v", err)
+	}
+	if err := store.queryRow(ctx, `SELECT model_call_count FROM runs WHERE tenant_id = 'tenant-1' AND run_id = 'run-1'`).Scan(&modelCalls); err != nil {
+		t.Fatalf("read run: %v", err)
+	}
+	if events != 1 || modelCalls != 1 {
+		t.Fatalf("events = %d, model_call_count = %d, want the event stored and counted once", events, modelCalls)
+	}
+}
+
+func TestIntegrationRetentionPurgesRunsRollupsAndIDs(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+
+	now := time.Date(2026, 2, 20, 12, 0, 0, 0, time.UTC)
+	expired := payloadWithID("550e8400-e29b-41d4-a716-446655440002")
+	expired["occurred_at"] = now.Add(-10 * oneDay).Format(time.RFC3339)
+	if inserted, err := store.InsertEvent(ctx, expired); err != nil || !inserted {
+		t.Fatalf("InsertEvent() = %v, %v, want inserted", inserted, err)
+	}
+	if _, err := store.db.ExecContext(ctx, `
+INSERT INTO rollups_hourly (
+  bucket_start, kind, tenant_id, workspace_id, project_id, agent_id, workflow_id,
+  total_count, success_count, failure_count, cost_usd, total_tokens, latency_sum_ms, latency_count, latency_histogram
+)
+VALUES ($1, 'run', 'tenant-1', 'workspace-1', 'project-1', 'agent-1', 'workflow-1', 1, 1, 0, 0, 0, 0, 0, '{}')`, now.Add(-10*oneDay).Truncate(time.Hour)); err != nil {
+		t.Fatalf("insert rollup: %v", err)
+	}
+
+	result, err := store.MaintainEventPartitions(ctx, persistence.PartitionPolicy{Now: now, DefaultRetentionDays: 7})
+	if err != nil {
+		t.Fatalf("MaintainEventPartitions() error = %v", err)
+	}
+	if result.PurgedEvents != 1 || result.PurgedRuns != 1 || result.PurgedRollups != 1 {
+		t.Fatalf("result = %+v, want the event, its run and its rollup bucket purged", result)
+	}
+
+	var ids int64
+	if err := store.queryRow(ctx, `SELECT COUNT(*) FROM agent_event_ids`).Scan(&ids); err != nil {
+		t.Fatalf("count event ids: %v", err)
+	}
+	if ids != 0 {
+		t.Fatalf("agent_event_ids = %d rows, want the purged event's id released", ids)
+	}
+}
+
+func TestIntegrationOverviewCostCoversFinishedRunsOnly(t *testing.T) {
+	store := integrationStore(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	event := func(eventID, eventType, runID string, costUSD float64) map[string]any {
+		payload := payloadWithID(eventID)
+		payload["event_type"] = eventType
+		payload["occurred_at"] = now.Add(-time.Minute).Format(time.RFC3339)
+		payload["run"].(map[string]any)["run_id"] = runID
+		payload["cost"] = map[string]any{"cost_usd": costUSD}
+		return payload
+	}
+	if _, err := store.InsertEvents(ctx, []map[string]any{
+		event("550e8400-e29b-41d4-a716-446655440010", "model.call.completed", "run-finished", 2),
+		event("550e8400-e29b-41d4-a716-446655440011", "run.completed", "run-finished", 2),
+		// Still in flight: its call cost is not in the overview yet.
+		event("550e8400-e29b-41d4-a716-446655440012", "model.call.completed", "run-in-flight", 5),
+	}); err != nil {
+		t.Fatalf("InsertEvents() error = %v", err)
+	}
+
+	overview, err := store.GetOverviewMetrics(ctx, persistence.OverviewFilter{WindowHours: 1})
+	if err != nil {
+		t.Fatalf("GetOverviewMetrics() error = %v", err)
+	}
+	if overview.TotalRuns != 1 || overview.TotalCostUSD != 2 || overview.CostBasis != persistence.OverviewCostFinishedRuns {
+		t.Fatalf("overview = %+v, want only the finished run and its cost", overview)
+	}
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// latencyQuantiles are the quantiles of persistence.LatencyPercentiles, in field order.
+var latencyQuantiles = [...]string{"0.5", "0.9", "0.95", "0.99"}
+
+// percentileColumns selects one percentile_cont column per latency quantile
+// of column, limited to rows matching where when it is non-empty.
+func percentileColumns(column string, where string) string {
+	var filter string
+	if where != "" {
+		filter = " FILTER (WHERE " + where + ")"
+	}
+
+	columns := make([]string, 0, len(latencyQuantiles))
+	for _, quantile := range latencyQuantiles {
+		columns = append(columns, fmt.Sprintf("COALESCE(percentile_cont(%s) WITHIN GROUP (ORDER BY %s)%s, 0)", quantile, column, filter))
+	}
+	return strings.Join(columns, ",\n  ")
+}
+
+// latencyDest returns Scan destinations for the columns of percentileColumns.
+func latencyDest(p *persistence.LatencyPercentiles) []any {
+	return []any{&p.P50, &p.P90, &p.P95, &p.P99}
+}
+
+// buildCallLatencyQuery selects step and model call latency percentiles from
+// step.latency_ms on completed and failed events in the window. With a
+// non-zero width the percentiles are computed per date_bin bucket, which is
+// selected first.
+func buildCallLatencyQuery(windowStart time.Time, windowEnd time.Time, width time.Duration, filter persistence.OverviewFilter) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 8)
+	args = append(args, windowStart, windowEnd)
+
+	b.WriteString("\nSELECT\n  ")
+	if width > 0 {
+		args = append(args, int64(width/time.Second))
+		b.WriteString("date_bin(make_interval(secs => $3), occurred_at, TIMESTAMPTZ '1970-01-01 00:00:00+00') AS bucket_start,\n  ")
+	}
+	b.WriteString(percentileColumns("latency_ms", "event_type LIKE 'step.%'"))
+	b.WriteString(",\n  ")
+	b.WriteString(percentileColumns("latency_ms", "event_type LIKE 'model.call.%'"))
+	b.WriteString(`
+FROM (
+  SELECT event_type, occurred_at, (payload->'step'->>'latency_ms')::NUMERIC::BIGINT AS latency_ms
+  FROM agent_events
+  WHERE event_type IN ('step.completed', 'step.failed', 'model.call.completed', 'model.call.failed')
+    AND occurred_at >= $1 AND occurred_at <= $2
+    AND payload->'step'->>'latency_ms' IS NOT NULL`)
+	args = appendOverviewFilters(&b, args, filter)
+	b.WriteString("\n) call_latencies\n")
+
+	if width > 0 {
+		b.WriteString("GROUP BY bucket_start\nORDER BY bucket_start\n")
+	}
+
+	return b.String(), args
+}
@@ -4,17 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
 )
 
-const (
-	defaultWindowHours = 24
-	maxWindowHours     = 24 * 7
-)
-
 // GetOverviewMetrics returns aggregate usage/cost/reliability metrics for dashboard overview.
 func (s *Store) GetOverviewMetrics(ctx context.Context, filter persistence.OverviewFilter) (persistence.OverviewMetrics, error) {
 	var out persistence.OverviewMetrics
@@ -23,16 +19,30 @@ func (s *Store) GetOverviewMetrics(ctx context.Context, filter persistence.Overv
 		return out, errors.New("event store is not configured")
 	}
 
-	windowHours := filter.WindowHours
-	if windowHours == 0 {
-		windowHours = defaultWindowHours
-	}
-	if windowHours < 1 || windowHours > maxWindowHours {
-		return out, fmt.Errorf("window_hours must be between 1 and %d", maxWindowHours)
+	windowStart, windowEnd, windowHours, err := overviewWindow(filter)
+	if err != nil {
+		return out, err
 	}
 
-	windowEnd := time.Now().UTC()
-	windowStart := windowEnd.Add(-time.Duration(windowHours) * time.Hour)
+	filter.WindowHours = windowHours
+	if windowEnd.Sub(windowStart) > rollupMinWindow && s.queryRows != nil {
+		watermark, ok, err := s.rollupWatermark(ctx)
+		if err != nil {
+			return out, err
+		}
+		if plan, covered := planRollups(windowStart, windowEnd, watermark); ok && covered {
+			out, err = s.getRollupOverview(ctx, plan, filter)
+			if err != nil {
+				return out, err
+			}
+			out.WindowStart, out.WindowEnd, out.WindowHours, out.Filters = windowStart, windowEnd, windowHours, filter
+			if out.TotalRuns > 0 {
+				out.SuccessRate = (float64(out.SuccessfulRuns) / float64(out.TotalRuns)) * 100
+			}
+			out.Source, out.CostBasis = persistence.OverviewSourceRollups, persistence.OverviewCostFinishedRuns
+			return out, nil
+		}
+	}
 
 	query, args := buildOverviewQuery(windowStart, windowEnd, filter)
 	row := s.queryRow(ctx, query, args...)
@@ -42,17 +52,24 @@ func (s *Store) GetOverviewMetrics(ctx context.Context, filter persistence.Overv
 	var failedRuns int64
 	var totalCostUSD float64
 	var avgLatencyMS float64
+	var runLatency, stepLatency, modelCallLatency persistence.LatencyPercentiles
 
-	if err := row.Scan(&totalRuns, &successfulRuns, &failedRuns, &totalCostUSD, &avgLatencyMS); err != nil {
+	dest := append([]any{&totalRuns, &successfulRuns, &failedRuns, &totalCostUSD, &avgLatencyMS}, latencyDest(&runLatency)...)
+	if err := row.Scan(dest...); err != nil {
 		return out, fmt.Errorf("query metrics overview: %w", err)
 	}
 
+	query, args = buildCallLatencyQuery(windowStart, windowEnd, 0, filter)
+	dest = append(latencyDest(&stepLatency), latencyDest(&modelCallLatency)...)
+	if err := s.queryRow(ctx, query, args...).Scan(dest...); err != nil {
+		return out, fmt.Errorf("query call latency percentiles: %w", err)
+	}
+
 	successRate := 0.0
 	if totalRuns > 0 {
 		successRate = (float64(successfulRuns) / float64(totalRuns)) * 100
 	}
 
-	filter.WindowHours = windowHours
 	out = persistence.OverviewMetrics{
 		WindowStart:    windowStart,
 		WindowEnd:      windowEnd,
@@ -63,44 +80,62 @@ func (s *Store) GetOverviewMetrics(ctx context.Context, filter persistence.Overv
 		FailedRuns:     failedRuns,
 		SuccessRate:    successRate,
 		TotalCostUSD:   totalCostUSD,
+		CostBasis:      persistence.OverviewCostFinishedRuns,
 		AvgLatencyMS:   avgLatencyMS,
+
+		RunLatency:       runLatency,
+		StepLatency:      stepLatency,
+		ModelCallLatency: modelCallLatency,
+		Source:           persistence.OverviewSourceRaw,
 	}
 
 	return out, nil
 }
 
+// overviewWindow resolves the filter window as of now, along with its length
+// in whole hours (rounded up) for the response.
+func overviewWindow(filter persistence.OverviewFilter) (time.Time, time.Time, int, error) {
+	windowStart, windowEnd, err := filter.Window(time.Now())
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, err
+	}
+
+	windowHours := int(math.Ceil(windowEnd.Sub(windowStart).Hours()))
+	return windowStart, windowEnd, windowHours, nil
+}
+
 func buildOverviewQuery(windowStart time.Time, windowEnd time.Time, filter persistence.OverviewFilter) (string, []any) {
 	var b strings.Builder
 	args := make([]any, 0, 8)
 
+	// Runs count in the window they finished in; in-flight runs are excluded,
+	// and so is their cost (persistence.OverviewCostFinishedRuns).
 	b.WriteString(`
 SELECT
-  COALESCE(SUM(CASE WHEN event_type IN ('run.completed', 'run.failed') THEN 1 ELSE 0 END), 0) AS total_runs,
-  COALESCE(SUM(CASE WHEN event_type = 'run.completed' THEN 1 ELSE 0 END), 0) AS successful_runs,
-  COALESCE(SUM(CASE WHEN event_type = 'run.failed' THEN 1 ELSE 0 END), 0) AS failed_runs,
-  COALESCE(SUM(cost_usd), 0) AS total_cost_usd,
-  COALESCE(
-    AVG(
-      CASE
-        WHEN event_type IN ('run.completed', 'run.failed')
-             AND payload->'run'->>'latency_ms' IS NOT NULL
-        THEN (payload->'run'->>'latency_ms')::DOUBLE PRECISION
-      END
-    ),
-    0
-  ) AS avg_latency_ms
-FROM agent_events
-WHERE occurred_at >= $1 AND occurred_at <= $2`)
+  COUNT(*) AS total_runs,
+  COUNT(*) FILTER (WHERE status = 'success') AS successful_runs,
+  COUNT(*) FILTER (WHERE status = 'failure') AS failed_runs,
+  COALESCE(SUM(total_cost_usd), 0) AS total_cost_usd,
+  COALESCE(AVG(latency_ms), 0) AS avg_latency_ms,
+  ` + percentileColumns("latency_ms", "") + `
+FROM runs
+WHERE status <> 'started' AND ended_at >= $1 AND ended_at <= $2`)
 	args = append(args, windowStart, windowEnd)
 
-	nextArg := 3
+	args = appendOverviewFilters(&b, args, filter)
+
+	return b.String(), args
+}
+
+// appendOverviewFilters adds an equality predicate per non-empty filter
+// dimension, numbering placeholders after the existing args.
+func appendOverviewFilters(b *strings.Builder, args []any, filter persistence.OverviewFilter) []any {
 	appendFilter := func(column string, value string) {
 		if value == "" {
 			return
 		}
-		b.WriteString(fmt.Sprintf(" AND %s = $%d", column, nextArg))
 		args = append(args, value)
-		nextArg++
+		b.WriteString(fmt.Sprintf(" AND %s = $%d", column, len(args)))
 	}
 
 	appendFilter("tenant_id", filter.TenantID)
@@ -109,5 +144,34 @@ WHERE occurred_at >= $1 AND occurred_at <= $2`)
 	appendFilter("agent_id", filter.AgentID)
 	appendFilter("workflow_id", filter.WorkflowID)
 
-	return b.String(), args
+	return args
+}
+
+// policyViolationsSQL counts policy.decision events that blocked an action.
+const policyViolationsSQL = `
+SELECT COUNT(*)
+FROM agent_events
+WHERE event_type = 'policy.decision' AND payload->'policy'->>'decision' = 'block'
+  AND occurred_at >= $1 AND occurred_at <= $2`
+
+// CountPolicyViolations counts blocking policy decisions in the filter's window.
+func (s *Store) CountPolicyViolations(ctx context.Context, filter persistence.OverviewFilter) (int64, error) {
+	if s == nil || s.db == nil || s.queryRow == nil {
+		return 0, errors.New("event store is not configured")
+	}
+
+	windowStart, windowEnd, _, err := overviewWindow(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var b strings.Builder
+	b.WriteString(policyViolationsSQL)
+	args := appendOverviewFilters(&b, []any{windowStart, windowEnd}, filter)
+
+	var violations int64
+	if err := s.queryRow(ctx, b.String(), args...).Scan(&violations); err != nil {
+		return 0, fmt.Errorf("query policy violations: %w", err)
+	}
+	return violations, nil
 }
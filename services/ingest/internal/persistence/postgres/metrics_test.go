@@ -35,6 +35,20 @@ func (f fakeScanRow) Scan(dest ...any) error {
 	return nil
 }
 
+// overviewRows answers the runs query with runs and the call latency query with calls.
+func overviewRows(runs []any, calls []any) queryRowFunc {
+	return func(_ context.Context, query string, _ ...any) rowScanner {
+		if strings.Contains(query, "call_latencies") {
+			return fakeScanRow{values: calls}
+		}
+		return fakeScanRow{values: runs}
+	}
+}
+
+func latencyValues(p50, p90, p95, p99 float64) []any {
+	return []any{p50, p90, p95, p99}
+}
+
 func TestBuildOverviewQueryIncludesFilters(t *testing.T) {
 	start := time.Date(2026, 2, 7, 0, 0, 0, 0, time.UTC)
 	end := start.Add(24 * time.Hour)
@@ -66,20 +80,24 @@ func TestBuildOverviewQueryIncludesFilters(t *testing.T) {
 	if len(args) != 7 {
 		t.Fatalf("args len = %d, want 7", len(args))
 	}
+	if !strings.Contains(query, "FROM runs") {
+		t.Fatalf("query should read the runs table: %s", query)
+	}
+	// Cost is that of runs that ended in the window, like the run counts.
+	for _, want := range []string{"SUM(total_cost_usd)", "status <> 'started' AND ended_at >= $1 AND ended_at <= $2"} {
+		if !strings.Contains(query, want) {
+			t.Fatalf("query missing %q: %s", want, query)
+		}
+	}
 }
 
 func TestGetOverviewMetricsReturnsComputedValues(t *testing.T) {
 	store := &Store{
 		db: &fakeDB{},
-		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
-			return fakeScanRow{values: []any{
-				int64(10),
-				int64(8),
-				int64(2),
-				float64(12.34),
-				float64(150),
-			}}
-		},
+		queryRow: overviewRows(
+			append([]any{int64(10), int64(8), int64(2), float64(12.34), float64(150)}, latencyValues(100, 200, 300, 900)...),
+			append(latencyValues(10, 20, 30, 40), latencyValues(500, 800, 1200, 4000)...),
+		),
 	}
 
 	overview, err := store.GetOverviewMetrics(context.Background(), persistence.OverviewFilter{WindowHours: 24})
@@ -99,26 +117,27 @@ func TestGetOverviewMetricsReturnsComputedValues(t *testing.T) {
 	if overview.SuccessRate != 80 {
 		t.Fatalf("SuccessRate = %v, want 80", overview.SuccessRate)
 	}
-	if overview.TotalCostUSD != 12.34 {
-		t.Fatalf("TotalCostUSD = %v, want 12.34", overview.TotalCostUSD)
+	if overview.TotalCostUSD != 12.34 || overview.CostBasis != persistence.OverviewCostFinishedRuns {
+		t.Fatalf("cost = %v (%s), want 12.34 over finished runs", overview.TotalCostUSD, overview.CostBasis)
 	}
 	if overview.AvgLatencyMS != 150 {
 		t.Fatalf("AvgLatencyMS = %v, want 150", overview.AvgLatencyMS)
 	}
+	if want := (persistence.LatencyPercentiles{P50: 100, P90: 200, P95: 300, P99: 900}); overview.RunLatency != want {
+		t.Fatalf("RunLatency = %+v, want %+v", overview.RunLatency, want)
+	}
+	if overview.StepLatency.P99 != 40 || overview.ModelCallLatency.P95 != 1200 {
+		t.Fatalf("call latencies = %+v / %+v", overview.StepLatency, overview.ModelCallLatency)
+	}
 }
 
 func TestGetOverviewMetricsEmptyDataset(t *testing.T) {
 	store := &Store{
 		db: &fakeDB{},
-		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
-			return fakeScanRow{values: []any{
-				int64(0),
-				int64(0),
-				int64(0),
-				float64(0),
-				float64(0),
-			}}
-		},
+		queryRow: overviewRows(
+			append([]any{int64(0), int64(0), int64(0), float64(0), float64(0)}, latencyValues(0, 0, 0, 0)...),
+			append(latencyValues(0, 0, 0, 0), latencyValues(0, 0, 0, 0)...),
+		),
 	}
 
 	overview, err := store.GetOverviewMetrics(context.Background(), persistence.OverviewFilter{})
@@ -137,15 +156,10 @@ func TestGetOverviewMetricsEmptyDataset(t *testing.T) {
 func TestGetOverviewMetricsRejectsBadWindow(t *testing.T) {
 	store := &Store{
 		db: &fakeDB{},
-		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
-			return fakeScanRow{values: []any{
-				int64(0),
-				int64(0),
-				int64(0),
-				float64(0),
-				float64(0),
-			}}
-		},
+		queryRow: overviewRows(
+			append([]any{int64(0), int64(0), int64(0), float64(0), float64(0)}, latencyValues(0, 0, 0, 0)...),
+			append(latencyValues(0, 0, 0, 0), latencyValues(0, 0, 0, 0)...),
+		),
 	}
 
 	_, err := store.GetOverviewMetrics(context.Background(), persistence.OverviewFilter{WindowHours: 0})
@@ -158,3 +172,24 @@ func TestGetOverviewMetricsRejectsBadWindow(t *testing.T) {
 		t.Fatal("expected error for invalid window hours")
 	}
 }
+
+func TestBuildCallLatencyQuery(t *testing.T) {
+	start := time.Date(2026, 2, 7, 0, 0, 0, 0, time.UTC)
+
+	query, args := buildCallLatencyQuery(start, start.Add(time.Hour), 0, persistence.OverviewFilter{AgentID: "agent-1"})
+	if strings.Contains(query, "date_bin") || !strings.Contains(query, "agent_id = $3") || len(args) != 3 {
+		t.Fatalf("overview latency query = %s, args = %v", query, args)
+	}
+	if !strings.Contains(query, "percentile_cont(0.99) WITHIN GROUP (ORDER BY latency_ms) FILTER (WHERE event_type LIKE 'model.call.%')") {
+		t.Fatalf("query missing model call p99: %s", query)
+	}
+	// Validation accepts whole-number floats such as 12.0, which a direct BIGINT cast rejects.
+	if !strings.Contains(query, "(payload->'step'->>'latency_ms')::NUMERIC::BIGINT") {
+		t.Fatalf("query must cast latency through NUMERIC: %s", query)
+	}
+
+	query, args = buildCallLatencyQuery(start, start.Add(time.Hour), 5*time.Minute, persistence.OverviewFilter{AgentID: "agent-1"})
+	if !strings.Contains(query, "GROUP BY bucket_start") || !strings.Contains(query, "agent_id = $4") || args[2] != int64(300) {
+		t.Fatalf("bucketed latency query = %s, args = %v", query, args)
+	}
+}
@@ -0,0 +1,274 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const (
+	eventPartitionPrefix = "agent_events_p"
+	eventPartitionLayout = "20060102"
+	eventArchiveSchema   = "agent_events_archive"
+	oneDay               = 24 * time.Hour
+)
+
+const selectEventPartitionsSQL = `
+SELECT child.relname
+FROM pg_inherits
+JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+WHERE parent.relname = 'agent_events' AND child.relname LIKE 'agent\_events\_p%'
+`
+
+const selectRetentionPoliciesSQL = `SELECT tenant_id, retention_days FROM tenant_retention_policies`
+
+// retentionPurge deletes what one retention cutoff expires: the events with
+// their event_ids, the runs whose newest event expired, and the hourly and
+// daily rollup buckets that end by the cutoff. Every statement takes the same
+// arguments. Partitions are only dropped past every tenant's cutoff, so the
+// ids of dropped or archived events are released here too.
+type retentionPurge struct {
+	events, runs, hourly, daily string
+}
+
+// tenantRetentionPurge applies a tenant's policy: $1 is the tenant, $2 the cutoff.
+var tenantRetentionPurge = newRetentionPurge("tenant_id = $1", "$2::TIMESTAMPTZ")
+
+// defaultRetentionPurge applies the default retention to tenants without a
+// policy: $1 is the cutoff, $2 the tenants with one.
+var defaultRetentionPurge = newRetentionPurge("tenant_id <> ALL($2)", "$1::TIMESTAMPTZ")
+
+func newRetentionPurge(tenant, cutoff string) retentionPurge {
+	return retentionPurge{
+		events: fmt.Sprintf(`
+WITH released AS (
+  DELETE FROM agent_event_ids WHERE %[1]s AND occurred_at < %[2]s
+)
+DELETE FROM agent_events WHERE %[1]s AND occurred_at < %[2]s`, tenant, cutoff),
+		runs:   fmt.Sprintf(`DELETE FROM runs WHERE %s AND last_event_at < %s`, tenant, cutoff),
+		hourly: fmt.Sprintf(`DELETE FROM rollups_hourly WHERE %s AND bucket_start <= %s - INTERVAL '1 hour'`, tenant, cutoff),
+		daily:  fmt.Sprintf(`DELETE FROM rollups_daily WHERE %s AND bucket_start <= %s - INTERVAL '1 day'`, tenant, cutoff),
+	}
+}
+
+// MaintainEventPartitions creates the daily agent_events partitions from
+// today through policy.PrecreateDays ahead, drops or archives partitions past
+// every tenant's retention, and deletes the remaining expired events of
+// tenants whose retention ends inside a live partition, along with the runs
+// and rollups built from expired events.
+func (s *Store) MaintainEventPartitions(ctx context.Context, policy persistence.PartitionPolicy) (persistence.PartitionMaintenance, error) {
+	var out persistence.PartitionMaintenance
+
+	if s == nil || s.db == nil || s.queryRows == nil {
+		return out, errors.New("event store is not configured")
+	}
+
+	existing, err := s.eventPartitionDays(ctx)
+	if err != nil {
+		return out, err
+	}
+	tenantDays, err := s.retentionPolicies(ctx)
+	if err != nil {
+		return out, err
+	}
+
+	today := policy.Now.UTC().Truncate(oneDay)
+	for _, start := range missingPartitionDays(existing, today, policy.PrecreateDays) {
+		if _, err := s.db.ExecContext(ctx, createEventPartitionSQL(start)); err != nil {
+			return out, fmt.Errorf("create partition %s: %w", eventPartitionName(start), err)
+		}
+		out.Created = append(out.Created, eventPartitionName(start))
+	}
+
+	if cutoff, ok := partitionCutoff(today, policy.DefaultRetentionDays, tenantDays); ok {
+		for _, start := range existing {
+			if start.Add(oneDay).After(cutoff) {
+				continue
+			}
+			name := eventPartitionName(start)
+			if policy.Archive {
+				if _, err := s.db.ExecContext(ctx, archiveEventPartitionSQL(name)); err != nil {
+					return out, fmt.Errorf("archive partition %s: %w", name, err)
+				}
+				out.Archived = append(out.Archived, name)
+				continue
+			}
+			if _, err := s.db.ExecContext(ctx, dropEventPartitionSQL(name)); err != nil {
+				return out, fmt.Errorf("drop partition %s: %w", name, err)
+			}
+			out.Dropped = append(out.Dropped, name)
+		}
+	}
+
+	tenants := make([]string, 0, len(tenantDays))
+	for tenantID := range tenantDays {
+		tenants = append(tenants, tenantID)
+	}
+	sort.Strings(tenants)
+
+	for _, tenantID := range tenants {
+		cutoff := policy.Now.Add(-time.Duration(tenantDays[tenantID]) * oneDay)
+		if err := s.purgeExpired(ctx, &out, tenantRetentionPurge, tenantID, cutoff); err != nil {
+			return out, fmt.Errorf("purge tenant %s: %w", tenantID, err)
+		}
+	}
+	if policy.DefaultRetentionDays > 0 {
+		cutoff := policy.Now.Add(-time.Duration(policy.DefaultRetentionDays) * oneDay)
+		if err := s.purgeExpired(ctx, &out, defaultRetentionPurge, cutoff, tenants); err != nil {
+			return out, fmt.Errorf("purge expired rows: %w", err)
+		}
+	}
+
+	return out, nil
+}
+
+// purgeExpired runs purge's statements with args and adds up what they deleted.
+func (s *Store) purgeExpired(ctx context.Context, out *persistence.PartitionMaintenance, purge retentionPurge, args ...any) error {
+	for _, step := range []struct {
+		table string
+		query string
+		count *int64
+	}{
+		{"agent_events", purge.events, &out.PurgedEvents},
+		{"runs", purge.runs, &out.PurgedRuns},
+		{"rollups_hourly", purge.hourly, &out.PurgedRollups},
+		{"rollups_daily", purge.daily, &out.PurgedRollups},
+	} {
+		result, err := s.db.ExecContext(ctx, step.query, args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.table, err)
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.table, err)
+		}
+		*step.count += deleted
+	}
+	return nil
+}
+
+// eventPartitionDays returns the start day of every daily partition, oldest first.
+func (s *Store) eventPartitionDays(ctx context.Context) ([]time.Time, error) {
+	rows, err := s.queryRows(ctx, selectEventPartitionsSQL)
+	if err != nil {
+		return nil, fmt.Errorf("query agent_events partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var days []time.Time
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan agent_events partition: %w", err)
+		}
+		start, err := time.Parse(eventPartitionLayout, strings.TrimPrefix(name, eventPartitionPrefix))
+		if err != nil {
+			continue
+		}
+		days = append(days, start)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query agent_events partitions: %w", err)
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+func (s *Store) retentionPolicies(ctx context.Context) (map[string]int, error) {
+	rows, err := s.queryRows(ctx, selectRetentionPoliciesSQL)
+	if err != nil {
+		return nil, fmt.Errorf("query retention policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := make(map[string]int)
+	for rows.Next() {
+		var tenantID string
+		var days int64
+		if err := rows.Scan(&tenantID, &days); err != nil {
+			return nil, fmt.Errorf("scan retention policy: %w", err)
+		}
+		policies[tenantID] = int(days)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+// missingPartitionDays lists the days in [today, today+ahead] without a partition.
+func missingPartitionDays(existing []time.Time, today time.Time, ahead int) []time.Time {
+	have := make(map[time.Time]bool, len(existing))
+	for _, start := range existing {
+		have[start] = true
+	}
+
+	var missing []time.Time
+	for i := 0; i <= ahead; i++ {
+		start := today.Add(time.Duration(i) * oneDay)
+		if !have[start] {
+			missing = append(missing, start)
+		}
+	}
+	return missing
+}
+
+// partitionCutoff is the day before which every tenant's events have
+// expired, so whole partitions ending by it can go. Without a default
+// retention, tenants without a policy keep events forever and nothing is cut.
+func partitionCutoff(today time.Time, defaultDays int, tenantDays map[string]int) (time.Time, bool) {
+	if defaultDays <= 0 {
+		return time.Time{}, false
+	}
+
+	longest := defaultDays
+	for _, days := range tenantDays {
+		longest = max(longest, days)
+	}
+	return today.Add(-time.Duration(longest) * oneDay), true
+}
+
+func eventPartitionName(start time.Time) string {
+	return eventPartitionPrefix + start.Format(eventPartitionLayout)
+}
+
+// createEventPartitionSQL creates the partition for the day at start. Events
+// for that day already caught by agent_events_default are moved into it
+// before it is attached, which Postgres requires. The statements run as one
+// implicit transaction since the query has no parameters.
+func createEventPartitionSQL(start time.Time) string {
+	name := eventPartitionName(start)
+	from := start.Format(time.RFC3339)
+	to := start.Add(oneDay).Format(time.RFC3339)
+
+	return fmt.Sprintf(`
+CREATE TABLE %[1]s (LIKE agent_events INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+WITH moved AS (
+  DELETE FROM agent_events_default
+  WHERE occurred_at >= '%[2]s' AND occurred_at < '%[3]s'
+  RETURNING *
+)
+INSERT INTO %[1]s SELECT * FROM moved;
+ALTER TABLE agent_events ATTACH PARTITION %[1]s FOR VALUES FROM ('%[2]s') TO ('%[3]s');
+`, name, from, to)
+}
+
+// archiveEventPartitionSQL detaches a partition into the archive schema,
+// where it stays queryable until an operator exports or drops it.
+func archiveEventPartitionSQL(name string) string {
+	return fmt.Sprintf(`
+ALTER TABLE agent_events DETACH PARTITION %[1]s;
+ALTER TABLE %[1]s SET SCHEMA %[2]s;
+`, name, eventArchiveSchema)
+}
+
+func dropEventPartitionSQL(name string) string {
+	return "DROP TABLE " + name
+}
@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+func partitionDay(d int) time.Time {
+	return time.Date(2026, 2, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMissingPartitionDaysSpansMonthBoundary(t *testing.T) {
+	today := time.Date(2026, 1, 30, 0, 0, 0, 0, time.UTC)
+	existing := []time.Time{today, today.Add(oneDay)}
+
+	got := missingPartitionDays(existing, today, 3)
+	want := []time.Time{partitionDay(1), partitionDay(2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("missingPartitionDays() = %v, want %v", got, want)
+	}
+}
+
+func TestPartitionCutoffWaitsForLongestRetention(t *testing.T) {
+	today := partitionDay(28)
+
+	if _, ok := partitionCutoff(today, 0, map[string]int{"tenant-1": 7}); ok {
+		t.Fatal("partitionCutoff() = true, want no drops while tenants without a policy keep events forever")
+	}
+	cutoff, ok := partitionCutoff(today, 7, map[string]int{"tenant-1": 3, "tenant-2": 14})
+	if !ok || !cutoff.Equal(partitionDay(14)) {
+		t.Fatalf("partitionCutoff() = %v, %v, want %v", cutoff, ok, partitionDay(14))
+	}
+}
+
+func TestCreateEventPartitionSQLMovesDefaultRows(t *testing.T) {
+	got := createEventPartitionSQL(partitionDay(7))
+
+	for _, want := range []string{
+		"CREATE TABLE agent_events_p20260207 (LIKE agent_events INCLUDING DEFAULTS INCLUDING CONSTRAINTS);",
+		"DELETE FROM agent_events_default\n  WHERE occurred_at >= '2026-02-07T00:00:00Z' AND occurred_at < '2026-02-08T00:00:00Z'",
+		"INSERT INTO agent_events_p20260207 SELECT * FROM moved;",
+		"ATTACH PARTITION agent_events_p20260207 FOR VALUES FROM ('2026-02-07T00:00:00Z') TO ('2026-02-08T00:00:00Z')",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("partition SQL missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRetentionPurgeCoversIDsRunsAndWholeBuckets(t *testing.T) {
+	for _, want := range []string{
+		"DELETE FROM agent_event_ids WHERE tenant_id = $1 AND occurred_at < $2::TIMESTAMPTZ",
+		"DELETE FROM agent_events WHERE tenant_id = $1 AND occurred_at < $2::TIMESTAMPTZ",
+	} {
+		if !strings.Contains(tenantRetentionPurge.events, want) {
+			t.Fatalf("events purge missing %q:\n%s", want, tenantRetentionPurge.events)
+		}
+	}
+	if want := "DELETE FROM runs WHERE tenant_id <> ALL($2) AND last_event_at < $1::TIMESTAMPTZ"; defaultRetentionPurge.runs != want {
+		t.Fatalf("runs purge = %q, want %q", defaultRetentionPurge.runs, want)
+	}
+	// A bucket goes only once it ends by the cutoff.
+	if !strings.HasSuffix(tenantRetentionPurge.hourly, "bucket_start <= $2::TIMESTAMPTZ - INTERVAL '1 hour'") ||
+		!strings.HasSuffix(tenantRetentionPurge.daily, "bucket_start <= $2::TIMESTAMPTZ - INTERVAL '1 day'") {
+		t.Fatalf("rollup purges = %q, %q", tenantRetentionPurge.hourly, tenantRetentionPurge.daily)
+	}
+}
+
+func TestMaintainEventPartitions(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		archive bool
+		expired string
+	}{
+		{name: "drop", expired: "DROP TABLE agent_events_p20260201"},
+		{name: "archive", archive: true, expired: "ALTER TABLE agent_events_p20260201 SET SCHEMA agent_events_archive"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &execRecorder{}
+			store := &Store{
+				db: db,
+				queryRows: func(_ context.Context, query string, _ ...any) (rowsScanner, error) {
+					if strings.Contains(query, "tenant_retention_policies") {
+						return &valuesRows{rows: [][]any{{"tenant-short", int64(2)}}}, nil
+					}
+					return &valuesRows{rows: [][]any{
+						{"agent_events_p20260202"},
+						{"agent_events_p20260201"},
+						{"agent_events_p20260208"},
+					}}, nil
+				},
+			}
+
+			now := partitionDay(8).Add(15 * time.Hour)
+			result, err := store.MaintainEventPartitions(context.Background(), persistence.PartitionPolicy{
+				Now:                  now,
+				PrecreateDays:        2,
+				DefaultRetentionDays: 6,
+				Archive:              tc.archive,
+			})
+			if err != nil {
+				t.Fatalf("MaintainEventPartitions() error = %v", err)
+			}
+
+			if want := []string{"agent_events_p20260209", "agent_events_p20260210"}; !reflect.DeepEqual(result.Created, want) {
+				t.Fatalf("Created = %v, want %v", result.Created, want)
+			}
+			expired := result.Dropped
+			if tc.archive {
+				expired = result.Archived
+			}
+			if !reflect.DeepEqual(expired, []string{"agent_events_p20260201"}) {
+				t.Fatalf("result = %+v, want only the partition ending by the cutoff expired", result)
+			}
+			// The fake reports one deleted row per statement.
+			if result.PurgedEvents != 2 || result.PurgedRuns != 2 || result.PurgedRollups != 4 {
+				t.Fatalf("result = %+v, want each purge statement run for both cutoffs", result)
+			}
+
+			if len(db.execs) != 11 {
+				t.Fatalf("executed %d statements, want 11", len(db.execs))
+			}
+			if !strings.Contains(db.execs[2].query, tc.expired) {
+				t.Fatalf("expiry statement = %q, want %q", db.execs[2].query, tc.expired)
+			}
+			purges := []string{tenantRetentionPurge.events, tenantRetentionPurge.runs, tenantRetentionPurge.hourly, tenantRetentionPurge.daily,
+				defaultRetentionPurge.events, defaultRetentionPurge.runs, defaultRetentionPurge.hourly, defaultRetentionPurge.daily}
+			for i, want := range purges {
+				got := db.execs[3+i]
+				if got.query != want {
+					t.Fatalf("purge %d = %q, want %q", i, got.query, want)
+				}
+				if i < 4 && (got.args[0] != "tenant-short" || got.args[1] != now.Add(-2*oneDay)) {
+					t.Fatalf("tenant purge %d args = %v", i, got.args)
+				}
+				if i >= 4 && (got.args[0] != now.Add(-6*oneDay) || !reflect.DeepEqual(got.args[1], []string{"tenant-short"})) {
+					t.Fatalf("default purge %d args = %v", i, got.args)
+				}
+			}
+		})
+	}
+}
+
+func TestInsertEventsAcrossPartitionBoundary(t *testing.T) {
+	var queries []recordedQuery
+	store := returningStore(map[string]bool{
+		"550e8400-e29b-41d4-a716-446655440001": true,
+		"550e8400-e29b-41d4-a716-446655440002": true,
+	}, &queries)
+
+	beforeMidnight := payloadWithID("550e8400-e29b-41d4-a716-446655440001")
+	beforeMidnight["occurred_at"] = "2026-02-07T23:59:59.999Z"
+	afterMidnight := payloadWithID("550e8400-e29b-41d4-a716-446655440002")
+	afterMidnight["occurred_at"] = "2026-02-08T00:00:00Z"
+
+	inserted, err := store.InsertEvents(context.Background(), []map[string]any{beforeMidnight, afterMidnight})
+	if err != nil {
+		t.Fatalf("InsertEvents() error = %v", err)
+	}
+	if !inserted[0] || !inserted[1] {
+		t.Fatalf("inserted = %v, want both days inserted", inserted)
+	}
+
+	// Postgres routes each row to its day; the statement only names the parent.
+	if len(queries) != 1 || !strings.Contains(queries[0].query, "INSERT INTO agent_events (") {
+		t.Fatalf("queries = %d, want one insert into the partitioned parent", len(queries))
+	}
+	if strings.Contains(queries[0].query, eventPartitionPrefix) {
+		t.Fatalf("insert must not target a partition directly:\n%s", queries[0].query)
+	}
+	occurredAt := func(row int) time.Time {
+		return queries[0].args[row*len(eventColumns)+3].(time.Time)
+	}
+	if got := occurredAt(1).Sub(occurredAt(0)); got != time.Millisecond {
+		t.Fatalf("occurred_at gap = %v, want rows straddling midnight", got)
+	}
+}
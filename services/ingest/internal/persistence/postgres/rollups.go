@@ -0,0 +1,522 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const rollupWatermarkName = "rollups"
+
+// Metrics for windows longer than rollupMinWindow are served from rollups;
+// shorter windows are read exactly from runs and agent_events.
+const rollupMinWindow = 24 * time.Hour
+
+// latencyBoundsMS are the inclusive upper bounds of the latency histogram
+// buckets stored in rollups; one more bucket counts everything above the last.
+var latencyBoundsMS = [...]int64{
+	5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000,
+	10000, 25000, 60000, 120000, 300000, 600000, 1800000, 3600000,
+}
+
+// rollupInputSQL normalizes finished runs and completed/failed step and model
+// call events into one row shape with a timestamp ts. Predicates on ts and the
+// dimension columns are pushed down into both branches.
+const rollupInputSQL = `(
+  SELECT
+    'run' AS kind, ended_at AS ts, tenant_id, workspace_id, project_id, agent_id, workflow_id, '' AS provider, '' AS model,
+    status = 'success' AS succeeded, status = 'failure' AS failed,
+    total_cost_usd AS cost_usd, total_tokens, latency_ms
+  FROM runs
+  WHERE status <> 'started'
+  UNION ALL
+  SELECT
+    CASE WHEN event_type LIKE 'step.%' THEN 'step' ELSE 'model_call' END, occurred_at, tenant_id, workspace_id, project_id, agent_id, workflow_id,
+    CASE WHEN event_type LIKE 'model.call.%' THEN COALESCE(payload->'model_call'->>'provider', '') ELSE '' END,
+    CASE WHEN event_type LIKE 'model.call.%' THEN COALESCE(payload->'model_call'->>'model', '') ELSE '' END,
+    event_type LIKE '%.completed', event_type LIKE '%.failed',
+    cost_usd, total_tokens, (payload->'step'->>'latency_ms')::NUMERIC::BIGINT
+  FROM agent_events
+  WHERE event_type IN ('step.completed', 'step.failed', 'model.call.completed', 'model.call.failed')
+) rollup_input`
+
+const rollupDimensions = `kind, tenant_id, workspace_id, project_id, agent_id, workflow_id, provider, model`
+
+const rollupMeasures = `total_count, success_count, failure_count, cost_usd, total_tokens, latency_sum_ms, latency_count, latency_histogram`
+
+// rollupAggregatesSQL aggregates rollup_input rows into rollupMeasures.
+var rollupAggregatesSQL = `
+  COUNT(*) AS total_count,
+  COUNT(*) FILTER (WHERE succeeded) AS success_count,
+  COUNT(*) FILTER (WHERE failed) AS failure_count,
+  COALESCE(SUM(cost_usd), 0) AS cost_usd,
+  COALESCE(SUM(total_tokens), 0)::BIGINT AS total_tokens,
+  COALESCE(SUM(latency_ms), 0)::BIGINT AS latency_sum_ms,
+  COUNT(latency_ms) AS latency_count,
+  ` + histogramSQL("latency_ms") + ` AS latency_histogram`
+
+// histogramSQL counts column into the latencyBoundsMS buckets.
+func histogramSQL(column string) string {
+	counts := make([]string, 0, len(latencyBoundsMS)+1)
+	lower := ""
+	for _, bound := range latencyBoundsMS {
+		upper := strconv.FormatInt(bound, 10)
+		predicate := column + " <= " + upper
+		if lower != "" {
+			predicate = column + " > " + lower + " AND " + predicate
+		}
+		counts = append(counts, "COUNT(*) FILTER (WHERE "+predicate+")")
+		lower = upper
+	}
+	counts = append(counts, "COUNT(*) FILTER (WHERE "+column+" > "+lower+")")
+	return "ARRAY[" + strings.Join(counts, ", ") + "]::BIGINT[]"
+}
+
+// rollupUpsertSQL recomputes every row of table within [$1, $2) from source
+// and removes rows whose key no longer has data there.
+func rollupUpsertSQL(table string, source string) string {
+	return `
+WITH recomputed AS (` + source + `
+),
+removed AS (
+  DELETE FROM ` + table + ` AS existing
+  WHERE existing.bucket_start >= $1 AND existing.bucket_start < $2
+    AND NOT EXISTS (
+      SELECT 1 FROM recomputed
+      WHERE (recomputed.bucket_start, ` + prefixColumns("recomputed", rollupDimensions) + `)
+        = (existing.bucket_start, ` + prefixColumns("existing", rollupDimensions) + `)
+    )
+)
+INSERT INTO ` + table + ` (bucket_start, ` + rollupDimensions + `, ` + rollupMeasures + `)
+SELECT bucket_start, ` + rollupDimensions + `, ` + rollupMeasures + ` FROM recomputed
+ON CONFLICT (bucket_start, ` + rollupDimensions + `) DO UPDATE SET
+  total_count = EXCLUDED.total_count,
+  success_count = EXCLUDED.success_count,
+  failure_count = EXCLUDED.failure_count,
+  cost_usd = EXCLUDED.cost_usd,
+  total_tokens = EXCLUDED.total_tokens,
+  latency_sum_ms = EXCLUDED.latency_sum_ms,
+  latency_count = EXCLUDED.latency_count,
+  latency_histogram = EXCLUDED.latency_histogram,
+  updated_at = NOW()
+`
+}
+
+var (
+	// rollupHourlySQL re-aggregates the hours in [$1, $2) from runs and agent_events.
+	rollupHourlySQL = rollupUpsertSQL("rollups_hourly", `
+  SELECT date_trunc('hour', ts, 'UTC') AS bucket_start, `+rollupDimensions+`,`+rollupAggregatesSQL+`
+  FROM `+rollupInputSQL+`
+  WHERE ts >= $1 AND ts < $2
+  GROUP BY 1, `+rollupDimensions)
+
+	// rollupDailySQL re-aggregates the days in [$1, $2) from rollups_hourly.
+	rollupDailySQL = rollupUpsertSQL("rollups_daily", `
+  SELECT
+    date_trunc('day', bucket_start, 'UTC') AS bucket_start, `+rollupDimensions+`,
+    SUM(total_count)::BIGINT AS total_count,
+    SUM(success_count)::BIGINT AS success_count,
+    SUM(failure_count)::BIGINT AS failure_count,
+    SUM(cost_usd) AS cost_usd,
+    SUM(total_tokens)::BIGINT AS total_tokens,
+    SUM(latency_sum_ms)::BIGINT AS latency_sum_ms,
+    SUM(latency_count)::BIGINT AS latency_count,
+    histogram_sum(latency_histogram) AS latency_histogram
+  FROM rollups_hourly
+  WHERE bucket_start >= $1 AND bucket_start < $2
+  GROUP BY 1, `+rollupDimensions)
+)
+
+const selectRollupWatermarkSQL = `SELECT watermark FROM rollup_watermarks WHERE name = $1`
+
+const upsertRollupWatermarkSQL = `
+INSERT INTO rollup_watermarks (name, watermark) VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET watermark = EXCLUDED.watermark, updated_at = NOW()
+`
+
+// selectAffectedHoursSQL lists the hours touched by rows ingested in ($1, $2]:
+// the occurrence hour of new step and model call events (however late they
+// arrive), the end hour of runs the ingest statements updated, and the hours
+// those runs moved out of, marked in rollup_dirty_hours up to $2.
+const selectAffectedHoursSQL = `
+SELECT date_trunc('hour', occurred_at, 'UTC') AS hour_start
+FROM agent_events
+WHERE ingested_at > $1 AND ingested_at <= $2
+  AND event_type IN ('step.completed', 'step.failed', 'model.call.completed', 'model.call.failed')
+UNION
+SELECT date_trunc('hour', ended_at, 'UTC')
+FROM runs
+WHERE updated_at > $1 AND updated_at <= $2 AND status <> 'started'
+UNION
+SELECT hour_start
+FROM rollup_dirty_hours
+WHERE marked_at <= $2
+ORDER BY 1
+`
+
+// clearDirtyHoursSQL removes the dirty hours a pass up to $1 recomputed.
+const clearDirtyHoursSQL = `DELETE FROM rollup_dirty_hours WHERE marked_at <= $1`
+
+// AggregateRollups folds rows ingested since the watermark, up to upTo, into
+// rollups_hourly and rollups_daily and then advances the watermark. Every
+// affected bucket is recomputed from its source rows, so late events and
+// retries never double count. upTo should trail now by enough for in-flight
+// inserts to commit, since their ingested_at is their transaction start.
+func (s *Store) AggregateRollups(ctx context.Context, upTo time.Time) (persistence.RollupResult, error) {
+	var out persistence.RollupResult
+
+	if s == nil || s.db == nil || s.queryRow == nil || s.queryRows == nil {
+		return out, errors.New("event store is not configured")
+	}
+
+	watermark, _, err := s.rollupWatermark(ctx)
+	if err != nil {
+		return out, err
+	}
+	out = persistence.RollupResult{PreviousWatermark: watermark, Watermark: watermark}
+	if !upTo.After(watermark) {
+		return out, nil
+	}
+
+	rows, err := s.queryRows(ctx, selectAffectedHoursSQL, watermark, upTo)
+	if err != nil {
+		return out, fmt.Errorf("query affected rollup hours: %w", err)
+	}
+	var hours []time.Time
+	for rows.Next() {
+		var hour time.Time
+		if err := rows.Scan(&hour); err != nil {
+			rows.Close()
+			return out, fmt.Errorf("scan affected rollup hour: %w", err)
+		}
+		hours = append(hours, hour.UTC())
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return out, fmt.Errorf("query affected rollup hours: %w", err)
+	}
+
+	for _, span := range hourSpans(hours) {
+		if _, err := s.db.ExecContext(ctx, rollupHourlySQL, span.start, span.end); err != nil {
+			return out, fmt.Errorf("aggregate hourly rollups: %w", err)
+		}
+		if _, err := s.db.ExecContext(ctx, rollupDailySQL, floorDay(span.start), ceilDay(span.end)); err != nil {
+			return out, fmt.Errorf("aggregate daily rollups: %w", err)
+		}
+	}
+
+	if len(hours) > 0 {
+		if _, err := s.db.ExecContext(ctx, clearDirtyHoursSQL, upTo); err != nil {
+			return out, fmt.Errorf("clear rollup dirty hours: %w", err)
+		}
+	}
+	if _, err := s.db.ExecContext(ctx, upsertRollupWatermarkSQL, rollupWatermarkName, upTo); err != nil {
+		return out, fmt.Errorf("advance rollup watermark: %w", err)
+	}
+
+	out.Watermark = upTo
+	out.Hours = len(hours)
+	return out, nil
+}
+
+// rollupWatermark returns the stored watermark, or the Unix epoch and false
+// before the aggregator first ran.
+func (s *Store) rollupWatermark(ctx context.Context) (time.Time, bool, error) {
+	var watermark time.Time
+	err := s.queryRow(ctx, selectRollupWatermarkSQL, rollupWatermarkName).Scan(&watermark)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Unix(0, 0).UTC(), false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("query rollup watermark: %w", err)
+	}
+	return watermark.UTC(), true, nil
+}
+
+type timeSpan struct {
+	start time.Time
+	end   time.Time
+}
+
+func (t timeSpan) empty() bool {
+	return !t.start.Before(t.end)
+}
+
+// hourSpans merges sorted hour starts into contiguous [start, end) spans.
+func hourSpans(hours []time.Time) []timeSpan {
+	var spans []timeSpan
+	for _, hour := range hours {
+		if n := len(spans); n > 0 && !hour.After(spans[n-1].end) {
+			if end := hour.Add(time.Hour); end.After(spans[n-1].end) {
+				spans[n-1].end = end
+			}
+			continue
+		}
+		spans = append(spans, timeSpan{start: hour, end: hour.Add(time.Hour)})
+	}
+	return spans
+}
+
+// rollupPlan splits an overview window into whole days served by
+// rollups_daily, whole hours served by rollups_hourly, and raw edges: the
+// partial hours at either end and everything after the watermark.
+type rollupPlan struct {
+	daily  timeSpan
+	hourly [2]timeSpan
+	raw    [2]timeSpan
+}
+
+// planRollups returns false when the window contains no whole hour before the watermark.
+func planRollups(windowStart time.Time, windowEnd time.Time, watermark time.Time) (rollupPlan, bool) {
+	rolledEnd := windowEnd
+	if watermark.Before(rolledEnd) {
+		rolledEnd = watermark
+	}
+
+	hourStart := windowStart.Truncate(time.Hour)
+	if hourStart.Before(windowStart) {
+		hourStart = hourStart.Add(time.Hour)
+	}
+	hourEnd := rolledEnd.Truncate(time.Hour)
+	if !hourStart.Before(hourEnd) {
+		return rollupPlan{}, false
+	}
+
+	dayStart, dayEnd := ceilDay(hourStart), floorDay(hourEnd)
+	if !dayStart.Before(dayEnd) {
+		dayStart, dayEnd = hourEnd, hourEnd
+	}
+
+	return rollupPlan{
+		daily:  timeSpan{dayStart, dayEnd},
+		hourly: [2]timeSpan{{hourStart, dayStart}, {dayEnd, hourEnd}},
+		raw:    [2]timeSpan{{windowStart, hourStart}, {hourEnd, windowEnd}},
+	}, true
+}
+
+func floorDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func ceilDay(t time.Time) time.Time {
+	day := floorDay(t)
+	if day.Before(t) {
+		day = day.Add(24 * time.Hour)
+	}
+	return day
+}
+
+// rollupKindTotals is one kind's merged measures from rollupTotalsSQL.
+type rollupKindTotals struct {
+	total, successful, failed int64
+	costUSD                   float64
+	tokens                    int64
+	latencySum, latencyCount  int64
+	histogram                 []int64
+}
+
+func (t rollupKindTotals) avgLatency() float64 {
+	if t.latencyCount == 0 {
+		return 0
+	}
+	return float64(t.latencySum) / float64(t.latencyCount)
+}
+
+// scan reads rollupTotalsSQL's columns after dest.
+func (t *rollupKindTotals) scan(rows rowsScanner, dest ...any) error {
+	var histogram string
+	dest = append(dest, &t.total, &t.successful, &t.failed, &t.costUSD, &t.tokens, &t.latencySum, &t.latencyCount, &histogram)
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(histogram), &t.histogram)
+}
+
+// rollupTotalsSQL merges rollup segment rows into rollupKindTotals.
+const rollupTotalsSQL = `
+  SUM(total_count)::BIGINT,
+  SUM(success_count)::BIGINT,
+  SUM(failure_count)::BIGINT,
+  COALESCE(SUM(cost_usd), 0),
+  COALESCE(SUM(total_tokens), 0)::BIGINT,
+  COALESCE(SUM(latency_sum_ms), 0)::BIGINT,
+  COALESCE(SUM(latency_count), 0)::BIGINT,
+  to_json(histogram_sum(latency_histogram))::TEXT`
+
+// withoutDaily reads the plan's whole days from rollups_hourly too, for
+// queries grouping by buckets shorter than a day.
+func (p rollupPlan) withoutDaily() rollupPlan {
+	start, end := p.hourly[0].start, p.hourly[1].end
+	p.daily = timeSpan{end, end}
+	p.hourly = [2]timeSpan{{start, end}, {end, end}}
+	return p
+}
+
+// appendRollupSegments writes the plan's daily rollups, hourly rollups and raw
+// edges as a UNION ALL of rows with bucket_start, the rollup dimensions and
+// the rollup measures. Raw edges are aggregated per hour on the fly; the raw
+// edge end is inclusive like the exact queries.
+func appendRollupSegments(b *strings.Builder, args []any, plan rollupPlan, filter persistence.OverviewFilter) []any {
+	segment := func(table string, spans []timeSpan) {
+		b.WriteString("\n  SELECT bucket_start, " + rollupDimensions + ", " + rollupMeasures + " FROM " + table + " WHERE (")
+		for i, span := range spans {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			args = append(args, span.start, span.end)
+			b.WriteString(fmt.Sprintf("(bucket_start >= $%d AND bucket_start < $%d)", len(args)-1, len(args)))
+		}
+		b.WriteString(")")
+		args = appendOverviewFilters(b, args, filter)
+	}
+
+	segment("rollups_daily", []timeSpan{plan.daily})
+	b.WriteString("\n  UNION ALL")
+	segment("rollups_hourly", plan.hourly[:])
+	b.WriteString("\n  UNION ALL")
+
+	b.WriteString("\n  SELECT bucket_start, " + rollupDimensions + ", " + rollupMeasures + " FROM (\n  SELECT date_trunc('hour', ts, 'UTC') AS bucket_start, " + rollupDimensions + "," + rollupAggregatesSQL + "\n  FROM " + rollupInputSQL + "\n  WHERE (")
+	for i, span := range plan.raw {
+		if i > 0 {
+			b.WriteString(" OR ")
+		}
+		endOp := "<"
+		if i == len(plan.raw)-1 {
+			endOp = "<="
+		}
+		args = append(args, span.start, span.end)
+		b.WriteString(fmt.Sprintf("(ts >= $%d AND ts %s $%d)", len(args)-1, endOp, len(args)))
+	}
+	b.WriteString(")")
+	args = appendOverviewFilters(b, args, filter)
+	b.WriteString("\n  GROUP BY 1, " + rollupDimensions + "\n  ) raw_edges")
+
+	return args
+}
+
+// buildRollupOverviewQuery merges the plan's segments into one row per kind.
+func buildRollupOverviewQuery(plan rollupPlan, filter persistence.OverviewFilter) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 24)
+
+	b.WriteString("\nSELECT\n  kind," + rollupTotalsSQL + "\nFROM (")
+	args = appendRollupSegments(&b, args, plan, filter)
+	b.WriteString("\n) segments\nGROUP BY kind\n")
+
+	return b.String(), args
+}
+
+// rollupWindowPlan plans a window longer than rollupMinWindow. It fails with
+// persistence.ErrRollupsUnavailable until the aggregator has rolled up at
+// least one whole hour of it, rather than scanning the window raw.
+func (s *Store) rollupWindowPlan(ctx context.Context, windowStart time.Time, windowEnd time.Time) (rollupPlan, error) {
+	if s.queryRow == nil {
+		return rollupPlan{}, errors.New("event store is not configured")
+	}
+	watermark, ok, err := s.rollupWatermark(ctx)
+	if err != nil {
+		return rollupPlan{}, err
+	}
+	plan, covered := planRollups(windowStart, windowEnd, watermark)
+	if !ok || !covered {
+		return rollupPlan{}, fmt.Errorf("%w: windows longer than %s are served from rollups, which do not cover this window yet", persistence.ErrRollupsUnavailable, rollupMinWindow)
+	}
+	return plan, nil
+}
+
+// getRollupOverview computes overview metrics from rollups for windows the
+// plan covers; latency percentiles are estimated from the merged histograms.
+func (s *Store) getRollupOverview(ctx context.Context, plan rollupPlan, filter persistence.OverviewFilter) (persistence.OverviewMetrics, error) {
+	var out persistence.OverviewMetrics
+
+	query, args := buildRollupOverviewQuery(plan, filter)
+	rows, err := s.queryRows(ctx, query, args...)
+	if err != nil {
+		return out, fmt.Errorf("query rollup overview: %w", err)
+	}
+	defer rows.Close()
+
+	kinds := make(map[string]rollupKindTotals)
+	for rows.Next() {
+		var kind string
+		var t rollupKindTotals
+		if err := t.scan(rows, &kind); err != nil {
+			return out, fmt.Errorf("scan rollup overview: %w", err)
+		}
+		kinds[kind] = t
+	}
+	if err := rows.Err(); err != nil {
+		return out, fmt.Errorf("query rollup overview: %w", err)
+	}
+
+	runs := kinds["run"]
+	out = persistence.OverviewMetrics{
+		TotalRuns:      runs.total,
+		SuccessfulRuns: runs.successful,
+		FailedRuns:     runs.failed,
+		TotalCostUSD:   runs.costUSD,
+		AvgLatencyMS:   runs.avgLatency(),
+
+		RunLatency:       histogramPercentiles(runs.histogram),
+		StepLatency:      histogramPercentiles(kinds["step"].histogram),
+		ModelCallLatency: histogramPercentiles(kinds["model_call"].histogram),
+	}
+	return out, nil
+}
+
+// histogramPercentiles estimates latency quantiles from latencyBoundsMS
+// bucket counts, interpolating linearly within a bucket. Values in the
+// overflow bucket are reported at the last bound.
+func histogramPercentiles(counts []int64) persistence.LatencyPercentiles {
+	quantile := func(q float64) float64 {
+		var total int64
+		for _, count := range counts {
+			total += count
+		}
+		if total == 0 {
+			return 0
+		}
+
+		target := q * float64(total)
+		var cumulative int64
+		for i, count := range counts {
+			if count == 0 || float64(cumulative+count) < target {
+				cumulative += count
+				continue
+			}
+			if i >= len(latencyBoundsMS) {
+				return float64(latencyBoundsMS[len(latencyBoundsMS)-1])
+			}
+			lower := 0.0
+			if i > 0 {
+				lower = float64(latencyBoundsMS[i-1])
+			}
+			upper := float64(latencyBoundsMS[i])
+			return lower + (upper-lower)*(target-float64(cumulative))/float64(count)
+		}
+		return float64(latencyBoundsMS[len(latencyBoundsMS)-1])
+	}
+
+	return persistence.LatencyPercentiles{
+		P50: quantile(0.5),
+		P90: quantile(0.9),
+		P95: quantile(0.95),
+		P99: quantile(0.99),
+	}
+}
+
+func prefixColumns(prefix string, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, column := range parts {
+		parts[i] = prefix + "." + column
+	}
+	return strings.Join(parts, ", ")
+}
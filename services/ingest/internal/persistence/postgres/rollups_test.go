@@ -0,0 +1,323 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// execRecorder records every statement a Store executes.
+type execRecorder struct {
+	fakeDB
+	execs []recordedQuery
+}
+
+func (e *execRecorder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	e.execs = append(e.execs, recordedQuery{query: query, args: args})
+	return e.fakeDB.ExecContext(ctx, query, args...)
+}
+
+func TestHistogramSQLCoversEveryBucket(t *testing.T) {
+	got := histogramSQL("latency_ms")
+	if n := strings.Count(got, "COUNT(*) FILTER"); n != len(latencyBoundsMS)+1 {
+		t.Fatalf("histogram has %d buckets, want %d", n, len(latencyBoundsMS)+1)
+	}
+	for _, want := range []string{
+		"COUNT(*) FILTER (WHERE latency_ms <= 5)",
+		"COUNT(*) FILTER (WHERE latency_ms > 5 AND latency_ms <= 10)",
+		"COUNT(*) FILTER (WHERE latency_ms > 3600000)]::BIGINT[]",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("histogram SQL missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestHourSpansMergesContiguousHours(t *testing.T) {
+	base := time.Date(2026, 2, 7, 0, 0, 0, 0, time.UTC)
+	spans := hourSpans([]time.Time{base, base.Add(time.Hour), base.Add(2 * time.Hour), base.Add(5 * time.Hour)})
+
+	want := []timeSpan{
+		{base, base.Add(3 * time.Hour)},
+		{base.Add(5 * time.Hour), base.Add(6 * time.Hour)},
+	}
+	if len(spans) != len(want) || spans[0] != want[0] || spans[1] != want[1] {
+		t.Fatalf("hourSpans() = %v, want %v", spans, want)
+	}
+}
+
+func TestPlanRollups(t *testing.T) {
+	start := time.Date(2026, 2, 1, 10, 30, 0, 0, time.UTC)
+	end := time.Date(2026, 2, 8, 10, 30, 0, 0, time.UTC)
+
+	plan, ok := planRollups(start, end, time.Date(2026, 2, 8, 9, 15, 0, 0, time.UTC))
+	if !ok {
+		t.Fatal("planRollups() = false, want rollups for a week before the watermark")
+	}
+	day := func(d, h int) time.Time { return time.Date(2026, 2, d, h, 0, 0, 0, time.UTC) }
+	want := rollupPlan{
+		daily:  timeSpan{day(2, 0), day(8, 0)},
+		hourly: [2]timeSpan{{day(1, 11), day(2, 0)}, {day(8, 0), day(8, 9)}},
+		raw:    [2]timeSpan{{start, day(1, 11)}, {day(8, 9), end}},
+	}
+	if plan != want {
+		t.Fatalf("plan = %+v, want %+v", plan, want)
+	}
+
+	// Without a whole day the hours are served from rollups_hourly alone.
+	plan, ok = planRollups(day(3, 0), day(3, 20), end)
+	if !ok || !plan.daily.empty() || plan.hourly[0] != (timeSpan{day(3, 0), day(3, 20)}) || !plan.hourly[1].empty() {
+		t.Fatalf("plan = %+v, want hourly only", plan)
+	}
+
+	if _, ok := planRollups(start, end, start.Add(20*time.Minute)); ok {
+		t.Fatal("planRollups() = true, want raw when the watermark precedes the first whole hour")
+	}
+
+	// Sub-day buckets read the whole days from rollups_hourly too.
+	plan, _ = planRollups(start, end, time.Date(2026, 2, 8, 9, 15, 0, 0, time.UTC))
+	plan = plan.withoutDaily()
+	if !plan.daily.empty() || plan.hourly[0] != (timeSpan{day(1, 11), day(8, 9)}) || !plan.hourly[1].empty() || plan.raw != want.raw {
+		t.Fatalf("plan without daily = %+v", plan)
+	}
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	counts := make([]int64, len(latencyBoundsMS)+1)
+	counts[4] = 100 // (50, 100]
+
+	got := histogramPercentiles(counts)
+	if got.P50 != 75 || got.P90 != 95 || got.P99 != 99.5 {
+		t.Fatalf("percentiles = %+v, want interpolation within (50, 100]", got)
+	}
+
+	counts[len(counts)-1] = 900
+	if got := histogramPercentiles(counts); got.P99 != 3600000 {
+		t.Fatalf("P99 = %v, want overflow reported at the last bound", got.P99)
+	}
+	if got := histogramPercentiles(nil); got != (persistence.LatencyPercentiles{}) {
+		t.Fatalf("empty percentiles = %+v, want zeroes", got)
+	}
+}
+
+func TestAggregateRollupsRecomputesAffectedBuckets(t *testing.T) {
+	watermark := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	upTo := watermark.Add(time.Minute)
+	late := time.Date(2026, 2, 5, 23, 0, 0, 0, time.UTC)
+	db := &execRecorder{}
+	var hoursArgs []any
+
+	store := &Store{
+		db: db,
+		queryRow: func(_ context.Context, query string, _ ...any) rowScanner {
+			if !strings.Contains(query, "rollup_watermarks") {
+				t.Fatalf("unexpected query %s", query)
+			}
+			return valuesRow{values: []any{watermark}}
+		},
+		queryRows: func(_ context.Context, _ string, args ...any) (rowsScanner, error) {
+			hoursArgs = args
+			return &valuesRows{rows: [][]any{
+				{late},
+				{watermark.Add(-time.Hour)},
+				{watermark},
+			}}, nil
+		},
+	}
+
+	result, err := store.AggregateRollups(context.Background(), upTo)
+	if err != nil {
+		t.Fatalf("AggregateRollups() error = %v", err)
+	}
+	if result.Hours != 3 || !result.Watermark.Equal(upTo) || !result.PreviousWatermark.Equal(watermark) {
+		t.Fatalf("result = %+v", result)
+	}
+	if len(hoursArgs) != 2 || hoursArgs[0] != watermark || hoursArgs[1] != upTo {
+		t.Fatalf("affected hours args = %v, want (watermark, upTo]", hoursArgs)
+	}
+
+	// The late hour and the two contiguous recent hours are separate spans,
+	// each followed by its days; the recomputed dirty hours are cleared and
+	// the watermark advances last.
+	if len(db.execs) != 6 {
+		t.Fatalf("executed %d statements, want 6", len(db.execs))
+	}
+	day := func(d int) time.Time { return time.Date(2026, 2, d, 0, 0, 0, 0, time.UTC) }
+	wantArgs := [][]any{
+		{late, late.Add(time.Hour)},
+		{day(5), day(6)},
+		{watermark.Add(-time.Hour), watermark.Add(time.Hour)},
+		{day(7), day(8)},
+		{upTo},
+		{rollupWatermarkName, upTo},
+	}
+	for i, exec := range db.execs {
+		for j, arg := range wantArgs[i] {
+			if exec.args[j] != arg {
+				t.Fatalf("statement %d args = %v, want %v", i, exec.args, wantArgs[i])
+			}
+		}
+	}
+	if !strings.Contains(db.execs[0].query, "INSERT INTO rollups_hourly") || !strings.Contains(db.execs[1].query, "INSERT INTO rollups_daily") {
+		t.Fatalf("unexpected statement order:\n%s\n%s", db.execs[0].query, db.execs[1].query)
+	}
+	if !strings.Contains(db.execs[1].query, "histogram_sum(latency_histogram)") {
+		t.Fatalf("daily rollups must merge hourly histograms:\n%s", db.execs[1].query)
+	}
+	if !strings.Contains(db.execs[4].query, "DELETE FROM rollup_dirty_hours") {
+		t.Fatalf("statement 4 = %s, want the dirty hours cleared", db.execs[4].query)
+	}
+}
+
+func TestSelectAffectedHoursIncludesRunsMovedOutOfAnHour(t *testing.T) {
+	if !strings.Contains(selectAffectedHoursSQL, "FROM rollup_dirty_hours\nWHERE marked_at <= $2") {
+		t.Fatalf("affected hours must include dirty hours:\n%s", selectAffectedHoursSQL)
+	}
+	// The ingest statements mark the hour a run's ended_at moved out of,
+	// reading the previous value from the locked row.
+	for _, want := range []string{
+		"previous_ended_at = r.ended_at",
+		"RETURNING previous_ended_at, ended_at",
+		"INSERT INTO rollup_dirty_hours (hour_start)",
+		"date_trunc('hour', previous_ended_at, 'UTC') IS DISTINCT FROM date_trunc('hour', ended_at, 'UTC')",
+	} {
+		if !strings.Contains(materializeRunsSQL, want) {
+			t.Fatalf("run materialization missing %q", want)
+		}
+	}
+}
+
+func TestAggregateRollupsStartsFromEpoch(t *testing.T) {
+	db := &execRecorder{}
+	var hoursArgs []any
+	store := &Store{
+		db: db,
+		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
+			return valuesRow{err: sql.ErrNoRows}
+		},
+		queryRows: func(_ context.Context, _ string, args ...any) (rowsScanner, error) {
+			hoursArgs = args
+			return &valuesRows{}, nil
+		},
+	}
+
+	upTo := time.Date(2026, 2, 7, 12, 0, 0, 0, time.UTC)
+	result, err := store.AggregateRollups(context.Background(), upTo)
+	if err != nil {
+		t.Fatalf("AggregateRollups() error = %v", err)
+	}
+	if !hoursArgs[0].(time.Time).Equal(time.Unix(0, 0)) || result.Hours != 0 {
+		t.Fatalf("hours args = %v, result = %+v, want a scan from the epoch", hoursArgs, result)
+	}
+	if len(db.execs) != 1 || !strings.Contains(db.execs[0].query, "rollup_watermarks") {
+		t.Fatalf("execs = %v, want only the watermark advanced", db.execs)
+	}
+}
+
+func TestBuildRollupOverviewQuery(t *testing.T) {
+	start := time.Date(2026, 2, 1, 10, 30, 0, 0, time.UTC)
+	end := start.Add(7 * 24 * time.Hour)
+	plan, _ := planRollups(start, end, end)
+
+	query, args := buildRollupOverviewQuery(plan, persistence.OverviewFilter{TenantID: "tenant-1"})
+
+	for _, want := range []string{
+		"FROM rollups_daily WHERE ((bucket_start >= $1 AND bucket_start < $2)) AND tenant_id = $3",
+		"FROM rollups_hourly WHERE ((bucket_start >= $4 AND bucket_start < $5) OR (bucket_start >= $6 AND bucket_start < $7)) AND tenant_id = $8",
+		"WHERE ((ts >= $9 AND ts < $10) OR (ts >= $11 AND ts <= $12)) AND tenant_id = $13",
+		"to_json(histogram_sum(latency_histogram))::TEXT",
+		"GROUP BY kind",
+	} {
+		if !strings.Contains(query, want) {
+			t.Fatalf("query missing %q:\n%s", want, query)
+		}
+	}
+	if len(args) != 13 || args[12] != "tenant-1" || args[11] != end {
+		t.Fatalf("args = %v", args)
+	}
+}
+
+// histogram renders a rollup latency histogram with count values in one bucket.
+func histogram(bucket int, count int) string {
+	counts := make([]string, len(latencyBoundsMS)+1)
+	for i := range counts {
+		counts[i] = "0"
+	}
+	counts[bucket] = strconv.Itoa(count)
+	return "[" + strings.Join(counts, ",") + "]"
+}
+
+func TestGetOverviewMetricsReadsRollupsForLongWindows(t *testing.T) {
+	end := time.Now().UTC()
+	start := end.Add(-72 * time.Hour)
+
+	var overviewArgs []any
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, query string, _ ...any) rowScanner {
+			if !strings.Contains(query, "rollup_watermarks") {
+				t.Fatalf("exact overview must not run when rollups cover the window:\n%s", query)
+			}
+			return valuesRow{values: []any{end.Add(-10 * time.Minute)}}
+		},
+		queryRows: func(_ context.Context, _ string, args ...any) (rowsScanner, error) {
+			overviewArgs = args
+			return &valuesRows{rows: [][]any{
+				{"run", int64(10), int64(8), int64(2), 1.25, int64(500), int64(1500), int64(10), histogram(4, 10)},
+				{"model_call", int64(4), int64(4), int64(0), 1.0, int64(400), int64(800), int64(4), histogram(5, 4)},
+			}}, nil
+		},
+	}
+
+	overview, err := store.GetOverviewMetrics(context.Background(), persistence.OverviewFilter{Start: &start, End: &end})
+	if err != nil {
+		t.Fatalf("GetOverviewMetrics() error = %v", err)
+	}
+	if overview.Source != persistence.OverviewSourceRollups || overviewArgs == nil {
+		t.Fatalf("Source = %q, want rollups", overview.Source)
+	}
+	if overview.TotalRuns != 10 || overview.SuccessRate != 80 || overview.TotalCostUSD != 1.25 || overview.AvgLatencyMS != 150 {
+		t.Fatalf("overview = %+v", overview)
+	}
+	if overview.RunLatency.P50 != 75 || overview.ModelCallLatency.P50 != 175 || overview.StepLatency.P50 != 0 {
+		t.Fatalf("latency = %+v / %+v / %+v", overview.RunLatency, overview.ModelCallLatency, overview.StepLatency)
+	}
+	if overview.WindowHours != 72 || !overview.WindowStart.Equal(start) {
+		t.Fatalf("window = %v..%v (%dh)", overview.WindowStart, overview.WindowEnd, overview.WindowHours)
+	}
+}
+
+func TestGetOverviewMetricsFallsBackToRawBeforeFirstAggregation(t *testing.T) {
+	end := time.Now().UTC()
+	start := end.Add(-72 * time.Hour)
+	runs := overviewRows(
+		append([]any{int64(1), int64(1), int64(0), 0.5, 100.0}, latencyValues(100, 100, 100, 100)...),
+		append(latencyValues(0, 0, 0, 0), latencyValues(0, 0, 0, 0)...),
+	)
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(ctx context.Context, query string, args ...any) rowScanner {
+			if strings.Contains(query, "rollup_watermarks") {
+				return valuesRow{err: sql.ErrNoRows}
+			}
+			return runs(ctx, query, args...)
+		},
+		queryRows: func(_ context.Context, query string, _ ...any) (rowsScanner, error) {
+			t.Fatalf("rollups must not be read without a watermark:\n%s", query)
+			return nil, nil
+		},
+	}
+
+	overview, err := store.GetOverviewMetrics(context.Background(), persistence.OverviewFilter{Start: &start, End: &end})
+	if err != nil {
+		t.Fatalf("GetOverviewMetrics() error = %v", err)
+	}
+	if overview.Source != persistence.OverviewSourceRaw || overview.TotalRuns != 1 {
+		t.Fatalf("overview = %+v, want the exact raw result", overview)
+	}
+}
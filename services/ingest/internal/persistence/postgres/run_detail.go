@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const selectRunSQL = `
+SELECT
+  run_id, tenant_id, workspace_id, project_id, agent_id, workflow_id,
+  workflow_version, prompt_version, status, error_type, started_at, ended_at, latency_ms,
+  total_tokens, total_cost_usd, step_count, model_call_count, tool_call_count,
+  first_event_at, last_event_at
+FROM runs
+WHERE tenant_id = $1 AND run_id = $2
+`
+
+const selectRunEventsSQL = `
+SELECT
+  event_id::TEXT,
+  event_type,
+  occurred_at,
+  trace_id,
+  span_id,
+  parent_span_id,
+  CASE
+    WHEN event_type LIKE 'step.%' THEN payload->'step'->>'status'
+    WHEN event_type LIKE 'run.%' THEN run_status
+  END AS status,
+  error_type,
+  total_tokens,
+  cost_usd,
+  CASE
+    WHEN event_type LIKE 'run.%' THEN (payload->'run'->>'latency_ms')::NUMERIC::BIGINT
+    WHEN event_type LIKE 'step.%' THEN (payload->'step'->>'latency_ms')::NUMERIC::BIGINT
+    -- Model and tool call events report their latency on the step they run in.
+    WHEN event_type LIKE 'model.call.%' THEN (payload->'step'->>'latency_ms')::NUMERIC::BIGINT
+    WHEN event_type LIKE 'tool.call.%' THEN (payload->'step'->>'latency_ms')::NUMERIC::BIGINT
+  END AS latency_ms,
+  payload->'step'->>'step_id',
+  payload->'step'->>'name',
+  payload->'model_call'->>'provider',
+  payload->'model_call'->>'model'
+FROM agent_events
+WHERE tenant_id = $1 AND run_id = $2
+ORDER BY occurred_at, id
+`
+
+// maxRunEvents bounds how many events GetRun loads for one run. One more is
+// fetched so a run that has more reports Truncated.
+const maxRunEvents = 10000
+
+// GetRun returns a tenant's run summary and its events folded into a span
+// tree. It returns persistence.ErrNotFound when the tenant has no such run.
+func (s *Store) GetRun(ctx context.Context, tenantID string, runID string) (persistence.RunDetail, error) {
+	var out persistence.RunDetail
+
+	if s == nil || s.db == nil || s.queryRow == nil || s.queryRows == nil {
+		return out, errors.New("event store is not configured")
+	}
+
+	run := &out.Run
+	err := s.queryRow(ctx, selectRunSQL, tenantID, runID).Scan(
+		&run.RunID, &run.TenantID, &run.WorkspaceID, &run.ProjectID, &run.AgentID, &run.WorkflowID,
+		&run.WorkflowVersion, &run.PromptVersion, &run.Status, &run.ErrorType, &run.StartedAt, &run.EndedAt, &run.LatencyMS,
+		&run.TotalTokens, &run.TotalCostUSD, &run.StepCount, &run.ModelCallCount, &run.ToolCallCount,
+		&run.FirstEventAt, &run.LastEventAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, persistence.ErrNotFound
+	}
+	if err != nil {
+		return out, fmt.Errorf("query run: %w", err)
+	}
+
+	rows, err := s.queryRows(ctx, selectRunEventsSQL+fmt.Sprintf("LIMIT %d\n", maxRunEvents+1), tenantID, runID)
+	if err != nil {
+		return out, fmt.Errorf("query run events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []persistence.RunEvent
+	for rows.Next() {
+		var event persistence.RunEvent
+		if err := rows.Scan(
+			&event.EventID, &event.EventType, &event.OccurredAt,
+			&event.TraceID, &event.SpanID, &event.ParentSpanID,
+			&event.Status, &event.ErrorType, &event.TotalTokens, &event.CostUSD, &event.LatencyMS,
+			&event.StepID, &event.StepName, &event.Provider, &event.Model,
+		); err != nil {
+			return out, fmt.Errorf("scan run event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return out, fmt.Errorf("query run events: %w", err)
+	}
+
+	if len(events) > maxRunEvents {
+		events = events[:maxRunEvents]
+		out.Truncated = true
+	}
+
+	out.Spans, out.OrphanedSpans = persistence.BuildSpanTree(events)
+	if out.Spans == nil {
+		out.Spans = []*persistence.Span{}
+	}
+	out.EventCount = len(events)
+	return out, nil
+}
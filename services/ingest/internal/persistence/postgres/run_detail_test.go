@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// scanValues assigns values to Scan destinations the way database/sql does,
+// including nil into pointer destinations.
+func scanValues(dest []any, values []any) error {
+	if len(dest) != len(values) {
+		return fmt.Errorf("scan got %d destinations for %d values", len(dest), len(values))
+	}
+	for i, value := range values {
+		target := reflect.ValueOf(dest[i]).Elem()
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			continue
+		}
+		v := reflect.ValueOf(value)
+		if target.Kind() == reflect.Pointer && v.Kind() != reflect.Pointer {
+			ptr := reflect.New(target.Type().Elem())
+			ptr.Elem().Set(v)
+			v = ptr
+		}
+		target.Set(v)
+	}
+	return nil
+}
+
+type valuesRow struct {
+	values []any
+	err    error
+}
+
+func (v valuesRow) Scan(dest ...any) error {
+	if v.err != nil {
+		return v.err
+	}
+	return scanValues(dest, v.values)
+}
+
+type valuesRows struct {
+	rows [][]any
+	idx  int
+}
+
+func (v *valuesRows) Next() bool {
+	if v.idx >= len(v.rows) {
+		return false
+	}
+	v.idx++
+	return true
+}
+
+func (v *valuesRows) Scan(dest ...any) error {
+	return scanValues(dest, v.rows[v.idx-1])
+}
+
+func (v *valuesRows) Err() error {
+	return nil
+}
+
+func (v *valuesRows) Close() error {
+	return nil
+}
+
+func TestGetRunBuildsSpanTree(t *testing.T) {
+	start := time.Date(2026, 2, 7, 21, 0, 0, 0, time.UTC)
+	var eventsQueryArgs []any
+
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
+			return valuesRow{values: []any{
+				"run-1", "tenant-1", "workspace-1", "project-1", "agent-1", "workflow-1",
+				nil, nil, "success", nil, start, start.Add(time.Minute), int64(60000),
+				int64(120), 0.02, int64(1), int64(1), int64(0),
+				start, start.Add(time.Minute),
+			}}
+		},
+		queryRows: func(_ context.Context, _ string, args ...any) (rowsScanner, error) {
+			eventsQueryArgs = args
+			return &valuesRows{rows: [][]any{
+				{"e1", "run.started", start, "trace-1", "run-span", nil, "started", nil, nil, nil, nil, nil, nil, nil, nil},
+				{"e2", "model.call.completed", start.Add(time.Second), "trace-1", "model-span", "run-span", nil, nil, int64(120), 0.02, nil, nil, nil, "openai", "gpt-4o"},
+				{"e3", "run.completed", start.Add(time.Minute), "trace-1", "run-span", nil, "success", nil, int64(120), 0.02, int64(60000), nil, nil, nil, nil},
+			}}, nil
+		},
+	}
+
+	detail, err := store.GetRun(context.Background(), "tenant-1", "run-1")
+	if err != nil {
+		t.Fatalf("GetRun() error = %v", err)
+	}
+	if len(eventsQueryArgs) != 2 || eventsQueryArgs[0] != "tenant-1" || eventsQueryArgs[1] != "run-1" {
+		t.Fatalf("events query args = %v, want tenant-1 and run-1", eventsQueryArgs)
+	}
+	if detail.Truncated {
+		t.Fatal("detail.Truncated = true, want false")
+	}
+	if detail.Run.RunID != "run-1" || detail.Run.Status != "success" || *detail.Run.LatencyMS != 60000 {
+		t.Fatalf("run = %+v", detail.Run)
+	}
+	if detail.EventCount != 3 || detail.OrphanedSpans != 0 || len(detail.Spans) != 1 {
+		t.Fatalf("detail = %+v, want one root span from three events", detail)
+	}
+	if children := detail.Spans[0].Children; len(children) != 1 || children[0].Name != "openai/gpt-4o" {
+		t.Fatalf("run span children = %+v, want model call", children)
+	}
+}
+
+func TestGetRunNotFound(t *testing.T) {
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
+			return valuesRow{err: sql.ErrNoRows}
+		},
+		queryRows: func(_ context.Context, _ string, _ ...any) (rowsScanner, error) {
+			t.Fatal("events must not be queried for a missing run")
+			return nil, nil
+		},
+	}
+
+	if _, err := store.GetRun(context.Background(), "tenant-1", "missing"); !errors.Is(err, persistence.ErrNotFound) {
+		t.Fatalf("GetRun() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetRunReportsTruncatedEvents(t *testing.T) {
+	start := time.Date(2026, 2, 7, 21, 0, 0, 0, time.UTC)
+	var eventsQuery string
+	events := make([][]any, 0, maxRunEvents+1)
+	for i := 0; i <= maxRunEvents; i++ {
+		events = append(events, []any{
+			fmt.Sprintf("e%d", i), "step.completed", start, "trace-1", "step-span", nil, "success", nil, nil, nil, nil, nil, nil, nil, nil,
+		})
+	}
+
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
+			return valuesRow{values: []any{
+				"run-1", "tenant-1", "workspace-1", "project-1", "agent-1", "workflow-1",
+				nil, nil, "started", nil, start, nil, nil,
+				int64(0), 0.0, int64(0), int64(0), int64(0),
+				start, start,
+			}}
+		},
+		queryRows: func(_ context.Context, query string, _ ...any) (rowsScanner, error) {
+			eventsQuery = query
+			return &valuesRows{rows: events}, nil
+		},
+	}
+
+	detail, err := store.GetRun(context.Background(), "tenant-1", "run-1")
+	if err != nil {
+		t.Fatalf("GetRun() error = %v", err)
+	}
+	if !detail.Truncated || detail.EventCount != maxRunEvents {
+		t.Fatalf("truncated = %v, event_count = %d, want the first %d events", detail.Truncated, detail.EventCount, maxRunEvents)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("LIMIT %d", maxRunEvents+1),
+		"WHEN event_type LIKE 'model.call.%' THEN (payload->'step'->>'latency_ms')::NUMERIC::BIGINT",
+	} {
+		if !strings.Contains(eventsQuery, want) {
+			t.Fatalf("events query missing %q:\n%s", want, eventsQuery)
+		}
+	}
+}
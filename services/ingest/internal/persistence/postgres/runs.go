@@ -0,0 +1,123 @@
+package postgres
+
+// insertedEventColumns are returned by the agent_events insert for run materialization.
+const insertedEventColumns = `event_id, event_type, occurred_at, tenant_id, workspace_id, project_id,
+  run_id, agent_id, workflow_id, run_status, error_type, total_tokens, cost_usd, payload`
+
+// materializeRunsSQL folds the events in the "inserted" CTE into one delta per
+// run and upserts it into runs. Run ids are only unique within a tenant, so
+// runs are keyed by (tenant_id, run_id). Counters add up; terminal fields (status,
+// ended_at, reported latency and totals) follow the latest run.completed or
+// run.failed by occurred_at, so out-of-order delivery never regresses a run.
+// When a newer terminal event moves ended_at to another hour, the hour it left
+// is marked in rollup_dirty_hours; previous_ended_at is read from the locked
+// row, so concurrent updates of one run each mark the hour they moved it from.
+const materializeRunsSQL = `
+run_deltas AS (
+  SELECT
+    tenant_id,
+    run_id,
+    MIN(workspace_id) AS workspace_id,
+    MIN(project_id) AS project_id,
+    MIN(agent_id) AS agent_id,
+    MIN(workflow_id) AS workflow_id,
+    (ARRAY_AGG(payload->'run'->>'workflow_version' ORDER BY occurred_at DESC)
+      FILTER (WHERE payload->'run'->>'workflow_version' IS NOT NULL))[1] AS workflow_version,
+    (ARRAY_AGG(payload->'run'->>'prompt_version' ORDER BY occurred_at DESC)
+      FILTER (WHERE payload->'run'->>'prompt_version' IS NOT NULL))[1] AS prompt_version,
+    COALESCE((ARRAY_AGG(
+      CASE
+        WHEN run_status IN ('success', 'failure', 'cancelled') THEN run_status
+        WHEN event_type = 'run.failed' THEN 'failure'
+        ELSE 'success'
+      END ORDER BY occurred_at DESC) FILTER (WHERE event_type IN ('run.completed', 'run.failed')))[1], 'started') AS status,
+    COALESCE(
+      (ARRAY_AGG(error_type ORDER BY occurred_at DESC) FILTER (WHERE event_type = 'run.failed' AND error_type IS NOT NULL))[1],
+      (ARRAY_AGG(error_type ORDER BY occurred_at) FILTER (WHERE error_type IS NOT NULL))[1]
+    ) AS error_type,
+    LEAST(
+      MIN((payload->'run'->>'started_at')::TIMESTAMPTZ),
+      MIN(occurred_at) FILTER (WHERE event_type = 'run.started')
+    ) AS started_at,
+    MAX(COALESCE((payload->'run'->>'ended_at')::TIMESTAMPTZ, occurred_at))
+      FILTER (WHERE event_type IN ('run.completed', 'run.failed')) AS ended_at,
+    (ARRAY_AGG((payload->'run'->>'latency_ms')::NUMERIC::BIGINT ORDER BY occurred_at DESC)
+      FILTER (WHERE event_type IN ('run.completed', 'run.failed') AND payload->'run'->>'latency_ms' IS NOT NULL))[1] AS reported_latency_ms,
+    (ARRAY_AGG(total_tokens ORDER BY occurred_at DESC)
+      FILTER (WHERE event_type IN ('run.completed', 'run.failed') AND total_tokens IS NOT NULL))[1] AS reported_tokens,
+    (ARRAY_AGG(cost_usd ORDER BY occurred_at DESC)
+      FILTER (WHERE event_type IN ('run.completed', 'run.failed') AND cost_usd IS NOT NULL))[1] AS reported_cost_usd,
+    COALESCE(SUM(total_tokens) FILTER (WHERE event_type LIKE 'model.call.%' OR event_type LIKE 'tool.call.%'), 0) AS call_tokens,
+    COALESCE(SUM(cost_usd) FILTER (WHERE event_type LIKE 'model.call.%' OR event_type LIKE 'tool.call.%'), 0) AS call_cost_usd,
+    COUNT(*) FILTER (WHERE event_type IN ('step.completed', 'step.failed')) AS step_count,
+    COUNT(*) FILTER (WHERE event_type IN ('model.call.completed', 'model.call.failed')) AS model_call_count,
+    COUNT(*) FILTER (WHERE event_type IN ('tool.call.completed', 'tool.call.failed')) AS tool_call_count,
+    MIN(occurred_at) AS first_event_at,
+    MAX(occurred_at) AS last_event_at,
+    MAX(occurred_at) FILTER (WHERE event_type IN ('run.completed', 'run.failed')) AS terminal_event_at
+  FROM inserted
+  WHERE event_type LIKE 'run.%'
+     OR event_type LIKE 'step.%'
+     OR event_type LIKE 'model.call.%'
+     OR event_type LIKE 'tool.call.%'
+  GROUP BY tenant_id, run_id
+),
+materialized_runs AS (
+  INSERT INTO runs AS r (
+    run_id, tenant_id, workspace_id, project_id, agent_id, workflow_id,
+    workflow_version, prompt_version, status, error_type, started_at, ended_at,
+    reported_latency_ms, reported_tokens, reported_cost_usd, call_tokens, call_cost_usd,
+    step_count, model_call_count, tool_call_count, first_event_at, last_event_at, terminal_event_at
+  )
+  SELECT
+    run_id, tenant_id, workspace_id, project_id, agent_id, workflow_id,
+    workflow_version, prompt_version, status, error_type, started_at, ended_at,
+    reported_latency_ms, reported_tokens, reported_cost_usd, call_tokens, call_cost_usd,
+    step_count, model_call_count, tool_call_count, first_event_at, last_event_at, terminal_event_at
+  FROM run_deltas
+  ORDER BY tenant_id, run_id
+  ON CONFLICT (tenant_id, run_id) DO UPDATE SET
+    workflow_version = COALESCE(EXCLUDED.workflow_version, r.workflow_version),
+    prompt_version = COALESCE(EXCLUDED.prompt_version, r.prompt_version),
+    status = CASE WHEN ` + newerTerminalSQL + ` THEN EXCLUDED.status ELSE r.status END,
+    error_type = COALESCE(CASE WHEN ` + newerTerminalSQL + ` THEN EXCLUDED.error_type END, r.error_type, EXCLUDED.error_type),
+    started_at = LEAST(r.started_at, EXCLUDED.started_at),
+    ended_at = CASE WHEN ` + newerTerminalSQL + ` THEN EXCLUDED.ended_at ELSE r.ended_at END,
+    reported_latency_ms = CASE WHEN ` + newerTerminalSQL + `
+      THEN COALESCE(EXCLUDED.reported_latency_ms, r.reported_latency_ms) ELSE r.reported_latency_ms END,
+    reported_tokens = CASE WHEN ` + newerTerminalSQL + `
+      THEN COALESCE(EXCLUDED.reported_tokens, r.reported_tokens) ELSE r.reported_tokens END,
+    reported_cost_usd = CASE WHEN ` + newerTerminalSQL + `
+      THEN COALESCE(EXCLUDED.reported_cost_usd, r.reported_cost_usd) ELSE r.reported_cost_usd END,
+    call_tokens = r.call_tokens + EXCLUDED.call_tokens,
+    call_cost_usd = r.call_cost_usd + EXCLUDED.call_cost_usd,
+    step_count = r.step_count + EXCLUDED.step_count,
+    model_call_count = r.model_call_count + EXCLUDED.model_call_count,
+    tool_call_count = r.tool_call_count + EXCLUDED.tool_call_count,
+    first_event_at = LEAST(r.first_event_at, EXCLUDED.first_event_at),
+    last_event_at = GREATEST(r.last_event_at, EXCLUDED.last_event_at),
+    terminal_event_at = GREATEST(r.terminal_event_at, EXCLUDED.terminal_event_at),
+    previous_ended_at = r.ended_at,
+    updated_at = NOW()
+  RETURNING previous_ended_at, ended_at
+),
+moved_run_hours AS (
+  INSERT INTO rollup_dirty_hours (hour_start)
+  SELECT DISTINCT date_trunc('hour', previous_ended_at, 'UTC')
+  FROM materialized_runs
+  WHERE date_trunc('hour', previous_ended_at, 'UTC') IS DISTINCT FROM date_trunc('hour', ended_at, 'UTC')
+    AND previous_ended_at IS NOT NULL
+  ON CONFLICT (hour_start) DO UPDATE SET marked_at = EXCLUDED.marked_at
+)`
+
+// newerTerminalSQL is true when the incoming delta carries a terminal event at least as recent as the stored one.
+const newerTerminalSQL = `(EXCLUDED.terminal_event_at IS NOT NULL AND (r.terminal_event_at IS NULL OR EXCLUDED.terminal_event_at >= r.terminal_event_at))`
+
+// withRunMaterialization wraps an agent_events INSERT ... ON CONFLICT DO NOTHING
+// so the runs table is updated from the newly inserted rows in the same
+// statement. Duplicates never reach "inserted" and so are never counted twice.
+// The statement returns the inserted event_ids.
+func withRunMaterialization(insertSQL string) string {
+	return "\nWITH inserted AS (" + insertSQL + "RETURNING " + insertedEventColumns + "\n)," +
+		materializeRunsSQL + "\nSELECT event_id::TEXT FROM inserted\n"
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInsertEventMaterializesRun(t *testing.T) {
+	db := &fakeDB{result: fakeResult{rows: 1}}
+	store := &Store{db: db}
+
+	if _, err := store.InsertEvent(context.Background(), validPayload()); err != nil {
+		t.Fatalf("InsertEvent() error = %v", err)
+	}
+
+	assertMaterializesRuns(t, db.query)
+	if got := len(db.args); got != len(eventColumns) {
+		t.Fatalf("args len = %d, want %d", got, len(eventColumns))
+	}
+}
+
+func TestBulkInsertMaterializesRuns(t *testing.T) {
+	var queries []recordedQuery
+	store := returningStore(map[string]bool{}, &queries)
+
+	if _, err := store.InsertEvents(context.Background(), []map[string]any{validPayload()}); err != nil {
+		t.Fatalf("InsertEvents() error = %v", err)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("queries = %d, want 1", len(queries))
+	}
+
+	assertMaterializesRuns(t, queries[0].query)
+	if !strings.HasSuffix(strings.TrimSpace(queries[0].query), "SELECT event_id::TEXT FROM inserted") {
+		t.Fatalf("query = %q, want inserted event ids returned", queries[0].query)
+	}
+}
+
+func assertMaterializesRuns(t *testing.T, query string) {
+	t.Helper()
+
+	for _, want := range []string{
+		"WITH inserted AS (",
+		"ON CONFLICT (event_id, occurred_at) DO NOTHING\nRETURNING event_id,",
+		"FROM inserted",
+		"INSERT INTO runs AS r",
+		"GROUP BY tenant_id, run_id",
+		"ON CONFLICT (tenant_id, run_id) DO UPDATE",
+		"(payload->'run'->>'latency_ms')::NUMERIC::BIGINT",
+		"step_count = r.step_count + EXCLUDED.step_count",
+	} {
+		if !strings.Contains(query, want) {
+			t.Fatalf("query missing %q:\n%s", want, query)
+		}
+	}
+	if strings.Count(query, "(") != strings.Count(query, ")") {
+		t.Fatalf("query has unbalanced parentheses:\n%s", query)
+	}
+}
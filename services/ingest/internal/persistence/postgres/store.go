@@ -6,12 +6,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
-const insertEventSQL = `
+// insertEventSQL inserts one event and folds it into its runs row. The
+// agent_events insert trigger skips an event_id already stored under any
+// occurred_at, ahead of the (event_id, occurred_at) conflict clause.
+var insertEventSQL = withRunMaterialization(`
 INSERT INTO agent_events (
   event_id,
   event_version,
@@ -39,8 +46,8 @@ VALUES (
   $11, $12, $13,
   $14, $15, $16, $17, $18
 )
-ON CONFLICT (event_id) DO NOTHING
-`
+ON CONFLICT (event_id, occurred_at) DO NOTHING
+`)
 
 type dbAPI interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
@@ -54,10 +61,20 @@ type rowScanner interface {
 
 type queryRowFunc func(ctx context.Context, query string, args ...any) rowScanner
 
+type rowsScanner interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+type queryRowsFunc func(ctx context.Context, query string, args ...any) (rowsScanner, error)
+
 // Store persists validated events in Postgres.
 type Store struct {
-	db       dbAPI
-	queryRow queryRowFunc
+	db        dbAPI
+	queryRow  queryRowFunc
+	queryRows queryRowsFunc
 }
 
 // NewStore constructs a postgres-backed event store and verifies connectivity.
@@ -84,10 +101,14 @@ func NewStore(databaseURL string) (*Store, error) {
 		queryRow: func(ctx context.Context, query string, args ...any) rowScanner {
 			return db.QueryRowContext(ctx, query, args...)
 		},
+		queryRows: func(ctx context.Context, query string, args ...any) (rowsScanner, error) {
+			return db.QueryContext(ctx, query, args...)
+		},
 	}, nil
 }
 
-// InsertEvent writes one validated event. It returns inserted=false for idempotent duplicates.
+// InsertEvent writes one validated event. It returns inserted=false for idempotent duplicates
+// and an error matching persistence.ErrInvalidEvent when the event can never be stored.
 func (s *Store) InsertEvent(ctx context.Context, payload map[string]any) (bool, error) {
 	if s == nil || s.db == nil {
 		return false, errors.New("event store is not configured")
@@ -95,29 +116,13 @@ func (s *Store) InsertEvent(ctx context.Context, payload map[string]any) (bool,
 
 	row, err := buildEventRow(payload)
 	if err != nil {
-		return false, err
-	}
-
-	result, err := s.db.ExecContext(ctx, insertEventSQL,
-		row.EventID,
-		row.EventVersion,
-		row.EventType,
-		row.OccurredAt,
-		row.TenantID,
-		row.WorkspaceID,
-		row.ProjectID,
-		row.RunID,
-		row.AgentID,
-		row.WorkflowID,
-		row.TraceID,
-		row.SpanID,
-		row.ParentSpanID,
-		row.RunStatus,
-		row.ErrorType,
-		row.TotalTokens,
-		row.CostUSD,
-		row.Payload,
-	)
+		return false, fmt.Errorf("%w: %w", persistence.ErrInvalidEvent, err)
+	}
+
+	result, err := s.db.ExecContext(ctx, insertEventSQL, row.args()...)
+	if isDataException(err) {
+		return false, fmt.Errorf("%w: insert agent event: %w", persistence.ErrInvalidEvent, err)
+	}
 	if err != nil {
 		return false, fmt.Errorf("insert agent event: %w", err)
 	}
@@ -167,6 +172,30 @@ type eventRow struct {
 	Payload      []byte
 }
 
+// args returns the row values in insert column order.
+func (r eventRow) args() []any {
+	return []any{
+		r.EventID,
+		r.EventVersion,
+		r.EventType,
+		r.OccurredAt,
+		r.TenantID,
+		r.WorkspaceID,
+		r.ProjectID,
+		r.RunID,
+		r.AgentID,
+		r.WorkflowID,
+		r.TraceID,
+		r.SpanID,
+		r.ParentSpanID,
+		r.RunStatus,
+		r.ErrorType,
+		r.TotalTokens,
+		r.CostUSD,
+		r.Payload,
+	}
+}
+
 func buildEventRow(payload map[string]any) (eventRow, error) {
 	var row eventRow
 
@@ -321,14 +350,22 @@ func optionalInt64(root map[string]any, path ...string) (*int64, error) {
 
 	switch v := value.(type) {
 	case json.Number:
-		i, err := v.Int64()
+		// The validator accepts integral numbers written as 1500.0 or 1.5e3, so accept them too.
+		if i, err := v.Int64(); err == nil {
+			return &i, nil
+		}
+		f, err := v.Float64()
 		if err != nil {
 			return nil, fmt.Errorf("%s must be an integer", joinPath(path))
 		}
+		i, ok := integralInt64(f)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an integer", joinPath(path))
+		}
 		return &i, nil
 	case float64:
-		i := int64(v)
-		if float64(i) != v {
+		i, ok := integralInt64(v)
+		if !ok {
 			return nil, fmt.Errorf("%s must be an integer", joinPath(path))
 		}
 		return &i, nil
@@ -342,6 +379,21 @@ func optionalInt64(root map[string]any, path ...string) (*int64, error) {
 	}
 }
 
+// integralInt64 converts f when it is a whole number within the int64 range.
+func integralInt64(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// isDataException reports whether postgres rejected a value itself (SQLSTATE
+// class 22, e.g. numeric overflow), which fails the same way on every retry.
+func isDataException(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "22")
+}
+
 func optionalFloat64(root map[string]any, path ...string) (*float64, error) {
 	value, ok, err := lookup(root, path...)
 	if err != nil {
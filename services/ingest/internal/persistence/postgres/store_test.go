@@ -3,10 +3,14 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type fakeResult struct {
@@ -107,8 +111,39 @@ func TestInsertEventMissingRequiredField(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error for missing required field")
 	}
-	if !strings.Contains(err.Error(), "$.tenant.workspace_id") {
-		t.Fatalf("error = %v, want missing path", err)
+	if !strings.Contains(err.Error(), "$.tenant.workspace_id") || !errors.Is(err, persistence.ErrInvalidEvent) {
+		t.Fatalf("error = %v, want missing path as an invalid event", err)
+	}
+}
+
+func TestInsertEventDataExceptionIsInvalid(t *testing.T) {
+	store := &Store{db: &fakeDB{execErr: &pgconn.PgError{Code: "22003"}}}
+
+	if _, err := store.InsertEvent(context.Background(), validPayload()); !errors.Is(err, persistence.ErrInvalidEvent) {
+		t.Fatalf("error = %v, want ErrInvalidEvent", err)
+	}
+	store = &Store{db: &fakeDB{execErr: &pgconn.PgError{Code: "57P01"}}}
+	if _, err := store.InsertEvent(context.Background(), validPayload()); errors.Is(err, persistence.ErrInvalidEvent) {
+		t.Fatalf("error = %v, want a retryable error", err)
+	}
+}
+
+func TestOptionalInt64AcceptsIntegralNumbers(t *testing.T) {
+	for raw, want := range map[any]int64{
+		json.Number("1500"):   1500,
+		json.Number("1500.0"): 1500,
+		json.Number("1.5e3"):  1500,
+		1500.0:                1500,
+	} {
+		got, err := optionalInt64(map[string]any{"n": raw}, "n")
+		if err != nil || *got != want {
+			t.Fatalf("optionalInt64(%v) = %v, %v, want %d", raw, got, err, want)
+		}
+	}
+	for _, raw := range []any{json.Number("1500.5"), json.Number("1e19"), 1500.5, "1500"} {
+		if _, err := optionalInt64(map[string]any{"n": raw}, "n"); err == nil {
+			t.Fatalf("optionalInt64(%v) error = nil, want non-integer rejected", raw)
+		}
 	}
 }
 
@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// GetMetricsTimeseries returns run metrics per bucket for the filter window.
+// Buckets are aligned to the Unix epoch in UTC and the first one starts at or
+// before the window start, so every run in the window lands in a full bucket.
+// Windows longer than rollupMinWindow are read from rollups in 1h or 1d buckets.
+func (s *Store) GetMetricsTimeseries(ctx context.Context, filter persistence.OverviewFilter, bucket string) (persistence.MetricsTimeseries, error) {
+	var out persistence.MetricsTimeseries
+
+	if s == nil || s.db == nil || s.queryRows == nil {
+		return out, errors.New("event store is not configured")
+	}
+
+	width, ok := persistence.TimeseriesBuckets[bucket]
+	if !ok {
+		return out, fmt.Errorf("unsupported bucket %q", bucket)
+	}
+	windowStart, windowEnd, windowHours, err := overviewWindow(filter)
+	if err != nil {
+		return out, err
+	}
+	if points := windowEnd.Sub(windowStart) / width; points > persistence.MaxTimeseriesPoints {
+		return out, fmt.Errorf("window of %dh in %s buckets exceeds %d points", windowHours, bucket, persistence.MaxTimeseriesPoints)
+	}
+	firstBucket := windowStart.Truncate(width)
+
+	byBucket := make(map[int64]persistence.TimeseriesPoint)
+	source := persistence.OverviewSourceRaw
+	if windowEnd.Sub(windowStart) > rollupMinWindow {
+		if width < time.Hour {
+			return out, fmt.Errorf("windows longer than %s need a 1h or 1d bucket", rollupMinWindow)
+		}
+		plan, err := s.rollupWindowPlan(ctx, firstBucket, windowEnd)
+		if err != nil {
+			return out, err
+		}
+		if width < 24*time.Hour {
+			plan = plan.withoutDaily()
+		}
+		if err := s.addRollupTimeseries(ctx, plan, width, filter, byBucket); err != nil {
+			return out, err
+		}
+		source = persistence.OverviewSourceRollups
+	} else if err := s.addRawTimeseries(ctx, firstBucket, windowEnd, width, filter, byBucket); err != nil {
+		return out, err
+	}
+
+	filter.WindowHours = windowHours
+	out = persistence.MetricsTimeseries{
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
+		WindowHours: windowHours,
+		Bucket:      bucket,
+		Filters:     filter,
+		Points:      fillTimeseries(firstBucket, windowEnd, width, byBucket),
+		Source:      source,
+	}
+	return out, nil
+}
+
+// addRawTimeseries reads the points from runs and agent_events into byBucket.
+func (s *Store) addRawTimeseries(ctx context.Context, firstBucket time.Time, windowEnd time.Time, width time.Duration, filter persistence.OverviewFilter, byBucket map[int64]persistence.TimeseriesPoint) error {
+	query, args := buildTimeseriesQuery(firstBucket, windowEnd, width, filter)
+	rows, err := s.queryRows(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query metrics timeseries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var point persistence.TimeseriesPoint
+		dest := []any{
+			&point.BucketStart, &point.TotalRuns, &point.SuccessfulRuns, &point.FailedRuns,
+			&point.TotalCostUSD, &point.TotalTokens, &point.AvgLatencyMS,
+		}
+		if err := rows.Scan(append(dest, latencyDest(&point.RunLatency)...)...); err != nil {
+			return fmt.Errorf("scan metrics timeseries: %w", err)
+		}
+		point.BucketStart = point.BucketStart.UTC()
+		byBucket[point.BucketStart.Unix()] = point
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query metrics timeseries: %w", err)
+	}
+	return s.addCallLatencies(ctx, firstBucket, windowEnd, width, filter, byBucket)
+}
+
+// addRollupTimeseries reads the points from the plan's rollup segments into
+// byBucket; latency percentiles are estimated from the merged histograms.
+func (s *Store) addRollupTimeseries(ctx context.Context, plan rollupPlan, width time.Duration, filter persistence.OverviewFilter, byBucket map[int64]persistence.TimeseriesPoint) error {
+	query, args := buildRollupTimeseriesQuery(plan, width, filter)
+	rows, err := s.queryRows(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query rollup timeseries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucketStart time.Time
+		var kind string
+		var t rollupKindTotals
+		if err := t.scan(rows, &bucketStart, &kind); err != nil {
+			return fmt.Errorf("scan rollup timeseries: %w", err)
+		}
+
+		bucketStart = bucketStart.UTC()
+		point := byBucket[bucketStart.Unix()]
+		point.BucketStart = bucketStart
+		switch kind {
+		case "run":
+			point.TotalRuns, point.SuccessfulRuns, point.FailedRuns = t.total, t.successful, t.failed
+			point.TotalCostUSD, point.TotalTokens, point.AvgLatencyMS = t.costUSD, t.tokens, t.avgLatency()
+			point.RunLatency = histogramPercentiles(t.histogram)
+		case "step":
+			point.StepLatency = histogramPercentiles(t.histogram)
+		case "model_call":
+			point.ModelCallLatency = histogramPercentiles(t.histogram)
+		}
+		byBucket[bucketStart.Unix()] = point
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query rollup timeseries: %w", err)
+	}
+	return nil
+}
+
+// addCallLatencies sets step and model call latency percentiles on the
+// points in byBucket, adding points for buckets that had calls but no runs.
+func (s *Store) addCallLatencies(ctx context.Context, firstBucket time.Time, windowEnd time.Time, width time.Duration, filter persistence.OverviewFilter, byBucket map[int64]persistence.TimeseriesPoint) error {
+	query, args := buildCallLatencyQuery(firstBucket, windowEnd, width, filter)
+	rows, err := s.queryRows(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query call latency percentiles: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucketStart time.Time
+		var step, modelCall persistence.LatencyPercentiles
+		dest := append([]any{&bucketStart}, latencyDest(&step)...)
+		if err := rows.Scan(append(dest, latencyDest(&modelCall)...)...); err != nil {
+			return fmt.Errorf("scan call latency percentiles: %w", err)
+		}
+
+		bucketStart = bucketStart.UTC()
+		point, ok := byBucket[bucketStart.Unix()]
+		if !ok {
+			point.BucketStart = bucketStart
+		}
+		point.StepLatency, point.ModelCallLatency = step, modelCall
+		byBucket[bucketStart.Unix()] = point
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query call latency percentiles: %w", err)
+	}
+	return nil
+}
+
+// fillTimeseries returns one point per bucket from first through end, using
+// the queried point when there is one and a zero point otherwise.
+func fillTimeseries(first time.Time, end time.Time, width time.Duration, byBucket map[int64]persistence.TimeseriesPoint) []persistence.TimeseriesPoint {
+	points := make([]persistence.TimeseriesPoint, 0, int(end.Sub(first)/width)+1)
+	for bucketStart := first; !bucketStart.After(end); bucketStart = bucketStart.Add(width) {
+		point, ok := byBucket[bucketStart.Unix()]
+		if !ok {
+			point = persistence.TimeseriesPoint{BucketStart: bucketStart}
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+func buildTimeseriesQuery(windowStart time.Time, windowEnd time.Time, width time.Duration, filter persistence.OverviewFilter) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 8)
+
+	// Like the overview, runs count in the bucket they finished in.
+	b.WriteString(`
+SELECT
+  date_bin(make_interval(secs => $3), ended_at, TIMESTAMPTZ '1970-01-01 00:00:00+00') AS bucket_start,
+  COUNT(*) AS total_runs,
+  COUNT(*) FILTER (WHERE status = 'success') AS successful_runs,
+  COUNT(*) FILTER (WHERE status = 'failure') AS failed_runs,
+  COALESCE(SUM(total_cost_usd), 0) AS total_cost_usd,
+  COALESCE(SUM(total_tokens), 0)::BIGINT AS total_tokens,
+  COALESCE(AVG(latency_ms), 0) AS avg_latency_ms,
+  ` + percentileColumns("latency_ms", "") + `
+FROM runs
+WHERE status <> 'started' AND ended_at >= $1 AND ended_at <= $2`)
+	args = append(args, windowStart, windowEnd, int64(width/time.Second))
+	args = appendOverviewFilters(&b, args, filter)
+
+	b.WriteString("\nGROUP BY bucket_start\nORDER BY bucket_start\n")
+
+	return b.String(), args
+}
+
+// buildRollupTimeseriesQuery merges the plan's segments into one row per
+// bucket and kind. Widths below a day need a plan without daily rollups.
+func buildRollupTimeseriesQuery(plan rollupPlan, width time.Duration, filter persistence.OverviewFilter) (string, []any) {
+	var b strings.Builder
+	args := make([]any, 0, 24)
+
+	b.WriteString(`
+SELECT
+  date_bin(make_interval(secs => $1), bucket_start, TIMESTAMPTZ '1970-01-01 00:00:00+00') AS bucket_start,
+  kind,` + rollupTotalsSQL + `
+FROM (`)
+	args = append(args, int64(width/time.Second))
+	args = appendRollupSegments(&b, args, plan, filter)
+	b.WriteString("\n) segments\nGROUP BY 1, 2\nORDER BY 1\n")
+
+	return b.String(), args
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+func TestGetMetricsTimeseriesZeroFillsBuckets(t *testing.T) {
+	var captured recordedQuery
+	current := time.Now().UTC().Truncate(time.Hour)
+
+	store := &Store{
+		db: &fakeDB{},
+		queryRows: func(_ context.Context, query string, args ...any) (rowsScanner, error) {
+			if strings.Contains(query, "call_latencies") {
+				return &valuesRows{rows: [][]any{
+					append(append([]any{current.Add(-time.Hour)}, latencyValues(10, 20, 30, 40)...), latencyValues(0, 0, 0, 0)...),
+				}}, nil
+			}
+			captured = recordedQuery{query: query, args: args}
+			return &valuesRows{rows: [][]any{
+				append([]any{current.Add(-2 * time.Hour), int64(4), int64(3), int64(1), 1.5, int64(900), 250.0}, latencyValues(200, 300, 310, 320)...),
+				append([]any{current, int64(1), int64(1), int64(0), 0.25, int64(100), 80.0}, latencyValues(80, 80, 80, 80)...),
+			}}, nil
+		},
+	}
+
+	series, err := store.GetMetricsTimeseries(context.Background(), persistence.OverviewFilter{WindowHours: 3, ProjectID: "project-1"}, "1h")
+	if err != nil {
+		t.Fatalf("GetMetricsTimeseries() error = %v", err)
+	}
+
+	if !strings.Contains(captured.query, "date_bin(make_interval(secs => $3)") || !strings.Contains(captured.query, "project_id = $4") {
+		t.Fatalf("timeseries query = %s", captured.query)
+	}
+	if captured.args[2] != int64(3600) {
+		t.Fatalf("bucket seconds arg = %v, want 3600", captured.args[2])
+	}
+
+	// The window start falls inside the bucket three hours back, so four buckets cover it.
+	if len(series.Points) != 4 {
+		t.Fatalf("points = %d, want 4: %+v", len(series.Points), series.Points)
+	}
+	for i, point := range series.Points {
+		want := current.Add(time.Duration(i-3) * time.Hour)
+		if !point.BucketStart.Equal(want) {
+			t.Fatalf("point %d bucket_start = %v, want %v", i, point.BucketStart, want)
+		}
+	}
+	if series.Points[0].TotalRuns != 0 || series.Points[2].TotalRuns != 0 {
+		t.Fatalf("empty buckets not zero-filled: %+v", series.Points)
+	}
+	if p := series.Points[1]; p.TotalRuns != 4 || p.FailedRuns != 1 || p.TotalTokens != 900 || p.AvgLatencyMS != 250 || p.RunLatency.P99 != 320 {
+		t.Fatalf("point 1 = %+v", p)
+	}
+	// Step latencies land in a bucket without finished runs.
+	if p := series.Points[2]; p.StepLatency.P90 != 20 || !p.BucketStart.Equal(current.Add(-time.Hour)) {
+		t.Fatalf("point 2 = %+v", p)
+	}
+	if series.Points[3].TotalCostUSD != 0.25 || series.Bucket != "1h" || series.WindowHours != 3 {
+		t.Fatalf("series = %+v", series)
+	}
+}
+
+func TestGetMetricsTimeseriesRejectsBadBucket(t *testing.T) {
+	store := &Store{db: &fakeDB{}, queryRows: func(_ context.Context, _ string, _ ...any) (rowsScanner, error) {
+		t.Fatal("query must not run")
+		return nil, nil
+	}}
+
+	if _, err := store.GetMetricsTimeseries(context.Background(), persistence.OverviewFilter{}, "2h"); err == nil {
+		t.Fatal("GetMetricsTimeseries(2h) error = nil, want unsupported bucket")
+	}
+	if _, err := store.GetMetricsTimeseries(context.Background(), persistence.OverviewFilter{WindowHours: 168}, "1m"); err == nil {
+		t.Fatal("GetMetricsTimeseries(168h, 1m) error = nil, want too many points")
+	}
+}
+
+func TestGetMetricsTimeseriesReadsRollupsForLongWindows(t *testing.T) {
+	end := time.Now().UTC()
+	start := end.Add(-72 * time.Hour)
+	bucket := end.Truncate(time.Hour).Add(-24 * time.Hour)
+
+	var captured recordedQuery
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
+			return valuesRow{values: []any{end.Add(-10 * time.Minute)}}
+		},
+		queryRows: func(_ context.Context, query string, args ...any) (rowsScanner, error) {
+			captured = recordedQuery{query: query, args: args}
+			return &valuesRows{rows: [][]any{
+				{bucket, "run", int64(4), int64(3), int64(1), 2.0, int64(400), int64(1000), int64(4), histogram(4, 4)},
+				{bucket, "model_call", int64(2), int64(2), int64(0), 1.0, int64(300), int64(200), int64(2), histogram(5, 2)},
+			}}, nil
+		},
+	}
+
+	series, err := store.GetMetricsTimeseries(context.Background(), persistence.OverviewFilter{Start: &start, End: &end, TenantID: "tenant-1"}, "1h")
+	if err != nil {
+		t.Fatalf("GetMetricsTimeseries() error = %v", err)
+	}
+
+	if !strings.Contains(captured.query, "FROM rollups_hourly") || strings.Contains(captured.query, "ended_at, TIMESTAMPTZ") || captured.args[0] != int64(3600) {
+		t.Fatalf("timeseries query = %s, args = %v", captured.query, captured.args)
+	}
+	// Hourly buckets read whole days from rollups_hourly, so the daily span is empty.
+	if captured.args[1] != captured.args[2] {
+		t.Fatalf("daily span = %v..%v, want empty", captured.args[1], captured.args[2])
+	}
+	if series.Source != persistence.OverviewSourceRollups || len(series.Points) != 73 {
+		t.Fatalf("source = %q, points = %d", series.Source, len(series.Points))
+	}
+	point := series.Points[48]
+	if !point.BucketStart.Equal(bucket) || point.TotalRuns != 4 || point.FailedRuns != 1 || point.AvgLatencyMS != 250 {
+		t.Fatalf("point = %+v", point)
+	}
+	if point.RunLatency.P50 != 75 || point.ModelCallLatency.P50 != 175 || point.StepLatency.P50 != 0 {
+		t.Fatalf("latency = %+v / %+v / %+v", point.RunLatency, point.ModelCallLatency, point.StepLatency)
+	}
+}
+
+func TestGetMetricsTimeseriesRejectsLongWindowsWithoutRollups(t *testing.T) {
+	end := time.Now().UTC()
+	start := end.Add(-72 * time.Hour)
+	store := &Store{
+		db: &fakeDB{},
+		queryRow: func(_ context.Context, _ string, _ ...any) rowScanner {
+			return valuesRow{err: sql.ErrNoRows}
+		},
+		queryRows: func(_ context.Context, query string, _ ...any) (rowsScanner, error) {
+			t.Fatalf("a long window must not be scanned raw:\n%s", query)
+			return nil, nil
+		},
+	}
+
+	_, err := store.GetMetricsTimeseries(context.Background(), persistence.OverviewFilter{Start: &start, End: &end}, "1h")
+	if !errors.Is(err, persistence.ErrRollupsUnavailable) {
+		t.Fatalf("GetMetricsTimeseries() error = %v, want ErrRollupsUnavailable", err)
+	}
+	if _, err := store.GetMetricsTimeseries(context.Background(), persistence.OverviewFilter{Start: &start, End: &end}, "5m"); err == nil {
+		t.Fatal("GetMetricsTimeseries(72h, 5m) error = nil, want a bucket the rollups can serve")
+	}
+}
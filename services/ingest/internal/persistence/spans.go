@@ -0,0 +1,214 @@
+package persistence
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Span kinds, derived from the event_type prefix.
+const (
+	SpanKindRun       = "run"
+	SpanKindStep      = "step"
+	SpanKindModelCall = "model_call"
+	SpanKindToolCall  = "tool_call"
+	SpanKindOther     = "other"
+)
+
+// Span is one trace span of a run, folded from every event sharing its span_id.
+type Span struct {
+	SpanID       string  `json:"span_id"`
+	ParentSpanID *string `json:"parent_span_id"`
+	TraceID      string  `json:"trace_id"`
+	Kind         string  `json:"kind"`
+	// Name is the step name, step_id, or provider/model, whichever identifies the span best.
+	Name        string     `json:"name,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	StartedAt   *time.Time `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at"`
+	LatencyMS   *int64     `json:"latency_ms"`
+	TotalTokens *int64     `json:"total_tokens"`
+	CostUSD     *float64   `json:"cost_usd"`
+	ErrorType   *string    `json:"error_type,omitempty"`
+	Provider    *string    `json:"provider,omitempty"`
+	Model       *string    `json:"model,omitempty"`
+	// Orphaned marks spans whose parent_span_id never arrived; they are returned as roots.
+	Orphaned bool       `json:"orphaned"`
+	Events   []RunEvent `json:"events"`
+	Children []*Span    `json:"children"`
+}
+
+// BuildSpanTree groups events by span_id and links spans through
+// parent_span_id. Spans without a parent are roots; spans whose parent is
+// missing (or that only reach themselves through a cycle) are flagged as
+// orphaned and returned as roots too. Events must be in occurrence order.
+func BuildSpanTree(events []RunEvent) (roots []*Span, orphaned int) {
+	spans := make(map[string]*Span)
+	order := make([]*Span, 0)
+	for _, event := range events {
+		span, ok := spans[event.SpanID]
+		if !ok {
+			span = &Span{SpanID: event.SpanID, TraceID: event.TraceID, Kind: spanKind(event.EventType)}
+			spans[event.SpanID] = span
+			order = append(order, span)
+		}
+		span.apply(event)
+	}
+
+	for _, span := range order {
+		span.finish()
+	}
+
+	for _, span := range order {
+		if span.ParentSpanID == nil || *span.ParentSpanID == "" {
+			roots = append(roots, span)
+			continue
+		}
+		parent, ok := spans[*span.ParentSpanID]
+		if !ok || parent == span {
+			span.Orphaned = true
+			orphaned++
+			roots = append(roots, span)
+			continue
+		}
+		parent.Children = append(parent.Children, span)
+	}
+
+	// Spans caught in a parent cycle are unreachable from any root.
+	reachable := make(map[*Span]bool, len(order))
+	var walk func(span *Span)
+	walk = func(span *Span) {
+		reachable[span] = true
+		for _, child := range span.Children {
+			if !reachable[child] {
+				walk(child)
+			}
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+	for _, span := range order {
+		if reachable[span] {
+			continue
+		}
+		// Detach from the cycle so the tree stays acyclic when serialized.
+		parent := spans[*span.ParentSpanID]
+		parent.Children = removeSpan(parent.Children, span)
+		span.Orphaned = true
+		orphaned++
+		roots = append(roots, span)
+		walk(span)
+	}
+
+	sortSpans(roots)
+	return roots, orphaned
+}
+
+func (s *Span) apply(event RunEvent) {
+	s.Events = append(s.Events, event)
+	if s.Kind == SpanKindOther {
+		s.Kind = spanKind(event.EventType)
+	}
+	if event.ParentSpanID != nil && *event.ParentSpanID != "" {
+		s.ParentSpanID = event.ParentSpanID
+	}
+
+	occurredAt := event.OccurredAt
+	if s.StartedAt == nil || occurredAt.Before(*s.StartedAt) {
+		s.StartedAt = &occurredAt
+	}
+
+	switch {
+	case strings.HasSuffix(event.EventType, ".completed"), strings.HasSuffix(event.EventType, ".failed"):
+		s.EndedAt = &occurredAt
+		s.Status = "success"
+		if strings.HasSuffix(event.EventType, ".failed") {
+			s.Status = "failure"
+		}
+		if event.TotalTokens != nil {
+			s.TotalTokens = event.TotalTokens
+		}
+		if event.CostUSD != nil {
+			s.CostUSD = event.CostUSD
+		}
+		if event.LatencyMS != nil {
+			s.LatencyMS = event.LatencyMS
+		}
+	case strings.HasSuffix(event.EventType, ".started"):
+		if s.Status == "" {
+			s.Status = "started"
+		}
+	}
+
+	// Run and step events carry an explicit status (e.g. cancelled, skipped).
+	if (s.Kind == SpanKindRun || s.Kind == SpanKindStep) && event.Status != nil && *event.Status != "started" {
+		s.Status = *event.Status
+	}
+	if event.ErrorType != nil {
+		s.ErrorType = event.ErrorType
+	}
+	if event.Provider != nil {
+		s.Provider = event.Provider
+	}
+	if event.Model != nil {
+		s.Model = event.Model
+	}
+	if s.Kind == SpanKindStep || s.Kind == SpanKindToolCall {
+		if event.StepName != nil && *event.StepName != "" {
+			s.Name = *event.StepName
+		} else if s.Name == "" && event.StepID != nil {
+			s.Name = *event.StepID
+		}
+	}
+}
+
+func (s *Span) finish() {
+	if s.Kind == SpanKindModelCall && s.Provider != nil && s.Model != nil {
+		s.Name = *s.Provider + "/" + *s.Model
+	}
+	if s.LatencyMS == nil && s.StartedAt != nil && s.EndedAt != nil {
+		latency := s.EndedAt.Sub(*s.StartedAt).Milliseconds()
+		s.LatencyMS = &latency
+	}
+	s.Children = make([]*Span, 0)
+}
+
+func spanKind(eventType string) string {
+	switch {
+	case strings.HasPrefix(eventType, "run."):
+		return SpanKindRun
+	case strings.HasPrefix(eventType, "step."):
+		return SpanKindStep
+	case strings.HasPrefix(eventType, "model.call."):
+		return SpanKindModelCall
+	case strings.HasPrefix(eventType, "tool.call."):
+		return SpanKindToolCall
+	default:
+		return SpanKindOther
+	}
+}
+
+func removeSpan(spans []*Span, target *Span) []*Span {
+	out := spans[:0]
+	for _, span := range spans {
+		if span != target {
+			out = append(out, span)
+		}
+	}
+	return out
+}
+
+// sortSpans orders siblings by start time, then span_id, at every level.
+func sortSpans(spans []*Span) {
+	sort.SliceStable(spans, func(i, j int) bool {
+		a, b := spans[i].StartedAt, spans[j].StartedAt
+		if !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return spans[i].SpanID < spans[j].SpanID
+	})
+	for _, span := range spans {
+		sortSpans(span.Children)
+	}
+}
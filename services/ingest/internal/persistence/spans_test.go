@@ -0,0 +1,101 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+)
+
+func strPtr(s string) *string { return &s }
+
+func int64Ptr(n int64) *int64 { return &n }
+
+func float64Ptr(f float64) *float64 { return &f }
+
+func spanEvent(eventType string, offset time.Duration, spanID string, parent string) RunEvent {
+	event := RunEvent{
+		EventID:    spanID + "-" + eventType,
+		EventType:  eventType,
+		OccurredAt: time.Date(2026, 2, 7, 21, 0, 0, 0, time.UTC).Add(offset),
+		TraceID:    "trace-1",
+		SpanID:     spanID,
+	}
+	if parent != "" {
+		event.ParentSpanID = strPtr(parent)
+	}
+	return event
+}
+
+func TestBuildSpanTreeNestsSpansAndFlagsOrphans(t *testing.T) {
+	modelDone := spanEvent("model.call.completed", 3*time.Second, "model-1", "step-1")
+	modelDone.TotalTokens = int64Ptr(120)
+	modelDone.CostUSD = float64Ptr(0.02)
+	modelDone.Provider = strPtr("openai")
+	modelDone.Model = strPtr("gpt-4o")
+
+	stepDone := spanEvent("step.completed", 4*time.Second, "step-1", "run-1")
+	stepDone.Status = strPtr("success")
+	stepDone.LatencyMS = int64Ptr(3000)
+	stepDone.StepName = strPtr("plan")
+
+	events := []RunEvent{
+		spanEvent("run.started", 0, "run-1", ""),
+		spanEvent("step.started", time.Second, "step-1", "run-1"),
+		spanEvent("model.call.started", 2*time.Second, "model-1", "step-1"),
+		modelDone,
+		stepDone,
+		spanEvent("tool.call.failed", 5*time.Second, "tool-1", "missing-step"),
+		spanEvent("run.completed", 6*time.Second, "run-1", ""),
+	}
+
+	roots, orphaned := BuildSpanTree(events)
+	if orphaned != 1 || len(roots) != 2 {
+		t.Fatalf("roots = %d, orphaned = %d, want run root plus one orphan", len(roots), orphaned)
+	}
+
+	run := roots[0]
+	if run.SpanID != "run-1" || run.Kind != SpanKindRun || run.Status != "success" || len(run.Events) != 2 {
+		t.Fatalf("run span = %+v", run)
+	}
+	if run.LatencyMS == nil || *run.LatencyMS != 6000 {
+		t.Fatalf("run latency = %v, want derived 6000ms", run.LatencyMS)
+	}
+
+	if len(run.Children) != 1 {
+		t.Fatalf("run children = %d, want 1", len(run.Children))
+	}
+	step := run.Children[0]
+	if step.Kind != SpanKindStep || step.Name != "plan" || *step.LatencyMS != 3000 {
+		t.Fatalf("step span = %+v", step)
+	}
+
+	if len(step.Children) != 1 {
+		t.Fatalf("step children = %d, want 1", len(step.Children))
+	}
+	model := step.Children[0]
+	if model.Kind != SpanKindModelCall || model.Name != "openai/gpt-4o" || *model.TotalTokens != 120 || *model.CostUSD != 0.02 {
+		t.Fatalf("model span = %+v", model)
+	}
+	if *model.LatencyMS != 1000 {
+		t.Fatalf("model latency = %d, want 1000", *model.LatencyMS)
+	}
+
+	orphan := roots[1]
+	if !orphan.Orphaned || orphan.SpanID != "tool-1" || orphan.Status != "failure" {
+		t.Fatalf("orphan span = %+v", orphan)
+	}
+}
+
+func TestBuildSpanTreeBreaksParentCycles(t *testing.T) {
+	events := []RunEvent{
+		spanEvent("step.started", 0, "a", "b"),
+		spanEvent("step.started", time.Second, "b", "a"),
+	}
+
+	roots, orphaned := BuildSpanTree(events)
+	if orphaned != 1 || len(roots) != 1 {
+		t.Fatalf("roots = %d, orphaned = %d, want the cycle reported once", len(roots), orphaned)
+	}
+	if roots[0].SpanID != "a" || len(roots[0].Children) != 1 || len(roots[0].Children[0].Children) != 0 {
+		t.Fatalf("cycle not broken: %+v", roots[0])
+	}
+}
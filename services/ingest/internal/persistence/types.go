@@ -1,15 +1,24 @@
 package persistence
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
-// OverviewFilter defines query constraints for metrics overview reads.
+// OverviewFilter defines query constraints for metrics overview reads. The
+// window is Start/End when Start is set, the current month for Range "mtd",
+// and otherwise the WindowHours ending now.
 type OverviewFilter struct {
-	WindowHours int    `json:"window_hours"`
-	TenantID    string `json:"tenant_id,omitempty"`
-	WorkspaceID string `json:"workspace_id,omitempty"`
-	ProjectID   string `json:"project_id,omitempty"`
-	AgentID     string `json:"agent_id,omitempty"`
-	WorkflowID  string `json:"workflow_id,omitempty"`
+	WindowHours int        `json:"window_hours"`
+	Start       *time.Time `json:"start,omitempty"`
+	End         *time.Time `json:"end,omitempty"`
+	Range       string     `json:"range,omitempty"`
+	TenantID    string     `json:"tenant_id,omitempty"`
+	WorkspaceID string     `json:"workspace_id,omitempty"`
+	ProjectID   string     `json:"project_id,omitempty"`
+	AgentID     string     `json:"agent_id,omitempty"`
+	WorkflowID  string     `json:"workflow_id,omitempty"`
 }
 
 // OverviewMetrics is the deterministic response contract for GET /v1/metrics/overview.
@@ -24,4 +33,331 @@ type OverviewMetrics struct {
 	SuccessRate    float64        `json:"success_rate"`
 	TotalCostUSD   float64        `json:"total_cost_usd"`
 	AvgLatencyMS   float64        `json:"avg_latency_ms"`
+	// Latency distributions: runs by runs.latency_ms, steps and model calls by step.latency_ms.
+	RunLatency       LatencyPercentiles `json:"run_latency_ms"`
+	StepLatency      LatencyPercentiles `json:"step_latency_ms"`
+	ModelCallLatency LatencyPercentiles `json:"model_call_latency_ms"`
+	// Source is OverviewSourceRaw or OverviewSourceRollups.
+	Source string `json:"source"`
+	// CostBasis names what TotalCostUSD covers: OverviewCostFinishedRuns.
+	CostBasis string `json:"cost_basis"`
+
+	// Previous holds the same metrics for the comparison period when requested.
+	Previous *OverviewMetrics `json:"previous,omitempty"`
+}
+
+// Overview metric sources. Rollup-backed latency percentiles are estimated
+// from fixed histogram buckets rather than computed exactly.
+const (
+	OverviewSourceRaw     = "raw"
+	OverviewSourceRollups = "rollups"
+)
+
+// OverviewCostFinishedRuns is the overview's cost basis: the total cost of
+// the runs that ended in the window. Spend of runs still in flight, and of
+// calls in the window whose run ends later, is not counted yet.
+const OverviewCostFinishedRuns = "finished_runs"
+
+// RollupResult reports one aggregation pass over newly ingested rows.
+type RollupResult struct {
+	PreviousWatermark time.Time
+	Watermark         time.Time
+	// Hours is the number of hourly buckets recomputed.
+	Hours int
+}
+
+// PartitionPolicy drives one agent_events partition maintenance pass.
+type PartitionPolicy struct {
+	Now time.Time
+	// PrecreateDays is how many daily partitions are kept ready after today.
+	PrecreateDays int
+	// DefaultRetentionDays applies to tenants without a tenant_retention_policies
+	// row; zero keeps their events forever.
+	DefaultRetentionDays int
+	// Archive detaches expired partitions into the archive schema instead of dropping them.
+	Archive bool
+}
+
+// PartitionMaintenance reports what one maintenance pass changed.
+type PartitionMaintenance struct {
+	Created       []string
+	Dropped       []string
+	Archived      []string
+	PurgedEvents  int64
+	PurgedRuns    int64
+	PurgedRollups int64
+}
+
+// LatencyPercentiles summarizes a latency distribution in milliseconds; all
+// zero when nothing in the window reported a latency.
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// TimeseriesBuckets maps each supported bucket size to its width.
+var TimeseriesBuckets = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// MaxTimeseriesPoints bounds window/bucket for one request: a week of 5m buckets.
+const MaxTimeseriesPoints = 2016
+
+// TimeseriesPoint aggregates the runs that ended within one bucket.
+type TimeseriesPoint struct {
+	BucketStart    time.Time `json:"bucket_start"`
+	TotalRuns      int64     `json:"total_runs"`
+	SuccessfulRuns int64     `json:"successful_runs"`
+	FailedRuns     int64     `json:"failed_runs"`
+	TotalCostUSD   float64   `json:"total_cost_usd"`
+	TotalTokens    int64     `json:"total_tokens"`
+	AvgLatencyMS   float64   `json:"avg_latency_ms"`
+
+	RunLatency       LatencyPercentiles `json:"run_latency_ms"`
+	StepLatency      LatencyPercentiles `json:"step_latency_ms"`
+	ModelCallLatency LatencyPercentiles `json:"model_call_latency_ms"`
+}
+
+// MetricsTimeseries is the response contract for GET /v1/metrics/timeseries.
+// Points cover the window in order, with zeroes for buckets without runs.
+type MetricsTimeseries struct {
+	WindowStart time.Time         `json:"window_start"`
+	WindowEnd   time.Time         `json:"window_end"`
+	WindowHours int               `json:"window_hours"`
+	Bucket      string            `json:"bucket"`
+	Filters     OverviewFilter    `json:"filters"`
+	Points      []TimeseriesPoint `json:"points"`
+	// Source is OverviewSourceRaw or OverviewSourceRollups.
+	Source string `json:"source"`
+}
+
+// Breakdown group_by dimensions. Run dimensions group the runs table; provider
+// and model group model call events by their model_call payload.
+const (
+	BreakdownTenant    = "tenant"
+	BreakdownWorkspace = "workspace"
+	BreakdownProject   = "project"
+	BreakdownAgent     = "agent"
+	BreakdownWorkflow  = "workflow"
+	BreakdownProvider  = "provider"
+	BreakdownModel     = "model"
+)
+
+// BreakdownDimensions lists the supported breakdown group_by values.
+var BreakdownDimensions = []string{
+	BreakdownTenant,
+	BreakdownWorkspace,
+	BreakdownProject,
+	BreakdownAgent,
+	BreakdownWorkflow,
+	BreakdownProvider,
+	BreakdownModel,
+}
+
+// Breakdown units: what TotalRuns and its success/failure split count.
+const (
+	BreakdownUnitRuns       = "runs"
+	BreakdownUnitModelCalls = "model_calls"
+)
+
+// BreakdownRow holds overview metrics for one dimension value.
+type BreakdownRow struct {
+	Key            string  `json:"key,omitempty"`
+	TotalRuns      int64   `json:"total_runs"`
+	SuccessfulRuns int64   `json:"successful_runs"`
+	FailedRuns     int64   `json:"failed_runs"`
+	SuccessRate    float64 `json:"success_rate"`
+	TotalCostUSD   float64 `json:"total_cost_usd"`
+	TotalTokens    int64   `json:"total_tokens"`
+	AvgLatencyMS   float64 `json:"avg_latency_ms"`
+}
+
+// MetricsBreakdown is the response contract for GET /v1/metrics/breakdown.
+// Rows holds the Limit most expensive values; Other folds in the rest.
+type MetricsBreakdown struct {
+	WindowStart time.Time      `json:"window_start"`
+	WindowEnd   time.Time      `json:"window_end"`
+	WindowHours int            `json:"window_hours"`
+	Filters     OverviewFilter `json:"filters"`
+	GroupBy     string         `json:"group_by"`
+	Unit        string         `json:"unit"`
+	Limit       int            `json:"limit"`
+	Rows        []BreakdownRow `json:"rows"`
+	Other       *BreakdownRow  `json:"other"`
+	// Source is OverviewSourceRaw or OverviewSourceRollups.
+	Source string `json:"source"`
+}
+
+// ErrNotFound is returned by reads for a missing entity.
+var ErrNotFound = errors.New("not found")
+
+// ErrRollupsUnavailable is returned for long metrics windows that must be
+// served from rollups before the aggregator has covered them.
+var ErrRollupsUnavailable = errors.New("rollups unavailable")
+
+// ErrInvalidEvent marks an event that can never be stored as sent, such as a
+// missing column value or a value postgres rejects. Retrying or spooling it
+// cannot help, so callers reject it instead.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// InvalidEventsError is returned by bulk inserts that skipped invalid events
+// and wrote the rest. Errs is keyed by the payload's index in the call.
+type InvalidEventsError struct {
+	Errs map[int]error
+}
+
+func (e *InvalidEventsError) Error() string {
+	first := -1
+	for idx := range e.Errs {
+		if first < 0 || idx < first {
+			first = idx
+		}
+	}
+	if first < 0 {
+		return ErrInvalidEvent.Error()
+	}
+	return fmt.Sprintf("%d invalid events, first at %d: %v", len(e.Errs), first, e.Errs[first])
+}
+
+// Unwrap lets errors.Is(err, ErrInvalidEvent) match.
+func (e *InvalidEventsError) Unwrap() error {
+	return ErrInvalidEvent
+}
+
+// Run is one row of the runs table.
+type Run struct {
+	RunID           string     `json:"run_id"`
+	TenantID        string     `json:"tenant_id"`
+	WorkspaceID     string     `json:"workspace_id"`
+	ProjectID       string     `json:"project_id"`
+	AgentID         string     `json:"agent_id"`
+	WorkflowID      string     `json:"workflow_id"`
+	WorkflowVersion *string    `json:"workflow_version"`
+	PromptVersion   *string    `json:"prompt_version"`
+	Status          string     `json:"status"`
+	ErrorType       *string    `json:"error_type"`
+	StartedAt       *time.Time `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at"`
+	LatencyMS       *int64     `json:"latency_ms"`
+	TotalTokens     int64      `json:"total_tokens"`
+	TotalCostUSD    float64    `json:"total_cost_usd"`
+	StepCount       int64      `json:"step_count"`
+	ModelCallCount  int64      `json:"model_call_count"`
+	ToolCallCount   int64      `json:"tool_call_count"`
+	FirstEventAt    time.Time  `json:"first_event_at"`
+	LastEventAt     time.Time  `json:"last_event_at"`
+}
+
+// RunEvent is one stored event of a run with the fields needed to rebuild its trace.
+type RunEvent struct {
+	EventID      string    `json:"event_id"`
+	EventType    string    `json:"event_type"`
+	OccurredAt   time.Time `json:"occurred_at"`
+	TraceID      string    `json:"-"`
+	SpanID       string    `json:"-"`
+	ParentSpanID *string   `json:"-"`
+	// Status is run.status on run events and step.status on step events.
+	Status      *string  `json:"status,omitempty"`
+	ErrorType   *string  `json:"error_type,omitempty"`
+	TotalTokens *int64   `json:"total_tokens,omitempty"`
+	CostUSD     *float64 `json:"cost_usd,omitempty"`
+	// LatencyMS is run.latency_ms or step.latency_ms as reported by the producer.
+	LatencyMS *int64  `json:"latency_ms,omitempty"`
+	StepID    *string `json:"-"`
+	StepName  *string `json:"-"`
+	Provider  *string `json:"-"`
+	Model     *string `json:"-"`
+}
+
+// RunDetail is the response contract for GET /v1/runs/{run_id}.
+type RunDetail struct {
+	Run           Run     `json:"run"`
+	Spans         []*Span `json:"spans"`
+	EventCount    int     `json:"event_count"`
+	OrphanedSpans int     `json:"orphaned_spans"`
+	// Truncated is set when the run has more events than were loaded.
+	Truncated bool `json:"truncated"`
+}
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Failure group_by dimensions.
+const (
+	FailureGroupErrorType        = "error_type"
+	FailureGroupErrorCode        = "error_code"
+	FailureGroupErrorMessageHash = "error_message_hash"
+	FailureGroupModel            = "model"
+	FailureGroupTool             = "tool"
+)
+
+// FailureGroupDimensions lists the supported FailureQuery.GroupBy values.
+var FailureGroupDimensions = []string{
+	FailureGroupErrorType,
+	FailureGroupErrorCode,
+	FailureGroupErrorMessageHash,
+	FailureGroupModel,
+	FailureGroupTool,
+}
+
+// FailureQuery selects failed run, step, model call and tool call events.
+type FailureQuery struct {
+	Filter OverviewFilter
+	// GroupBy is empty for the event list, or one of the FailureGroup* dimensions.
+	GroupBy string
+	Cursor  string
+	Limit   int
+}
+
+// Failure is one failed event.
+type Failure struct {
+	EventID          string    `json:"event_id"`
+	EventType        string    `json:"event_type"`
+	OccurredAt       time.Time `json:"occurred_at"`
+	RunID            string    `json:"run_id"`
+	TenantID         string    `json:"tenant_id"`
+	WorkspaceID      string    `json:"workspace_id"`
+	ProjectID        string    `json:"project_id"`
+	AgentID          string    `json:"agent_id"`
+	WorkflowID       string    `json:"workflow_id"`
+	SpanID           string    `json:"span_id"`
+	ErrorType        *string   `json:"error_type"`
+	ErrorCode        *string   `json:"error_code"`
+	ErrorMessageHash *string   `json:"error_message_hash"`
+	Retryable        *bool     `json:"retryable"`
+	Model            *string   `json:"model"`
+	Tool             *string   `json:"tool"`
+}
+
+// FailurePage is the response contract for GET /v1/failures.
+type FailurePage struct {
+	WindowStart time.Time      `json:"window_start"`
+	WindowEnd   time.Time      `json:"window_end"`
+	Filters     OverviewFilter `json:"filters"`
+	Failures    []Failure      `json:"failures"`
+	NextCursor  string         `json:"next_cursor,omitempty"`
+}
+
+// FailureGroup aggregates failures sharing one group_by value; Key is nil for events without it.
+type FailureGroup struct {
+	Key          *string   `json:"key"`
+	Count        int64     `json:"count"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	SampleRunIDs []string  `json:"sample_run_ids"`
+}
+
+// FailureGroupPage is the response contract for GET /v1/failures?group_by=.
+type FailureGroupPage struct {
+	WindowStart time.Time      `json:"window_start"`
+	WindowEnd   time.Time      `json:"window_end"`
+	Filters     OverviewFilter `json:"filters"`
+	GroupBy     string         `json:"group_by"`
+	Groups      []FailureGroup `json:"groups"`
+	NextCursor  string         `json:"next_cursor,omitempty"`
 }
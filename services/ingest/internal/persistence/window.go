@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Window limits shared by every metrics and failures read.
+const (
+	DefaultWindowHours = 24
+	// MaxWindowHours bounds the window_hours shorthand; longer ranges use start/end.
+	MaxWindowHours = 24 * 7
+	// MaxWindowMonths bounds explicit and month-to-date ranges.
+	MaxWindowMonths = 13
+)
+
+// RangeMonthToDate selects the current UTC calendar month up to now.
+const RangeMonthToDate = "mtd"
+
+// Window resolves the filter to the [start, end] it covers as of now: the
+// explicit Start/End, month-to-date, or the trailing WindowHours (default 24).
+func (f OverviewFilter) Window(now time.Time) (time.Time, time.Time, error) {
+	now = now.UTC()
+
+	switch {
+	case f.Range == RangeMonthToDate:
+		if f.Start != nil || f.End != nil {
+			return time.Time{}, time.Time{}, errors.New("range cannot be combined with start/end")
+		}
+		return monthStart(now), now, nil
+	case f.Range != "":
+		return time.Time{}, time.Time{}, fmt.Errorf("unsupported range %q", f.Range)
+	case f.Start != nil:
+		end := now
+		if f.End != nil {
+			end = f.End.UTC()
+		}
+		start := f.Start.UTC()
+		if !start.Before(end) {
+			return time.Time{}, time.Time{}, errors.New("start must be before end")
+		}
+		if end.After(start.AddDate(0, MaxWindowMonths, 0)) {
+			return time.Time{}, time.Time{}, fmt.Errorf("start/end may span at most %d months", MaxWindowMonths)
+		}
+		return start, end, nil
+	case f.End != nil:
+		return time.Time{}, time.Time{}, errors.New("end requires start")
+	}
+
+	windowHours := f.WindowHours
+	if windowHours == 0 {
+		windowHours = DefaultWindowHours
+	}
+	if windowHours < 1 || windowHours > MaxWindowHours {
+		return time.Time{}, time.Time{}, fmt.Errorf("window_hours must be between 1 and %d", MaxWindowHours)
+	}
+	return now.Add(-time.Duration(windowHours) * time.Hour), now, nil
+}
+
+// PreviousWindow returns the period that [start, end] is compared against:
+// the same elapsed time from the start of the previous month for
+// month-to-date, otherwise the equally long window ending at start.
+func (f OverviewFilter) PreviousWindow(start time.Time, end time.Time) (time.Time, time.Time) {
+	if f.Range == RangeMonthToDate {
+		previousStart := start.AddDate(0, -1, 0)
+		previousEnd := previousStart.Add(end.Sub(start))
+		if previousEnd.After(start) {
+			previousEnd = start
+		}
+		return previousStart, previousEnd
+	}
+	return start.Add(-end.Sub(start)), start
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
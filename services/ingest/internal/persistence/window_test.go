@@ -0,0 +1,83 @@
+package persistence
+
+import (
+	"testing"
+	"time"
+)
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestWindowResolvesRanges(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	start := time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		filter    OverviewFilter
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		"default":       {OverviewFilter{}, now.Add(-24 * time.Hour), now},
+		"window_hours":  {OverviewFilter{WindowHours: 6}, now.Add(-6 * time.Hour), now},
+		"start and end": {OverviewFilter{Start: timePtr(start), End: timePtr(start.AddDate(0, 1, 0))}, start, start.AddDate(0, 1, 0)},
+		"open end":      {OverviewFilter{Start: timePtr(start)}, start, now},
+		"month to date": {OverviewFilter{Range: RangeMonthToDate}, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), now},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotStart, gotEnd, err := tt.filter.Window(now)
+			if err != nil {
+				t.Fatalf("Window() error = %v", err)
+			}
+			if !gotStart.Equal(tt.wantStart) || !gotEnd.Equal(tt.wantEnd) {
+				t.Fatalf("Window() = [%v, %v], want [%v, %v]", gotStart, gotEnd, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestWindowRejectsInvalidRanges(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]OverviewFilter{
+		"window_hours too large": {WindowHours: 169},
+		"end before start":       {Start: timePtr(now), End: timePtr(now.Add(-time.Hour))},
+		"end without start":      {End: timePtr(now)},
+		"over 13 months":         {Start: timePtr(time.Date(2025, 2, 27, 0, 0, 0, 0, time.UTC))},
+		"unknown range":          {Range: "ytd"},
+		"range with start":       {Range: RangeMonthToDate, Start: timePtr(now.Add(-time.Hour))},
+	}
+	for name, filter := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := filter.Window(now); err == nil {
+				t.Fatal("Window() error = nil")
+			}
+		})
+	}
+
+	if _, _, err := (OverviewFilter{Start: timePtr(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))}).Window(now); err != nil {
+		t.Fatalf("13 month window error = %v", err)
+	}
+}
+
+func TestPreviousWindow(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	prevStart, prevEnd := OverviewFilter{WindowHours: 24}.PreviousWindow(start, start.Add(24*time.Hour))
+	if !prevStart.Equal(start.Add(-24*time.Hour)) || !prevEnd.Equal(start) {
+		t.Fatalf("trailing previous = [%v, %v]", prevStart, prevEnd)
+	}
+
+	// Month-to-date compares against the same elapsed time into the previous
+	// month, clamped so a long month never overlaps the current one.
+	mtd := OverviewFilter{Range: RangeMonthToDate}
+	prevStart, prevEnd = mtd.PreviousWindow(start, start.Add(10*24*time.Hour))
+	if !prevStart.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) || !prevEnd.Equal(time.Date(2026, 2, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("mtd previous = [%v, %v]", prevStart, prevEnd)
+	}
+	_, prevEnd = mtd.PreviousWindow(start, time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC))
+	if !prevEnd.Equal(start) {
+		t.Fatalf("mtd previous end = %v, want clamped to %v", prevEnd, start)
+	}
+}
@@ -0,0 +1,286 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const (
+	writeTimeout        = 10 * time.Second
+	defaultRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff     = 5 * time.Second
+)
+
+var (
+	// ErrQueueFull is returned by Enqueue when the bounded queue has no free capacity.
+	ErrQueueFull = errors.New("event queue is full")
+	// ErrClosed is returned by Enqueue once shutdown has started.
+	ErrClosed = errors.New("event queue is closed")
+)
+
+// EventWriter persists batches of validated events.
+type EventWriter interface {
+	InsertEvents(ctx context.Context, payloads []map[string]any) ([]bool, error)
+}
+
+// Spooler durably stores events that could not be written.
+type Spooler interface {
+	Append(payload map[string]any) error
+}
+
+// Config controls queue capacity and writer batching.
+type Config struct {
+	QueueSize     int
+	Workers       int
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// Spool, when set, receives batches whose write failed so they are replayed
+	// later. Without one, a failed batch is retried until shutdown, waiting
+	// RetryBackoff (default 100ms) at first and doubling up to 5s.
+	Spool        Spooler
+	RetryBackoff time.Duration
+}
+
+// Pipeline buffers validated events in a bounded in-memory queue drained by
+// a pool of writer goroutines that persist them in batches.
+type Pipeline struct {
+	logger *slog.Logger
+	writer EventWriter
+	cfg    Config
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan map[string]any
+	wg     sync.WaitGroup
+	start  sync.Once
+	// stopping is closed by Shutdown to end retries.
+	stopping chan struct{}
+	dropped  atomic.Int64
+}
+
+// New constructs a pipeline. Call Start to launch writers.
+func New(logger *slog.Logger, writer EventWriter, cfg Config) (*Pipeline, error) {
+	if writer == nil {
+		return nil, errors.New("event writer is required")
+	}
+	if cfg.QueueSize < 1 {
+		return nil, fmt.Errorf("queue size must be positive, got %d", cfg.QueueSize)
+	}
+	if cfg.Workers < 1 {
+		return nil, fmt.Errorf("workers must be positive, got %d", cfg.Workers)
+	}
+	if cfg.BatchSize < 1 {
+		return nil, fmt.Errorf("batch size must be positive, got %d", cfg.BatchSize)
+	}
+	if cfg.FlushInterval <= 0 {
+		return nil, fmt.Errorf("flush interval must be positive, got %s", cfg.FlushInterval)
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+
+	return &Pipeline{
+		logger:   logger,
+		writer:   writer,
+		cfg:      cfg,
+		queue:    make(chan map[string]any, cfg.QueueSize),
+		stopping: make(chan struct{}),
+	}, nil
+}
+
+// Start launches the writer pool. It is safe to call more than once.
+func (p *Pipeline) Start() {
+	p.start.Do(func() {
+		for i := 0; i < p.cfg.Workers; i++ {
+			p.wg.Add(1)
+			go p.runWriter(i)
+		}
+	})
+}
+
+// Enqueue hands a validated event to the writers without blocking.
+func (p *Pipeline) Enqueue(payload map[string]any) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	select {
+	case p.queue <- payload:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Depth reports the number of events waiting to be written.
+func (p *Pipeline) Depth() int {
+	return len(p.queue)
+}
+
+// Dropped reports the number of accepted events lost because they could be
+// neither written nor spooled.
+func (p *Pipeline) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Shutdown stops intake and waits for writers to drain queued events or for ctx to expire.
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+		close(p.stopping)
+	}
+	p.mu.Unlock()
+
+	p.Start() // drain even if writers were never launched
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.logger.Info("ingest_queue_drained")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("drain event queue: %w (%d events left)", ctx.Err(), p.Depth())
+	}
+}
+
+func (p *Pipeline) runWriter(id int) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]map[string]any, 0, p.cfg.BatchSize)
+	for {
+		select {
+		case payload, ok := <-p.queue:
+			if !ok {
+				p.flush(id, batch)
+				return
+			}
+			batch = append(batch, payload)
+			if len(batch) >= p.cfg.BatchSize {
+				p.flush(id, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(id, batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes batch. Without a spool a failed write is retried with
+// backoff until shutdown; whatever is still unwritten then is dropped.
+func (p *Pipeline) flush(id int, batch []map[string]any) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := p.write(id, batch)
+	for backoff := p.cfg.RetryBackoff; err != nil && p.cfg.Spool == nil; backoff = min(2*backoff, maxRetryBackoff) {
+		select {
+		case <-p.stopping:
+			p.drop(id, len(batch), err)
+			return
+		case <-time.After(backoff):
+		}
+		err = p.write(id, batch)
+	}
+	if err != nil {
+		p.spoolBatch(id, batch)
+	}
+}
+
+// write inserts batch once. Events the store rejects as invalid are logged
+// and count as handled: the rest of the batch was written.
+func (p *Pipeline) write(id int, batch []map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	inserted, err := p.writer.InsertEvents(ctx, batch)
+	var invalid *persistence.InvalidEventsError
+	if errors.As(err, &invalid) {
+		// The rest of the batch was written; spooling these would only fail again.
+		for idx, invalidErr := range invalid.Errs {
+			p.logger.Error("ingest_event_invalid",
+				slog.Int("writer", id),
+				slog.Any("event_id", batch[idx]["event_id"]),
+				slog.String("error", invalidErr.Error()),
+			)
+		}
+		err = nil
+	}
+	if err != nil {
+		p.logger.Error("ingest_batch_persist_failed",
+			slog.Int("writer", id),
+			slog.Int("events", len(batch)),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	newEvents := 0
+	for _, ok := range inserted {
+		if ok {
+			newEvents++
+		}
+	}
+	p.logger.Debug("ingest_batch_persisted",
+		slog.Int("writer", id),
+		slog.Int("events", len(batch)),
+		slog.Int("inserted", newEvents),
+	)
+	return nil
+}
+
+func (p *Pipeline) spoolBatch(id int, batch []map[string]any) {
+	// Keep going after a failure: one oversized event must not cost the rest of the batch.
+	lost := 0
+	var lastErr error
+	for _, payload := range batch {
+		if err := p.cfg.Spool.Append(payload); err != nil {
+			lost++
+			lastErr = err
+		}
+	}
+	if lost > 0 {
+		p.drop(id, lost, fmt.Errorf("spool: %w", lastErr))
+	}
+	if spooled := len(batch) - lost; spooled > 0 {
+		p.logger.Warn("ingest_batch_spooled", slog.Int("writer", id), slog.Int("events", spooled))
+	}
+}
+
+// drop counts events that were accepted but will never be stored.
+func (p *Pipeline) drop(id, events int, err error) {
+	total := p.dropped.Add(int64(events))
+	p.logger.Error("ingest_batch_dropped",
+		slog.Int("writer", id),
+		slog.Int("events", events),
+		slog.Int64("dropped_total", total),
+		slog.String("error", err.Error()),
+	)
+}
@@ -0,0 +1,300 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+type recordingWriter struct {
+	mu      sync.Mutex
+	batches [][]map[string]any
+	block   chan struct{}
+	err     error
+	// failFirst fails that many calls before succeeding.
+	failFirst int
+}
+
+func (w *recordingWriter) InsertEvents(_ context.Context, payloads []map[string]any) ([]bool, error) {
+	if w.block != nil {
+		<-w.block
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.failFirst > 0 {
+		w.failFirst--
+		return nil, errors.New("db down")
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	batch := append([]map[string]any(nil), payloads...)
+	w.batches = append(w.batches, batch)
+	return make([]bool, len(payloads)), nil
+}
+
+func (w *recordingWriter) events() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	total := 0
+	for _, batch := range w.batches {
+		total += len(batch)
+	}
+	return total
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, nil))
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	valid := Config{QueueSize: 1, Workers: 1, BatchSize: 1, FlushInterval: time.Millisecond}
+
+	tests := map[string]Config{
+		"queue size": {QueueSize: 0, Workers: 1, BatchSize: 1, FlushInterval: time.Millisecond},
+		"workers":    {QueueSize: 1, Workers: 0, BatchSize: 1, FlushInterval: time.Millisecond},
+		"batch size": {QueueSize: 1, Workers: 1, BatchSize: 0, FlushInterval: time.Millisecond},
+		"flush":      {QueueSize: 1, Workers: 1, BatchSize: 1},
+	}
+	for name, cfg := range tests {
+		if _, err := New(testLogger(), &recordingWriter{}, cfg); err == nil {
+			t.Fatalf("%s: expected config error", name)
+		}
+	}
+
+	if _, err := New(testLogger(), nil, valid); err == nil {
+		t.Fatal("expected error for nil writer")
+	}
+}
+
+func TestPipelineBatchesBySize(t *testing.T) {
+	writer := &recordingWriter{}
+	p, err := New(testLogger(), writer, Config{QueueSize: 10, Workers: 1, BatchSize: 3, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.Start()
+
+	for i := 0; i < 3; i++ {
+		if err := p.Enqueue(map[string]any{"i": i}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	waitFor(t, func() bool { return writer.events() == 3 })
+
+	writer.mu.Lock()
+	batches := len(writer.batches)
+	writer.mu.Unlock()
+	if batches != 1 {
+		t.Fatalf("batches = %d, want 1", batches)
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+}
+
+func TestPipelineFlushesOnInterval(t *testing.T) {
+	writer := &recordingWriter{}
+	p, err := New(testLogger(), writer, Config{QueueSize: 10, Workers: 1, BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.Start()
+	defer p.Shutdown(context.Background())
+
+	if err := p.Enqueue(map[string]any{"i": 1}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	waitFor(t, func() bool { return writer.events() == 1 })
+}
+
+func TestPipelineEnqueueReturnsQueueFull(t *testing.T) {
+	p, err := New(testLogger(), &recordingWriter{}, Config{QueueSize: 1, Workers: 1, BatchSize: 1, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := p.Enqueue(map[string]any{}); err != nil {
+		t.Fatalf("first Enqueue() error = %v", err)
+	}
+	if err := p.Enqueue(map[string]any{}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("second Enqueue() error = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestPipelineShutdownDrainsQueue(t *testing.T) {
+	writer := &recordingWriter{}
+	p, err := New(testLogger(), writer, Config{QueueSize: 50, Workers: 2, BatchSize: 7, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := p.Enqueue(map[string]any{"i": i}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	p.Start()
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if got := writer.events(); got != 50 {
+		t.Fatalf("written events = %d, want 50", got)
+	}
+	if err := p.Enqueue(map[string]any{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Enqueue() after shutdown error = %v, want ErrClosed", err)
+	}
+}
+
+func TestPipelineShutdownHonorsContext(t *testing.T) {
+	writer := &recordingWriter{block: make(chan struct{})}
+	defer close(writer.block)
+
+	p, err := New(testLogger(), writer, Config{QueueSize: 5, Workers: 1, BatchSize: 1, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.Start()
+	for i := 0; i < 3; i++ {
+		_ = p.Enqueue(map[string]any{"i": i})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() error = %v, want deadline exceeded", err)
+	}
+}
+
+type memorySpool struct {
+	mu     sync.Mutex
+	events []map[string]any
+}
+
+func (m *memorySpool) Append(payload map[string]any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, payload)
+	return nil
+}
+
+func TestPipelineSpoolsFailedBatches(t *testing.T) {
+	spool := &memorySpool{}
+	writer := &recordingWriter{err: errors.New("db down")}
+	p, err := New(testLogger(), writer, Config{QueueSize: 10, Workers: 1, BatchSize: 2, FlushInterval: time.Hour, Spool: spool})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.Start()
+
+	for i := 0; i < 3; i++ {
+		if err := p.Enqueue(map[string]any{"i": i}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	spool.mu.Lock()
+	defer spool.mu.Unlock()
+	if len(spool.events) != 3 {
+		t.Fatalf("spooled events = %d, want 3", len(spool.events))
+	}
+}
+
+func TestPipelineDropsInvalidEventsWithoutSpooling(t *testing.T) {
+	spool := &memorySpool{}
+	writer := &recordingWriter{err: &persistence.InvalidEventsError{Errs: map[int]error{0: errors.New("bad value")}}}
+	p, err := New(testLogger(), writer, Config{QueueSize: 10, Workers: 1, BatchSize: 2, FlushInterval: time.Hour, Spool: spool})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.Start()
+
+	for i := 0; i < 2; i++ {
+		if err := p.Enqueue(map[string]any{"i": i}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	spool.mu.Lock()
+	defer spool.mu.Unlock()
+	if len(spool.events) != 0 {
+		t.Fatalf("spooled events = %d, want none: the rest of the batch was written", len(spool.events))
+	}
+}
+
+func TestPipelineRetriesFailedBatchesWithoutSpool(t *testing.T) {
+	writer := &recordingWriter{failFirst: 3}
+	p, err := New(testLogger(), writer, Config{QueueSize: 10, Workers: 1, BatchSize: 2, FlushInterval: time.Hour, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.Start()
+
+	for i := 0; i < 2; i++ {
+		if err := p.Enqueue(map[string]any{"i": i}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	waitFor(t, func() bool { return writer.events() == 2 })
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if p.Dropped() != 0 {
+		t.Fatalf("Dropped() = %d, want the retried batch written", p.Dropped())
+	}
+}
+
+func TestPipelineCountsBatchesDroppedAtShutdown(t *testing.T) {
+	writer := &recordingWriter{err: errors.New("db down")}
+	p, err := New(testLogger(), writer, Config{QueueSize: 10, Workers: 1, BatchSize: 2, FlushInterval: time.Hour, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	p.Start()
+
+	for i := 0; i < 3; i++ {
+		if err := p.Enqueue(map[string]any{"i": i}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if p.Dropped() != 3 {
+		t.Fatalf("Dropped() = %d, want every event counted once retries stopped", p.Dropped())
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met in time")
+}
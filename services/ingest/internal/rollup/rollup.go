@@ -0,0 +1,48 @@
+// Package rollup keeps the hourly and daily metrics rollups current.
+package rollup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+// Aggregator folds rows ingested since the last pass, up to upTo, into the rollups.
+type Aggregator interface {
+	AggregateRollups(ctx context.Context, upTo time.Time) (persistence.RollupResult, error)
+}
+
+// Run aggregates every interval until ctx is cancelled. Each pass stops
+// settleDelay short of now so inserts still in flight, whose ingested_at is
+// their transaction start, are picked up by a later pass instead of skipped.
+func Run(ctx context.Context, logger *slog.Logger, aggregator Aggregator, interval time.Duration, settleDelay time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result, err := aggregator.AggregateRollups(ctx, time.Now().Add(-settleDelay))
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("rollup_aggregation_failed", slog.String("error", err.Error()))
+			continue
+		}
+		if result.Hours == 0 {
+			continue
+		}
+		logger.Info("rollups_aggregated",
+			slog.Int("hours", result.Hours),
+			slog.Time("watermark", result.Watermark),
+			slog.Time("previous_watermark", result.PreviousWatermark),
+		)
+	}
+}
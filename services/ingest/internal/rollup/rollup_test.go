@@ -0,0 +1,68 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+type recordingAggregator struct {
+	mu    sync.Mutex
+	calls []time.Time
+	err   error
+}
+
+func (r *recordingAggregator) AggregateRollups(_ context.Context, upTo time.Time) (persistence.RollupResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, upTo)
+	return persistence.RollupResult{Watermark: upTo, Hours: 1}, r.err
+}
+
+func (r *recordingAggregator) snapshot() []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]time.Time(nil), r.calls...)
+}
+
+func TestRunAggregatesBehindSettleDelay(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+	}{
+		{name: "success"},
+		{name: "failures keep the loop running", err: errors.New("db down")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			aggregator := &recordingAggregator{err: tc.err}
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				Run(ctx, logger, aggregator, 5*time.Millisecond, time.Minute)
+			}()
+
+			deadline := time.Now().Add(2 * time.Second)
+			for len(aggregator.snapshot()) < 2 {
+				if time.Now().After(deadline) {
+					t.Fatal("rollups were not aggregated in time")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			if upTo := aggregator.snapshot()[0]; time.Since(upTo) < time.Minute {
+				t.Fatalf("upTo = %v, want at least the settle delay behind now", upTo)
+			}
+		})
+	}
+}
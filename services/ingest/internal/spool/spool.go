@@ -0,0 +1,455 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+const (
+	segmentPrefix   = "events-"
+	segmentSuffix   = ".ndjson"
+	offsetSuffix    = ".offset"
+	quarantineFile  = "quarantine.ndjson"
+	replayBatchSize = 200
+	maxLineBytes    = 1 << 20 // matches the ingest request body limit
+)
+
+// ErrEventTooLarge is returned by Append for an event whose encoded line
+// exceeds the replay limit. Re-encoding can grow a payload past the size it
+// was accepted at, so the limit is checked on the line actually written.
+var ErrEventTooLarge = fmt.Errorf("spooled event exceeds %d bytes", maxLineBytes)
+
+// EventWriter persists batches of events drained from the spool.
+type EventWriter interface {
+	InsertEvents(ctx context.Context, payloads []map[string]any) ([]bool, error)
+}
+
+// Spool is an append-only, disk-backed buffer of accepted events that could
+// not be written to the database. Events are stored as NDJSON in numbered
+// segment files; a segment is deleted only after all of its events were
+// written, so replay is at-least-once and relies on event_id idempotency.
+type Spool struct {
+	dir             string
+	maxSegmentBytes int64
+	logger          *slog.Logger
+
+	mu          sync.Mutex
+	active      *os.File
+	activeSeq   uint64
+	activeBytes int64
+	replayMu    sync.Mutex
+}
+
+// Open prepares dir for spooling, creating it when missing.
+func Open(dir string, maxSegmentBytes int64, logger *slog.Logger) (*Spool, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New("spool directory is required")
+	}
+	if maxSegmentBytes <= 0 {
+		return nil, fmt.Errorf("segment size must be positive, got %d", maxSegmentBytes)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool directory: %w", err)
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	s := &Spool{dir: dir, maxSegmentBytes: maxSegmentBytes, logger: logger}
+
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		s.activeSeq = segments[len(segments)-1].seq
+	}
+
+	return s, nil
+}
+
+// Append durably writes one event to the active segment.
+func (s *Spool) Append(payload map[string]any) error {
+	line, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal spooled event: %w", err)
+	}
+	if len(line)+1 > maxLineBytes {
+		return ErrEventTooLarge
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil || s.activeBytes+int64(len(line)) > s.maxSegmentBytes {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.active.Write(line); err != nil {
+		return fmt.Errorf("write spool segment: %w", err)
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("sync spool segment: %w", err)
+	}
+	s.activeBytes += int64(len(line))
+
+	return nil
+}
+
+// Pending reports the number of segment files waiting for replay.
+func (s *Spool) Pending() (int, error) {
+	segments, err := s.segments()
+	if err != nil {
+		return 0, err
+	}
+	return len(segments), nil
+}
+
+// Replay drains spooled events into writer, oldest segment first, and returns
+// the number of events written. Lines that can never be written, because they
+// do not decode or the writer rejects them as invalid, are moved to
+// quarantine.ndjson for inspection. Replay stops at the first other write
+// error, leaving the failing segment in place for the next attempt. Each
+// segment's offset file records how far it has been handled, so the next
+// attempt, even after a restart, resumes there instead of quarantining or
+// writing the same lines again.
+func (s *Spool) Replay(ctx context.Context, writer EventWriter) (int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	// Seal the active segment so new appends never race with replay.
+	s.mu.Lock()
+	sealErr := s.closeActiveLocked()
+	s.mu.Unlock()
+	if sealErr != nil {
+		return 0, sealErr
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, seg := range segments {
+		if s.isActive(seg.seq) {
+			continue
+		}
+
+		n, err := s.replaySegment(ctx, writer, seg.path)
+		replayed += n
+		if err != nil {
+			return replayed, err
+		}
+		if err := os.Remove(seg.path); err != nil {
+			return replayed, fmt.Errorf("remove replayed segment: %w", err)
+		}
+		if err := os.Remove(seg.path + offsetSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return replayed, fmt.Errorf("remove replayed segment offset: %w", err)
+		}
+	}
+
+	return replayed, nil
+}
+
+// Run replays the spool every interval until ctx is cancelled.
+func (s *Spool) Run(ctx context.Context, writer EventWriter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pending, err := s.Pending()
+		if err != nil {
+			s.logger.Error("spool_scan_failed", slog.String("error", err.Error()))
+			continue
+		}
+		if pending == 0 {
+			continue
+		}
+
+		replayed, err := s.Replay(ctx, writer)
+		if err != nil {
+			s.logger.Warn("spool_replay_incomplete",
+				slog.Int("replayed", replayed),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		s.logger.Info("spool_replayed", slog.Int("replayed", replayed))
+	}
+}
+
+// Close releases the active segment file.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeActiveLocked()
+}
+
+// quarantinedLine is a line held back from quarantine until the batch it was
+// read with is written, so a failed attempt quarantines nothing.
+type quarantinedLine struct {
+	line   []byte
+	reason error
+}
+
+func (s *Spool) replaySegment(ctx context.Context, writer EventWriter, path string) (int, error) {
+	offset, err := readOffset(path)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open spool segment: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek spool segment: %w", err)
+	}
+
+	segmentName := filepath.Base(path)
+	reader := bufio.NewReaderSize(file, 64*1024)
+	batch := make([]map[string]any, 0, replayBatchSize)
+	lines := make([][]byte, 0, replayBatchSize)
+	var held []quarantinedLine
+	read := offset
+	replayed := 0
+
+	// flush writes the batch, then quarantines the lines held back with it
+	// and records everything read so far as handled.
+	flush := func() error {
+		if read == offset {
+			return nil
+		}
+		if len(batch) > 0 {
+			_, err := writer.InsertEvents(ctx, batch)
+			var invalid *persistence.InvalidEventsError
+			if errors.As(err, &invalid) {
+				for idx, invalidErr := range invalid.Errs {
+					held = append(held, quarantinedLine{line: lines[idx], reason: invalidErr})
+				}
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("replay spooled events: %w", err)
+			}
+			replayed += len(batch)
+			if invalid != nil {
+				replayed -= len(invalid.Errs)
+			}
+		}
+		for _, q := range held {
+			if err := s.quarantine(segmentName, q.line, q.reason); err != nil {
+				return err
+			}
+		}
+		if err := writeOffset(path, read); err != nil {
+			return err
+		}
+		offset = read
+		batch, lines, held = batch[:0], lines[:0], held[:0]
+		return nil
+	}
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		read += int64(len(line))
+		if len(bytes.TrimSpace(line)) > 0 {
+			payload, err := decodeLine(line)
+			if err != nil {
+				// Usually a torn trailing write from a crash; keep it rather than drop it.
+				held = append(held, quarantinedLine{line: line, reason: err})
+			} else {
+				batch = append(batch, payload)
+				lines = append(lines, line)
+			}
+		}
+
+		if len(batch)+len(held) >= replayBatchSize {
+			if err := flush(); err != nil {
+				return replayed, err
+			}
+		}
+
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				break
+			}
+			return replayed, fmt.Errorf("read spool segment: %w", readErr)
+		}
+	}
+
+	return replayed, flush()
+}
+
+// readOffset returns how many bytes of the segment at path were already
+// handled, or zero when none were.
+func readOffset(path string) (int64, error) {
+	raw, err := os.ReadFile(path + offsetSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read spool segment offset: %w", err)
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("parse spool segment offset %q", raw)
+	}
+	return offset, nil
+}
+
+// writeOffset durably replaces the segment's handled offset.
+func writeOffset(path string, offset int64) error {
+	tmp := path + offsetSuffix + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("write spool segment offset: %w", err)
+	}
+	_, err = file.WriteString(strconv.FormatInt(offset, 10))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+offsetSuffix)
+	}
+	if err != nil {
+		return fmt.Errorf("write spool segment offset: %w", err)
+	}
+	return nil
+}
+
+// quarantine appends a line that can never be replayed to quarantine.ndjson,
+// which segments() ignores.
+func (s *Spool) quarantine(segmentName string, line []byte, reason error) error {
+	file, err := os.OpenFile(filepath.Join(s.dir, quarantineFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open spool quarantine: %w", err)
+	}
+	defer file.Close()
+
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		line = append(line, '\n')
+	}
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("write spool quarantine: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync spool quarantine: %w", err)
+	}
+
+	s.logger.Warn("spool_line_quarantined",
+		slog.String("segment", segmentName),
+		slog.String("error", reason.Error()),
+	)
+	return nil
+}
+
+func decodeLine(line []byte) (map[string]any, error) {
+	if len(line) > maxLineBytes {
+		return nil, fmt.Errorf("line exceeds %d bytes", maxLineBytes)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	var payload map[string]any
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (s *Spool) rotateLocked() error {
+	if err := s.closeActiveLocked(); err != nil {
+		return err
+	}
+
+	s.activeSeq++
+	file, err := os.OpenFile(s.segmentPath(s.activeSeq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("create spool segment: %w", err)
+	}
+
+	s.active = file
+	s.activeBytes = 0
+	return nil
+}
+
+func (s *Spool) closeActiveLocked() error {
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	if err != nil {
+		return fmt.Errorf("close spool segment: %w", err)
+	}
+	return nil
+}
+
+func (s *Spool) isActive(seq uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active != nil && seq == s.activeSeq
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+type segment struct {
+	seq  uint64
+	path string
+}
+
+func (s *Spool) segments() ([]segment, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list spool directory: %w", err)
+	}
+
+	out := make([]segment, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		out = append(out, segment{seq: seq, path: filepath.Join(s.dir, name)})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].seq < out[j].seq })
+	return out, nil
+}
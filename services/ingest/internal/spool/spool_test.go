@@ -0,0 +1,352 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/francisbulus/agent-ops/services/ingest/internal/persistence"
+)
+
+type recordingWriter struct {
+	mu      sync.Mutex
+	events  []map[string]any
+	err     error
+	invalid map[string]bool
+	// failAfter, when set, fails every batch after that many succeeded.
+	failAfter int
+	batches   int
+}
+
+func (w *recordingWriter) InsertEvents(_ context.Context, payloads []map[string]any) ([]bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	if w.failAfter > 0 && w.batches >= w.failAfter {
+		return nil, errors.New("db down")
+	}
+	w.batches++
+	invalid := make(map[int]error)
+	for idx, payload := range payloads {
+		if w.invalid[fmt.Sprint(payload["event_id"])] {
+			invalid[idx] = errors.New("numeric field overflow")
+			continue
+		}
+		w.events = append(w.events, payload)
+	}
+	if len(invalid) > 0 {
+		return make([]bool, len(payloads)), &persistence.InvalidEventsError{Errs: invalid}
+	}
+	return make([]bool, len(payloads)), nil
+}
+
+func (w *recordingWriter) count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.events)
+}
+
+func openTestSpool(t *testing.T, maxSegmentBytes int64) (*Spool, string) {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "spool")
+	s, err := Open(dir, maxSegmentBytes, slog.New(slog.NewJSONHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s, dir
+}
+
+func TestOpenRejectsInvalidSettings(t *testing.T) {
+	if _, err := Open("", 1024, nil); err == nil {
+		t.Fatal("expected error for empty dir")
+	}
+	if _, err := Open(t.TempDir(), 0, nil); err == nil {
+		t.Fatal("expected error for zero segment size")
+	}
+}
+
+func TestAppendRotatesSegments(t *testing.T) {
+	s, _ := openTestSpool(t, 64)
+
+	for i := 0; i < 5; i++ {
+		if err := s.Append(map[string]any{"event_id": "0123456789abcdef0123456789", "i": i}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	pending, err := s.Pending()
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+	if pending < 2 {
+		t.Fatalf("pending segments = %d, want rotation into >= 2", pending)
+	}
+}
+
+func TestReplayDrainsAndRemovesSegments(t *testing.T) {
+	s, _ := openTestSpool(t, 128)
+
+	for i := 0; i < 10; i++ {
+		if err := s.Append(map[string]any{"event_id": "e", "i": i}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	writer := &recordingWriter{}
+	replayed, err := s.Replay(context.Background(), writer)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed != 10 || writer.count() != 10 {
+		t.Fatalf("replayed = %d, written = %d, want 10", replayed, writer.count())
+	}
+
+	pending, err := s.Pending()
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+	if pending != 0 {
+		t.Fatalf("pending = %d, want 0 after replay", pending)
+	}
+
+	if got := fmt.Sprint(writer.events[0]["i"]); got != "0" {
+		t.Fatalf("first replayed event i = %v, want oldest event first", got)
+	}
+}
+
+func TestReplayKeepsSegmentsOnWriteFailure(t *testing.T) {
+	s, _ := openTestSpool(t, 1<<20)
+
+	if err := s.Append(map[string]any{"event_id": "e1"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	failing := &recordingWriter{err: errors.New("db down")}
+	if _, err := s.Replay(context.Background(), failing); err == nil {
+		t.Fatal("expected replay error")
+	}
+
+	pending, _ := s.Pending()
+	if pending != 1 {
+		t.Fatalf("pending = %d, want 1 retained segment", pending)
+	}
+
+	// Appends after a failed replay land in a new segment and both drain later.
+	if err := s.Append(map[string]any{"event_id": "e2"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	writer := &recordingWriter{}
+	replayed, err := s.Replay(context.Background(), writer)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed != 2 {
+		t.Fatalf("replayed = %d, want 2", replayed)
+	}
+}
+
+func TestReplayQuarantinesTornTrailingLine(t *testing.T) {
+	s, dir := openTestSpool(t, 1<<20)
+
+	if err := s.Append(map[string]any{"event_id": "e1"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"))
+	file, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open segment: %v", err)
+	}
+	_, _ = file.WriteString(`{"event_id":"e2","tru`)
+	_ = file.Close()
+
+	writer := &recordingWriter{}
+	replayed, err := s.Replay(context.Background(), writer)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed != 1 {
+		t.Fatalf("replayed = %d, want 1", replayed)
+	}
+	if got := readQuarantine(t, dir); got != `{"event_id":"e2","tru`+"\n" {
+		t.Fatalf("quarantine = %q, want the torn line", got)
+	}
+}
+
+func TestReplayQuarantinesInvalidEventsAndContinues(t *testing.T) {
+	s, dir := openTestSpool(t, 1<<20)
+
+	for _, id := range []string{"e1", "e2", "e3"} {
+		if err := s.Append(map[string]any{"event_id": id}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	writer := &recordingWriter{invalid: map[string]bool{"e2": true}}
+	replayed, err := s.Replay(context.Background(), writer)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed != 2 || writer.count() != 2 {
+		t.Fatalf("replayed = %d, written = %d, want 2", replayed, writer.count())
+	}
+	if pending, _ := s.Pending(); pending != 0 {
+		t.Fatalf("pending = %d, want the segment drained", pending)
+	}
+	if got := readQuarantine(t, dir); got != `{"event_id":"e2"}`+"\n" {
+		t.Fatalf("quarantine = %q, want the invalid event", got)
+	}
+}
+
+func TestReplayRetryResumesAfterHandledLines(t *testing.T) {
+	s, dir := openTestSpool(t, 1<<30)
+
+	// Two batches: the first holds the invalid e0, the second fails to write.
+	for i := 0; i <= replayBatchSize; i++ {
+		if err := s.Append(map[string]any{"event_id": fmt.Sprintf("e%d", i)}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	flaky := &recordingWriter{invalid: map[string]bool{"e0": true}, failAfter: 1}
+	replayed, err := s.Replay(context.Background(), flaky)
+	if err == nil || replayed != replayBatchSize-1 {
+		t.Fatalf("Replay() = %d, %v, want the first batch written and then an error", replayed, err)
+	}
+
+	writer := &recordingWriter{invalid: map[string]bool{"e0": true}}
+	replayed, err = s.Replay(context.Background(), writer)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed != 1 || writer.count() != 1 {
+		t.Fatalf("replayed = %d, written = %d, want only the unhandled event", replayed, writer.count())
+	}
+	if got := readQuarantine(t, dir); got != `{"event_id":"e0"}`+"\n" {
+		t.Fatalf("quarantine = %q, want e0 once", got)
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(dir, segmentPrefix+"*")); len(leftover) != 0 {
+		t.Fatalf("files = %v, want the segment and its offset removed", leftover)
+	}
+}
+
+func TestReplayQuarantinesNothingFromAFailedBatch(t *testing.T) {
+	s, dir := openTestSpool(t, 1<<20)
+
+	if err := s.Append(map[string]any{"event_id": "e1"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"))
+	file, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open segment: %v", err)
+	}
+	_, _ = file.WriteString("not json\n")
+	_ = file.Close()
+
+	if _, err := s.Replay(context.Background(), &recordingWriter{err: errors.New("db down")}); err == nil {
+		t.Fatal("expected replay error")
+	}
+	if _, err := s.Replay(context.Background(), &recordingWriter{}); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if got := readQuarantine(t, dir); got != "not json\n" {
+		t.Fatalf("quarantine = %q, want the bad line once", got)
+	}
+}
+
+func TestAppendRefusesOversizedEvents(t *testing.T) {
+	s, _ := openTestSpool(t, 4<<20)
+
+	// HTML escaping re-encodes each "<" as six bytes, so this outgrows its source.
+	payload := map[string]any{"event_id": "e1", "note": strings.Repeat("<", maxLineBytes/4)}
+	if err := s.Append(payload); !errors.Is(err, ErrEventTooLarge) {
+		t.Fatalf("Append() error = %v, want ErrEventTooLarge", err)
+	}
+	if pending, _ := s.Pending(); pending != 0 {
+		t.Fatalf("pending = %d, want nothing written", pending)
+	}
+}
+
+func readQuarantine(t *testing.T, dir string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, quarantineFile))
+	if err != nil {
+		t.Fatalf("read quarantine: %v", err)
+	}
+	return string(data)
+}
+
+func TestOpenResumesAfterExistingSegments(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spool")
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	first, err := Open(dir, 1<<20, logger)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := first.Append(map[string]any{"event_id": "e1"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	_ = first.Close()
+
+	second, err := Open(dir, 1<<20, logger)
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer second.Close()
+	if err := second.Append(map[string]any{"event_id": "e2"}); err != nil {
+		t.Fatalf("Append() after reopen error = %v", err)
+	}
+
+	writer := &recordingWriter{}
+	replayed, err := second.Replay(context.Background(), writer)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if replayed != 2 {
+		t.Fatalf("replayed = %d, want 2 across restarts", replayed)
+	}
+}
+
+func TestRunReplaysInBackground(t *testing.T) {
+	s, _ := openTestSpool(t, 1<<20)
+	if err := s.Append(map[string]any{"event_id": "e1"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writer := &recordingWriter{}
+	go s.Run(ctx, writer, 5*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for writer.count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("spool was not replayed in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
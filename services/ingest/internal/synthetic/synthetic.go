@@ -0,0 +1,49 @@
+// Package synthetic holds what the background workers share to emit their
+// own events through the ingest path: deterministic event identities, the
+// placeholder for scope levels a source does not set, and the ticker loop.
+package synthetic
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Unscoped fills the tenant ids and agent_id that the event schema requires
+// but that sit above a budget's or rule's scope.
+const Unscoped = "*"
+
+// Scoped returns id, or Unscoped when the scope level is not set.
+func Scoped(id string) string {
+	if id == "" {
+		return Unscoped
+	}
+	return id
+}
+
+// EventID derives an event_id from namespace and the parts of an emission's
+// idempotency key as a name-based (version 5 layout) UUID, so a retried
+// emission is a duplicate InsertEvent ignores.
+func EventID(namespace string, key ...string) string {
+	sum := sha1.Sum([]byte(namespace + "|" + strings.Join(key, "|")))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// Every calls pass with the tick time every interval until ctx is cancelled.
+func Every(ctx context.Context, interval time.Duration, pass func(now time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			pass(now)
+		}
+	}
+}
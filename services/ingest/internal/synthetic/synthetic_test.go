@@ -0,0 +1,51 @@
+package synthetic
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventIDIsStableVersion5UUID(t *testing.T) {
+	id := EventID("agent-ops/budget.threshold_hit", "budget-1", "2026-02-01T00:00:00Z", "80")
+	// Threshold events stored before the helper was shared keep their ids.
+	if id != "5931d181-3a7e-5468-832e-5898d382a5ec" {
+		t.Fatalf("event id = %q, want the id budgets always derived", id)
+	}
+	if id == EventID("agent-ops/budget.threshold_hit", "budget-1", "2026-02-01T00:00:00Z", "100") {
+		t.Fatal("event id must differ per key")
+	}
+	if len(id) != 36 || id[14] != '5' || (id[19] != '8' && id[19] != '9' && id[19] != 'a' && id[19] != 'b') {
+		t.Fatalf("event id = %q, want a version 5 RFC 4122 UUID", id)
+	}
+}
+
+func TestScopedFillsUnsetLevels(t *testing.T) {
+	if Scoped("") != Unscoped || Scoped("agent-1") != "agent-1" {
+		t.Fatalf("Scoped() = %q / %q", Scoped(""), Scoped("agent-1"))
+	}
+}
+
+func TestEveryStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var passes atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		Every(ctx, time.Millisecond, func(time.Time) {
+			if passes.Add(1) == 3 {
+				cancel()
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Every() did not return after cancel")
+	}
+	if passes.Load() < 3 {
+		t.Fatalf("passes = %d, want at least 3", passes.Load())
+	}
+}
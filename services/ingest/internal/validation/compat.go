@@ -0,0 +1,536 @@
+package validation
+
+import (
+	"fmt"
+	"os"
+)
+
+// Compatibility classifies how a schema change affects existing payloads.
+type Compatibility string
+
+const (
+	// CompatBackward changes widen the schema: every payload valid under the
+	// old schema is still valid, so existing producers keep working.
+	CompatBackward Compatibility = "backward"
+	// CompatForward changes constrain data the old schema left open (such as
+	// declaring a property under a permissive additionalProperties): payloads
+	// valid under the new schema still pass the old one.
+	CompatForward Compatibility = "forward"
+	// CompatBreaking changes can reject payloads the old schema explicitly accepted.
+	CompatBreaking Compatibility = "breaking"
+)
+
+// SchemaChange describes one difference between two schema versions.
+type SchemaChange struct {
+	Path          string        `json:"path"`
+	Keyword       string        `json:"keyword"`
+	Compatibility Compatibility `json:"compatibility"`
+	Message       string        `json:"message"`
+}
+
+// LoadSchema reads and parses a schema document using the same resolution as NewEventValidator.
+func LoadSchema(schemaPath string) (map[string]any, error) {
+	resolvedPath, err := resolveSchemaPath(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(resolvedPath)
+	if err != nil {
+		return nil, fmt.Errorf("read schema: %w", err)
+	}
+
+	validator, err := parseEventValidator(raw)
+	if err != nil {
+		return nil, err
+	}
+	return validator.schema, nil
+}
+
+// HasBreakingChanges reports whether any change is breaking.
+func HasBreakingChanges(changes []SchemaChange) bool {
+	for _, change := range changes {
+		if change.Compatibility == CompatBreaking {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareSchemas diffs two schema documents and classifies each change. Paths
+// use the same instance notation as validation errors ("$.run.status",
+// "$.items[]"). Changes to composition keywords (allOf, anyOf, oneOf, not,
+// if/then/else, patternProperties, propertyNames) cannot be proven safe and
+// are reported as breaking.
+func CompareSchemas(oldSchema, newSchema map[string]any) []SchemaChange {
+	d := &schemaDiff{
+		oldRoot:  oldSchema,
+		newRoot:  newSchema,
+		refPairs: make(map[[2]string]bool),
+	}
+	d.compare("$", oldSchema, newSchema, 0)
+	return d.changes
+}
+
+// annotationKeywords do not affect validation and are ignored when diffing.
+var annotationKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "$defs": true,
+	"title": true, "description": true, "examples": true, "default": true,
+	"deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// opaqueKeywords are compared structurally; any difference is reported as breaking.
+var opaqueKeywords = []string{"allOf", "anyOf", "oneOf", "not", "if", "then", "else", "patternProperties", "propertyNames"}
+
+type schemaDiff struct {
+	oldRoot map[string]any
+	newRoot map[string]any
+	changes []SchemaChange
+	// refPairs are the (old, new) $ref pairs already being compared. A
+	// recursive schema reaches the same pair again; comparing it once is enough.
+	refPairs map[[2]string]bool
+}
+
+func (d *schemaDiff) add(path, keyword string, compat Compatibility, format string, args ...any) {
+	d.changes = append(d.changes, SchemaChange{
+		Path:          path,
+		Keyword:       keyword,
+		Compatibility: compat,
+		Message:       fmt.Sprintf(format, args...),
+	})
+}
+
+func (d *schemaDiff) compare(path string, oldRaw, newRaw any, depth int) {
+	if depth > maxSchemaDepth {
+		d.add(path, "$ref", CompatBreaking, "schema nesting is too deep to compare")
+		return
+	}
+
+	if pair := [2]string{refOf(oldRaw), refOf(newRaw)}; pair != [2]string{} {
+		if d.refPairs[pair] {
+			return
+		}
+		d.refPairs[pair] = true
+	}
+	oldRaw = deref(d.oldRoot, oldRaw)
+	newRaw = deref(d.newRoot, newRaw)
+
+	oldBool, oldIsBool := schemaAsBool(oldRaw)
+	newBool, newIsBool := schemaAsBool(newRaw)
+	switch {
+	case oldIsBool && newIsBool:
+		if oldBool && !newBool {
+			d.add(path, "schema", CompatBreaking, "schema no longer accepts any value")
+		} else if !oldBool && newBool {
+			d.add(path, "schema", CompatBackward, "schema now accepts any value")
+		}
+		return
+	case oldIsBool && !oldBool:
+		d.add(path, "schema", CompatBackward, "schema now accepts values it previously rejected")
+		return
+	case newIsBool && !newBool:
+		d.add(path, "schema", CompatBreaking, "schema no longer accepts any value")
+		return
+	}
+
+	oldSchema, _ := toMap(oldRaw)
+	newSchema, _ := toMap(newRaw)
+	if oldSchema == nil {
+		oldSchema = map[string]any{}
+	}
+	if newSchema == nil {
+		newSchema = map[string]any{}
+	}
+
+	d.compareType(path, oldSchema["type"], newSchema["type"])
+	d.compareEnum(path, oldSchema, newSchema)
+	d.compareConst(path, oldSchema, newSchema)
+
+	d.compareBound(path, "minimum", oldSchema, newSchema, true)
+	d.compareBound(path, "exclusiveMinimum", oldSchema, newSchema, true)
+	d.compareBound(path, "maximum", oldSchema, newSchema, false)
+	d.compareBound(path, "exclusiveMaximum", oldSchema, newSchema, false)
+	d.compareBound(path, "minLength", oldSchema, newSchema, true)
+	d.compareBound(path, "maxLength", oldSchema, newSchema, false)
+	d.compareBound(path, "minItems", oldSchema, newSchema, true)
+	d.compareBound(path, "maxItems", oldSchema, newSchema, false)
+
+	d.compareRestriction(path, "pattern", oldSchema, newSchema)
+	d.compareRestriction(path, "format", oldSchema, newSchema)
+
+	if oldUnique, newUnique := oldSchema["uniqueItems"] == true, newSchema["uniqueItems"] == true; oldUnique != newUnique {
+		if newUnique {
+			d.add(path, "uniqueItems", CompatBreaking, "items must now be unique")
+		} else {
+			d.add(path, "uniqueItems", CompatBackward, "items no longer need to be unique")
+		}
+	}
+
+	d.compareRequired(path, oldSchema, newSchema)
+	d.compareDependentRequired(path, oldSchema, newSchema)
+	d.compareProperties(path, oldSchema, newSchema, depth)
+	d.compareItems(path, oldSchema, newSchema, depth)
+
+	for _, keyword := range opaqueKeywords {
+		oldVal, oldOK := oldSchema[keyword]
+		newVal, newOK := newSchema[keyword]
+		switch {
+		case !oldOK && !newOK:
+		case oldOK && !newOK:
+			d.add(path, keyword, CompatBackward, "%s removed", keyword)
+		case !oldOK && newOK:
+			d.add(path, keyword, CompatBreaking, "%s added", keyword)
+		case !equalJSONValue(oldVal, newVal):
+			d.add(path, keyword, CompatBreaking, "%s changed; compatibility cannot be verified", keyword)
+		}
+	}
+}
+
+// refOf returns raw's $ref, or an empty string when it has none.
+func refOf(raw any) string {
+	schema, _ := toMap(raw)
+	ref, _ := schema["$ref"].(string)
+	return ref
+}
+
+// deref follows $ref chains so referenced definitions are compared by content.
+func deref(root map[string]any, raw any) any {
+	for hops := 0; hops < maxSchemaDepth; hops++ {
+		schema, ok := toMap(raw)
+		if !ok {
+			return raw
+		}
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return raw
+		}
+		target, found := resolveRef(root, ref)
+		if !found {
+			return raw
+		}
+
+		// Sibling keywords apply alongside the reference; merge them over the target.
+		targetMap, isMap := toMap(target)
+		if len(schema) == 1 || !isMap {
+			raw = target
+			continue
+		}
+		merged := make(map[string]any, len(targetMap)+len(schema))
+		for key, val := range targetMap {
+			merged[key] = val
+		}
+		for key, val := range schema {
+			if key != "$ref" {
+				merged[key] = val
+			}
+		}
+		raw = merged
+	}
+	return raw
+}
+
+func (d *schemaDiff) compareType(path string, oldType, newType any) {
+	oldSet := typeSet(oldType)
+	newSet := typeSet(newType)
+
+	narrowed := oldSet == nil && newSet != nil
+	widened := oldSet != nil && newSet == nil
+	for name := range oldSet {
+		if !typeSetAllows(newSet, name) {
+			narrowed = true
+		}
+	}
+	for name := range newSet {
+		if !typeSetAllows(oldSet, name) {
+			widened = true
+		}
+	}
+
+	if narrowed {
+		d.add(path, "type", CompatBreaking, "type narrowed from %s to %s", typeLabel(oldType), typeLabel(newType))
+	} else if widened {
+		d.add(path, "type", CompatBackward, "type widened from %s to %s", typeLabel(oldType), typeLabel(newType))
+	}
+}
+
+func (d *schemaDiff) compareEnum(path string, oldSchema, newSchema map[string]any) {
+	oldVals, oldOK := toSlice(oldSchema["enum"])
+	newVals, newOK := toSlice(newSchema["enum"])
+	switch {
+	case !oldOK && !newOK:
+		return
+	case oldOK && !newOK:
+		d.add(path, "enum", CompatBackward, "enum restriction removed")
+		return
+	case !oldOK && newOK:
+		d.add(path, "enum", CompatBreaking, "enum restriction added")
+		return
+	}
+
+	for _, val := range oldVals {
+		if !valueInEnum(val, newVals) {
+			d.add(path, "enum", CompatBreaking, "enum value %s removed", jsonLabel(val))
+		}
+	}
+	for _, val := range newVals {
+		if !valueInEnum(val, oldVals) {
+			d.add(path, "enum", CompatBackward, "enum value %s added", jsonLabel(val))
+		}
+	}
+}
+
+func (d *schemaDiff) compareConst(path string, oldSchema, newSchema map[string]any) {
+	oldVal, oldOK := oldSchema["const"]
+	newVal, newOK := newSchema["const"]
+	switch {
+	case !oldOK && !newOK:
+	case oldOK && !newOK:
+		d.add(path, "const", CompatBackward, "const %s removed", jsonLabel(oldVal))
+	case !oldOK && newOK:
+		d.add(path, "const", CompatBreaking, "const %s added", jsonLabel(newVal))
+	case !equalJSONValue(oldVal, newVal):
+		d.add(path, "const", CompatBreaking, "const changed from %s to %s", jsonLabel(oldVal), jsonLabel(newVal))
+	}
+}
+
+// compareBound classifies a numeric limit. Raising a lower bound or lowering
+// an upper bound narrows the schema.
+func (d *schemaDiff) compareBound(path, keyword string, oldSchema, newSchema map[string]any, lower bool) {
+	oldVal, oldOK := toFloat(oldSchema[keyword])
+	newVal, newOK := toFloat(newSchema[keyword])
+	switch {
+	case !oldOK && !newOK:
+	case oldOK && !newOK:
+		d.add(path, keyword, CompatBackward, "%s %s removed", keyword, trimFloat(oldVal))
+	case !oldOK && newOK:
+		d.add(path, keyword, CompatBreaking, "%s %s added", keyword, trimFloat(newVal))
+	case oldVal != newVal:
+		narrowed := newVal > oldVal
+		if !lower {
+			narrowed = newVal < oldVal
+		}
+		compat := CompatBackward
+		if narrowed {
+			compat = CompatBreaking
+		}
+		d.add(path, keyword, compat, "%s changed from %s to %s", keyword, trimFloat(oldVal), trimFloat(newVal))
+	}
+}
+
+func (d *schemaDiff) compareRestriction(path, keyword string, oldSchema, newSchema map[string]any) {
+	oldVal, oldOK := oldSchema[keyword].(string)
+	newVal, newOK := newSchema[keyword].(string)
+	switch {
+	case !oldOK && !newOK:
+	case oldOK && !newOK:
+		d.add(path, keyword, CompatBackward, "%s %q removed", keyword, oldVal)
+	case !oldOK && newOK:
+		d.add(path, keyword, CompatBreaking, "%s %q added", keyword, newVal)
+	case oldVal != newVal:
+		d.add(path, keyword, CompatBreaking, "%s changed from %q to %q", keyword, oldVal, newVal)
+	}
+}
+
+func (d *schemaDiff) compareRequired(path string, oldSchema, newSchema map[string]any) {
+	oldRequired, _ := toStringSlice(oldSchema["required"])
+	newRequired, _ := toStringSlice(newSchema["required"])
+
+	for _, name := range newRequired {
+		if !containsString(oldRequired, name) {
+			d.add(childPath(path, name), "required", CompatBreaking, "new required field %q", name)
+		}
+	}
+	for _, name := range oldRequired {
+		if !containsString(newRequired, name) {
+			d.add(childPath(path, name), "required", CompatBackward, "field %q is no longer required", name)
+		}
+	}
+}
+
+func (d *schemaDiff) compareDependentRequired(path string, oldSchema, newSchema map[string]any) {
+	oldDeps, _ := toMap(oldSchema["dependentRequired"])
+	newDeps, _ := toMap(newSchema["dependentRequired"])
+
+	for _, trigger := range unionKeys(oldDeps, newDeps) {
+		oldFields, _ := toStringSlice(oldDeps[trigger])
+		newFields, _ := toStringSlice(newDeps[trigger])
+		for _, name := range newFields {
+			if !containsString(oldFields, name) {
+				d.add(childPath(path, name), "dependentRequired", CompatBreaking, "field %q is now required when %q is present", name, trigger)
+			}
+		}
+		for _, name := range oldFields {
+			if !containsString(newFields, name) {
+				d.add(childPath(path, name), "dependentRequired", CompatBackward, "field %q is no longer required when %q is present", name, trigger)
+			}
+		}
+	}
+}
+
+func (d *schemaDiff) compareProperties(path string, oldSchema, newSchema map[string]any, depth int) {
+	oldProps, _ := toMap(oldSchema["properties"])
+	newProps, _ := toMap(newSchema["properties"])
+	oldAdditional, hasOldAdditional := oldSchema["additionalProperties"]
+	newAdditional, hasNewAdditional := newSchema["additionalProperties"]
+	if !hasOldAdditional {
+		oldAdditional = true
+	}
+	if !hasNewAdditional {
+		newAdditional = true
+	}
+
+	for _, name := range unionKeys(oldProps, newProps) {
+		oldProp, inOld := oldProps[name]
+		newProp, inNew := newProps[name]
+		propPath := childPath(path, name)
+
+		switch {
+		case inOld && inNew:
+			d.compare(propPath, oldProp, newProp, depth+1)
+		case inOld:
+			if newAdditional == false {
+				d.add(propPath, "properties", CompatBreaking, "property %q removed under additionalProperties: false", name)
+			} else {
+				// The property now falls under additionalProperties.
+				d.compare(propPath, oldProp, newAdditional, depth+1)
+			}
+		default:
+			if oldAdditional == false {
+				d.add(propPath, "properties", CompatBackward, "new optional property %q", name)
+			} else if !isTrivialSchema(newProp) {
+				// Previously accepted as an additional property; now constrained.
+				before := len(d.changes)
+				d.compare(propPath, oldAdditional, newProp, depth+1)
+				if len(d.changes) > before {
+					d.changes = d.changes[:before]
+					d.add(propPath, "properties", CompatForward, "property %q declared where additionalProperties previously accepted it", name)
+				}
+			}
+		}
+	}
+
+	switch {
+	case oldAdditional != false && newAdditional == false:
+		d.add(path, "additionalProperties", CompatBreaking, "undeclared properties are now rejected")
+	case oldAdditional == false && newAdditional != false:
+		d.add(path, "additionalProperties", CompatBackward, "undeclared properties are now accepted")
+		d.compare(childPath(path, "*"), true, newAdditional, depth+1)
+	default:
+		d.compare(childPath(path, "*"), oldAdditional, newAdditional, depth+1)
+	}
+}
+
+func (d *schemaDiff) compareItems(path string, oldSchema, newSchema map[string]any, depth int) {
+	oldPrefix, _ := toSlice(oldSchema["prefixItems"])
+	newPrefix, _ := toSlice(newSchema["prefixItems"])
+	oldItems, hasOldItems := oldSchema["items"]
+	newItems, hasNewItems := newSchema["items"]
+	if !hasOldItems {
+		oldItems = true
+	}
+	if !hasNewItems {
+		newItems = true
+	}
+
+	limit := len(oldPrefix)
+	if len(newPrefix) > limit {
+		limit = len(newPrefix)
+	}
+	for idx := 0; idx < limit; idx++ {
+		oldItem, newItem := oldItems, newItems
+		if idx < len(oldPrefix) {
+			oldItem = oldPrefix[idx]
+		}
+		if idx < len(newPrefix) {
+			newItem = newPrefix[idx]
+		}
+		d.compare(indexPath(path, idx), oldItem, newItem, depth+1)
+	}
+
+	if hasOldItems || hasNewItems {
+		d.compare(path+"[]", oldItems, newItems, depth+1)
+	}
+}
+
+func schemaAsBool(raw any) (bool, bool) {
+	if raw == nil {
+		return true, true
+	}
+	b, ok := raw.(bool)
+	return b, ok
+}
+
+func isTrivialSchema(raw any) bool {
+	if allowed, ok := raw.(bool); ok {
+		return allowed
+	}
+	schema, ok := toMap(raw)
+	if !ok {
+		return false
+	}
+	for key := range schema {
+		if !annotationKeywords[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// typeSet returns the allowed JSON types, or nil when any type is allowed.
+func typeSet(typeSpec any) map[string]bool {
+	switch t := typeSpec.(type) {
+	case string:
+		return map[string]bool{t: true}
+	case []any:
+		out := make(map[string]bool, len(t))
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				out[name] = true
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func typeSetAllows(set map[string]bool, name string) bool {
+	if set == nil {
+		return true
+	}
+	return set[name] || (name == "integer" && set["number"])
+}
+
+func typeLabel(typeSpec any) string {
+	if typeSpec == nil {
+		return "any"
+	}
+	return typeDescription(typeSpec)
+}
+
+func jsonLabel(v any) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func unionKeys(a, b map[string]any) []string {
+	seen := make(map[string]any, len(a)+len(b))
+	for key := range a {
+		seen[key] = nil
+	}
+	for key := range b {
+		seen[key] = nil
+	}
+	return sortedKeys(seen)
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package validation
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustSchema(t *testing.T, doc string) map[string]any {
+	t.Helper()
+
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(doc), &schema); err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	return schema
+}
+
+func findChange(changes []SchemaChange, path, keyword string) (SchemaChange, bool) {
+	for _, change := range changes {
+		if change.Path == path && change.Keyword == keyword {
+			return change, true
+		}
+	}
+	return SchemaChange{}, false
+}
+
+func TestCompareSchemasIdenticalHasNoChanges(t *testing.T) {
+	schema, err := LoadSchema(filepath.Join(repoSchemaDir(t), "agent-event-v0.schema.json"))
+	if err != nil {
+		t.Fatalf("LoadSchema() error = %v", err)
+	}
+
+	if changes := CompareSchemas(schema, schema); len(changes) != 0 {
+		t.Fatalf("changes = %+v, want none", changes)
+	}
+}
+
+func TestCompareSchemasClassifiesChanges(t *testing.T) {
+	oldSchema := mustSchema(t, `{
+		"title": "old",
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["status", "legacy"],
+		"properties": {
+			"status": {"type": "string", "enum": ["ok", "failed"]},
+			"count": {"type": "integer", "minimum": 0, "maximum": 10},
+			"name": {"type": "string", "maxLength": 10},
+			"legacy": {"type": "string"},
+			"meta": {"type": "object", "properties": {"a": {"type": "string"}}}
+		}
+	}`)
+	newSchema := mustSchema(t, `{
+		"title": "new",
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["status", "region"],
+		"properties": {
+			"status": {"type": "string", "enum": ["ok", "cancelled"]},
+			"count": {"type": "number", "minimum": 1, "maximum": 20},
+			"name": {"type": "string", "maxLength": 20, "pattern": "^[a-z]+$"},
+			"region": {"type": "string"},
+			"meta": {"type": "object", "properties": {"a": {"type": "string"}, "b": {"type": "integer"}}}
+		}
+	}`)
+
+	changes := CompareSchemas(oldSchema, newSchema)
+
+	want := []struct {
+		path    string
+		keyword string
+		compat  Compatibility
+	}{
+		{"$.status", "enum", CompatBreaking},
+		{"$.count", "type", CompatBackward},
+		{"$.count", "minimum", CompatBreaking},
+		{"$.count", "maximum", CompatBackward},
+		{"$.name", "maxLength", CompatBackward},
+		{"$.name", "pattern", CompatBreaking},
+		{"$.region", "required", CompatBreaking},
+		{"$.region", "properties", CompatBackward},
+		{"$.legacy", "required", CompatBackward},
+		{"$.legacy", "properties", CompatBreaking},
+		{"$.meta.b", "properties", CompatForward},
+	}
+	for _, w := range want {
+		change, ok := findChange(changes, w.path, w.keyword)
+		if !ok {
+			t.Fatalf("missing change %s %s in %+v", w.path, w.keyword, changes)
+		}
+		if change.Compatibility != w.compat {
+			t.Fatalf("%s %s compatibility = %s, want %s (%s)", w.path, w.keyword, change.Compatibility, w.compat, change.Message)
+		}
+	}
+
+	if !HasBreakingChanges(changes) {
+		t.Fatal("HasBreakingChanges() = false, want true")
+	}
+}
+
+func TestCompareSchemasWideningOnlyIsNotBreaking(t *testing.T) {
+	oldSchema := mustSchema(t, `{
+		"type": "object",
+		"required": ["kind"],
+		"additionalProperties": false,
+		"properties": {"kind": {"enum": ["a"]}, "tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}}
+	}`)
+	newSchema := mustSchema(t, `{
+		"type": "object",
+		"required": ["kind"],
+		"properties": {"kind": {"enum": ["a", "b"]}, "tags": {"type": "array", "items": {"type": ["string", "integer"]}}}
+	}`)
+
+	changes := CompareSchemas(oldSchema, newSchema)
+	if HasBreakingChanges(changes) {
+		t.Fatalf("changes = %+v, want no breaking changes", changes)
+	}
+	if _, ok := findChange(changes, "$.tags[]", "type"); !ok {
+		t.Fatalf("missing widened item type in %+v", changes)
+	}
+	if _, ok := findChange(changes, "$", "additionalProperties"); !ok {
+		t.Fatalf("missing additionalProperties change in %+v", changes)
+	}
+}
+
+func TestCompareSchemasFollowsRefs(t *testing.T) {
+	oldSchema := mustSchema(t, `{
+		"$defs": {"id": {"type": "string", "minLength": 1}},
+		"properties": {"run_id": {"$ref": "#/$defs/id"}}
+	}`)
+	newSchema := mustSchema(t, `{
+		"$defs": {"identifier": {"type": "string", "minLength": 8}},
+		"properties": {"run_id": {"$ref": "#/$defs/identifier"}}
+	}`)
+
+	changes := CompareSchemas(oldSchema, newSchema)
+	if len(changes) != 1 {
+		t.Fatalf("changes = %+v, want only the minLength change", changes)
+	}
+	if change, _ := findChange(changes, "$.run_id", "minLength"); change.Compatibility != CompatBreaking {
+		t.Fatalf("change = %+v, want breaking minLength", change)
+	}
+}
+
+func TestCompareSchemasStopsOnRecursiveRefs(t *testing.T) {
+	doc := `{
+		"$defs": {"node": {
+			"type": "object",
+			"properties": {"left": {"$ref": "#/$defs/node"}, "right": {"$ref": "#/$defs/node"}}
+		}},
+		"$ref": "#/$defs/node"
+	}`
+
+	oldSchema, newSchema := mustSchema(t, doc), mustSchema(t, doc)
+	done := make(chan []SchemaChange, 1)
+	go func() { done <- CompareSchemas(oldSchema, newSchema) }()
+	select {
+	case changes := <-done:
+		if len(changes) != 0 {
+			t.Fatalf("changes = %+v, want none", changes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CompareSchemas() did not return on a recursive schema")
+	}
+}
+
+func TestCompareSchemasFlagsCompositionChanges(t *testing.T) {
+	oldSchema := mustSchema(t, `{"anyOf": [{"type": "string"}]}`)
+	newSchema := mustSchema(t, `{"anyOf": [{"type": "integer"}]}`)
+
+	change, ok := findChange(CompareSchemas(oldSchema, newSchema), "$", "anyOf")
+	if !ok || change.Compatibility != CompatBreaking {
+		t.Fatalf("change = %+v, want breaking anyOf change", change)
+	}
+}
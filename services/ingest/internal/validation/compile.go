@@ -0,0 +1,483 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// typeMask is a bit set of JSON types a schema accepts.
+type typeMask uint8
+
+const (
+	typeObject typeMask = 1 << iota
+	typeArray
+	typeString
+	typeNumber
+	typeInteger
+	typeBoolean
+	typeNull
+	typeUnknown // unrecognized type names accept any value, as before compilation
+)
+
+var typeNames = map[string]typeMask{
+	"object":  typeObject,
+	"array":   typeArray,
+	"string":  typeString,
+	"number":  typeNumber,
+	"integer": typeInteger,
+	"boolean": typeBoolean,
+	"null":    typeNull,
+}
+
+// schemaNode is one compiled schema. Keyword values are decoded once at
+// compile time and failure messages that do not depend on the instance are
+// rendered up front, so validating an event only walks typed fields.
+type schemaNode struct {
+	location string // JSON pointer of this schema within its document
+	reject   bool   // the boolean schema false
+	ref      *schemaNode
+
+	types   typeMask
+	typeErr violation
+
+	enum       *valueSet
+	enumValues []any
+	enumErr    violation
+	hasConst   bool
+	constVal   any
+	constErr   violation
+
+	numberBounds []numberBound
+
+	minLength, maxLength int // -1 when absent
+	minLengthErr         violation
+	maxLengthErr         violation
+	pattern              *regexp.Regexp
+	patternErr           violation
+	format               func(string) bool
+	formatErr            violation
+
+	prefixItems        []*schemaNode
+	items              *schemaNode
+	minItems, maxItems int // -1 when absent
+	minItemsErr        violation
+	maxItemsErr        violation
+	uniqueItems        bool
+
+	required          []string
+	dependentRequired []dependency
+	properties        map[string]*schemaNode
+	patternProperties []patternProperty
+	additional        *schemaNode // nil when additionalProperties is absent
+	propertyNames     *schemaNode
+
+	allOf, anyOf, oneOf []*schemaNode
+	not                 *schemaNode
+	ifNode              *schemaNode
+	thenNode            *schemaNode
+	elseNode            *schemaNode
+
+	// Skip whole keyword groups when the schema declares none of them.
+	hasNumber, hasString, hasArray, hasObject bool
+}
+
+type numberBound struct {
+	limit float64
+	check func(num, limit float64) bool
+	err   violation
+}
+
+type dependency struct {
+	trigger string
+	fields  []string
+	err     violation
+}
+
+// violation is the instance-independent part of a validation Error.
+type violation struct {
+	code    string
+	keyword string // keyword location within the schema document
+	message string
+}
+
+// at builds the violation for keyword on node.
+func (n *schemaNode) at(keyword string, code string, message string) violation {
+	location := n.location
+	if keyword != "" {
+		location += "/" + keyword
+	}
+	return violation{code: code, keyword: location, message: message}
+}
+
+type patternProperty struct {
+	re   *regexp.Regexp
+	node *schemaNode
+}
+
+// valueSet answers enum membership without re-comparing every allowed value.
+type valueSet struct {
+	strings  map[string]struct{}
+	numbers  map[float64]struct{}
+	hasTrue  bool
+	hasFalse bool
+	hasNull  bool
+	other    []any // arrays and objects, compared structurally
+}
+
+func newValueSet(values []any) *valueSet {
+	set := &valueSet{strings: map[string]struct{}{}, numbers: map[float64]struct{}{}}
+	for _, value := range values {
+		if num, ok := toFloat(value); ok {
+			set.numbers[num] = struct{}{}
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			set.strings[v] = struct{}{}
+		case bool:
+			if v {
+				set.hasTrue = true
+			} else {
+				set.hasFalse = true
+			}
+		case nil:
+			set.hasNull = true
+		default:
+			set.other = append(set.other, v)
+		}
+	}
+	return set
+}
+
+func (s *valueSet) contains(value any) bool {
+	switch v := value.(type) {
+	case string:
+		_, ok := s.strings[v]
+		return ok
+	case bool:
+		return (v && s.hasTrue) || (!v && s.hasFalse)
+	case nil:
+		return s.hasNull
+	case []any, map[string]any:
+		return valueInEnum(v, s.other)
+	}
+	if num, ok := toFloat(value); ok {
+		_, found := s.numbers[num]
+		return found
+	}
+	return false
+}
+
+// compiler turns a decoded schema document into schemaNodes. References are
+// compiled once per target and shared, which also ties off recursive schemas.
+type compiler struct {
+	root map[string]any
+	refs map[string]*schemaNode
+}
+
+func compileSchema(raw any) (*schemaNode, error) {
+	root, _ := toMap(raw)
+	c := &compiler{root: root, refs: map[string]*schemaNode{}}
+	return c.compile(raw, "#")
+}
+
+func (c *compiler) compile(raw any, location string) (*schemaNode, error) {
+	node := &schemaNode{}
+	if err := c.fill(node, raw, location); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (c *compiler) compileChild(schema map[string]any, keyword string, location string) (*schemaNode, error) {
+	raw, ok := schema[keyword]
+	if !ok {
+		return nil, nil
+	}
+	return c.compile(raw, location+"/"+keyword)
+}
+
+func (c *compiler) compileList(schema map[string]any, keyword string, location string) ([]*schemaNode, error) {
+	items, ok := toSlice(schema[keyword])
+	if !ok {
+		return nil, nil
+	}
+	nodes := make([]*schemaNode, 0, len(items))
+	for idx, item := range items {
+		node, err := c.compile(item, location+"/"+keyword+"/"+strconv.Itoa(idx))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (c *compiler) fill(node *schemaNode, raw any, location string) error {
+	node.location = location
+	node.minLength, node.maxLength, node.minItems, node.maxItems = -1, -1, -1, -1
+
+	if allowed, ok := raw.(bool); ok {
+		node.reject = !allowed
+		return nil
+	}
+	schema, ok := toMap(raw)
+	if !ok || schema == nil {
+		return nil
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := c.resolve(ref, location)
+		if err != nil {
+			return err
+		}
+		node.ref = target
+	}
+
+	if typeSpec, ok := schema["type"]; ok {
+		node.types = compileTypes(typeSpec)
+		node.typeErr = node.at("type", CodeTypeMismatch, fmt.Sprintf("must be type %s", typeDescription(typeSpec)))
+	}
+	if enumVals, ok := toSlice(schema["enum"]); ok {
+		node.enum = newValueSet(enumVals)
+		node.enumValues = enumVals
+		node.enumErr = node.at("enum", CodeEnumMismatch, "must be one of allowed enum values")
+	}
+	if constVal, ok := schema["const"]; ok {
+		node.hasConst = true
+		node.constVal = constVal
+		node.constErr = node.at("const", CodeConstMismatch, fmt.Sprintf("must equal %v", constVal))
+	}
+
+	c.compileNumber(node, schema)
+	if err := c.compileString(node, schema, location); err != nil {
+		return err
+	}
+	if err := c.compileArray(node, schema, location); err != nil {
+		return err
+	}
+	if err := c.compileObject(node, schema, location); err != nil {
+		return err
+	}
+	return c.compileComposition(node, schema, location)
+}
+
+func (c *compiler) resolve(ref string, location string) (*schemaNode, error) {
+	if node, ok := c.refs[ref]; ok {
+		return node, nil
+	}
+
+	target, found := resolveRef(c.root, ref)
+	if !found {
+		return nil, fmt.Errorf("%s: $ref %q cannot be resolved", location, ref)
+	}
+
+	node := &schemaNode{}
+	c.refs[ref] = node
+	if err := c.fill(node, target, ref); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func compileTypes(typeSpec any) typeMask {
+	var mask typeMask
+	add := func(name string) {
+		if bit, ok := typeNames[name]; ok {
+			mask |= bit
+		} else {
+			mask |= typeUnknown
+		}
+	}
+
+	switch t := typeSpec.(type) {
+	case string:
+		add(t)
+	case []any:
+		for _, raw := range t {
+			if name, ok := raw.(string); ok {
+				add(name)
+			}
+		}
+	default:
+		mask = typeUnknown
+	}
+	return mask
+}
+
+func (c *compiler) compileNumber(node *schemaNode, schema map[string]any) {
+	bounds := []struct {
+		keyword string
+		code    string
+		op      string
+		check   func(num, limit float64) bool
+	}{
+		{"minimum", CodeMinimum, ">=", func(num, limit float64) bool { return num >= limit }},
+		{"maximum", CodeMaximum, "<=", func(num, limit float64) bool { return num <= limit }},
+		{"exclusiveMinimum", CodeExclusiveMinimum, ">", func(num, limit float64) bool { return num > limit }},
+		{"exclusiveMaximum", CodeExclusiveMaximum, "<", func(num, limit float64) bool { return num < limit }},
+	}
+	for _, bound := range bounds {
+		if limit, ok := toFloat(schema[bound.keyword]); ok {
+			node.numberBounds = append(node.numberBounds, numberBound{
+				limit: limit,
+				check: bound.check,
+				err:   node.at(bound.keyword, bound.code, fmt.Sprintf("must be %s %s", bound.op, trimFloat(limit))),
+			})
+		}
+	}
+	node.hasNumber = len(node.numberBounds) > 0
+}
+
+func (c *compiler) compileString(node *schemaNode, schema map[string]any, location string) error {
+	if minLength, ok := toInt(schema["minLength"]); ok {
+		node.minLength = minLength
+		node.minLengthErr = node.at("minLength", CodeMinLength, fmt.Sprintf("must have length >= %d", minLength))
+	}
+	if maxLength, ok := toInt(schema["maxLength"]); ok {
+		node.maxLength = maxLength
+		node.maxLengthErr = node.at("maxLength", CodeMaxLength, fmt.Sprintf("must have length <= %d", maxLength))
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s/pattern: %q is not a valid regular expression: %w", location, pattern, err)
+		}
+		node.pattern = re
+		node.patternErr = node.at("pattern", CodePatternMismatch, fmt.Sprintf("must match pattern %s", pattern))
+	}
+	if format, ok := schema["format"].(string); ok {
+		var code, message string
+		if node.format, code, message = compileFormat(format); node.format != nil {
+			node.formatErr = node.at("format", code, message)
+		}
+	}
+
+	node.hasString = node.minLength >= 0 || node.maxLength >= 0 || node.pattern != nil || node.format != nil
+	return nil
+}
+
+// compileFormat returns the checker for an asserted format; unknown formats are annotations.
+func compileFormat(format string) (func(string) bool, string, string) {
+	switch format {
+	case "date-time":
+		return func(str string) bool {
+			_, err := time.Parse(time.RFC3339, str)
+			return err == nil
+		}, CodeFormatDateTime, "must be RFC3339 date-time"
+	case "uuid":
+		return uuidPattern.MatchString, CodeFormatUUID, "must be a valid UUID"
+	default:
+		return nil, "", ""
+	}
+}
+
+func (c *compiler) compileArray(node *schemaNode, schema map[string]any, location string) error {
+	var err error
+	if node.prefixItems, err = c.compileList(schema, "prefixItems", location); err != nil {
+		return err
+	}
+	if node.items, err = c.compileChild(schema, "items", location); err != nil {
+		return err
+	}
+	if minItems, ok := toInt(schema["minItems"]); ok {
+		node.minItems = minItems
+		node.minItemsErr = node.at("minItems", CodeMinItems, fmt.Sprintf("must have at least %d items", minItems))
+	}
+	if maxItems, ok := toInt(schema["maxItems"]); ok {
+		node.maxItems = maxItems
+		node.maxItemsErr = node.at("maxItems", CodeMaxItems, fmt.Sprintf("must have at most %d items", maxItems))
+	}
+	node.uniqueItems, _ = schema["uniqueItems"].(bool)
+
+	node.hasArray = len(node.prefixItems) > 0 || node.items != nil || node.minItems >= 0 || node.maxItems >= 0 || node.uniqueItems
+	return nil
+}
+
+func (c *compiler) compileObject(node *schemaNode, schema map[string]any, location string) error {
+	node.required, _ = toStringSlice(schema["required"])
+
+	if deps, ok := toMap(schema["dependentRequired"]); ok {
+		for _, trigger := range sortedKeys(deps) {
+			fields, _ := toStringSlice(deps[trigger])
+			node.dependentRequired = append(node.dependentRequired, dependency{
+				trigger: trigger,
+				fields:  fields,
+				err: node.at("dependentRequired/"+escapePointer(trigger), CodeDependentRequired,
+					fmt.Sprintf("is required when %s is present", trigger)),
+			})
+		}
+	}
+
+	if props, ok := toMap(schema["properties"]); ok {
+		node.properties = make(map[string]*schemaNode, len(props))
+		for _, name := range sortedKeys(props) {
+			prop, err := c.compile(props[name], location+"/properties/"+escapePointer(name))
+			if err != nil {
+				return err
+			}
+			node.properties[name] = prop
+		}
+	}
+
+	if patternProps, ok := toMap(schema["patternProperties"]); ok {
+		for _, pattern := range sortedKeys(patternProps) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s/patternProperties: %q is not a valid regular expression: %w", location, pattern, err)
+			}
+			prop, err := c.compile(patternProps[pattern], location+"/patternProperties/"+escapePointer(pattern))
+			if err != nil {
+				return err
+			}
+			node.patternProperties = append(node.patternProperties, patternProperty{re: re, node: prop})
+		}
+	}
+
+	var err error
+	if node.additional, err = c.compileChild(schema, "additionalProperties", location); err != nil {
+		return err
+	}
+	if node.propertyNames, err = c.compileChild(schema, "propertyNames", location); err != nil {
+		return err
+	}
+
+	node.hasObject = len(node.required) > 0 || len(node.dependentRequired) > 0 || node.properties != nil ||
+		len(node.patternProperties) > 0 || node.additional != nil || node.propertyNames != nil
+	return nil
+}
+
+func (c *compiler) compileComposition(node *schemaNode, schema map[string]any, location string) error {
+	var err error
+	if node.allOf, err = c.compileList(schema, "allOf", location); err != nil {
+		return err
+	}
+	if node.anyOf, err = c.compileList(schema, "anyOf", location); err != nil {
+		return err
+	}
+	if node.oneOf, err = c.compileList(schema, "oneOf", location); err != nil {
+		return err
+	}
+	if node.not, err = c.compileChild(schema, "not", location); err != nil {
+		return err
+	}
+	if node.ifNode, err = c.compileChild(schema, "if", location); err != nil {
+		return err
+	}
+	// then/else only apply alongside if, so skip compiling them otherwise.
+	if node.ifNode == nil {
+		return nil
+	}
+	if node.thenNode, err = c.compileChild(schema, "then", location); err != nil {
+		return err
+	}
+	node.elseNode, err = c.compileChild(schema, "else", location)
+	return err
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
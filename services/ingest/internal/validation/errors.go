@@ -0,0 +1,90 @@
+package validation
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// Stable error codes for schema violations. Clients may branch on these;
+// messages are for humans and may change.
+const (
+	CodeRequired            = "required"
+	CodeTypeMismatch        = "type_mismatch"
+	CodeEnumMismatch        = "enum_mismatch"
+	CodeConstMismatch       = "const_mismatch"
+	CodeMinimum             = "minimum"
+	CodeMaximum             = "maximum"
+	CodeExclusiveMinimum    = "exclusive_minimum"
+	CodeExclusiveMaximum    = "exclusive_maximum"
+	CodeMinLength           = "min_length"
+	CodeMaxLength           = "max_length"
+	CodePatternMismatch     = "pattern_mismatch"
+	CodeFormatDateTime      = "format_date_time"
+	CodeFormatUUID          = "format_uuid"
+	CodeMinItems            = "min_items"
+	CodeMaxItems            = "max_items"
+	CodeDuplicateItem       = "duplicate_item"
+	CodeDependentRequired   = "dependent_required"
+	CodeAdditionalProperty  = "additional_property"
+	CodeInvalidPropertyName = "invalid_property_name"
+	CodeAnyOfMismatch       = "any_of_mismatch"
+	CodeOneOfMismatch       = "one_of_mismatch"
+	CodeNotMismatch         = "not_mismatch"
+	CodeNotAllowed          = "not_allowed"
+	CodeSchemaTooDeep       = "schema_too_deep"
+	CodeUnsupportedVersion  = "unsupported_event_version"
+	CodeNotConfigured       = "validator_not_configured"
+)
+
+// maxValueChars bounds how much of an offending value is echoed back in an Error.
+const maxValueChars = 128
+
+// Error represents one validation failure.
+type Error struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// KeywordLocation is the JSON pointer of the failing schema keyword, e.g.
+	// "#/properties/run/properties/status/enum". Empty for semantic rules.
+	KeywordLocation string `json:"keyword_location,omitempty"`
+	// Value is the offending instance value as JSON. Strings longer than
+	// maxValueChars are cut short, and longer arrays or objects are replaced
+	// by a cut-short string of their encoding. Absent when the value is missing.
+	Value json.RawMessage `json:"value,omitempty"`
+	// AllowedValues lists the accepted values for enum and const failures.
+	AllowedValues []any `json:"allowed_values,omitempty"`
+}
+
+// missingValue marks failures about absent fields, which have no value to echo.
+type missingValue struct{}
+
+// encodeValue renders value for Error.Value.
+func encodeValue(value any) json.RawMessage {
+	if _, ok := value.(missingValue); ok {
+		return nil
+	}
+	if str, ok := value.(string); ok {
+		raw, _ := json.Marshal(truncateString(str))
+		return raw
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	if utf8.RuneCount(raw) > maxValueChars {
+		raw, _ = json.Marshal(truncateString(string(raw)))
+	}
+	return raw
+}
+
+func truncateString(str string) string {
+	count := 0
+	for idx := range str {
+		if count == maxValueChars {
+			return str[:idx] + "…"
+		}
+		count++
+	}
+	return str
+}
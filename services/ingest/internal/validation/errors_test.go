@@ -0,0 +1,38 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEncodeValueTruncatesLongValues(t *testing.T) {
+	if got := string(encodeValue("short")); got != `"short"` {
+		t.Fatalf("encodeValue(short) = %s", got)
+	}
+	if got := string(encodeValue(42.5)); got != `42.5` {
+		t.Fatalf("encodeValue(42.5) = %s", got)
+	}
+	if got := string(encodeValue(nil)); got != `null` {
+		t.Fatalf("encodeValue(nil) = %s", got)
+	}
+
+	long := strings.Repeat("é", maxValueChars+10)
+	got := string(encodeValue(long))
+	want := `"` + strings.Repeat("é", maxValueChars) + `…"`
+	if got != want {
+		t.Fatalf("encodeValue(long string) = %s, want %d runes and an ellipsis", got, maxValueChars)
+	}
+
+	items := make([]any, 100)
+	for idx := range items {
+		items[idx] = "item"
+	}
+	got = string(encodeValue(items))
+	if !strings.HasPrefix(got, `"[\"item\"`) || !strings.HasSuffix(got, `…"`) {
+		t.Fatalf("encodeValue(long array) = %s, want truncated JSON string", got)
+	}
+	if runes := utf8.RuneCountInString(got); runes > 2*maxValueChars {
+		t.Fatalf("encodeValue(long array) has %d runes, want bounded output", runes)
+	}
+}
@@ -0,0 +1,236 @@
+package validation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSchemaDir  = "packages/schemas"
+	schemaFileSuffix  = ".schema.json"
+	eventVersionField = "event_version"
+	eventVersionPath  = "$." + eventVersionField
+)
+
+// SchemaInfo describes one registered event schema version.
+type SchemaInfo struct {
+	Version string `json:"version"`
+	ID      string `json:"id,omitempty"`
+	Title   string `json:"title,omitempty"`
+}
+
+// Registry holds one validator per event_version and dispatches payloads to
+// the schema matching their declared version, so producers on different
+// contract versions can be ingested side by side.
+type Registry struct {
+	versions   []SchemaInfo
+	validators map[string]*EventValidator
+	documents  map[string]json.RawMessage
+	hash       string
+}
+
+// NewRegistry loads event schemas from schemaPath, which may be a single
+// schema file or a directory of *.schema.json files. Each schema must pin
+// properties.event_version to a const string naming its version.
+func NewRegistry(schemaPath string) (*Registry, error) {
+	files, err := readSchemaFiles(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	return newRegistry(files)
+}
+
+// schemaFile is one schema document read from disk.
+type schemaFile struct {
+	name string
+	raw  []byte
+}
+
+// readSchemaFiles reads the schema file or directory at schemaPath in lexical file order.
+func readSchemaFiles(schemaPath string) ([]schemaFile, error) {
+	if strings.TrimSpace(schemaPath) == "" {
+		schemaPath = defaultSchemaDir
+	}
+
+	resolvedPath, err := resolveSchemaPath(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(resolvedPath)
+	if err != nil {
+		return nil, fmt.Errorf("stat schema path: %w", err)
+	}
+
+	paths := []string{resolvedPath}
+	if stat.IsDir() {
+		paths, err = filepath.Glob(filepath.Join(resolvedPath, "*"+schemaFileSuffix))
+		if err != nil {
+			return nil, fmt.Errorf("list schema directory: %w", err)
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no %s files found in %s", schemaFileSuffix, resolvedPath)
+		}
+	}
+
+	files := make([]schemaFile, 0, len(paths))
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read schema %s: %w", filepath.Base(path), err)
+		}
+		files = append(files, schemaFile{name: filepath.Base(path), raw: raw})
+	}
+	return files, nil
+}
+
+// hashSchemaFiles fingerprints a schema set by file name and content.
+func hashSchemaFiles(files []schemaFile) string {
+	h := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00", file.name, len(file.raw))
+		h.Write(file.raw)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func newRegistry(files []schemaFile) (*Registry, error) {
+	registry := &Registry{
+		validators: make(map[string]*EventValidator, len(files)),
+		documents:  make(map[string]json.RawMessage, len(files)),
+		hash:       hashSchemaFiles(files),
+	}
+	for _, file := range files {
+		if err := registry.load(file.raw); err != nil {
+			return nil, fmt.Errorf("load schema %s: %w", file.name, err)
+		}
+	}
+
+	sort.Slice(registry.versions, func(i, j int) bool {
+		return versionLess(registry.versions[i].Version, registry.versions[j].Version)
+	})
+
+	return registry, nil
+}
+
+func (r *Registry) load(raw []byte) error {
+	validator, err := parseEventValidator(raw)
+	if err != nil {
+		return err
+	}
+
+	version, err := schemaVersion(validator.schema)
+	if err != nil {
+		return err
+	}
+	if _, exists := r.validators[version]; exists {
+		return fmt.Errorf("event_version %q is defined by more than one schema", version)
+	}
+
+	info := SchemaInfo{Version: version}
+	info.ID, _ = validator.schema["$id"].(string)
+	info.Title, _ = validator.schema["title"].(string)
+
+	r.versions = append(r.versions, info)
+	r.validators[version] = validator
+	r.documents[version] = json.RawMessage(raw)
+	return nil
+}
+
+// Validate checks payload against the schema registered for its event_version.
+func (r *Registry) Validate(payload any) []Error {
+	if r == nil {
+		return []Error{{Path: "$", Code: CodeNotConfigured, Message: "validator is not configured"}}
+	}
+
+	obj, ok := payload.(map[string]any)
+	if !ok {
+		return []Error{{Path: "$", Code: CodeTypeMismatch, Message: "must be type object", Value: encodeValue(payload)}}
+	}
+
+	rawVersion, present := obj[eventVersionField]
+	if !present {
+		return []Error{{Path: eventVersionPath, Code: CodeRequired, Message: "is required"}}
+	}
+	version, ok := rawVersion.(string)
+	if !ok {
+		return []Error{{Path: eventVersionPath, Code: CodeTypeMismatch, Message: "must be type string", Value: encodeValue(rawVersion)}}
+	}
+
+	validator, ok := r.validators[version]
+	if !ok {
+		allowed := make([]any, 0, len(r.versions))
+		for _, info := range r.versions {
+			allowed = append(allowed, info.Version)
+		}
+		return []Error{{
+			Path:          eventVersionPath,
+			Code:          CodeUnsupportedVersion,
+			Message:       fmt.Sprintf("unsupported event_version %q (supported: %s)", version, strings.Join(r.Versions(), ", ")),
+			Value:         encodeValue(version),
+			AllowedValues: allowed,
+		}}
+	}
+
+	return validator.Validate(payload)
+}
+
+// Versions lists registered event versions in ascending order.
+func (r *Registry) Versions() []string {
+	out := make([]string, 0, len(r.versions))
+	for _, info := range r.versions {
+		out = append(out, info.Version)
+	}
+	return out
+}
+
+// Schemas describes every registered schema in ascending version order.
+func (r *Registry) Schemas() []SchemaInfo {
+	return append([]SchemaInfo(nil), r.versions...)
+}
+
+// Hash fingerprints the loaded schema files; it changes whenever any file is
+// added, removed, renamed or edited.
+func (r *Registry) Hash() string {
+	return r.hash
+}
+
+// Schema returns the raw schema document registered for version.
+func (r *Registry) Schema(version string) (json.RawMessage, bool) {
+	doc, ok := r.documents[version]
+	return doc, ok
+}
+
+func schemaVersion(schema map[string]any) (string, error) {
+	properties, _ := toMap(schema["properties"])
+	field, _ := toMap(properties[eventVersionField])
+	version, ok := field["const"].(string)
+	if !ok || strings.TrimSpace(version) == "" {
+		return "", errors.New("schema must pin properties.event_version to a const string")
+	}
+	return version, nil
+}
+
+// versionLess orders "v<N>" versions numerically and anything else lexically after them.
+func versionLess(a, b string) bool {
+	an, aErr := strconv.Atoi(strings.TrimPrefix(a, "v"))
+	bn, bErr := strconv.Atoi(strings.TrimPrefix(b, "v"))
+	switch {
+	case aErr == nil && bErr == nil:
+		return an < bn
+	case aErr == nil:
+		return true
+	case bErr == nil:
+		return false
+	default:
+		return a < b
+	}
+}
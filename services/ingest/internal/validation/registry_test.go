@@ -0,0 +1,132 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func repoSchemaDir(t *testing.T) string {
+	t.Helper()
+
+	_, testFile, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("failed to resolve caller path")
+	}
+	return filepath.Clean(filepath.Join(filepath.Dir(testFile), "../../../../packages/schemas"))
+}
+
+// writeVersionedSchemas copies the repo v0 schema into dir once per version with event_version re-pinned.
+func writeVersionedSchemas(t *testing.T, dir string, versions ...string) {
+	t.Helper()
+
+	raw, err := os.ReadFile(filepath.Join(repoSchemaDir(t), "agent-event-v0.schema.json"))
+	if err != nil {
+		t.Fatalf("read v0 schema: %v", err)
+	}
+
+	for _, version := range versions {
+		doc := strings.Replace(string(raw), `"const": "v0"`, `"const": "`+version+`"`, 1)
+		name := "agent-event-" + version + ".schema.json"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(doc), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func validRegistryPayload(version string) map[string]any {
+	return map[string]any{
+		"event_version": version,
+		"event_id":      "123e4567-e89b-12d3-a456-426614174000",
+		"event_type":    "run.started",
+		"occurred_at":   "2026-02-07T21:00:00Z",
+		"tenant":        map[string]any{"tenant_id": "t1", "workspace_id": "w1", "project_id": "p1"},
+		"run":           map[string]any{"run_id": "r1", "agent_id": "a1", "workflow_id": "wf1", "status": "started"},
+		"trace":         map[string]any{"trace_id": "tr1", "span_id": "sp1"},
+	}
+}
+
+func TestNewRegistryLoadsRepoSchemas(t *testing.T) {
+	registry, err := NewRegistry(repoSchemaDir(t))
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	if _, ok := registry.Schema("v0"); !ok {
+		t.Fatalf("versions = %v, want v0 registered", registry.Versions())
+	}
+	if errList := registry.Validate(validRegistryPayload("v0")); len(errList) != 0 {
+		t.Fatalf("Validate() errors = %v, want none", errList)
+	}
+}
+
+func TestRegistryDispatchesOnEventVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeVersionedSchemas(t, dir, "v1", "v0", "v10")
+
+	registry, err := NewRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	if got := strings.Join(registry.Versions(), ","); got != "v0,v1,v10" {
+		t.Fatalf("Versions() = %s, want v0,v1,v10", got)
+	}
+
+	for _, version := range []string{"v0", "v1"} {
+		if errList := registry.Validate(validRegistryPayload(version)); len(errList) != 0 {
+			t.Fatalf("Validate(%s) errors = %v, want none", version, errList)
+		}
+	}
+
+	payload := validRegistryPayload("v1")
+	delete(payload, "trace")
+	if errList := registry.Validate(payload); !containsPath(errList, "$.trace") {
+		t.Fatalf("Validate() errors = %v, want v1 schema applied", errList)
+	}
+}
+
+func TestRegistryRejectsUnknownOrMissingVersion(t *testing.T) {
+	registry, err := NewRegistry(repoSchemaDir(t))
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	errList := registry.Validate(validRegistryPayload("v9"))
+	if len(errList) != 1 || errList[0].Path != "$.event_version" || !strings.Contains(errList[0].Message, `unsupported event_version "v9"`) {
+		t.Fatalf("Validate() errors = %v, want unsupported version error", errList)
+	}
+
+	payload := validRegistryPayload("v0")
+	delete(payload, "event_version")
+	if errList := registry.Validate(payload); len(errList) != 1 || errList[0].Message != "is required" {
+		t.Fatalf("Validate() errors = %v, want missing event_version", errList)
+	}
+
+	if errList := registry.Validate([]any{}); len(errList) != 1 || errList[0].Path != "$" {
+		t.Fatalf("Validate() errors = %v, want non-object rejection", errList)
+	}
+}
+
+func TestNewRegistryRejectsInvalidSchemaSets(t *testing.T) {
+	duplicate := t.TempDir()
+	writeVersionedSchemas(t, duplicate, "v0")
+	raw, _ := os.ReadFile(filepath.Join(duplicate, "agent-event-v0.schema.json"))
+	_ = os.WriteFile(filepath.Join(duplicate, "copy.schema.json"), raw, 0o644)
+
+	unpinned := t.TempDir()
+	_ = os.WriteFile(filepath.Join(unpinned, "event.schema.json"), []byte(`{"type":"object"}`), 0o644)
+
+	tests := map[string]string{
+		"duplicate version": duplicate,
+		"missing const":     unpinned,
+		"empty directory":   t.TempDir(),
+	}
+	for name, dir := range tests {
+		if _, err := NewRegistry(dir); err == nil {
+			t.Fatalf("%s: expected NewRegistry() error", name)
+		}
+	}
+}
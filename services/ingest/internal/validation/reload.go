@@ -0,0 +1,93 @@
+package validation
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// ReloadResult describes the outcome of ReloadingRegistry.Reload.
+type ReloadResult struct {
+	Hash          string   `json:"schema_hash"`
+	PreviousHash  string   `json:"previous_schema_hash,omitempty"`
+	Changed       bool     `json:"changed"`
+	EventVersions []string `json:"event_versions"`
+}
+
+// ReloadingRegistry validates against the most recently loaded schema set
+// and swaps in a new Registry atomically when the files at its path change.
+// A schema set that fails to load never replaces the active one.
+type ReloadingRegistry struct {
+	path    string
+	mu      sync.Mutex // serializes reloads
+	current atomic.Pointer[Registry]
+}
+
+// NewReloadingRegistry loads schemaPath like NewRegistry.
+func NewReloadingRegistry(schemaPath string) (*ReloadingRegistry, error) {
+	registry, err := NewRegistry(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReloadingRegistry{path: schemaPath}
+	r.current.Store(registry)
+	return r, nil
+}
+
+// Reload re-reads the schema path. Unchanged files are not recompiled. When
+// the new files fail to load, the error is returned and the active schema set
+// stays in place; the result then reports the still-active hash.
+func (r *ReloadingRegistry) Reload() (ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	active := r.current.Load()
+	result := ReloadResult{Hash: active.Hash(), EventVersions: active.Versions()}
+
+	files, err := readSchemaFiles(r.path)
+	if err != nil {
+		return result, err
+	}
+	if hashSchemaFiles(files) == active.Hash() {
+		return result, nil
+	}
+
+	next, err := newRegistry(files)
+	if err != nil {
+		return result, err
+	}
+	r.current.Store(next)
+
+	return ReloadResult{
+		Hash:          next.Hash(),
+		PreviousHash:  active.Hash(),
+		Changed:       true,
+		EventVersions: next.Versions(),
+	}, nil
+}
+
+// Validate checks payload against the active schema set.
+func (r *ReloadingRegistry) Validate(payload any) []Error {
+	return r.current.Load().Validate(payload)
+}
+
+// Hash fingerprints the active schema set.
+func (r *ReloadingRegistry) Hash() string {
+	return r.current.Load().Hash()
+}
+
+// Versions lists the active event versions in ascending order.
+func (r *ReloadingRegistry) Versions() []string {
+	return r.current.Load().Versions()
+}
+
+// Schemas describes the active schemas in ascending version order.
+func (r *ReloadingRegistry) Schemas() []SchemaInfo {
+	return r.current.Load().Schemas()
+}
+
+// Schema returns the active raw schema document for version.
+func (r *ReloadingRegistry) Schema(version string) (json.RawMessage, bool) {
+	return r.current.Load().Schema(version)
+}
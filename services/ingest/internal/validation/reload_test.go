@@ -0,0 +1,103 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadingRegistrySwapsChangedSchemas(t *testing.T) {
+	dir := t.TempDir()
+	writeVersionedSchemas(t, dir, "v0")
+
+	registry, err := NewReloadingRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewReloadingRegistry() error = %v", err)
+	}
+	initialHash := registry.Hash()
+
+	result, err := registry.Reload()
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if result.Changed || result.Hash != initialHash {
+		t.Fatalf("unchanged reload = %+v, want same hash without change", result)
+	}
+
+	if errList := registry.Validate(validRegistryPayload("v1")); len(errList) != 1 {
+		t.Fatalf("v1 before reload errors = %v, want unsupported version", errList)
+	}
+
+	writeVersionedSchemas(t, dir, "v1")
+	result, err = registry.Reload()
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if !result.Changed || result.PreviousHash != initialHash || result.Hash == initialHash || result.Hash != registry.Hash() {
+		t.Fatalf("reload result = %+v, want new hash replacing %s", result, initialHash)
+	}
+	if len(result.EventVersions) != 2 {
+		t.Fatalf("event versions = %v, want v0 and v1", result.EventVersions)
+	}
+	if errList := registry.Validate(validRegistryPayload("v1")); len(errList) != 0 {
+		t.Fatalf("v1 after reload errors = %v, want none", errList)
+	}
+	if _, ok := registry.Schema("v1"); !ok {
+		t.Fatal("Schema(v1) missing after reload")
+	}
+}
+
+func TestReloadingRegistryKeepsActiveSchemasOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeVersionedSchemas(t, dir, "v0")
+
+	registry, err := NewReloadingRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewReloadingRegistry() error = %v", err)
+	}
+	activeHash := registry.Hash()
+
+	broken := filepath.Join(dir, "agent-event-v1.schema.json")
+	if err := os.WriteFile(broken, []byte(`{"type":`), 0o644); err != nil {
+		t.Fatalf("write broken schema: %v", err)
+	}
+
+	result, err := registry.Reload()
+	if err == nil {
+		t.Fatal("expected reload error for malformed schema")
+	}
+	if result.Changed || result.Hash != activeHash || registry.Hash() != activeHash {
+		t.Fatalf("result = %+v, active hash = %s, want %s kept", result, registry.Hash(), activeHash)
+	}
+	if errList := registry.Validate(validRegistryPayload("v0")); len(errList) != 0 {
+		t.Fatalf("v0 errors after failed reload = %v, want none", errList)
+	}
+}
+
+func TestRegistryHashTracksFileContent(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+	writeVersionedSchemas(t, first, "v0")
+	writeVersionedSchemas(t, second, "v0")
+
+	a, err := NewRegistry(first)
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	b, err := NewRegistry(second)
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	if a.Hash() != b.Hash() {
+		t.Fatalf("identical schema sets hash to %s and %s", a.Hash(), b.Hash())
+	}
+
+	writeVersionedSchemas(t, second, "v1")
+	c, err := NewRegistry(second)
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	if c.Hash() == a.Hash() {
+		t.Fatal("hash did not change after adding a schema")
+	}
+}
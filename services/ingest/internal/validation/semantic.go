@@ -0,0 +1,242 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Validator checks a decoded payload and returns its violations.
+type Validator interface {
+	Validate(payload any) []Error
+}
+
+// RuleAction decides what happens to an event when a semantic rule fires.
+type RuleAction string
+
+const (
+	// RuleReject turns a rule violation into a validation error.
+	RuleReject RuleAction = "reject"
+	// RuleWarn accepts the event and reports the violation as a warning.
+	RuleWarn RuleAction = "warn"
+	// RuleOff disables the rule.
+	RuleOff RuleAction = "off"
+)
+
+// Stable semantic rule codes. They appear in Error.Code and in SEMANTIC_RULES.
+const (
+	RuleRunEndedBeforeStarted = "run_ended_before_started"
+	RuleTokenTotalMismatch    = "token_total_mismatch"
+	RuleRunStatusMismatch     = "run_status_mismatch"
+	RuleBudgetSpendDecreased  = "budget_spend_decreased"
+	RuleOccurredAtInFuture    = "occurred_at_in_future"
+)
+
+// DefaultMaxFutureSkew is how far occurred_at may run ahead of the server clock.
+const DefaultMaxFutureSkew = 5 * time.Minute
+
+// SemanticRule checks one cross-field invariant that JSON Schema cannot express.
+// Check runs only on schema-valid events and returns the violation, if any.
+type SemanticRule struct {
+	Code  string
+	Check func(event map[string]any, now time.Time) (Error, bool)
+}
+
+// ParseRuleAction validates a configured rule action.
+func ParseRuleAction(raw string) (RuleAction, error) {
+	switch action := RuleAction(strings.ToLower(strings.TrimSpace(raw))); action {
+	case RuleReject, RuleWarn, RuleOff:
+		return action, nil
+	default:
+		return "", fmt.Errorf("rule action must be one of reject|warn|off, got %q", raw)
+	}
+}
+
+// DefaultSemanticRules returns the built-in rules in evaluation order.
+func DefaultSemanticRules(maxFutureSkew time.Duration) []SemanticRule {
+	if maxFutureSkew <= 0 {
+		maxFutureSkew = DefaultMaxFutureSkew
+	}
+
+	return []SemanticRule{
+		{Code: RuleRunEndedBeforeStarted, Check: checkRunTimestamps},
+		{Code: RuleTokenTotalMismatch, Check: checkTokenTotal},
+		{Code: RuleRunStatusMismatch, Check: checkRunStatus},
+		{Code: RuleBudgetSpendDecreased, Check: checkBudgetSpend},
+		{Code: RuleOccurredAtInFuture, Check: func(event map[string]any, now time.Time) (Error, bool) {
+			return checkOccurredAt(event, now, maxFutureSkew)
+		}},
+	}
+}
+
+// SemanticValidator runs schema validation first and, for schema-valid
+// events, a set of semantic rules whose violations either reject the event or
+// are reported back as warnings.
+type SemanticValidator struct {
+	base    Validator
+	rules   []SemanticRule
+	actions map[string]RuleAction
+	now     func() time.Time
+}
+
+// NewSemanticValidator wraps base with rules. Rules missing from actions use
+// defaultAction; actions naming unknown rules are rejected so typos surface at startup.
+func NewSemanticValidator(base Validator, rules []SemanticRule, actions map[string]RuleAction, defaultAction RuleAction) (*SemanticValidator, error) {
+	if base == nil {
+		return nil, errors.New("base validator is required")
+	}
+	if _, err := ParseRuleAction(string(defaultAction)); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(rules))
+	resolved := make(map[string]RuleAction, len(rules))
+	for _, rule := range rules {
+		known[rule.Code] = true
+		resolved[rule.Code] = defaultAction
+	}
+	for code, action := range actions {
+		if !known[code] {
+			return nil, fmt.Errorf("unknown semantic rule %q", code)
+		}
+		if _, err := ParseRuleAction(string(action)); err != nil {
+			return nil, fmt.Errorf("semantic rule %s: %w", code, err)
+		}
+		resolved[code] = action
+	}
+
+	return &SemanticValidator{base: base, rules: rules, actions: resolved, now: time.Now}, nil
+}
+
+// Validate returns schema errors and violations of rules configured to reject.
+func (s *SemanticValidator) Validate(payload any) []Error {
+	errList, _ := s.ValidateWithWarnings(payload)
+	return errList
+}
+
+// ValidateWithWarnings also returns violations of rules configured to warn.
+// Warnings are only meaningful when errList is empty.
+func (s *SemanticValidator) ValidateWithWarnings(payload any) (errList []Error, warnings []Error) {
+	errList = s.base.Validate(payload)
+	if len(errList) > 0 {
+		return errList, nil
+	}
+
+	event, ok := payload.(map[string]any)
+	if !ok {
+		return errList, nil
+	}
+
+	now := s.now()
+	for _, rule := range s.rules {
+		action := s.actions[rule.Code]
+		if action == RuleOff {
+			continue
+		}
+
+		violation, fired := rule.Check(event, now)
+		if !fired {
+			continue
+		}
+		violation.Code = rule.Code
+		if action == RuleReject {
+			errList = append(errList, violation)
+		} else {
+			warnings = append(warnings, violation)
+		}
+	}
+
+	return errList, warnings
+}
+
+// Actions reports the effective action for every rule.
+func (s *SemanticValidator) Actions() map[string]RuleAction {
+	out := make(map[string]RuleAction, len(s.actions))
+	for code, action := range s.actions {
+		out[code] = action
+	}
+	return out
+}
+
+func checkRunTimestamps(event map[string]any, _ time.Time) (Error, bool) {
+	run, _ := toMap(event["run"])
+	started, okStarted := timeField(run, "started_at")
+	ended, okEnded := timeField(run, "ended_at")
+	if !okStarted || !okEnded || !ended.Before(started) {
+		return Error{}, false
+	}
+	return Error{Path: "$.run.ended_at", Message: "must not be before run.started_at", Value: encodeValue(run["ended_at"])}, true
+}
+
+func checkTokenTotal(event map[string]any, _ time.Time) (Error, bool) {
+	usage, _ := toMap(event["resource_usage"])
+	input, okInput := toFloat(usage["input_tokens"])
+	output, okOutput := toFloat(usage["output_tokens"])
+	total, okTotal := toFloat(usage["total_tokens"])
+	if !okInput || !okOutput || !okTotal || total == input+output {
+		return Error{}, false
+	}
+	return Error{
+		Path:    "$.resource_usage.total_tokens",
+		Message: fmt.Sprintf("must equal input_tokens + output_tokens (%s)", trimFloat(input+output)),
+		Value:   encodeValue(usage["total_tokens"]),
+	}, true
+}
+
+// terminalRunStatuses lists run.status values that contradict each terminal run event.
+var terminalRunStatuses = map[string][]string{
+	"run.completed": {"started", "failure"},
+	"run.failed":    {"started", "success"},
+}
+
+func checkRunStatus(event map[string]any, _ time.Time) (Error, bool) {
+	eventType, _ := event["event_type"].(string)
+	run, _ := toMap(event["run"])
+	status, _ := run["status"].(string)
+
+	for _, conflicting := range terminalRunStatuses[eventType] {
+		if status == conflicting {
+			return Error{
+				Path:    "$.run.status",
+				Message: fmt.Sprintf("must not be %q on a %s event", status, eventType),
+				Value:   encodeValue(status),
+			}, true
+		}
+	}
+	return Error{}, false
+}
+
+func checkBudgetSpend(event map[string]any, _ time.Time) (Error, bool) {
+	budget, _ := toMap(event["budget"])
+	before, okBefore := toFloat(budget["spent_before_usd"])
+	after, okAfter := toFloat(budget["spent_after_usd"])
+	if !okBefore || !okAfter || after >= before {
+		return Error{}, false
+	}
+	return Error{Path: "$.budget.spent_after_usd", Message: "must not be less than spent_before_usd", Value: encodeValue(budget["spent_after_usd"])}, true
+}
+
+func checkOccurredAt(event map[string]any, now time.Time, maxSkew time.Duration) (Error, bool) {
+	occurredAt, ok := timeField(event, "occurred_at")
+	if !ok || !occurredAt.After(now.Add(maxSkew)) {
+		return Error{}, false
+	}
+	return Error{
+		Path:    "$.occurred_at",
+		Message: fmt.Sprintf("must not be more than %s in the future", maxSkew),
+		Value:   encodeValue(event["occurred_at"]),
+	}, true
+}
+
+func timeField(obj map[string]any, field string) (time.Time, bool) {
+	raw, ok := obj[field].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
@@ -0,0 +1,127 @@
+package validation
+
+import (
+	"testing"
+	"time"
+)
+
+type staticValidator []Error
+
+func (s staticValidator) Validate(any) []Error {
+	return s
+}
+
+var semanticNow = time.Date(2026, 2, 7, 21, 0, 0, 0, time.UTC)
+
+func semanticEvent() map[string]any {
+	return map[string]any{
+		"event_type":  "run.completed",
+		"occurred_at": "2026-02-07T21:00:00Z",
+		"run": map[string]any{
+			"status":     "success",
+			"started_at": "2026-02-07T20:59:00Z",
+			"ended_at":   "2026-02-07T21:00:00Z",
+		},
+		"resource_usage": map[string]any{"input_tokens": 10.0, "output_tokens": 5.0, "total_tokens": 15.0},
+		"budget":         map[string]any{"spent_before_usd": 1.0, "spent_after_usd": 1.5},
+	}
+}
+
+func newTestSemanticValidator(t *testing.T, actions map[string]RuleAction, defaultAction RuleAction) *SemanticValidator {
+	t.Helper()
+
+	v, err := NewSemanticValidator(staticValidator(nil), DefaultSemanticRules(time.Minute), actions, defaultAction)
+	if err != nil {
+		t.Fatalf("NewSemanticValidator() error = %v", err)
+	}
+	v.now = func() time.Time { return semanticNow }
+	return v
+}
+
+func TestSemanticRulesDetectViolations(t *testing.T) {
+	tests := []struct {
+		code   string
+		path   string
+		mutate func(event map[string]any)
+	}{
+		{RuleRunEndedBeforeStarted, "$.run.ended_at", func(e map[string]any) {
+			e["run"].(map[string]any)["ended_at"] = "2026-02-07T20:58:00Z"
+		}},
+		{RuleTokenTotalMismatch, "$.resource_usage.total_tokens", func(e map[string]any) {
+			e["resource_usage"].(map[string]any)["total_tokens"] = 14.0
+		}},
+		{RuleRunStatusMismatch, "$.run.status", func(e map[string]any) {
+			e["event_type"] = "run.failed"
+		}},
+		{RuleBudgetSpendDecreased, "$.budget.spent_after_usd", func(e map[string]any) {
+			e["budget"].(map[string]any)["spent_after_usd"] = 0.5
+		}},
+		{RuleOccurredAtInFuture, "$.occurred_at", func(e map[string]any) {
+			e["occurred_at"] = "2026-02-07T21:05:00Z"
+		}},
+	}
+
+	v := newTestSemanticValidator(t, nil, RuleReject)
+	if errList, warnings := v.ValidateWithWarnings(semanticEvent()); len(errList) != 0 || len(warnings) != 0 {
+		t.Fatalf("baseline errors = %v, warnings = %v, want none", errList, warnings)
+	}
+
+	for _, tc := range tests {
+		event := semanticEvent()
+		tc.mutate(event)
+
+		errList := v.Validate(event)
+		if len(errList) != 1 || errList[0].Code != tc.code || errList[0].Path != tc.path {
+			t.Fatalf("%s: errors = %+v, want one error at %s", tc.code, errList, tc.path)
+		}
+	}
+}
+
+func TestSemanticRuleActions(t *testing.T) {
+	event := semanticEvent()
+	event["resource_usage"].(map[string]any)["total_tokens"] = 99.0
+	event["budget"].(map[string]any)["spent_after_usd"] = 0.1
+	event["occurred_at"] = "2026-02-08T00:00:00Z"
+
+	v := newTestSemanticValidator(t, map[string]RuleAction{
+		RuleTokenTotalMismatch: RuleReject,
+		RuleOccurredAtInFuture: RuleOff,
+	}, RuleWarn)
+
+	errList, warnings := v.ValidateWithWarnings(event)
+	if len(errList) != 1 || errList[0].Code != RuleTokenTotalMismatch {
+		t.Fatalf("errors = %+v, want token_total_mismatch rejection", errList)
+	}
+	if len(warnings) != 1 || warnings[0].Code != RuleBudgetSpendDecreased {
+		t.Fatalf("warnings = %+v, want budget_spend_decreased warning", warnings)
+	}
+}
+
+func TestSemanticRulesSkipSchemaInvalidEvents(t *testing.T) {
+	schemaErr := Error{Path: "$.run", Code: CodeRequired, Message: "is required"}
+	v, err := NewSemanticValidator(staticValidator{schemaErr}, DefaultSemanticRules(0), nil, RuleReject)
+	if err != nil {
+		t.Fatalf("NewSemanticValidator() error = %v", err)
+	}
+
+	event := semanticEvent()
+	event["event_type"] = "run.failed"
+	errList, warnings := v.ValidateWithWarnings(event)
+	if len(errList) != 1 || errList[0].Code != CodeRequired || errList[0].Path != schemaErr.Path || warnings != nil {
+		t.Fatalf("errors = %+v, warnings = %+v, want only the schema error", errList, warnings)
+	}
+}
+
+func TestNewSemanticValidatorRejectsBadConfig(t *testing.T) {
+	rules := DefaultSemanticRules(0)
+
+	if _, err := NewSemanticValidator(staticValidator(nil), rules, map[string]RuleAction{"no_such_rule": RuleWarn}, RuleWarn); err == nil {
+		t.Fatal("expected error for unknown rule code")
+	}
+	if _, err := NewSemanticValidator(staticValidator(nil), rules, map[string]RuleAction{RuleTokenTotalMismatch: "drop"}, RuleWarn); err == nil {
+		t.Fatal("expected error for unknown action")
+	}
+	if _, err := NewSemanticValidator(staticValidator(nil), rules, nil, "maybe"); err == nil {
+		t.Fatal("expected error for unknown default action")
+	}
+}
@@ -3,25 +3,23 @@ package validation
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
+	"unicode/utf8"
 )
 
 var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[1-5][0-9a-fA-F]{3}-[89abAB][0-9a-fA-F]{3}-[0-9a-fA-F]{12}$`)
 
-// Error represents one schema validation failure.
-type Error struct {
-	Path    string `json:"path"`
-	Message string `json:"message"`
-}
-
-// EventValidator validates telemetry payloads against the v0 event schema.
+// EventValidator validates telemetry payloads against one event schema document.
 type EventValidator struct {
 	schema map[string]any
+	root   *schemaNode
 }
 
 // NewEventValidator loads and parses a JSON schema file.
@@ -36,22 +34,36 @@ func NewEventValidator(schemaPath string) (*EventValidator, error) {
 		return nil, fmt.Errorf("read schema: %w", err)
 	}
 
+	return parseEventValidator(raw)
+}
+
+func parseEventValidator(raw []byte) (*EventValidator, error) {
 	var schema map[string]any
 	if err := json.Unmarshal(raw, &schema); err != nil {
 		return nil, fmt.Errorf("parse schema json: %w", err)
 	}
 
-	return &EventValidator{schema: schema}, nil
+	root, err := compileSchema(schema)
+	if err != nil {
+		return nil, fmt.Errorf("compile schema: %w", err)
+	}
+
+	return &EventValidator{schema: schema, root: root}, nil
 }
 
 // Validate returns all schema violations for a decoded JSON payload.
 func (v *EventValidator) Validate(payload any) []Error {
 	if v == nil {
-		return []Error{{Path: "$", Message: "validator is not configured"}}
+		return []Error{{Path: "$", Code: CodeNotConfigured, Message: "validator is not configured"}}
 	}
 
+	// Most events are valid, so try the allocation-free check first and only
+	// walk again collecting every error when it fails.
 	errList := make([]Error, 0)
-	validateNode(v.schema, payload, "$", &errList)
+	if v.root.validate(&evaluation{}, payload, "$") {
+		return errList
+	}
+	v.root.validate(&evaluation{errs: &errList}, payload, "$")
 	return errList
 }
 
@@ -70,7 +82,7 @@ func resolveSchemaPath(schemaPath string) (string, error) {
 	}
 
 	for _, candidate := range candidates {
-		if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+		if _, err := os.Stat(candidate); err == nil {
 			abs, err := filepath.Abs(candidate)
 			if err != nil {
 				return "", err
@@ -79,176 +91,462 @@ func resolveSchemaPath(schemaPath string) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("schema file not found from path %q", schemaPath)
+	return "", fmt.Errorf("schema not found from path %q", schemaPath)
+}
+
+// maxSchemaDepth bounds nested schema evaluation so cyclic $refs fail instead of overflowing the stack.
+const maxSchemaDepth = 256
+
+// evaluation carries per-payload state. With errs nil it only answers whether
+// the value is valid and stops at the first failure without building paths.
+type evaluation struct {
+	errs  *[]Error
+	depth int
 }
 
-func validateNode(schema map[string]any, value any, path string, errs *[]Error) {
-	if schema == nil {
-		return
+func (e *evaluation) collecting() bool {
+	return e.errs != nil
+}
+
+// fail records v for the instance value at path. The returned Error is only
+// valid until the next failure and is nil when e is not collecting.
+func (e *evaluation) fail(path string, v violation, value any) *Error {
+	if e.errs == nil {
+		return nil
+	}
+	*e.errs = append(*e.errs, Error{
+		Path:            path,
+		Code:            v.code,
+		Message:         v.message,
+		KeywordLocation: v.keyword,
+		Value:           encodeValue(value),
+	})
+	return &(*e.errs)[len(*e.errs)-1]
+}
+
+func (e *evaluation) child(parent string, field string) string {
+	if e.errs == nil {
+		return ""
+	}
+	return childPath(parent, field)
+}
+
+func (e *evaluation) index(parent string, idx int) string {
+	if e.errs == nil {
+		return ""
 	}
+	return indexPath(parent, idx)
+}
+
+// matches checks value against node without recording errors.
+func (e *evaluation) matches(node *schemaNode, value any) bool {
+	check := evaluation{depth: e.depth}
+	return node.validate(&check, value, "")
+}
 
-	if !matchesType(schema["type"], value) {
-		if typeSpec, ok := schema["type"]; ok {
-			addErr(errs, path, fmt.Sprintf("must be type %s", typeDescription(typeSpec)))
-			return
+// validate reports whether value satisfies the node, recording failures on e.
+func (n *schemaNode) validate(e *evaluation, value any, path string) bool {
+	if n.reject {
+		e.fail(path, n.at("", CodeNotAllowed, "is not allowed"), value)
+		return false
+	}
+
+	e.depth++
+	defer func() { e.depth-- }()
+	if e.depth > maxSchemaDepth {
+		e.fail(path, n.at("", CodeSchemaTooDeep, "schema nesting is too deep"), missingValue{})
+		return false
+	}
+
+	valid := true
+	if n.ref != nil && !n.ref.validate(e, value, path) {
+		if !e.collecting() {
+			return false
 		}
+		valid = false
 	}
 
-	if enumVals, ok := toSlice(schema["enum"]); ok && !valueInEnum(value, enumVals) {
-		addErr(errs, path, "must be one of allowed enum values")
+	if n.types != 0 && !matchesTypeMask(n.types, value) {
+		e.fail(path, n.typeErr, value)
+		return false
+	}
+
+	if n.enum != nil && !n.enum.contains(value) {
+		if !e.collecting() {
+			return false
+		}
+		if err := e.fail(path, n.enumErr, value); err != nil {
+			err.AllowedValues = n.enumValues
+		}
+		valid = false
+	}
+	if n.hasConst && !equalJSONValue(value, n.constVal) {
+		if !e.collecting() {
+			return false
+		}
+		if err := e.fail(path, n.constErr, value); err != nil {
+			err.AllowedValues = []any{n.constVal}
+		}
+		valid = false
 	}
 
-	if constVal, ok := schema["const"]; ok && !equalJSONValue(value, constVal) {
-		addErr(errs, path, fmt.Sprintf("must equal %v", constVal))
+	switch v := value.(type) {
+	case string:
+		if n.hasString && !n.validateString(e, v, path) {
+			valid = false
+		}
+	case []any:
+		if n.hasArray && !n.validateArray(e, v, path) {
+			valid = false
+		}
+	case map[string]any:
+		if n.hasObject && !n.validateObject(e, v, path) {
+			valid = false
+		}
+	default:
+		if n.hasNumber {
+			if num, isNum := toFloat(value); isNum && !n.validateNumber(e, num, path) {
+				valid = false
+			}
+		}
+	}
+	if !valid && !e.collecting() {
+		return false
 	}
 
-	if minRaw, ok := toFloat(schema["minimum"]); ok {
-		num, numOK := toFloat(value)
-		if !numOK || num < minRaw {
-			addErr(errs, path, fmt.Sprintf("must be >= %s", trimFloat(minRaw)))
+	return n.validateComposition(e, value, path) && valid
+}
+
+func (n *schemaNode) validateNumber(e *evaluation, num float64, path string) bool {
+	valid := true
+	for _, bound := range n.numberBounds {
+		if !bound.check(num, bound.limit) {
+			if !e.collecting() {
+				return false
+			}
+			e.fail(path, bound.err, num)
+			valid = false
 		}
 	}
+	return valid
+}
 
-	if minLength, ok := toInt(schema["minLength"]); ok {
-		str, ok := value.(string)
-		if !ok || len(str) < minLength {
-			addErr(errs, path, fmt.Sprintf("must have length >= %d", minLength))
+func (n *schemaNode) validateString(e *evaluation, str string, path string) bool {
+	valid := true
+	fail := func(v violation) bool {
+		e.fail(path, v, str)
+		valid = false
+		return e.collecting()
+	}
+
+	if n.minLength >= 0 || n.maxLength >= 0 {
+		length := utf8.RuneCountInString(str)
+		if n.minLength >= 0 && length < n.minLength && !fail(n.minLengthErr) {
+			return false
+		}
+		if n.maxLength >= 0 && length > n.maxLength && !fail(n.maxLengthErr) {
+			return false
 		}
 	}
+	if n.pattern != nil && !n.pattern.MatchString(str) && !fail(n.patternErr) {
+		return false
+	}
+	if n.format != nil && !n.format(str) && !fail(n.formatErr) {
+		return false
+	}
+	return valid
+}
 
-	if format, ok := schema["format"].(string); ok {
-		validateFormat(format, value, path, errs)
+func (n *schemaNode) validateArray(e *evaluation, items []any, path string) bool {
+	valid := true
+
+	for idx := 0; idx < len(n.prefixItems) && idx < len(items); idx++ {
+		if !n.prefixItems[idx].validate(e, items[idx], e.index(path, idx)) {
+			if !e.collecting() {
+				return false
+			}
+			valid = false
+		}
 	}
 
-	obj, isObj := value.(map[string]any)
-	if isObj {
-		if req, ok := toStringSlice(schema["required"]); ok {
-			for _, key := range req {
-				if _, found := obj[key]; !found {
-					addErr(errs, childPath(path, key), "is required")
+	if n.items != nil {
+		for idx := len(n.prefixItems); idx < len(items); idx++ {
+			if !n.items.validate(e, items[idx], e.index(path, idx)) {
+				if !e.collecting() {
+					return false
 				}
+				valid = false
 			}
 		}
+	}
 
-		if props, ok := toMap(schema["properties"]); ok {
-			for key, val := range obj {
-				if propSchema, found := toMap(props[key]); found {
-					validateNode(propSchema, val, childPath(path, key), errs)
-					continue
+	if n.minItems >= 0 && len(items) < n.minItems {
+		if !e.collecting() {
+			return false
+		}
+		e.fail(path, n.minItemsErr, items)
+		valid = false
+	}
+	if n.maxItems >= 0 && len(items) > n.maxItems {
+		if !e.collecting() {
+			return false
+		}
+		e.fail(path, n.maxItemsErr, items)
+		valid = false
+	}
+
+	if n.uniqueItems {
+		for i := 0; i < len(items); i++ {
+			for j := i + 1; j < len(items); j++ {
+				if equalJSONValue(items[i], items[j]) {
+					if !e.collecting() {
+						return false
+					}
+					e.fail(indexPath(path, j), n.at("uniqueItems", CodeDuplicateItem, fmt.Sprintf("duplicates item %d", i)), items[j])
+					valid = false
 				}
-
-				handleAdditionalProperties(schema["additionalProperties"], val, childPath(path, key), errs)
 			}
 		}
 	}
 
-	if allOfItems, ok := toSlice(schema["allOf"]); ok {
-		for _, item := range allOfItems {
-			itemMap, ok := toMap(item)
-			if !ok {
-				continue
+	return valid
+}
+
+func (n *schemaNode) validateObject(e *evaluation, obj map[string]any, path string) bool {
+	valid := true
+
+	for _, key := range n.required {
+		if _, found := obj[key]; !found {
+			if !e.collecting() {
+				return false
 			}
+			e.fail(childPath(path, key), n.at("required", CodeRequired, "is required"), missingValue{})
+			valid = false
+		}
+	}
 
-			ifSchema, hasIf := toMap(itemMap["if"])
-			thenSchema, hasThen := toMap(itemMap["then"])
-			if !hasThen {
-				continue
+	for _, dep := range n.dependentRequired {
+		if _, present := obj[dep.trigger]; !present {
+			continue
+		}
+		for _, key := range dep.fields {
+			if _, found := obj[key]; !found {
+				if !e.collecting() {
+					return false
+				}
+				e.fail(childPath(path, key), dep.err, missingValue{})
+				valid = false
 			}
+		}
+	}
+
+	if n.properties == nil && len(n.patternProperties) == 0 && n.additional == nil && n.propertyNames == nil {
+		return valid
+	}
 
-			if !hasIf || matches(ifSchema, value) {
-				validateNode(thenSchema, value, path, errs)
+	// Errors are reported in key order; the check-only pass skips the sort.
+	if e.collecting() {
+		for _, key := range sortedKeys(obj) {
+			if !n.validateProperty(e, key, obj[key], path) {
+				valid = false
 			}
 		}
+		return valid
 	}
+	for key, val := range obj {
+		if !n.validateProperty(e, key, val, path) {
+			return false
+		}
+	}
+	return valid
 }
 
-func matches(schema map[string]any, value any) bool {
-	errList := make([]Error, 0)
-	validateNode(schema, value, "$", &errList)
-	return len(errList) == 0
-}
+func (n *schemaNode) validateProperty(e *evaluation, key string, val any, path string) bool {
+	keyPath := e.child(path, key)
+	valid := true
+	matched := false
 
-func validateFormat(format string, value any, path string, errs *[]Error) {
-	str, ok := value.(string)
-	if !ok {
-		addErr(errs, path, fmt.Sprintf("must match %s format", format))
-		return
+	if prop, found := n.properties[key]; found {
+		matched = true
+		if !prop.validate(e, val, keyPath) {
+			if !e.collecting() {
+				return false
+			}
+			valid = false
+		}
 	}
 
-	switch format {
-	case "date-time":
-		if _, err := time.Parse(time.RFC3339, str); err != nil {
-			addErr(errs, path, "must be RFC3339 date-time")
+	for _, pp := range n.patternProperties {
+		if !pp.re.MatchString(key) {
+			continue
 		}
-	case "uuid":
-		if !uuidPattern.MatchString(str) {
-			addErr(errs, path, "must be a valid UUID")
+		matched = true
+		if !pp.node.validate(e, val, keyPath) {
+			if !e.collecting() {
+				return false
+			}
+			valid = false
 		}
 	}
+
+	if !matched && n.additional != nil {
+		if n.additional.reject {
+			if !e.collecting() {
+				return false
+			}
+			e.fail(keyPath, n.at("additionalProperties", CodeAdditionalProperty, "additional property is not allowed"), val)
+			valid = false
+		} else if !n.additional.validate(e, val, keyPath) {
+			if !e.collecting() {
+				return false
+			}
+			valid = false
+		}
+	}
+
+	if n.propertyNames != nil && !e.matches(n.propertyNames, key) {
+		if !e.collecting() {
+			return false
+		}
+		e.fail(keyPath, n.at("propertyNames", CodeInvalidPropertyName, "property name is not allowed"), key)
+		valid = false
+	}
+
+	return valid
 }
 
-func handleAdditionalProperties(additional any, value any, path string, errs *[]Error) {
-	if additional == nil {
-		return
+func (n *schemaNode) validateComposition(e *evaluation, value any, path string) bool {
+	valid := true
+
+	for _, item := range n.allOf {
+		if !item.validate(e, value, path) {
+			if !e.collecting() {
+				return false
+			}
+			valid = false
+		}
 	}
 
-	if allowed, ok := additional.(bool); ok {
-		if !allowed {
-			addErr(errs, path, "additional property is not allowed")
+	if len(n.anyOf) > 0 {
+		matchedAny := false
+		for _, item := range n.anyOf {
+			if e.matches(item, value) {
+				matchedAny = true
+				break
+			}
+		}
+		if !matchedAny {
+			if !e.collecting() {
+				return false
+			}
+			e.fail(path, n.at("anyOf", CodeAnyOfMismatch, "must match at least one schema in anyOf"), value)
+			valid = false
 		}
-		return
 	}
 
-	if schema, ok := toMap(additional); ok {
-		validateNode(schema, value, path, errs)
+	if len(n.oneOf) > 0 {
+		matchCount := 0
+		for _, item := range n.oneOf {
+			if e.matches(item, value) {
+				matchCount++
+			}
+		}
+		if matchCount != 1 {
+			if !e.collecting() {
+				return false
+			}
+			e.fail(path, n.at("oneOf", CodeOneOfMismatch, fmt.Sprintf("must match exactly one schema in oneOf (matched %d)", matchCount)), value)
+			valid = false
+		}
+	}
+
+	if n.not != nil && e.matches(n.not, value) {
+		if !e.collecting() {
+			return false
+		}
+		e.fail(path, n.at("not", CodeNotMismatch, "must not match schema in not"), value)
+		valid = false
 	}
+
+	if n.ifNode != nil {
+		branch := n.elseNode
+		if e.matches(n.ifNode, value) {
+			branch = n.thenNode
+		}
+		if branch != nil && !branch.validate(e, value, path) {
+			valid = false
+		}
+	}
+
+	return valid
 }
 
-func matchesType(typeSpec any, value any) bool {
-	if typeSpec == nil {
-		return true
+// resolveRef resolves document-local references ("#", "#/$defs/name", or the
+// same pointers prefixed with the root $id) to a subschema.
+func resolveRef(root map[string]any, ref string) (any, bool) {
+	if id, ok := root["$id"].(string); ok && id != "" {
+		ref = strings.TrimPrefix(ref, id)
+	}
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
 	}
 
-	switch t := typeSpec.(type) {
-	case string:
-		return matchesSingleType(t, value)
-	case []any:
-		for _, raw := range t {
-			name, ok := raw.(string)
-			if ok && matchesSingleType(name, value) {
-				return true
+	pointer, err := url.PathUnescape(strings.TrimPrefix(ref, "#"))
+	if err != nil {
+		return nil, false
+	}
+	if pointer == "" {
+		return root, true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+
+	var current any = root
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := current.(type) {
+		case map[string]any:
+			next, found := node[token]
+			if !found {
+				return nil, false
 			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
 		}
-		return false
-	default:
-		return true
 	}
+
+	return current, true
 }
 
-func matchesSingleType(typeName string, value any) bool {
-	switch typeName {
-	case "object":
-		_, ok := value.(map[string]any)
-		return ok
-	case "string":
-		_, ok := value.(string)
-		return ok
-	case "integer":
-		return isInteger(value)
-	case "number":
-		_, ok := toFloat(value)
-		return ok
-	case "boolean":
-		_, ok := value.(bool)
-		return ok
-	case "null":
-		return value == nil
-	case "array":
-		_, ok := value.([]any)
-		return ok
-	default:
+func matchesTypeMask(mask typeMask, value any) bool {
+	if mask&typeUnknown != 0 {
 		return true
 	}
+
+	switch value.(type) {
+	case map[string]any:
+		return mask&typeObject != 0
+	case []any:
+		return mask&typeArray != 0
+	case string:
+		return mask&typeString != 0
+	case bool:
+		return mask&typeBoolean != 0
+	case nil:
+		return mask&typeNull != 0
+	}
+	if _, isNum := toFloat(value); isNum {
+		return mask&typeNumber != 0 || (mask&typeInteger != 0 && isInteger(value))
+	}
+	return false
 }
 
 func isInteger(value any) bool {
@@ -258,17 +556,26 @@ func isInteger(value any) bool {
 	case uint, uint8, uint16, uint32, uint64:
 		return true
 	case float64:
-		return n == float64(int64(n))
+		return isIntegralFloat(n)
 	case float32:
-		return float64(n) == float64(int64(n))
+		return isIntegralFloat(float64(n))
 	case json.Number:
-		_, err := n.Int64()
-		return err == nil
+		if _, err := n.Int64(); err == nil {
+			return true
+		}
+		f, err := n.Float64()
+		return err == nil && isIntegralFloat(f)
 	default:
 		return false
 	}
 }
 
+// isIntegralFloat accepts whole numbers such as 1500.0 within the int64 range,
+// matching what the postgres store can write to BIGINT columns.
+func isIntegralFloat(f float64) bool {
+	return f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+}
+
 func valueInEnum(value any, enumValues []any) bool {
 	for _, allowed := range enumValues {
 		if equalJSONValue(value, allowed) {
@@ -278,13 +585,48 @@ func valueInEnum(value any, enumValues []any) bool {
 	return false
 }
 
+// equalJSONValue compares decoded JSON values structurally; numbers compare by value.
 func equalJSONValue(a, b any) bool {
 	if fa, ok := toFloat(a); ok {
-		if fb, ok := toFloat(b); ok {
-			return fa == fb
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equalJSONValue(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, aval := range av {
+			bval, found := bv[key]
+			if !found || !equalJSONValue(aval, bval) {
+				return false
+			}
 		}
+		return true
+	default:
+		return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
 	}
-	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
 }
 
 func toMap(v any) (map[string]any, bool) {
@@ -353,19 +695,22 @@ func toFloat(v any) (float64, bool) {
 			return 0, false
 		}
 		return f, true
-	case string:
-		f, err := strconv.ParseFloat(n, 64)
-		if err != nil {
-			return 0, false
-		}
-		return f, true
 	default:
 		return 0, false
 	}
 }
 
-func addErr(errs *[]Error, path string, message string) {
-	*errs = append(*errs, Error{Path: path, Message: message})
+func indexPath(parent string, idx int) string {
+	return fmt.Sprintf("%s[%d]", parent, idx)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func childPath(parent string, field string) string {
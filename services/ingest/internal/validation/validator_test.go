@@ -1,6 +1,10 @@
 package validation
 
 import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -145,6 +149,106 @@ func TestValidateAppliesConditionalRequirements(t *testing.T) {
 	}
 }
 
+// suiteCase mirrors one entry of a JSON-Schema-Test-Suite fixture file.
+type suiteCase struct {
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema"`
+	Tests       []struct {
+		Description string          `json:"description"`
+		Data        json.RawMessage `json:"data"`
+		Valid       bool            `json:"valid"`
+	} `json:"tests"`
+}
+
+func TestValidateJSONSchemaTestSuite(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "draft2020-12", "*.json"))
+	if err != nil {
+		t.Fatalf("glob fixtures: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no draft2020-12 fixtures found")
+	}
+
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+
+		var cases []suiteCase
+		if err := json.Unmarshal(raw, &cases); err != nil {
+			t.Fatalf("parse %s: %v", file, err)
+		}
+
+		keyword := strings.TrimSuffix(filepath.Base(file), ".json")
+		for _, tc := range cases {
+			// Schemas are decoded the way NewEventValidator loads them and
+			// instances the way the HTTP handler decodes request bodies.
+			var schema any
+			if err := json.Unmarshal(tc.Schema, &schema); err != nil {
+				t.Fatalf("%s/%s: parse schema: %v", keyword, tc.Description, err)
+			}
+			root, err := compileSchema(schema)
+			if err != nil {
+				t.Fatalf("%s/%s: compile schema: %v", keyword, tc.Description, err)
+			}
+
+			for _, test := range tc.Tests {
+				dec := json.NewDecoder(bytes.NewReader(test.Data))
+				dec.UseNumber()
+				var data any
+				if err := dec.Decode(&data); err != nil {
+					t.Fatalf("%s/%s/%s: parse data: %v", keyword, tc.Description, test.Description, err)
+				}
+
+				// Both evaluation modes must agree with the suite.
+				errList := make([]Error, 0)
+				root.validate(&evaluation{errs: &errList}, data, "$")
+				if got := len(errList) == 0; got != test.Valid {
+					t.Errorf("%s/%s/%s: valid = %v, want %v (errors %v)", keyword, tc.Description, test.Description, got, test.Valid, errList)
+				}
+				if got := root.validate(&evaluation{}, data, "$"); got != test.Valid {
+					t.Errorf("%s/%s/%s: check-only valid = %v, want %v", keyword, tc.Description, test.Description, got, test.Valid)
+				}
+			}
+		}
+	}
+}
+
+func TestNewEventValidatorRejectsUncompilableSchema(t *testing.T) {
+	tests := map[string]string{
+		"invalid pattern":    `{"properties":{"name":{"type":"string","pattern":"(unclosed"}}}`,
+		"unresolvable $ref":  `{"properties":{"name":{"$ref":"#/$defs/missing"}}}`,
+		"invalid patternKey": `{"patternProperties":{"[":{}}}`,
+	}
+	for name, doc := range tests {
+		path := filepath.Join(t.TempDir(), "schema.json")
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatalf("write schema: %v", err)
+		}
+		if _, err := NewEventValidator(path); err == nil {
+			t.Fatalf("%s: expected compile error", name)
+		}
+	}
+}
+
+func TestValidateSupportsRecursiveRefs(t *testing.T) {
+	root, err := compileSchema(map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"child": map[string]any{"$ref": "#"}, "name": map[string]any{"type": "string"}},
+	})
+	if err != nil {
+		t.Fatalf("compileSchema() error = %v", err)
+	}
+
+	payload := map[string]any{"child": map[string]any{"child": map[string]any{"name": 1}}}
+	errList := make([]Error, 0)
+	root.validate(&evaluation{errs: &errList}, payload, "$")
+	if !containsPath(errList, "$.child.child.name") {
+		t.Fatalf("errors = %v, want nested recursive error", errList)
+	}
+}
+
 func mustLoadRepoSchemaValidator(t *testing.T) *EventValidator {
 	t.Helper()
 
@@ -170,3 +274,137 @@ func containsPath(errList []Error, target string) bool {
 	}
 	return false
 }
+
+const benchmarkEventJSON = `{
+	"event_version": "v0",
+	"event_id": "123e4567-e89b-12d3-a456-426614174000",
+	"event_type": "model.call.completed",
+	"occurred_at": "2026-02-07T21:00:03Z",
+	"tenant": {"tenant_id": "tenant-1", "workspace_id": "workspace-1", "project_id": "project-1"},
+	"run": {"run_id": "run-1", "agent_id": "agent-1", "workflow_id": "workflow-1", "status": "started"},
+	"step": {"step_id": "step-1", "step_type": "prompt", "status": "success", "latency_ms": 812},
+	"model_call": {"model_call_id": "mc-1", "provider": "openai", "model": "gpt-4.1-mini", "temperature": 0.2},
+	"resource_usage": {"input_tokens": 1200, "output_tokens": 300, "total_tokens": 1500},
+	"cost": {"cost_usd": 0.0042, "currency": "USD", "price_book_version": "2026-02"},
+	"trace": {"trace_id": "trace-1", "span_id": "span-3", "parent_span_id": "span-2"},
+	"attributes": {"region": "us-east-1", "retry": 0, "cached": false}
+}`
+
+func decodeBenchmarkEvent(b *testing.B, raw string) any {
+	b.Helper()
+
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var payload any
+	if err := dec.Decode(&payload); err != nil {
+		b.Fatalf("decode benchmark event: %v", err)
+	}
+	return payload
+}
+
+func loadBenchmarkValidator(b *testing.B) *EventValidator {
+	b.Helper()
+
+	validator, err := NewEventValidator(filepath.Join("..", "..", "..", "..", "packages", "schemas", "agent-event-v0.schema.json"))
+	if err != nil {
+		b.Fatalf("NewEventValidator() error = %v", err)
+	}
+	return validator
+}
+
+// BenchmarkValidateValidEvent covers the common path: the compiled tree
+// should validate a valid event without allocating. testdata/validate_bench.txt
+// records both benchmarks against the walker that re-read the raw schema map
+// per event, run back to back on one machine: the valid event went from about
+// 67µs and 283 allocs/op to about 7µs and none, the invalid one from about
+// 64µs and 285 allocs/op to about 16µs and 54.
+func BenchmarkValidateValidEvent(b *testing.B) {
+	validator := loadBenchmarkValidator(b)
+	payload := decodeBenchmarkEvent(b, benchmarkEventJSON)
+	if errList := validator.Validate(payload); len(errList) != 0 {
+		b.Fatalf("benchmark event is invalid: %v", errList)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		validator.Validate(payload)
+	}
+}
+
+func BenchmarkValidateInvalidEvent(b *testing.B) {
+	validator := loadBenchmarkValidator(b)
+	raw := strings.Replace(benchmarkEventJSON, `"provider": "openai", `, "", 1)
+	raw = strings.Replace(raw, `"status": "success"`, `"status": "done"`, 1)
+	payload := decodeBenchmarkEvent(b, raw)
+	if errList := validator.Validate(payload); len(errList) != 2 {
+		b.Fatalf("benchmark event errors = %v, want 2", errList)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		validator.Validate(payload)
+	}
+}
+
+func TestValidateReportsStableErrorDetails(t *testing.T) {
+	validator := mustLoadRepoSchemaValidator(t)
+
+	payload := map[string]any{
+		"event_version": "v0",
+		"event_id":      "not-a-uuid",
+		"event_type":    "run.exploded",
+		"occurred_at":   "2026-02-07T21:00:00Z",
+		"tenant": map[string]any{
+			"tenant_id":  "tenant-1",
+			"project_id": "project-1",
+		},
+		"run": map[string]any{
+			"run_id":      "run-1",
+			"agent_id":    "agent-1",
+			"workflow_id": "workflow-1",
+			"status":      "started",
+		},
+		"trace": map[string]any{
+			"trace_id": "trace-1",
+			"span_id":  "span-1",
+		},
+	}
+
+	byPath := map[string]Error{}
+	for _, err := range validator.Validate(payload) {
+		byPath[err.Path] = err
+	}
+
+	eventID := byPath["$.event_id"]
+	if eventID.Code != CodeFormatUUID || eventID.KeywordLocation != "#/properties/event_id/format" || string(eventID.Value) != `"not-a-uuid"` {
+		t.Fatalf("event_id error = %+v, want format_uuid at #/properties/event_id/format", eventID)
+	}
+
+	eventType := byPath["$.event_type"]
+	if eventType.Code != CodeEnumMismatch || eventType.KeywordLocation != "#/properties/event_type/enum" || string(eventType.Value) != `"run.exploded"` {
+		t.Fatalf("event_type error = %+v, want enum_mismatch at #/properties/event_type/enum", eventType)
+	}
+	if len(eventType.AllowedValues) == 0 || eventType.AllowedValues[0] != "run.started" {
+		t.Fatalf("event_type allowed values = %v, want schema enum", eventType.AllowedValues)
+	}
+
+	workspace := byPath["$.tenant.workspace_id"]
+	if workspace.Code != CodeRequired || !strings.HasSuffix(workspace.KeywordLocation, "/required") || workspace.Value != nil {
+		t.Fatalf("workspace_id error = %+v, want required without value", workspace)
+	}
+}
+
+func TestIsIntegerMatchesBigintRange(t *testing.T) {
+	for _, value := range []any{1500, 1500.0, json.Number("1500.0"), json.Number("1.5e3"), json.Number("-9223372036854775808")} {
+		if !isInteger(value) {
+			t.Fatalf("isInteger(%v) = false, want true", value)
+		}
+	}
+	for _, value := range []any{1500.5, json.Number("1500.5"), json.Number("1e19"), 1e19, math.Inf(1)} {
+		if isInteger(value) {
+			t.Fatalf("isInteger(%v) = true, want false", value)
+		}
+	}
+}
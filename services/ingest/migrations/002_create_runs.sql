@@ -0,0 +1,107 @@
+-- One row per run, maintained by the ingest insert statements from run, step,
+-- model call and tool call events. Dashboards read this instead of agent_events.
+-- run_id is caller-supplied and only unique within a tenant.
+CREATE TABLE IF NOT EXISTS runs (
+  tenant_id TEXT NOT NULL,
+  run_id TEXT NOT NULL,
+  workspace_id TEXT NOT NULL,
+  project_id TEXT NOT NULL,
+  agent_id TEXT NOT NULL,
+  workflow_id TEXT NOT NULL,
+  workflow_version TEXT NULL,
+  prompt_version TEXT NULL,
+  status TEXT NOT NULL,
+  error_type TEXT NULL,
+  started_at TIMESTAMPTZ NULL,
+  ended_at TIMESTAMPTZ NULL,
+  -- latency_ms reported on the terminal run event, if any.
+  reported_latency_ms BIGINT NULL,
+  latency_ms BIGINT GENERATED ALWAYS AS (
+    COALESCE(reported_latency_ms, (EXTRACT(EPOCH FROM (ended_at - started_at)) * 1000)::BIGINT)
+  ) STORED,
+  -- Totals reported on the terminal run event win over the sum of model and tool call events.
+  reported_tokens BIGINT NULL,
+  reported_cost_usd NUMERIC(18, 6) NULL,
+  call_tokens BIGINT NOT NULL DEFAULT 0,
+  call_cost_usd NUMERIC(18, 6) NOT NULL DEFAULT 0,
+  total_tokens BIGINT GENERATED ALWAYS AS (COALESCE(reported_tokens, call_tokens)) STORED,
+  total_cost_usd NUMERIC(18, 6) GENERATED ALWAYS AS (COALESCE(reported_cost_usd, call_cost_usd)) STORED,
+  step_count INTEGER NOT NULL DEFAULT 0,
+  model_call_count INTEGER NOT NULL DEFAULT 0,
+  tool_call_count INTEGER NOT NULL DEFAULT 0,
+  first_event_at TIMESTAMPTZ NOT NULL,
+  last_event_at TIMESTAMPTZ NOT NULL,
+  -- occurred_at of the latest run.completed/run.failed, so late or repeated terminal events never regress status.
+  terminal_event_at TIMESTAMPTZ NULL,
+  -- ended_at before the latest update, so the rollups can re-aggregate the hour a run moved out of.
+  previous_ended_at TIMESTAMPTZ NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (tenant_id, run_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_runs_tenant_ended_at
+  ON runs (tenant_id, ended_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_runs_workspace_ended_at
+  ON runs (workspace_id, ended_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_runs_project_ended_at
+  ON runs (project_id, ended_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_runs_ended_at
+  ON runs (ended_at DESC);
+
+-- Backfill from events ingested before this table existed.
+INSERT INTO runs (
+  tenant_id, run_id, workspace_id, project_id, agent_id, workflow_id,
+  workflow_version, prompt_version, status, error_type, started_at, ended_at,
+  reported_latency_ms, reported_tokens, reported_cost_usd, call_tokens, call_cost_usd,
+  step_count, model_call_count, tool_call_count, first_event_at, last_event_at, terminal_event_at
+)
+SELECT
+  tenant_id,
+  run_id,
+  MIN(workspace_id),
+  MIN(project_id),
+  MIN(agent_id),
+  MIN(workflow_id),
+  (ARRAY_AGG(payload->'run'->>'workflow_version' ORDER BY occurred_at DESC)
+    FILTER (WHERE payload->'run'->>'workflow_version' IS NOT NULL))[1],
+  (ARRAY_AGG(payload->'run'->>'prompt_version' ORDER BY occurred_at DESC)
+    FILTER (WHERE payload->'run'->>'prompt_version' IS NOT NULL))[1],
+  COALESCE((ARRAY_AGG(
+    CASE
+      WHEN run_status IN ('success', 'failure', 'cancelled') THEN run_status
+      WHEN event_type = 'run.failed' THEN 'failure'
+      ELSE 'success'
+    END ORDER BY occurred_at DESC) FILTER (WHERE event_type IN ('run.completed', 'run.failed')))[1], 'started'),
+  COALESCE(
+    (ARRAY_AGG(error_type ORDER BY occurred_at DESC) FILTER (WHERE event_type = 'run.failed' AND error_type IS NOT NULL))[1],
+    (ARRAY_AGG(error_type ORDER BY occurred_at) FILTER (WHERE error_type IS NOT NULL))[1]
+  ),
+  LEAST(
+    MIN((payload->'run'->>'started_at')::TIMESTAMPTZ),
+    MIN(occurred_at) FILTER (WHERE event_type = 'run.started')
+  ),
+  MAX(COALESCE((payload->'run'->>'ended_at')::TIMESTAMPTZ, occurred_at)) FILTER (WHERE event_type IN ('run.completed', 'run.failed')),
+  (ARRAY_AGG((payload->'run'->>'latency_ms')::NUMERIC::BIGINT ORDER BY occurred_at DESC)
+    FILTER (WHERE event_type IN ('run.completed', 'run.failed') AND payload->'run'->>'latency_ms' IS NOT NULL))[1],
+  (ARRAY_AGG(total_tokens ORDER BY occurred_at DESC)
+    FILTER (WHERE event_type IN ('run.completed', 'run.failed') AND total_tokens IS NOT NULL))[1],
+  (ARRAY_AGG(cost_usd ORDER BY occurred_at DESC)
+    FILTER (WHERE event_type IN ('run.completed', 'run.failed') AND cost_usd IS NOT NULL))[1],
+  COALESCE(SUM(total_tokens) FILTER (WHERE event_type LIKE 'model.call.%' OR event_type LIKE 'tool.call.%'), 0),
+  COALESCE(SUM(cost_usd) FILTER (WHERE event_type LIKE 'model.call.%' OR event_type LIKE 'tool.call.%'), 0),
+  COUNT(*) FILTER (WHERE event_type IN ('step.completed', 'step.failed')),
+  COUNT(*) FILTER (WHERE event_type IN ('model.call.completed', 'model.call.failed')),
+  COUNT(*) FILTER (WHERE event_type IN ('tool.call.completed', 'tool.call.failed')),
+  MIN(occurred_at),
+  MAX(occurred_at),
+  MAX(occurred_at) FILTER (WHERE event_type IN ('run.completed', 'run.failed'))
+FROM agent_events
+WHERE event_type LIKE 'run.%'
+   OR event_type LIKE 'step.%'
+   OR event_type LIKE 'model.call.%'
+   OR event_type LIKE 'tool.call.%'
+GROUP BY tenant_id, run_id
+ON CONFLICT (tenant_id, run_id) DO NOTHING;
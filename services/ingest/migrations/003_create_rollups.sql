@@ -0,0 +1,76 @@
+-- Hourly and daily aggregates maintained by the rollup aggregator. One row per
+-- bucket, kind and dimension key: kind 'run' rolls up the runs table by
+-- ended_at, 'step' and 'model_call' roll up completed/failed events by
+-- occurred_at. provider and model are '' except for model_call rows.
+-- latency_histogram holds per-bucket counts for the bounds in
+-- internal/persistence/postgres/rollups.go (latencyBoundsMS), plus an overflow bucket.
+CREATE TABLE IF NOT EXISTS rollups_hourly (
+  bucket_start TIMESTAMPTZ NOT NULL,
+  kind TEXT NOT NULL,
+  tenant_id TEXT NOT NULL,
+  workspace_id TEXT NOT NULL,
+  project_id TEXT NOT NULL,
+  agent_id TEXT NOT NULL,
+  workflow_id TEXT NOT NULL,
+  provider TEXT NOT NULL DEFAULT '',
+  model TEXT NOT NULL DEFAULT '',
+  total_count BIGINT NOT NULL,
+  success_count BIGINT NOT NULL,
+  failure_count BIGINT NOT NULL,
+  cost_usd NUMERIC(18, 6) NOT NULL,
+  total_tokens BIGINT NOT NULL,
+  latency_sum_ms BIGINT NOT NULL,
+  latency_count BIGINT NOT NULL,
+  latency_histogram BIGINT[] NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (bucket_start, kind, tenant_id, workspace_id, project_id, agent_id, workflow_id, provider, model)
+);
+
+CREATE TABLE IF NOT EXISTS rollups_daily (LIKE rollups_hourly INCLUDING ALL);
+
+CREATE INDEX IF NOT EXISTS idx_rollups_hourly_tenant_bucket
+  ON rollups_hourly (tenant_id, bucket_start);
+
+CREATE INDEX IF NOT EXISTS idx_rollups_daily_tenant_bucket
+  ON rollups_daily (tenant_id, bucket_start);
+
+-- Rows ingested at or before watermark are reflected in the rollups.
+CREATE TABLE IF NOT EXISTS rollup_watermarks (
+  name TEXT PRIMARY KEY,
+  watermark TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Hours whose rollups went stale without a row in them being ingested or
+-- updated: the previous ended_at hour of runs whose ended_at moved. The ingest
+-- statements mark them and the aggregator clears them once recomputed.
+CREATE TABLE IF NOT EXISTS rollup_dirty_hours (
+  hour_start TIMESTAMPTZ PRIMARY KEY,
+  marked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rollup_dirty_hours_marked_at
+  ON rollup_dirty_hours (marked_at);
+
+-- agent_events has no index on ingested_at, which the aggregator scans from its watermark.
+CREATE INDEX IF NOT EXISTS idx_agent_events_ingested_at
+  ON agent_events (ingested_at);
+
+CREATE INDEX IF NOT EXISTS idx_runs_updated_at
+  ON runs (updated_at);
+
+-- histogram_sum adds latency histograms element-wise, so hourly rows roll up
+-- into daily rows and any set of rows merges into one distribution.
+CREATE OR REPLACE FUNCTION histogram_add(acc BIGINT[], next BIGINT[]) RETURNS BIGINT[]
+  LANGUAGE sql IMMUTABLE AS $$
+    SELECT CASE
+      WHEN acc IS NULL THEN next
+      WHEN next IS NULL THEN acc
+      ELSE ARRAY(SELECT COALESCE(a, 0) + COALESCE(b, 0) FROM unnest(acc, next) WITH ORDINALITY AS pairs(a, b, i) ORDER BY i)
+    END
+  $$;
+
+CREATE OR REPLACE AGGREGATE histogram_sum(BIGINT[]) (
+  SFUNC = histogram_add,
+  STYPE = BIGINT[]
+);
@@ -0,0 +1,141 @@
+-- Range-partitions agent_events by occurred_at into one partition per UTC day,
+-- named agent_events_pYYYYMMDD. The partition maintenance loop pre-creates
+-- future days and drops or archives expired ones; agent_events_default
+-- catches events outside every existing partition so ingest never fails on a
+-- missing day.
+--
+-- Unique constraints on a partitioned table must include the partition key,
+-- so event_id alone is claimed in the unpartitioned agent_event_ids instead.
+-- A trigger skips any event whose event_id is already claimed, whatever its
+-- occurred_at, so a retry that changed occurred_at is still a duplicate.
+BEGIN;
+
+CREATE TABLE agent_events_partitioned (
+  id BIGINT NOT NULL,
+  event_id UUID NOT NULL,
+  event_version TEXT NOT NULL,
+  event_type TEXT NOT NULL,
+  occurred_at TIMESTAMPTZ NOT NULL,
+  ingested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  tenant_id TEXT NOT NULL,
+  workspace_id TEXT NOT NULL,
+  project_id TEXT NOT NULL,
+  run_id TEXT NOT NULL,
+  agent_id TEXT NOT NULL,
+  workflow_id TEXT NOT NULL,
+  trace_id TEXT NOT NULL,
+  span_id TEXT NOT NULL,
+  parent_span_id TEXT NULL,
+  run_status TEXT NULL,
+  error_type TEXT NULL,
+  total_tokens BIGINT NULL,
+  cost_usd NUMERIC(18, 6) NULL,
+  payload JSONB NOT NULL,
+  PRIMARY KEY (id, occurred_at),
+  UNIQUE (event_id, occurred_at)
+) PARTITION BY RANGE (occurred_at);
+
+CREATE TABLE agent_events_default PARTITION OF agent_events_partitioned DEFAULT;
+
+-- One partition per day from the oldest stored event through a week ahead,
+-- starting at most 90 days back so a long history does not become thousands
+-- of partitions. Older rows stay in agent_events_default until retention
+-- deletes them.
+DO $$
+DECLARE
+  day DATE;
+BEGIN
+  FOR day IN
+    SELECT generate_series(
+      GREATEST(
+        COALESCE((SELECT MIN(occurred_at) AT TIME ZONE 'UTC' FROM agent_events), NOW() AT TIME ZONE 'UTC')::DATE,
+        (NOW() AT TIME ZONE 'UTC')::DATE - 90
+      ),
+      (NOW() AT TIME ZONE 'UTC')::DATE + 7,
+      INTERVAL '1 day'
+    )::DATE
+  LOOP
+    EXECUTE format(
+      'CREATE TABLE %I PARTITION OF agent_events_partitioned FOR VALUES FROM (%L) TO (%L)',
+      'agent_events_p' || to_char(day, 'YYYYMMDD'),
+      day::TEXT || ' 00:00:00+00',
+      (day + 1)::TEXT || ' 00:00:00+00'
+    );
+  END LOOP;
+END
+$$;
+
+INSERT INTO agent_events_partitioned SELECT * FROM agent_events;
+
+-- Keep the id sequence: failure pagination orders ties by id.
+ALTER SEQUENCE agent_events_id_seq OWNED BY NONE;
+DROP TABLE agent_events;
+ALTER TABLE agent_events_partitioned RENAME TO agent_events;
+ALTER TABLE agent_events ALTER COLUMN id SET DEFAULT nextval('agent_events_id_seq');
+ALTER SEQUENCE agent_events_id_seq OWNED BY agent_events.id;
+
+CREATE INDEX idx_agent_events_tenant_occurred_at
+  ON agent_events (tenant_id, occurred_at DESC);
+
+CREATE INDEX idx_agent_events_workspace_occurred_at
+  ON agent_events (workspace_id, occurred_at DESC);
+
+CREATE INDEX idx_agent_events_project_occurred_at
+  ON agent_events (project_id, occurred_at DESC);
+
+CREATE INDEX idx_agent_events_event_type_occurred_at
+  ON agent_events (event_type, occurred_at DESC);
+
+CREATE INDEX idx_agent_events_run_id
+  ON agent_events (run_id);
+
+CREATE INDEX idx_agent_events_trace_id
+  ON agent_events (trace_id);
+
+CREATE INDEX idx_agent_events_ingested_at
+  ON agent_events (ingested_at);
+
+-- One row per stored event_id. tenant_id and occurred_at let retention
+-- purge ids together with their events.
+CREATE TABLE agent_event_ids (
+  event_id UUID PRIMARY KEY,
+  tenant_id TEXT NOT NULL,
+  occurred_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_agent_event_ids_tenant_occurred_at
+  ON agent_event_ids (tenant_id, occurred_at);
+
+INSERT INTO agent_event_ids (event_id, tenant_id, occurred_at)
+SELECT event_id, tenant_id, occurred_at FROM agent_events;
+
+-- Returning NULL drops the row, so it never reaches RETURNING and the runs
+-- and rollups built from it. Concurrent inserts of one event_id wait on the
+-- primary key and the loser is skipped.
+CREATE FUNCTION claim_agent_event_id() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+BEGIN
+  INSERT INTO agent_event_ids (event_id, tenant_id, occurred_at)
+  VALUES (NEW.event_id, NEW.tenant_id, NEW.occurred_at)
+  ON CONFLICT (event_id) DO NOTHING;
+  IF NOT FOUND THEN
+    RETURN NULL;
+  END IF;
+  RETURN NEW;
+END
+$$;
+
+CREATE TRIGGER agent_events_claim_event_id
+  BEFORE INSERT ON agent_events
+  FOR EACH ROW EXECUTE FUNCTION claim_agent_event_id();
+
+-- Per-tenant event retention; tenants without a row use EVENT_RETENTION_DAYS.
+CREATE TABLE tenant_retention_policies (
+  tenant_id TEXT PRIMARY KEY,
+  retention_days INTEGER NOT NULL CHECK (retention_days > 0),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Expired partitions are detached into this schema when archiving is enabled.
+CREATE SCHEMA IF NOT EXISTS agent_events_archive;
+
+COMMIT;
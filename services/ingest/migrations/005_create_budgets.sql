@@ -0,0 +1,32 @@
+-- Spend budgets managed through /v1/budgets. Scope ids beyond the budget's
+-- scope are '', so a project budget has an empty agent_id.
+CREATE TABLE IF NOT EXISTS budgets (
+  budget_id TEXT PRIMARY KEY DEFAULT gen_random_uuid()::TEXT,
+  name TEXT NOT NULL DEFAULT '',
+  scope TEXT NOT NULL CHECK (scope IN ('tenant', 'workspace', 'project', 'agent')),
+  tenant_id TEXT NOT NULL,
+  workspace_id TEXT NOT NULL DEFAULT '',
+  project_id TEXT NOT NULL DEFAULT '',
+  agent_id TEXT NOT NULL DEFAULT '',
+  period TEXT NOT NULL CHECK (period IN ('hourly', 'daily', 'weekly', 'monthly')),
+  limit_usd NUMERIC(18, 6) NOT NULL CHECK (limit_usd >= 0),
+  enforcement TEXT NOT NULL CHECK (enforcement IN ('soft', 'hard')),
+  -- version starts at 1 and increments on every update; budget_versions keeps each one.
+  version INTEGER NOT NULL DEFAULT 1,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_budgets_tenant_scope
+  ON budgets (tenant_id, workspace_id, project_id, agent_id);
+
+CREATE TABLE IF NOT EXISTS budget_versions (
+  budget_id TEXT NOT NULL REFERENCES budgets (budget_id) ON DELETE CASCADE,
+  version INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  period TEXT NOT NULL,
+  limit_usd NUMERIC(18, 6) NOT NULL,
+  enforcement TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (budget_id, version)
+);
@@ -0,0 +1,15 @@
+-- Threshold crossings claimed by the budget worker, one row per budget,
+-- period and threshold. The row fixes the event_id and occurred_at of the
+-- budget.threshold_hit event so a crossing is emitted once even when the
+-- worker retries or several instances run; emitted_at is set once the event
+-- is stored.
+CREATE TABLE IF NOT EXISTS budget_threshold_hits (
+  budget_id TEXT NOT NULL REFERENCES budgets (budget_id) ON DELETE CASCADE,
+  period_start TIMESTAMPTZ NOT NULL,
+  threshold_pct INTEGER NOT NULL CHECK (threshold_pct > 0),
+  event_id UUID NOT NULL,
+  occurred_at TIMESTAMPTZ NOT NULL,
+  spent_usd NUMERIC(18, 6) NOT NULL,
+  emitted_at TIMESTAMPTZ,
+  PRIMARY KEY (budget_id, period_start, threshold_pct)
+);
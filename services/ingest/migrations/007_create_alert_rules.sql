@@ -0,0 +1,38 @@
+-- Alert rules managed through /v1/alert-rules. Scope ids beyond the rule's
+-- scope are ''; a workflow rule takes tenant_id and workflow_id.
+CREATE TABLE IF NOT EXISTS alert_rules (
+  rule_id TEXT PRIMARY KEY DEFAULT gen_random_uuid()::TEXT,
+  name TEXT NOT NULL DEFAULT '',
+  alert_type TEXT NOT NULL CHECK (alert_type IN (
+    'spend_spike', 'success_rate_drop', 'latency_breach', 'error_rate_spike', 'policy_violation_burst'
+  )),
+  scope TEXT NOT NULL CHECK (scope IN ('tenant', 'workspace', 'project', 'agent', 'workflow')),
+  tenant_id TEXT NOT NULL,
+  workspace_id TEXT NOT NULL DEFAULT '',
+  project_id TEXT NOT NULL DEFAULT '',
+  agent_id TEXT NOT NULL DEFAULT '',
+  workflow_id TEXT NOT NULL DEFAULT '',
+  metric TEXT NOT NULL,
+  comparison TEXT NOT NULL CHECK (comparison IN ('gt', 'gte', 'lt', 'lte')),
+  threshold DOUBLE PRECISION NOT NULL,
+  window_seconds INTEGER NOT NULL CHECK (window_seconds > 0),
+  for_seconds INTEGER NOT NULL DEFAULT 0 CHECK (for_seconds >= 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_rules_tenant
+  ON alert_rules (tenant_id, created_at);
+
+-- alert_states holds each rule's evaluation state: ok, pending (breaching
+-- for less than for_seconds), firing, or resolved. notified is false until
+-- the alert.emitted event for a firing or resolved transition is stored.
+CREATE TABLE IF NOT EXISTS alert_states (
+  rule_id TEXT PRIMARY KEY REFERENCES alert_rules (rule_id) ON DELETE CASCADE,
+  state TEXT NOT NULL CHECK (state IN ('ok', 'pending', 'firing', 'resolved')),
+  alert_id TEXT NOT NULL DEFAULT '',
+  pending_since TIMESTAMPTZ,
+  changed_at TIMESTAMPTZ NOT NULL,
+  last_value DOUBLE PRECISION,
+  evaluated_at TIMESTAMPTZ NOT NULL,
+  notified BOOLEAN NOT NULL DEFAULT TRUE
+);